@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/homeassistant"
+	log "github.com/sirupsen/logrus"
+)
+
+// applyAddonDefaults fills in what running as a Home Assistant add-on
+// implies: the state file in the add-on's data directory, the status page
+// served for ingress, and publishing to the Supervisor's MQTT broker with
+// discovery unless mqtt.broker is set
+func applyAddonDefaults(ctx context.Context, config *config.Configuration) error {
+	if config.StateFile == "" {
+		config.StateFile = homeassistant.StateFile
+	}
+	if config.HomeAssistant.IngressPort == 0 {
+		config.HomeAssistant.IngressPort = homeassistant.DefaultIngressPort
+	}
+	if config.HTTP.Address == "" {
+		config.HTTP.Address = fmt.Sprintf(":%d", config.HomeAssistant.IngressPort)
+	}
+	config.HTTP.StatusPage = true
+
+	if config.MQTT.Broker != "" {
+		return nil
+	}
+	broker, err := homeassistant.MQTTBroker(ctx)
+	if err != nil {
+		// Other outputs can do without it
+		if config.InfluxDB.Address != "" || len(config.Plugins) > 0 {
+			log.WithFields(log.Fields{
+				"op":    "main.applyAddonDefaults",
+				"error": err,
+			}).Warn("not publishing to MQTT")
+			return nil
+		}
+		return err
+	}
+	config.MQTT.Broker = broker.URL()
+	config.MQTT.Username = broker.Username
+	config.MQTT.Password = broker.Password
+	config.MQTT.Discovery = true
+	return nil
+}
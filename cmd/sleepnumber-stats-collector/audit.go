@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"os/user"
+)
+
+// openAudit opens the audit log of control actions, with the sinks it writes
+// points to when audit.measurement is set; close flushes and closes both
+func openAudit(config *config.Configuration) (actions *audit.Log, close func(), err error) {
+	var sink collector.Sink
+	closeSinks := func() {}
+	if config.Audit.Measurement {
+		sinks, err := newSinks(config, "", nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		sink = sinks
+		closeSinks = sinks.Close
+	}
+	actions, err = audit.Open(config.Audit.File, sink)
+	if err != nil {
+		closeSinks()
+		return nil, nil, err
+	}
+	return actions, func() {
+		actions.Close()
+		closeSinks()
+	}, nil
+}
+
+// cliOrigin is the origin of control actions taken from the command line,
+// naming the user running it
+func cliOrigin() audit.Origin {
+	origin := audit.Origin{Source: audit.SourceCLI}
+	current, err := user.Current()
+	if err == nil {
+		origin.Client = current.Username
+	}
+	return origin
+}
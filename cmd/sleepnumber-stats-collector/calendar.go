@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/export"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultCalendarDays is how many days of sessions the calendar feed
+	// covers unless ?days= asks for another number, up to maxCalendarDays
+	defaultCalendarDays = 30
+	maxCalendarDays     = 366
+	calendarTimeout     = time.Minute
+)
+
+// calendarHandler serves the sleep sessions stored in InfluxDB as an
+// iCalendar feed, optionally narrowed to one sleeper with ?bed= and ?side=;
+// the func returned releases its InfluxDB client
+func calendarHandler(config *config.Configuration) (http.Handler, func(), error) {
+	influxConfig := config.InfluxDB
+	client, _, err := sink.InfluxConnect(&influxConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	queryAPI := client.QueryAPI(influxConfig.Organization)
+	names := schema.FromConfig(config)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		days := defaultCalendarDays
+		if v := query.Get("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxCalendarDays {
+				http.Error(w, "days must be a number from 1 to "+strconv.Itoa(maxCalendarDays), http.StatusBadRequest)
+				return
+			}
+			days = n
+		}
+		bed, side := query.Get("bed"), query.Get("side")
+		if side != "" && side != sleep.Left && side != sleep.Right {
+			http.Error(w, "side must be left or right", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), calendarTimeout)
+		defer cancel()
+		now := time.Now()
+		samples, err := sleep.Query(ctx, queryAPI, names, now.AddDate(0, 0, -days), now)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.calendarHandler",
+				"error": err,
+			}).Warn("failed to read sleep sessions for the calendar")
+			http.Error(w, "failed to read sleep sessions", http.StatusBadGateway)
+			return
+		}
+		var sessions []sleep.Session
+		for _, s := range sleep.Sessions(samples, sleep.DefaultMinDuration, sleep.DefaultMergeGap) {
+			if (bed == "" || s.Bed == bed) && (side == "" || s.Side == side) {
+				sessions = append(sessions, s)
+			}
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		export.ICS(w, sessions)
+	})
+	return handler, client.Close, nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/secrets"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"time"
+)
+
+// newCollector builds the collector for one SleepIQ account from the shared
+// configuration
+func newCollector(config *config.Configuration, account config.Account, sink collector.Sink, state collector.StateStore) (*collector.Collector, error) {
+	opts, err := collectorOptions(config, account, state)
+	if err != nil {
+		return nil, err
+	}
+	return collector.New(opts, sink), nil
+}
+
+// collectorOptions translates the configuration of one account into
+// collector options
+func collectorOptions(config *config.Configuration, account config.Account, state collector.StateStore) (collector.Options, error) {
+	var schedule collector.Schedule
+	if len(config.Schedule) > 0 {
+		var err error
+		schedule, err = collector.ParseCron(config.Schedule...)
+		if err != nil {
+			return collector.Options{}, err
+		}
+	}
+
+	api, err := sleepIQOptions(config)
+	if err != nil {
+		return collector.Options{}, err
+	}
+
+	bedCollectors, err := selectCollectors(config.Collectors)
+	if err != nil {
+		return collector.Options{}, err
+	}
+
+	observer, err := pollObserver(config)
+	if err != nil {
+		return collector.Options{}, err
+	}
+
+	return collector.Options{
+		Username:           account.Username,
+		Password:           account.Password,
+		Account:            account.Name,
+		Tags:               config.Tags,
+		RenameMeasurements: config.Rename.Measurements,
+		RenameTags:         config.Rename.Tags,
+		RenameFields:       config.Rename.Fields,
+		PollInterval:       account.PollInterval,
+		SessionLifetime:    account.SessionLifetime,
+		Schedule:           schedule,
+		AdaptiveMin:        config.Adaptive.MinInterval,
+		AdaptiveMax:        config.Adaptive.MaxInterval,
+		Intervals: map[collector.Endpoint]time.Duration{
+			collector.EndpointFamilyStatus: account.PollIntervals.FamilyStatus,
+			collector.EndpointFoundation:   account.PollIntervals.Foundation,
+			collector.EndpointFootWarmer:   account.PollIntervals.FootWarmer,
+			collector.EndpointPump:         account.PollIntervals.Pump,
+			collector.EndpointClimate:      account.PollIntervals.Climate,
+			collector.EndpointSessions:     account.PollIntervals.Sessions,
+			collector.EndpointFirmware:     account.PollIntervals.Firmware,
+		},
+		API:                   api,
+		DeltaMode:             config.Delta.Enabled,
+		DeltaHeartbeat:        config.Delta.Heartbeat,
+		DedupMeasurements:     config.Dedup,
+		AggregateWindow:       config.Aggregate.Window,
+		AggregateMeasurements: config.Aggregate.Measurements,
+		AggregateFunctions:    config.Aggregate.Functions,
+		AggregateEvents:       config.Aggregate.Events,
+		DropMeasurements:      config.Drop.Measurements,
+		DropFields:            config.Drop.Fields,
+		DropTags:              config.Cardinality.DropTags,
+		TagsAsFields:          config.Cardinality.TagsAsFields,
+		BedConcurrency:        config.BedConcurrency,
+		BedsRefresh:           config.BedsRefresh,
+		Collectors:            bedCollectors,
+		Beds: collector.BedFilter{
+			Include: config.Beds.Include,
+			Exclude: config.Beds.Exclude,
+		},
+		StateStore:     state,
+		PersistSession: config.PersistSession,
+		Observer:       observer,
+		RecordRequests: config.RecordAPIRequests,
+	}, nil
+}
+
+// controlAccounts returns the accounts beds are controlled through, sharing
+// the clients of collectors, which poll accounts in the same order
+func controlAccounts(accounts []config.Account, collectors []*collector.Collector) []control.Account {
+	controlled := make([]control.Account, len(collectors))
+	for i, c := range collectors {
+		controlled[i] = control.Account{
+			Name:     accounts[i].Name,
+			Username: accounts[i].Username,
+			Password: accounts[i].Password,
+			Client:   c.Client(),
+		}
+	}
+	return controlled
+}
+
+// selectCollectors applies the collectors config section, which enables or
+// disables built-in collectors by name, on top of the default set
+func selectCollectors(enabled map[string]bool) ([]collector.BedCollector, error) {
+	selected := make(map[string]bool)
+	for _, bc := range collector.DefaultCollectors() {
+		selected[bc.Name()] = true
+	}
+
+	builtin := collector.BuiltinCollectors()
+	for name, on := range enabled {
+		known := false
+		for _, bc := range builtin {
+			if bc.Name() == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown collector %s", name)
+		}
+		selected[name] = on
+	}
+
+	bedCollectors := []collector.BedCollector{}
+	for _, bc := range builtin {
+		if selected[bc.Name()] {
+			bedCollectors = append(bedCollectors, bc)
+		}
+	}
+	return bedCollectors, nil
+}
+
+// bootstrapLogins logs into every account, prompting on the terminal for any
+// two-factor code, and stores each session in the state file. With save, it
+// first prompts for each password and saves it in the OS keyring once it has
+// been used to log in; the state file is then optional.
+func bootstrapLogins(ctx context.Context, config *config.Configuration, save bool) error {
+	persist := config.StateFile != "" && config.PersistSession
+	if !persist && !save {
+		return errors.New("-login needs stateFile set and persistSession enabled, or -save")
+	}
+	var state collector.StateStore
+	if persist {
+		state = collector.NewFileStateStore(config.StateFile)
+	}
+	stdin := bufio.NewReader(os.Stdin)
+
+	for _, account := range config.SleepIQAccounts() {
+		if save {
+			password, err := readPassword(stdin, account.Username)
+			if err != nil {
+				return err
+			}
+			account.Password = password
+		}
+
+		c, err := newCollector(config, account, nil, state)
+		if err != nil {
+			return err
+		}
+		if persist {
+			err = c.Bootstrap(ctx, func(challenge *sleepiq.MFAChallenge) (string, error) {
+				fmt.Fprintf(os.Stderr, "Enter the two-factor code sent for %s: ", account.Username)
+				code, err := stdin.ReadString('\n')
+				if err != nil {
+					return "", fmt.Errorf("failed to read two-factor code, %s", err)
+				}
+				return strings.TrimSpace(code), nil
+			})
+		} else {
+			err = c.Login(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to log into SleepIQ account %s, %s", account.Username, err)
+		}
+
+		if save {
+			err = secrets.SavePassword(account.Username, account.Password)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Saved password for %s in the keyring\n", account.Username)
+		}
+		if persist {
+			fmt.Fprintf(os.Stderr, "Stored login for %s\n", account.Username)
+		}
+	}
+	return nil
+}
+
+// readPassword prompts for the password of username, without echoing it
+// when reading from a terminal
+func readPassword(stdin *bufio.Reader, username string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Enter the SleepIQ password for %s: ", username)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password, %s", err)
+		}
+		return string(password), nil
+	}
+	password, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read password, %s", err)
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+// sleepIQOptions returns the SleepIQ API client settings shared by every
+// account
+func sleepIQOptions(config *config.Configuration) (sleepiq.Options, error) {
+	tlsConfig, err := sleepIQTLSConfig(&config.SleepIQClient)
+	if err != nil {
+		return sleepiq.Options{}, err
+	}
+	proxy, err := config.SleepIQClient.Proxy.Func()
+	if err != nil {
+		return sleepiq.Options{}, err
+	}
+
+	return sleepiq.Options{
+		BaseURL:          config.SleepIQClient.BaseURL,
+		BreakerThreshold: config.CircuitBreaker.Threshold,
+		BreakerCooldown:  config.CircuitBreaker.Cooldown,
+		RateLimit:        config.RateLimit.RequestsPerSecond,
+		RateBurst:        config.RateLimit.Burst,
+		RequestTimeout:   config.SleepIQClient.RequestTimeout,
+		ConnectTimeout:   config.SleepIQClient.ConnectTimeout,
+		MaxIdleConns:     config.SleepIQClient.Transport.MaxIdleConns,
+		IdleConnTimeout:  config.SleepIQClient.Transport.IdleConnTimeout,
+		KeepAlive:        config.SleepIQClient.Transport.KeepAlive,
+		TLSConfig:        tlsConfig,
+		TokenAuth:        config.SleepIQClient.TokenAuth,
+		Proxy:            proxy,
+		Record:           config.SleepIQClient.Record,
+		Replay:           config.SleepIQClient.Replay,
+		Observe: func(endpoint string, elapsed time.Duration, err error) {
+			metrics.ObserveAPI(endpoint, elapsed, err)
+			logAPIRequest(endpoint, elapsed, err)
+		},
+	}, nil
+}
+
+// sleepIQTLSConfig returns the TLS settings for SleepIQ API calls, or nil to
+// use the defaults
+func sleepIQTLSConfig(client *config.SleepIQClient) (*tls.Config, error) {
+	if !client.SkipVerifySsl && client.CAFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: client.SkipVerifySsl,
+	}
+	if client.CAFile != "" {
+		pem, err := os.ReadFile(client.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SleepIQ CA file %s, %s", client.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in SleepIQ CA file %s", client.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
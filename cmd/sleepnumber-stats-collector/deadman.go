@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/deadman"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// newDeadman returns the pinger for the configured dead man's switch, or nil
+// if there is none
+func newDeadman(config *config.Configuration) (*deadman.Pinger, error) {
+	if config.Deadman.URL == "" {
+		return nil, nil
+	}
+	proxy, err := config.Deadman.Proxy.Func()
+	if err != nil {
+		return nil, err
+	}
+	return deadman.New(config.Deadman.URL, config.Deadman.Timeout, proxy), nil
+}
+
+// pollObserver returns the collector.Observer counting poll cycles and
+// logins, which also pings the dead man's switch after each successful poll
+// cycle when one is configured
+func pollObserver(config *config.Configuration) (collector.Observer, error) {
+	pinger, err := newDeadman(config)
+	if err != nil || pinger == nil {
+		return metrics.Observer{}, err
+	}
+	return deadmanObserver{pinger: pinger}, nil
+}
+
+// deadmanObserver is a metrics.Observer that pings the dead man's switch
+// after each successful poll cycle
+type deadmanObserver struct {
+	metrics.Observer
+	pinger *deadman.Pinger
+}
+
+func (o deadmanObserver) PollCycle(account string, elapsed time.Duration, err error) {
+	o.Observer.PollCycle(account, elapsed, err)
+	if err == nil {
+		o.pinger.PingAsync()
+	}
+}
+
+// pingDeadman pings the dead man's switch, if one is configured, and waits
+// for the result; -once uses it since the process exits right after
+func pingDeadman(ctx context.Context, config *config.Configuration) {
+	pinger, err := newDeadman(config)
+	if err == nil && pinger != nil {
+		err = pinger.Ping(ctx)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main.pingDeadman",
+			"error": err,
+		}).Warn("failed to ping dead man's switch")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/downsample"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"os"
+	"strings"
+)
+
+// influxDownsample implements the influx-downsample subcommand, which creates
+// the InfluxDB v2 tasks, or v1 retention policies and continuous queries,
+// rolling the collector's measurements up into hourly and daily means, or
+// with -print prints them instead
+func influxDownsample(args []string) error {
+	rollups := downsample.DefaultRollups()
+	flags := flag.NewFlagSet("influx-downsample", flag.ExitOnError)
+	configLocation := flags.String("config", "config.yaml", "path to the configuration file with the InfluxDB settings")
+	printOnly := flags.Bool("print", false, "print the tasks or InfluxQL statements instead of creating them")
+	hourlyRetention := flags.Duration("hourly-retention", rollups[0].Retention, "how long to keep hourly means; 0 keeps them forever")
+	dailyRetention := flags.Duration("daily-retention", rollups[1].Retention, "how long to keep daily means; 0 keeps them forever")
+	flags.Parse(args)
+	rollups[0].Retention = *hourlyRetention
+	rollups[1].Retention = *dailyRetention
+
+	path := *configLocation
+	if _, err := os.Stat(path); os.IsNotExist(err) && !flagSet(flags, "config") {
+		path = ""
+	}
+	config, _, err := loadConfiguration(path, nil)
+	if err != nil {
+		return err
+	}
+	influx := config.InfluxDB
+	if influx.Address == "" && !*printOnly {
+		return errors.New("influxDB.address is not set, so there is nowhere to create the downsampling")
+	}
+	names := schema.FromConfig(config)
+
+	if usesInfluxQL(influx) {
+		statements := downsample.Statements(names, rollups)
+		if *printOnly {
+			fmt.Println(strings.Join(statements, ";\n") + ";")
+			return nil
+		}
+		return downsample.Execute(context.Background(), influx.Address, influx.Username, influx.Password, influx.SkipVerifySsl, statements)
+	}
+
+	tasks := downsample.Tasks(names, rollups)
+	if *printOnly {
+		for i, task := range tasks {
+			if i > 0 {
+				fmt.Println()
+			}
+			retention := "forever"
+			if task.Retention > 0 {
+				retention = task.Retention.String()
+			}
+			fmt.Printf("// Task %q, writing to bucket %q, kept %s\n%s", task.Name, task.Bucket, retention, task.Flux)
+		}
+		return nil
+	}
+	client, _, err := sink.InfluxConnect(&influx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return downsample.CreateTasks(context.Background(), client, influx.Organization, tasks)
+}
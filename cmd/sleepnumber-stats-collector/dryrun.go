@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+)
+
+// feature is a part of a run that reaches beyond printing points
+type feature string
+
+const (
+	featureDeadman        feature = "deadman"
+	featureStateFile      feature = "stateFile"
+	featureLeaderElection feature = "leaderElection"
+	featureVoice          feature = "voice"
+	featureStopMotion     feature = "stopMotion"
+	featurePassiveChecks  feature = "passiveChecks"
+	featureGoogleFit      feature = "googleFit"
+	featureReport         feature = "report"
+	featureTelegram       feature = "telegram"
+	featureGRPCControl    feature = "grpcControl"
+	featureHomeKitLights  feature = "homeKitLights"
+)
+
+// dryRunSkips are the features a dry run leaves to the real deployment: it
+// doesn't control the beds, report to or ping other systems, save state for
+// the next run, or take leadership from the running instance
+var dryRunSkips = []feature{
+	featureDeadman,
+	featureStateFile,
+	featureLeaderElection,
+	featureVoice,
+	featureStopMotion,
+	featurePassiveChecks,
+	featureGoogleFit,
+	featureReport,
+	featureTelegram,
+	featureGRPCControl,
+	featureHomeKitLights,
+}
+
+// runs reports whether f runs, which every feature does but those a dry run
+// skips
+func runs(f feature, dryRun bool) bool {
+	return !dryRun || !slices.Contains(dryRunSkips, f)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/export"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// exportTimeout bounds querying the data to export
+const exportTimeout = 5 * time.Minute
+
+// exportSessions implements the export subcommand, which reads the bed
+// occupancy stored in InfluxDB, groups it into sleep sessions, and writes
+// them in one of the export formats
+func exportSessions(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	configLocation := flags.String("config", "config.yaml", "path to the configuration file with the InfluxDB settings")
+	format := flags.String("format", "", "export format: "+strings.Join(export.FormatNames(), ", "))
+	output := flags.String("output", "", "file to write to; defaults to stdout")
+	since := flags.Duration("since", 7*24*time.Hour, "export sessions from this long ago, unless -start is set")
+	start := flags.String("start", "", "export sessions from this date or RFC 3339 time")
+	end := flags.String("end", "", "export sessions until this date or RFC 3339 time; defaults to now")
+	bed := flags.String("bed", "", "export only the sessions of the bed with this name")
+	side := flags.String("side", "", "export only the sessions of this side of the bed, left or right")
+	minDuration := flags.Duration("min-duration", sleep.DefaultMinDuration, "leave out sessions shorter than this")
+	mergeGap := flags.Duration("merge-gap", sleep.DefaultMergeGap, "join sessions on the same side less than this apart, such as across a trip to the bathroom")
+	flags.Parse(args)
+
+	write, ok := export.Formats[*format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q, must be one of %s", *format, strings.Join(export.FormatNames(), ", "))
+	}
+	if *side != "" && *side != sleep.Left && *side != sleep.Right {
+		return fmt.Errorf("unknown side %q, must be left or right", *side)
+	}
+	to := time.Now()
+	if *end != "" {
+		var err error
+		to, err = parseExportTime(*end)
+		if err != nil {
+			return err
+		}
+	}
+	from := to.Add(-*since)
+	if *start != "" {
+		var err error
+		from, err = parseExportTime(*start)
+		if err != nil {
+			return err
+		}
+	}
+	if !from.Before(to) {
+		return errors.New("the start of the export must come before its end")
+	}
+
+	path := *configLocation
+	if _, err := os.Stat(path); os.IsNotExist(err) && !flagSet(flags, "config") {
+		path = ""
+	}
+	config, _, err := loadConfiguration(path, nil)
+	if err != nil {
+		return err
+	}
+	if config.InfluxDB.Address == "" {
+		return errors.New("influxDB.address is not set, so there is no stored data to export")
+	}
+	client, _, err := sink.InfluxConnect(&config.InfluxDB)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	samples, err := sleep.Query(ctx, client.QueryAPI(config.InfluxDB.Organization), schema.FromConfig(config), from, to)
+	if err != nil {
+		return err
+	}
+	var sessions []sleep.Session
+	for _, s := range sleep.Sessions(samples, *minDuration, *mergeGap) {
+		if (*bed == "" || s.Bed == *bed) && (*side == "" || s.Side == *side) {
+			sessions = append(sessions, s)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s, %s", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return write(w, sessions)
+}
+
+// parseExportTime parses a date, taken as local midnight, or an RFC 3339 time
+func parseExportTime(value string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %q as a date such as 2024-01-31 or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// flagSet reports whether the named flag was given
+func flagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
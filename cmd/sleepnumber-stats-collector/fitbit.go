@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/fitbit"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	// defaultFitbitSchedule imports every six hours, so a night shows up
+	// soon after the tracker syncs it
+	defaultFitbitSchedule = "0 */6 * * *"
+	defaultFitbitLookback = 48 * time.Hour
+)
+
+// importFitbit writes the sleep logs of every configured Fitbit user to
+// points at startup and then on schedule until ctx is cancelled; logs
+// imported before are written again with the same time and tags, so they
+// overwrite themselves
+func importFitbit(ctx context.Context, fit config.Fitbit, points *bus.Bus) {
+	if fit.Schedule == "" {
+		fit.Schedule = defaultFitbitSchedule
+	}
+	if fit.Lookback == 0 {
+		fit.Lookback = defaultFitbitLookback
+	}
+	fail := func(err error) {
+		log.WithFields(log.Fields{
+			"op":    "main.importFitbit",
+			"error": err,
+		}).Error("not importing sleep logs from Fitbit")
+	}
+	schedule, err := collector.ParseCron(fit.Schedule)
+	if err != nil {
+		fail(err)
+		return
+	}
+	clients := make([]*fitbit.Client, len(fit.Users))
+	locations := make([]*time.Location, len(fit.Users))
+	for i, user := range fit.Users {
+		clients[i], err = fitbit.New(fit.ClientID, fit.ClientSecret, user.TokenFile)
+		if err != nil {
+			fail(err)
+			return
+		}
+		locations[i] = time.Local
+		if user.Timezone != "" {
+			locations[i], err = time.LoadLocation(user.Timezone)
+			if err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+
+	for {
+		now := time.Now()
+		for i, user := range fit.Users {
+			to := now.In(locations[i])
+			logs, err := clients[i].Sleep(ctx, to.Add(-fit.Lookback), to)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main.importFitbit",
+					"bed":   user.Bed,
+					"side":  user.Side,
+					"error": err,
+				}).Warn("failed to read sleep logs from Fitbit")
+				continue
+			}
+			tags := map[string]string{"name": user.Bed, "side": user.Side}
+			imported := 0
+			for _, s := range logs {
+				point, err := s.Point(tags, locations[i])
+				if err != nil {
+					log.WithFields(log.Fields{
+						"op":    "main.importFitbit",
+						"bed":   user.Bed,
+						"side":  user.Side,
+						"error": err,
+					}).Warn("skipping Fitbit sleep log")
+					continue
+				}
+				points.Write(ctx, point)
+				imported++
+			}
+			log.WithFields(log.Fields{
+				"op":   "main.importFitbit",
+				"bed":  user.Bed,
+				"side": user.Side,
+				"logs": imported,
+			}).Info("imported sleep logs from Fitbit")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(schedule.Next(time.Now()))):
+		}
+	}
+}
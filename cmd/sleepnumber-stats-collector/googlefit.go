@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/googlefit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	// defaultGoogleFitSchedule uploads once a day, after most nights end
+	defaultGoogleFitSchedule = "0 10 * * *"
+	defaultGoogleFitLookback = 36 * time.Hour
+	googleFitQueryTimeout    = time.Minute
+)
+
+// syncGoogleFit uploads the finished sleep sessions of every configured
+// sleeper to Google Fit on schedule until ctx is cancelled; sessions already
+// uploaded are updated in place, so runs may overlap
+func syncGoogleFit(ctx context.Context, config *config.Configuration) {
+	fit := config.GoogleFit
+	if fit.Schedule == "" {
+		fit.Schedule = defaultGoogleFitSchedule
+	}
+	if fit.Lookback == 0 {
+		fit.Lookback = defaultGoogleFitLookback
+	}
+	fail := func(err error) {
+		log.WithFields(log.Fields{
+			"op":    "main.syncGoogleFit",
+			"error": err,
+		}).Error("not uploading sleep sessions to Google Fit")
+	}
+	schedule, err := collector.ParseCron(fit.Schedule)
+	if err != nil {
+		fail(err)
+		return
+	}
+	clients := make([]*googlefit.Client, len(fit.Sleepers))
+	for i, sleeper := range fit.Sleepers {
+		clients[i], err = googlefit.New(fit.ClientID, fit.ClientSecret, sleeper.TokenFile)
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	influxConfig := config.InfluxDB
+	client, _, err := sink.InfluxConnect(&influxConfig)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer client.Close()
+	queryAPI := client.QueryAPI(influxConfig.Organization)
+	names := schema.FromConfig(config)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(schedule.Next(time.Now()))):
+		}
+
+		now := time.Now()
+		queryCtx, cancel := context.WithTimeout(ctx, googleFitQueryTimeout)
+		samples, err := sleep.Query(queryCtx, queryAPI, names, now.Add(-fit.Lookback), now)
+		cancel()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.syncGoogleFit",
+				"error": err,
+			}).Warn("failed to read sleep sessions for Google Fit")
+			continue
+		}
+		sessions := sleep.Sessions(samples, sleep.DefaultMinDuration, sleep.DefaultMergeGap)
+		for i, sleeper := range fit.Sleepers {
+			uploaded := 0
+			for _, s := range sessions {
+				// A session ending this recently may still go on
+				if s.Bed != sleeper.Bed || s.Side != sleeper.Side || now.Sub(s.End) < sleep.DefaultMergeGap {
+					continue
+				}
+				err = clients[i].Upload(ctx, s)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"op":    "main.syncGoogleFit",
+						"bed":   sleeper.Bed,
+						"side":  sleeper.Side,
+						"start": s.Start,
+						"error": err,
+					}).Warn("failed to upload sleep session to Google Fit")
+					continue
+				}
+				uploaded++
+			}
+			log.WithFields(log.Fields{
+				"op":       "main.syncGoogleFit",
+				"bed":      sleeper.Bed,
+				"side":     sleeper.Side,
+				"sessions": uploaded,
+			}).Info("uploaded sleep sessions to Google Fit")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/grafana"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	log "github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+)
+
+// grafanaDashboard implements the grafana-dashboard subcommand, which prints
+// a dashboard querying the measurements, tags, and fields the collector
+// writes under the config's names, or with -push creates it in Grafana
+func grafanaDashboard(args []string) error {
+	flags := flag.NewFlagSet("grafana-dashboard", flag.ExitOnError)
+	configLocation := flags.String("config", "config.yaml", "path to the configuration file whose names the dashboard uses; the defaults are used if it doesn't exist")
+	query := flags.String("query", "", "query language: flux for InfluxDB v2 or influxql for v1; defaults to what influxDB in the config is set up for")
+	push := flags.String("push", "", "URL of a Grafana to create or update the dashboard in, instead of printing it")
+	token := flags.String("token", "", "service account token for -push; defaults to GRAFANA_TOKEN")
+	flags.Parse(args)
+
+	configuration := &config.Configuration{}
+	_, err := os.Stat(*configLocation)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		configuration, err = config.LoadConfiguration(*configLocation, nil)
+		if err != nil {
+			return err
+		}
+	}
+	opts, err := dashboardOptions(configuration, *query)
+	if err != nil {
+		return err
+	}
+	dashboard := grafana.Dashboard(opts)
+
+	if *push != "" {
+		if *token == "" {
+			*token = os.Getenv("GRAFANA_TOKEN")
+		}
+		err = grafana.Push(context.Background(), *push, *token, dashboard)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"op":  "main.grafanaDashboard",
+			"url": *push,
+		}).Info("pushed dashboard to Grafana")
+		return nil
+	}
+	out, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode dashboard, %s", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// dashboardOptions returns the names the collector writes under with
+// configuration, querying them in language
+func dashboardOptions(configuration *config.Configuration, language string) (grafana.Options, error) {
+	if language == "" {
+		language = grafana.Flux
+		if usesInfluxQL(configuration.InfluxDB) {
+			language = grafana.InfluxQL
+		}
+	}
+	if language != grafana.Flux && language != grafana.InfluxQL {
+		return grafana.Options{}, fmt.Errorf("unknown query language %s, must be flux or influxql", language)
+	}
+	return grafana.Options{
+		Language: language,
+		Names:    schema.FromConfig(configuration),
+	}, nil
+}
+
+// usesInfluxQL reports whether influx is set up for InfluxDB v1, with a
+// database but no token
+func usesInfluxQL(influx config.InfluxDB) bool {
+	return influx.Token == "" && influx.TokenFile == "" && influx.Database != ""
+}
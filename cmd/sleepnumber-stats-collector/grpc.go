@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/grpcapi"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"time"
+)
+
+// grpcControlTimeout bounds a control call, covering finding the bed and
+// the change itself
+const grpcControlTimeout = 30 * time.Second
+
+// grpcController controls the beds through SleepIQ for the gRPC API
+type grpcController struct {
+	accounts []control.Account
+	actions  *audit.Log
+}
+
+func (c *grpcController) SetSleepNumber(ctx context.Context, bed, side string, number int, client string) error {
+	ctx, cancel := context.WithTimeout(ctx, grpcControlTimeout)
+	defer cancel()
+	return control.SetSleepNumber(ctx, c.accounts, bed, side, number, c.actions, audit.Origin{Source: audit.SourceGRPC, Client: client})
+}
+
+func (c *grpcController) SetPreset(ctx context.Context, bed, side, preset string, client string) error {
+	ctx, cancel := context.WithTimeout(ctx, grpcControlTimeout)
+	defer cancel()
+	return control.SetPreset(ctx, c.accounts, bed, side, preset, c.actions, audit.Origin{Source: audit.SourceGRPC, Client: client})
+}
+
+func (c *grpcController) StopMotion(ctx context.Context, bed string, client string) error {
+	// A caller giving up must not leave a bed half stopped
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stopMotionTimeout)
+	defer cancel()
+	return control.StopMotion(ctx, c.accounts, bed, c.actions, audit.Origin{Source: audit.SourceGRPC, Client: client})
+}
+
+// serveGRPC serves the gRPC API until ctx is cancelled, with the state of
+// the beds built from points; control is only offered through accounts with
+// grpc.token and allowControl set
+func serveGRPC(ctx context.Context, config *config.Configuration, points *bus.Bus, accounts []control.Account, allowControl bool) error {
+	var creds credentials.TransportCredentials
+	if config.GRPC.CertFile != "" {
+		var err error
+		creds, err = credentials.NewServerTLSFromFile(config.GRPC.CertFile, config.GRPC.KeyFile)
+		if err != nil {
+			return err
+		}
+	}
+	var controller grpcapi.Controller
+	if config.GRPC.Token != "" && allowControl {
+		actions, closeAudit, err := openAudit(config)
+		if err != nil {
+			return err
+		}
+		defer closeAudit()
+		controller = &grpcController{accounts: accounts, actions: actions}
+	}
+	listener, err := net.Listen("tcp", config.GRPC.Address)
+	if err != nil {
+		return err
+	}
+	sub, err := points.Subscribe("grpc", 0, "")
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	server := grpcapi.NewServer(schema.FromConfig(config), controller, config.GRPC.Token)
+	go func() {
+		for p := range sub.Points() {
+			server.Update(p)
+		}
+	}()
+	return grpcapi.Serve(ctx, listener, server, creds)
+}
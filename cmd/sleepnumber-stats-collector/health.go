@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/health"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	log "github.com/sirupsen/logrus"
+	"sync/atomic"
+	"time"
+)
+
+// readiness checks that every collector is logged in and polling on time,
+// unless this instance is standing by for another to lose leadership, and
+// that every sink is reachable
+func readiness(accounts []config.Account, collectors []*collector.Collector, polling *atomic.Bool, r *reloader) health.Check {
+	return func(ctx context.Context) []health.Problem {
+		var problems []health.Problem
+		if polling.Load() {
+			now := time.Now()
+			for i, c := range collectors {
+				h := c.Health()
+				err := h.Ready(now)
+				if err == nil {
+					continue
+				}
+				msg := err.Error()
+				if h.LastError != nil {
+					msg = fmt.Sprintf("%s, last error: %s", msg, h.LastError)
+				}
+				problems = append(problems, health.Problem{
+					Component: "account",
+					Name:      accountName(accounts[i]),
+					Cause:     collectorCause(h),
+					Error:     msg,
+				})
+			}
+		}
+		for _, s := range r.outputs().sinks {
+			err := s.Check(ctx)
+			if err != nil {
+				problems = append(problems, health.Problem{
+					Component: "sink",
+					Name:      s.Name(),
+					Cause:     health.SinkUnreachable,
+					Error:     err.Error(),
+				})
+			}
+		}
+		return problems
+	}
+}
+
+// collectorCause tells why a collector that isn't ready is failing from its
+// last error: SleepIQ rejecting the login, SleepIQ failing otherwise, or with
+// no error at all, polling falling behind
+func collectorCause(h collector.Health) health.Cause {
+	class := sleepiq.Classify(h.LastError)
+	switch {
+	case class == sleepiq.ClassAuth:
+		return health.AuthFailing
+	case !h.LoggedIn && class != sleepiq.ClassRetryable:
+		return health.AuthFailing
+	case h.LastError != nil:
+		return health.APIUnreachable
+	}
+	return health.StaleData
+}
+
+// accountName names an account for people, calling the top-level one default
+func accountName(account config.Account) string {
+	if account.Name == "" {
+		return "default"
+	}
+	return account.Name
+}
+
+// writeStats publishes the collector_stats measurement every interval until
+// ctx is cancelled
+func writeStats(ctx context.Context, points *bus.Bus, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			fields, err := metrics.Stats()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main.writeStats",
+					"error": err,
+				}).Error("failed to gather collector stats")
+				continue
+			}
+			points.Write(ctx, collector.Point{
+				Measurement: "collector_stats",
+				Tags:        map[string]string{},
+				Fields:      fields,
+				Time:        now,
+			})
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// healthcheckAddress is the default address of the health check server,
+// when neither -address nor HTTP_ADDRESS is set
+const healthcheckAddress = ":8080"
+
+// healthcheck implements the healthcheck subcommand, which asks the health
+// check server of a running collector whether it is ready, or with -live just
+// up, so Docker's HEALTHCHECK needs no curl in the image; it fails unless the
+// answer is 200
+func healthcheck(args []string) error {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	address := flags.String("address", "", "http.address of the collector to check, such as :8080; defaults to HTTP_ADDRESS or :8080")
+	live := flags.Bool("live", false, "check /healthz, whether the process is up, instead of /readyz")
+	timeout := flags.Duration("timeout", 5*time.Second, "time to wait for an answer")
+	flags.Parse(args)
+
+	if *address == "" {
+		*address = os.Getenv("HTTP_ADDRESS")
+	}
+	if *address == "" {
+		*address = healthcheckAddress
+	}
+	host, port, err := net.SplitHostPort(*address)
+	if err != nil {
+		return fmt.Errorf("failed to parse address %s, %s", *address, err)
+	}
+	// A server listening on every interface is reachable on loopback
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	path := "/readyz"
+	if *live {
+		path = "/healthz"
+	}
+	url := "http://" + net.JoinHostPort(host, port) + path
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request to %s, %s", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s, %s", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d: %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/homekit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"net"
+	"time"
+)
+
+// homeKitControlTimeout bounds switching a light, within how long HomeKit
+// controllers wait for an answer
+const homeKitControlTimeout = 8 * time.Second
+
+// homeKitController switches the underbed lights through SleepIQ for the
+// HomeKit bridge
+type homeKitController struct {
+	accounts []control.Account
+	actions  *audit.Log
+}
+
+func (c *homeKitController) SetLight(ctx context.Context, bed, side string, on bool, client string) error {
+	ctx, cancel := context.WithTimeout(ctx, homeKitControlTimeout)
+	defer cancel()
+	return control.SetLight(ctx, c.accounts, bed, side, on, c.actions, audit.Origin{Source: audit.SourceHomeKit, Client: client})
+}
+
+// serveHomeKit serves the HomeKit bridge until ctx is cancelled, with the
+// occupancy sensors and lights kept up to date from points; the lights are
+// only served, switched through accounts, with homeKit.light and
+// allowControl set
+func serveHomeKit(ctx context.Context, config *config.Configuration, points *bus.Bus, accounts []control.Account, allowControl bool) error {
+	var controller homekit.Controller
+	if config.HomeKit.Light && allowControl {
+		actions, closeAudit, err := openAudit(config)
+		if err != nil {
+			return err
+		}
+		defer closeAudit()
+		controller = &homeKitController{accounts: accounts, actions: actions}
+	}
+	bridge, err := homekit.NewBridge(&config.HomeKit, schema.FromConfig(config), controller)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp4", config.HomeKit.Address)
+	if err != nil {
+		return err
+	}
+	sub, err := points.Subscribe("homekit", 0, "")
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	go func() {
+		for p := range sub.Points() {
+			bridge.Update(p)
+		}
+	}()
+	return homekit.Serve(ctx, listener, bridge)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// starterConfig is the config written by the init subcommand: the settings
+// needed to get going, with the most common options commented out
+var starterConfig = template.Must(template.New("config").Funcs(template.FuncMap{
+	"quote": func(s string) string {
+		// JSON strings are valid YAML scalars, whatever they contain
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	},
+}).Parse(`# sleepnumber-stats-collector configuration
+#
+# Every setting is documented in config.yaml.example. Durations are written
+# like 30s, 5m, or 1h. Any value can also be set with an environment variable
+# named after its path, such as INFLUXDB_TOKEN.
+
+# SleepIQ account, as used to log in at https://sleepiq.sleepnumber.com
+sleepIQUsername: {{quote .SleepIQUsername}}
+sleepIQPassword: {{quote .SleepIQPassword}}
+# sleepIQPasswordFile: /run/secrets/sleepiq_password  # read the password from a file instead
+
+# How often to poll the beds
+pollInterval: 1m
+# adaptive:  # poll quickly while anyone is in bed and back off while the beds are empty
+#   minInterval: 10s
+#   maxInterval: 5m
+
+# collectors:  # measurements to collect; foundation, footwarmers, and sleeper are enabled by default
+#   pump: true
+# beds:  # collect only from some beds, by name or bed ID
+#   exclude: [Guest Room]
+# tags:  # static tags added to every point
+#   location: master_bedroom
+
+# stateFile: /var/lib/sleepnumber-stats-collector/state.json  # keep poll progress across restarts
+# logLevel: info  # debug, info, warn, or error
+# logFormat: json  # log JSON objects instead of text, for Loki or ELK
+
+# InfluxDB to write to
+influxDB:
+  address: {{quote .InfluxAddress}}
+{{- if .InfluxToken}}
+  # InfluxDB v2
+  token: {{quote .InfluxToken}}
+  organization: {{quote .InfluxOrganization}}
+  bucket: {{quote .InfluxBucket}}
+  # For InfluxDB v1, remove the three settings above and set these instead:
+  # username: myuser
+  # password: mypass
+  # database: mydb
+  # retentionPolicy: autogen
+{{- else}}
+  # InfluxDB v1
+  username: {{quote .InfluxUsername}}
+  password: {{quote .InfluxPassword}}
+  database: {{quote .InfluxDatabase}}
+  retentionPolicy: {{quote .InfluxRetentionPolicy}}
+  # For InfluxDB v2, remove the four settings above and set these instead:
+  # token: mytoken
+  # organization: myorg
+  # bucket: mybucket
+{{- end}}
+  # skipVerifySsl: false  # skip TLS certificate verification
+`))
+
+// starterSettings fills in starterConfig
+type starterSettings struct {
+	SleepIQUsername       string
+	SleepIQPassword       string
+	InfluxAddress         string
+	InfluxToken           string
+	InfluxOrganization    string
+	InfluxBucket          string
+	InfluxUsername        string
+	InfluxPassword        string
+	InfluxDatabase        string
+	InfluxRetentionPolicy string
+}
+
+// initConfig implements the init subcommand, which writes a starter config
+// file, optionally prompting for credentials and InfluxDB details
+func initConfig(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	path := flags.String("config", "config.yaml", "path of the configuration file to write")
+	interactive := flags.Bool("interactive", false, "prompt for SleepIQ credentials and InfluxDB details")
+	force := flags.Bool("force", false, "overwrite an existing configuration file")
+	flags.Parse(args)
+
+	settings := starterSettings{
+		SleepIQUsername:    "myusername",
+		SleepIQPassword:    "mypassword",
+		InfluxAddress:      "http://127.0.0.1:8086",
+		InfluxToken:        "mytoken",
+		InfluxOrganization: "myorg",
+		InfluxBucket:       "sleepnumber",
+	}
+	if *interactive {
+		err := promptSettings(bufio.NewReader(os.Stdin), os.Stderr, &settings)
+		if err != nil {
+			return err
+		}
+	}
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	// The file holds credentials, so only its owner may read it
+	file, err := os.OpenFile(*path, mode, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists, pass -force to overwrite it", *path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s, %s", *path, err)
+	}
+	err = starterConfig.Execute(file, settings)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s, %s", *path, err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write %s, %s", *path, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s; check it with: sleepnumber-stats-collector validate-config -config %s\n", *path, *path)
+	return nil
+}
+
+// promptSettings asks for each setting on out, keeping the current value
+// when the answer is empty
+func promptSettings(in *bufio.Reader, out io.Writer, settings *starterSettings) error {
+	prompt := func(question string, value *string) error {
+		fmt.Fprintf(out, "%s [%s]: ", question, *value)
+		answer, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			return fmt.Errorf("failed to read answer, %s", err)
+		}
+		answer = strings.TrimSpace(answer)
+		if answer != "" {
+			*value = answer
+		}
+		return nil
+	}
+
+	type question struct {
+		question string
+		value    *string
+	}
+	version := "2"
+	questions := []question{
+		{"SleepIQ username", &settings.SleepIQUsername},
+		{"SleepIQ password", &settings.SleepIQPassword},
+		{"InfluxDB address", &settings.InfluxAddress},
+		{"InfluxDB version (1 or 2)", &version},
+	}
+	for _, q := range questions {
+		err := prompt(q.question, q.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if version == "1" {
+		settings.InfluxToken = ""
+		settings.InfluxUsername = "myuser"
+		settings.InfluxPassword = "mypass"
+		settings.InfluxDatabase = "sleepnumber"
+		settings.InfluxRetentionPolicy = "autogen"
+		questions = []question{
+			{"InfluxDB username", &settings.InfluxUsername},
+			{"InfluxDB password", &settings.InfluxPassword},
+			{"InfluxDB database", &settings.InfluxDatabase},
+			{"InfluxDB retention policy", &settings.InfluxRetentionPolicy},
+		}
+	} else {
+		questions = []question{
+			{"InfluxDB token", &settings.InfluxToken},
+			{"InfluxDB organization", &settings.InfluxOrganization},
+			{"InfluxDB bucket", &settings.InfluxBucket},
+		}
+	}
+	for _, q := range questions {
+		err := prompt(q.question, q.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
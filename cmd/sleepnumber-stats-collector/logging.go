@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/syslog"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// logFile is the file currently logged to, if any
+var logFile io.WriteCloser
+
+// syslogHook is the hook currently sending logs to syslog, if any
+var syslogHook *syslog.Hook
+
+// setLogging applies the configured log level, format, file, and syslog
+// server; they default to info, text, stderr, and none. The log file is opened afresh every time, so
+// reloading the config after moving it aside starts a new one.
+func setLogging(config *config.Configuration) error {
+	level := config.LogLevel
+	if level == "" {
+		level = "info"
+	}
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	var formatter log.Formatter
+	switch config.LogFormat {
+	case "", "text":
+		formatter = &log.TextFormatter{}
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %s, must be text or json", config.LogFormat)
+	}
+
+	var file io.WriteCloser
+	if config.LogFile != "" && config.LogRotation.Enabled() {
+		file, err = openRotatingFile(config.LogFile, &config.LogRotation)
+	} else if config.LogFile != "" {
+		file, err = os.OpenFile(config.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s, %s", config.LogFile, err)
+	}
+	var hook *syslog.Hook
+	if config.Syslog.Address != "" {
+		appName := config.Syslog.AppName
+		if appName == "" {
+			appName = "sleepnumber-stats-collector"
+		}
+		hook, err = syslog.New(config.Syslog.Address, config.Syslog.Facility, appName)
+		if err != nil {
+			if file != nil {
+				file.Close()
+			}
+			return err
+		}
+	}
+
+	log.SetFormatter(formatter)
+	log.SetLevel(parsed)
+	if file != nil {
+		log.SetOutput(file)
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
+	replaceSyslogHook(hook)
+	return nil
+}
+
+// replaceSyslogHook swaps the syslog hook for hook, which may be nil, keeping
+// every other hook
+func replaceSyslogHook(hook *syslog.Hook) {
+	hooks := make(log.LevelHooks)
+	for level, levelHooks := range log.StandardLogger().Hooks {
+		for _, h := range levelHooks {
+			if old, ok := h.(*syslog.Hook); ok && old == syslogHook {
+				continue
+			}
+			hooks[level] = append(hooks[level], h)
+		}
+	}
+	if hook != nil {
+		hooks.Add(hook)
+	}
+	log.StandardLogger().ReplaceHooks(hooks)
+	if syslogHook != nil {
+		syslogHook.Close()
+	}
+	syslogHook = hook
+}
+
+// rotatingFile is a log file rotated by lumberjack once it grows too large
+// and, if an interval is set, on every multiple of the interval
+type rotatingFile struct {
+	*lumberjack.Logger
+	stop chan struct{}
+}
+
+// openRotatingFile opens path for logging with the rotation settings
+func openRotatingFile(path string, rotation *config.LogRotation) (*rotatingFile, error) {
+	f := &rotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    rotation.MaxSize,
+			MaxAge:     int(math.Ceil(rotation.MaxAge.Hours() / 24)),
+			MaxBackups: rotation.MaxBackups,
+			LocalTime:  true,
+			Compress:   rotation.Compress,
+		},
+		stop: make(chan struct{}),
+	}
+	// Open the file now so a path that can't be written fails the config
+	// instead of the first log entry
+	_, err := f.Write(nil)
+	if err != nil {
+		return nil, err
+	}
+	if rotation.Interval > 0 {
+		go f.rotateEvery(rotation.Interval)
+	}
+	return f, nil
+}
+
+// rotateEvery rotates the file on every multiple of interval since the zero
+// time, so a 24h interval rotates at midnight UTC, until the file is closed
+func (f *rotatingFile) rotateEvery(interval time.Duration) {
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(interval).Add(interval).Sub(now))
+		select {
+		case <-f.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			err := f.Rotate()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main.rotateEvery",
+					"error": err,
+				}).Error("failed to rotate log file")
+			}
+		}
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	close(f.stop)
+	return f.Logger.Close()
+}
+
+// logAPIRequest logs the timing of every SleepIQ API request at debug level,
+// to help tell which endpoint slows down a poll cycle
+func logAPIRequest(endpoint string, elapsed time.Duration, err error) {
+	entry := log.WithFields(log.Fields{
+		"op":       "sleepiq.request",
+		"endpoint": endpoint,
+		"elapsed":  elapsed.String(),
+	})
+	if err != nil {
+		entry = entry.WithField("error", err)
+	}
+	entry.Debug("SleepIQ API request finished")
+}
@@ -0,0 +1,798 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/health"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/homeassistant"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/leader"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/secrets"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/status"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/stream"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/systemd"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/tracing"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// secretsTimeout bounds fetching secrets from external stores
+const secretsTimeout = 30 * time.Second
+
+func main() {
+
+	// Load the config file based on path provided via CLI or the default
+	configLocation := flag.String("config", "config.yaml", "path to configuration file")
+	stopMotion := flag.String("stop-motion", "", "halt all foundation motion on the bed of the given name (or \"all\" beds) and exit")
+	login := flag.Bool("login", false, "log into every account interactively, prompting for two-factor codes, store the sessions in stateFile, and exit")
+	save := flag.Bool("save", false, "with -login, prompt for each account's SleepIQ password and save it in the OS keyring")
+	showVersion := flag.Bool("version", false, "print the version, commit, and build date and exit")
+	once := flag.Bool("once", false, "poll every account once, write the results to the sinks, and exit")
+	dryRun := flag.Bool("dry-run", false, "query SleepIQ as usual but print the points to stdout instead of writing them to any sink")
+	dryRunFormat := flag.String("dry-run-format", sink.PrintLineProtocol, "how -dry-run prints points: line (InfluxDB line protocol) or table")
+	addon := flag.Bool("addon", false, "run as a Home Assistant add-on, reading options from "+homeassistant.OptionsPath+" unless -config is set, publishing to the Supervisor's MQTT broker, and serving the status page to ingress")
+
+	// Flags overriding config values, which take precedence over the
+	// environment and the config file
+	overrideFlags := map[string]string{
+		"poll-interval":    "pollInterval",
+		"influxdb-address": "influxDB.address",
+		"influxdb-bucket":  "influxDB.bucket",
+		"log-level":        "logLevel",
+		"log-format":       "logFormat",
+		"log-file":         "logFile",
+		"record":           "sleepIQClient.record",
+		"replay":           "sleepIQClient.replay",
+	}
+	flag.String("poll-interval", "", "override pollInterval, as a duration such as 30s")
+	flag.String("influxdb-address", "", "override influxDB.address")
+	flag.String("influxdb-bucket", "", "override influxDB.bucket")
+	flag.String("log-level", "", "override logLevel (debug, info, warn, or error)")
+	flag.String("log-format", "", "override logFormat (text or json)")
+	flag.String("log-file", "", "override logFile, the file to log to instead of stderr")
+	flag.String("record", "", "override sleepIQClient.record, the directory to save every SleepIQ API response to")
+	flag.String("replay", "", "override sleepIQClient.replay, the directory of saved SleepIQ API responses to answer requests from instead of SleepIQ")
+
+	// Subcommands come before any flags; init has flags of its own
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		err := initConfig(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.initConfig",
+				"error": err,
+			}).Fatal("failed to write starter configuration")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		err := healthcheck(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.healthcheck",
+				"error": err,
+			}).Fatal("health check failed")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "grafana-dashboard" {
+		err := grafanaDashboard(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.grafanaDashboard",
+				"error": err,
+			}).Fatal("failed to provision Grafana dashboard")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		err := exportSessions(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.exportSessions",
+				"error": err,
+			}).Fatal("failed to export sleep sessions")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "influx-downsample" {
+		err := influxDownsample(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.influxDownsample",
+				"error": err,
+			}).Fatal("failed to set up downsampling")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		err := sleepReport(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.sleepReport",
+				"error": err,
+			}).Fatal("failed to produce sleep report")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		err := manageService(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.manageService",
+				"error": err,
+			}).Fatal("failed to manage Windows service")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "mock-sleepiq" {
+		err := mockSleepIQ(os.Args[2:])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.mockSleepIQ",
+				"error": err,
+			}).Fatal("failed to serve mock SleepIQ API")
+		}
+		return
+	}
+	var command string
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	// Without -config, a missing config.yaml means configuring purely from
+	// the environment
+	configSet := false
+	overrides := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		configSet = configSet || f.Name == "config"
+		if key, ok := overrideFlags[f.Name]; ok {
+			overrides[key] = f.Value.String()
+		}
+	})
+	if *addon {
+		overrides["homeAssistant.addon"] = "true"
+		if !configSet {
+			*configLocation = homeassistant.OptionsPath
+		}
+	}
+	if _, err := os.Stat(*configLocation); !configSet && os.IsNotExist(err) {
+		*configLocation = ""
+	}
+
+	if command == "validate-config" {
+		if !validateConfig(context.Background(), *configLocation, overrides) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	enabled := func(f feature) bool {
+		return runs(f, *dryRun)
+	}
+	if !enabled(featureDeadman) {
+		overrides["deadman.url"] = ""
+	}
+
+	config, secretsExpire, err := loadConfiguration(*configLocation, overrides)
+	if err != nil {
+		logConfigErrors("main.LoadConfiguration", err)
+		log.WithFields(log.Fields{
+			"op": "main.LoadConfiguration",
+		}).Fatal("failed to load configuration")
+	}
+	err = setLogging(config)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main",
+			"error": err,
+		}).Fatal("failed to set up logging")
+	}
+
+	buildVersion, buildCommit, buildDate := buildInfo()
+	log.WithFields(log.Fields{
+		"op":      "main",
+		"version": buildVersion,
+		"commit":  buildCommit,
+		"built":   buildDate,
+	}).Info("starting sleepnumber-stats-collector")
+
+	err = tracing.Start(&config.Tracing, buildVersion)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main",
+			"error": err,
+		}).Fatal("failed to start tracing")
+	}
+
+	// Cancel everything in flight on SIGTERM or SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// Or when the Windows service control manager asks the service to stop
+	ctx, err = serviceContext(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main",
+			"error": err,
+		}).Fatal("failed to start Windows service")
+	}
+
+	// Handle the emergency stop command before anything else
+	if *stopMotion != "" {
+		api, err := sleepIQOptions(config)
+		if err == nil {
+			var accounts []control.Account
+			accounts, err = control.Login(ctx, config, api)
+			if err == nil {
+				var actions *audit.Log
+				var closeAudit func()
+				actions, closeAudit, err = openAudit(config)
+				if err == nil {
+					err = control.StopMotion(ctx, accounts, *stopMotion, actions, cliOrigin())
+					closeAudit()
+				}
+			}
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.StopMotion",
+				"error": err,
+			}).Fatal("failed to stop bed motion")
+		}
+		return
+	}
+
+	// Store logins for two-factor accounts, or passwords, ahead of
+	// unattended runs
+	if *login {
+		err = bootstrapLogins(ctx, config, *save)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.bootstrapLogins",
+				"error": err,
+			}).Fatal("failed to store SleepIQ logins")
+		}
+		return
+	}
+
+	// Collectors publish to the bus, and each sink consumes its own
+	// subscription so adding a consumer doesn't touch the poll loop. The
+	// sinks outlive the poll loops so everything collected is drained on
+	// shutdown.
+	points := bus.New()
+	printFormat := ""
+	if *dryRun {
+		printFormat = *dryRunFormat
+	}
+	// Initialize a collector per SleepIQ account and login
+	accounts := config.SleepIQAccounts()
+	var state collector.StateStore
+	if config.StateFile != "" && enabled(featureStateFile) {
+		state = collector.NewFileStateStore(config.StateFile)
+	}
+	var collectors []*collector.Collector
+	for _, account := range accounts {
+		c, err := newCollector(config, account, points, state)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":      "main",
+				"account": account.Name,
+				"error":   err,
+			}).Fatal("failed to initialize collector")
+		}
+		err = c.Login(ctx)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":      "main",
+				"account": account.Name,
+				"error":   err,
+			}).Fatal("failed to log into SleepIQ account")
+		}
+		collectors = append(collectors, c)
+	}
+
+	// Control beds through the collectors' sessions rather than logging in
+	// for every action
+	controlled := controlAccounts(accounts, collectors)
+	out, err := startOutputs(config, printFormat, points, nil, controlled)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main",
+			"error": err,
+		}).Fatal("failed to initialize outputs")
+	}
+
+	// Poll every account once and exit, for cron jobs and debugging
+	if *once {
+		drainAndExit(config, func() error {
+			err := pollOnce(ctx, accounts, collectors)
+			if err == nil {
+				pingDeadman(ctx, config)
+			}
+			return err
+		}, points, func() *outputs {
+			return out
+		})
+		return
+	}
+
+	// Run every collector in a group sharing one context, so a collector
+	// failing with an error it can't recover from stops the rest and is
+	// reported here
+	var polling atomic.Bool
+	runCollectors := func(ctx context.Context) error {
+		polling.Store(true)
+		defer polling.Store(false)
+		g, ctx := errgroup.WithContext(ctx)
+		for i, c := range collectors {
+			g.Go(func() error {
+				err := c.Run(ctx)
+				if err != nil {
+					return fmt.Errorf("collector for account %q stopped, %w", accounts[i].Name, err)
+				}
+				return nil
+			})
+		}
+		return g.Wait()
+	}
+
+	run, runCtx := errgroup.WithContext(ctx)
+
+	// Keep the latest points from the start for the status page, the
+	// Telegram bot, voice assistants, and passive checks, and recent errors
+	// for the status page
+	passiveChecks := config.PassiveChecks.Icinga.URL != "" || config.PassiveChecks.NSCA.Address != ""
+	var latest *status.Latest
+	var recent *status.RecentErrors
+	if config.HTTP.StatusPage || config.Telegram.Token != "" || config.HTTP.VoiceToken != "" || passiveChecks {
+		latest = status.NewLatest()
+		if config.HTTP.StatusPage {
+			recent = status.NewRecentErrors(statusErrors)
+			log.AddHook(recent)
+		}
+		sub, err := points.Subscribe("status", 0, "")
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main",
+				"error": err,
+			}).Fatal("failed to subscribe the status page")
+		}
+		// Unsubscribing on shutdown keeps the points still being published
+		// from waiting on a reader that is gone
+		run.Go(func() error {
+			defer points.Unsubscribe(sub)
+			for {
+				select {
+				case <-runCtx.Done():
+					return nil
+				case p, ok := <-sub.Points():
+					if !ok {
+						return nil
+					}
+					latest.Write(p)
+				}
+			}
+		})
+	}
+
+	// Poll right away, or only while holding leadership when running
+	// redundant instances
+	if config.LeaderElection.Backend == "" || !enabled(featureLeaderElection) {
+		run.Go(func() error {
+			return runCollectors(runCtx)
+		})
+	} else {
+		lock, err := leader.New(&config.LeaderElection)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main",
+				"error": err,
+			}).Fatal("failed to initialize leader election")
+		}
+		run.Go(func() error {
+			return leader.Run(runCtx, lock, &config.LeaderElection, runCollectors)
+		})
+	}
+
+	// Reload the config file on SIGHUP, when leased secrets are due to be
+	// fetched again, and when secret files change
+	r := &reloader{
+		path:       *configLocation,
+		overrides:  overrides,
+		dryRun:     printFormat,
+		config:     config,
+		accounts:   accounts,
+		collectors: collectors,
+		state:      state,
+		points:     points,
+		out:        out,
+
+		secretsExpire: secretsExpire,
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	secretsChanged, err := watchSecretFiles(runCtx, secretFiles(config))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main",
+			"error": err,
+		}).Warn("failed to watch secret files, rotated secrets need a SIGHUP or restart")
+	}
+	run.Go(func() error {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-runCtx.Done():
+				return nil
+			case <-hup:
+				r.reload()
+			case <-r.secretsRefresh():
+				r.refreshSecrets()
+			case <-secretsChanged:
+				log.WithFields(log.Fields{
+					"op": "main",
+				}).Info("secret files changed, reloading")
+				r.reload()
+			}
+		}
+	})
+
+	// Serve health checks for Docker and Kubernetes, metrics for
+	// Prometheus, and the status page
+	if config.HTTP.Address != "" {
+		listener, err := net.Listen("tcp", config.HTTP.Address)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main",
+				"error": err,
+			}).Fatal("failed to listen for health checks")
+		}
+		mux := http.NewServeMux()
+		health.Register(mux, readiness(accounts, collectors, &polling, r))
+		if config.Metrics.Prometheus {
+			mux.Handle("/metrics", metrics.Handler())
+		}
+		if config.HTTP.StatusPage {
+			page := status.Handler(statusReport(buildVersion, accounts, collectors, &polling, r, latest, recent))
+			if config.HomeAssistant.Addon {
+				page = homeassistant.IngressOnly(page)
+			}
+			mux.Handle("/", page)
+		}
+		if config.HTTP.Calendar {
+			calendar, closeCalendar, err := calendarHandler(config)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main",
+					"error": err,
+				}).Fatal("failed to connect to InfluxDB for the calendar feed")
+			}
+			defer closeCalendar()
+			mux.Handle("/calendar.ics", calendar)
+		}
+		if config.HTTP.VoiceToken != "" && enabled(featureVoice) {
+			alexa, google, closeVoice, err := voiceHandlers(config, latest, controlled)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main",
+					"error": err,
+				}).Fatal("failed to set up the voice assistant webhooks")
+			}
+			defer closeVoice()
+			mux.Handle("/voice/alexa", alexa)
+			mux.Handle("/voice/google", google)
+		}
+		if config.HTTP.ControlToken != "" && enabled(featureStopMotion) {
+			stop, closeControl, err := stopMotionHandler(config, controlled)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main",
+					"error": err,
+				}).Fatal("failed to set up the stop motion endpoint")
+			}
+			defer closeControl()
+			mux.Handle("/stop-motion", stop)
+		}
+		if config.HTTP.Events {
+			events, err := streamPoints(points)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main",
+					"error": err,
+				}).Fatal("failed to subscribe the event stream")
+			}
+			mux.Handle("/events", stream.SSEHandler(events, schema.FromConfig(config).Tag("name")))
+		}
+		if config.HTTP.State {
+			docs, latestDoc, err := streamState(points, schema.FromConfig(config))
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main",
+					"error": err,
+				}).Fatal("failed to subscribe the state stream")
+			}
+			mux.Handle("/state", stream.WebSocketHandler(docs, latestDoc, config.HTTP.StateOrigin))
+		}
+		run.Go(func() error {
+			return health.Serve(runCtx, listener, mux)
+		})
+	}
+
+	// Write the same metrics to the sinks
+	if config.Metrics.Interval > 0 {
+		run.Go(func() error {
+			writeStats(runCtx, points, config.Metrics.Interval)
+			return nil
+		})
+	}
+
+	// Warn when a sink stops writing a measurement
+	if config.Staleness.Factor > 0 {
+		threshold := stalenessThreshold(config)
+		run.Go(func() error {
+			watchStaleness(runCtx, threshold, config.Staleness.Ignore)
+			return nil
+		})
+	}
+
+	// Report the collector, its data, and the beds to Icinga or NSCA
+	if passiveChecks && enabled(featurePassiveChecks) {
+		ready := readiness(accounts, collectors, &polling, r)
+		run.Go(func() error {
+			submitPassiveChecks(runCtx, config, ready, latest)
+			return nil
+		})
+	}
+
+	// Upload sleep sessions to Google Fit
+	if len(config.GoogleFit.Sleepers) > 0 && enabled(featureGoogleFit) {
+		run.Go(func() error {
+			syncGoogleFit(runCtx, config)
+			return nil
+		})
+	}
+
+	// Email the weekly sleep report
+	if len(config.Report.To) > 0 && enabled(featureReport) {
+		run.Go(func() error {
+			emailReports(runCtx, config)
+			return nil
+		})
+	}
+
+	// Answer questions and take control commands over Telegram
+	if config.Telegram.Token != "" && enabled(featureTelegram) {
+		run.Go(func() error {
+			runTelegram(runCtx, config, latest, controlled)
+			return nil
+		})
+	}
+
+	// Serve the state of the beds and control of them over gRPC
+	if config.GRPC.Address != "" {
+		run.Go(func() error {
+			return serveGRPC(runCtx, config, points, controlled, enabled(featureGRPCControl))
+		})
+	}
+
+	// Serve the beds to HomeKit as occupancy sensors and lights
+	if config.HomeKit.Address != "" {
+		run.Go(func() error {
+			return serveHomeKit(runCtx, config, points, controlled, enabled(featureHomeKitLights))
+		})
+	}
+
+	// Import wearable sleep logs next to the bed's
+	if len(config.Fitbit.Users) > 0 {
+		run.Go(func() error {
+			importFitbit(runCtx, config.Fitbit, points)
+			return nil
+		})
+	}
+
+	// Tell systemd that startup finished, and keep its watchdog fed while
+	// the poll loops make progress
+	notifySystemd("READY=1")
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		run.Go(func() error {
+			feedWatchdog(runCtx, interval, accounts, collectors, &polling)
+			return nil
+		})
+	}
+
+	<-runCtx.Done()
+	notifySystemd("STOPPING=1")
+	log.WithFields(log.Fields{
+		"op": "main",
+	}).Info("shutting down, draining data to sinks")
+
+	// Wait for the poll loops to stop and the sinks to write what was
+	// published, giving up once the shutdown deadline passes
+	drainAndExit(config, run.Wait, points, r.outputs)
+}
+
+// drainAndExit waits for collection to stop, then for the sinks to consume
+// what was published before flushing and closing them. It exits non-zero if
+// collection failed or draining outlasts the shutdown timeout.
+func drainAndExit(config *config.Configuration, wait func() error, points *bus.Bus, out func() *outputs) {
+	drained := make(chan error, 1)
+	go func() {
+		runErr := wait()
+		points.Close()
+		out().drain()
+		err := tracing.Shutdown(context.Background())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main",
+				"error": err,
+			}).Warn("failed to export traces")
+		}
+		drained <- runErr
+	}()
+
+	select {
+	case err := <-drained:
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main",
+				"error": err,
+			}).Error("shut down after collection failed")
+			serviceStopped(1)
+			os.Exit(1)
+		}
+		log.WithFields(log.Fields{
+			"op": "main",
+		}).Info("shutdown complete")
+		serviceStopped(0)
+	case <-time.After(config.ShutdownTimeout):
+		log.WithFields(log.Fields{
+			"op":      "main",
+			"timeout": config.ShutdownTimeout.String(),
+		}).Error("timed out draining data to sinks, exiting anyway")
+		serviceStopped(1)
+		os.Exit(1)
+	}
+}
+
+// pollOnce runs a single poll cycle of every collector, reporting the
+// failures of all of them
+func pollOnce(ctx context.Context, accounts []config.Account, collectors []*collector.Collector) error {
+	var errs []error
+	for i, c := range collectors {
+		err := c.Poll(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("poll of account %q failed, %w", accounts[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadConfiguration loads the config file, resolves secrets kept outside it,
+// and fills in defaults. It also returns when secrets with a lease should be
+// fetched again, or the zero time if none expire.
+func loadConfiguration(path string, overrides map[string]string) (*config.Configuration, time.Time, error) {
+	config, err := config.LoadConfiguration(path, overrides)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	err = config.ReadSecretFiles()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	secretsExpire, err := secrets.ResolveVault(ctx, config)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	err = secrets.ResolveAWS(ctx, config)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	err = secrets.ResolveKeyring(config)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// Destinations without their own proxy go through the top-level one
+	if config.SleepIQClient.Proxy == "" {
+		config.SleepIQClient.Proxy = config.Proxy
+	}
+	if config.InfluxDB.Proxy == "" {
+		config.InfluxDB.Proxy = config.Proxy
+	}
+	if config.Deadman.Proxy == "" {
+		config.Deadman.Proxy = config.Proxy
+	}
+	if config.Tracing.Proxy == "" {
+		config.Tracing.Proxy = config.Proxy
+	}
+
+	if config.SessionLifetime == 0 {
+		config.SessionLifetime = time.Hour
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = time.Minute
+	}
+	if config.BedConcurrency == 0 {
+		config.BedConcurrency = 4
+	}
+	if config.BedsRefresh == 0 {
+		config.BedsRefresh = time.Hour
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 10 * time.Second
+	}
+	if config.HomeAssistant.Addon {
+		err = applyAddonDefaults(ctx, config)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	// Report every invalid setting at once, including those only found when
+	// building each collector's options
+	errs := []error{config.Validate()}
+	for _, account := range config.SleepIQAccounts() {
+		_, err = collectorOptions(config, account, nil)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return config, secretsExpire, nil
+}
+
+// logConfigErrors logs each problem found in the configuration on its own
+func logConfigErrors(op string, err error) {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = flattenErrors(joined.Unwrap())
+	}
+	for _, err := range errs {
+		log.WithFields(log.Fields{
+			"op":    op,
+			"error": err,
+		}).Error("invalid configuration")
+	}
+}
+
+// flattenErrors expands joined errors into the errors they hold
+func flattenErrors(errs []error) []error {
+	var flat []error
+	for _, err := range errs {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			flat = append(flat, flattenErrors(joined.Unwrap())...)
+			continue
+		}
+		flat = append(flat, err)
+	}
+	return flat
+}
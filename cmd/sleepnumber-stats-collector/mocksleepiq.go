@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq/sleepiqtest"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// mockSleepIQ implements the mock-sleepiq subcommand, which serves a mock of
+// the SleepIQ API until interrupted, for developing and testing the
+// collector offline by pointing sleepIQClient.baseURL at it. With -cycle,
+// every side's sleeper gets into and out of bed in turn, so sessions and
+// presence change as they would overnight.
+func mockSleepIQ(args []string) error {
+	flags := flag.NewFlagSet("mock-sleepiq", flag.ExitOnError)
+	address := flags.String("address", "127.0.0.1:8800", "address to serve the mock API on")
+	username := flags.String("username", "mock@example.com", "SleepIQ username the mock accepts")
+	password := flags.String("password", "mock", "SleepIQ password the mock accepts")
+	beds := flags.String("beds", "Bed", "comma-separated names of the mock beds")
+	cycle := flags.Duration("cycle", 0, "time each sleeper spends in bed, and then out of it, in turn; sleepers stay out of bed unless set")
+	flags.Parse(args)
+
+	server := sleepiqtest.NewServer(*username, *password, strings.Split(*beds, ",")...)
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s, %s", *address, err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *cycle > 0 {
+		go cycleSleepers(ctx, server, *cycle)
+	}
+
+	httpServer := &http.Server{Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	log.WithFields(log.Fields{
+		"op":      "main.mockSleepIQ",
+		"baseURL": "http://" + listener.Addr().String() + sleepiqtest.BasePath,
+	}).Info("serving mock SleepIQ API, set sleepIQClient.baseURL to baseURL")
+	err = httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// cycleSleepers keeps every sleeper of server in bed for cycle and then out
+// of it for cycle until ctx is cancelled, the right side half a cycle behind
+// the left so the two don't always move together
+func cycleSleepers(ctx context.Context, server *sleepiqtest.Server, cycle time.Duration) {
+	ticker := time.NewTicker(cycle / 2)
+	defer ticker.Stop()
+	for step := 0; ; step++ {
+		left := step%4 < 2
+		right := (step+1)%4 < 2
+		for _, bed := range server.Beds() {
+			server.SetInBed(bed, "left", left)
+			server.SetInBed(bed, "right", right)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
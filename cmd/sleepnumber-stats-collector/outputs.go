@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"os"
+)
+
+// outputs is the set of sinks consuming the bus, each through its own
+// subscription; it is replaced as a whole when the sink configuration
+// changes
+type outputs struct {
+	sinks     sink.Multi
+	subs      []*bus.Subscription
+	consumers errgroup.Group
+	monitors  errgroup.Group
+}
+
+// newSinks initializes every configured sink, or with dryRun set to a print
+// format, a sink printing points to stdout in its place; sinks taking
+// commands stop motion through stopMotion, unless it is nil
+func newSinks(config *config.Configuration, dryRun string, stopMotion sink.StopMotion) (sink.Multi, error) {
+	if dryRun != "" {
+		printSink, err := sink.NewPrint(os.Stdout, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		return sink.Multi{printSink}, nil
+	}
+
+	var sinks sink.Multi
+	if config.InfluxDB.Address != "" {
+		influxSink, err := sink.NewInfluxDB(&config.InfluxDB)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize InfluxDB connection, %s", err)
+		}
+		sinks = append(sinks, influxSink)
+	}
+	if config.MQTT.Broker != "" {
+		mqttSink, err := sink.NewMQTT(&config.MQTT, schema.FromConfig(config), stopMotion)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, mqttSink)
+	}
+	if config.StateWebhook.URL != "" {
+		sinks = append(sinks, sink.NewStateWebhook(&config.StateWebhook, schema.FromConfig(config)))
+	}
+	if config.Textfile.Path != "" {
+		sinks = append(sinks, sink.NewTextfile(&config.Textfile))
+	}
+	if len(config.Hubitat.Sleepers) > 0 {
+		sinks = append(sinks, sink.NewHubitat(&config.Hubitat, schema.FromConfig(config)))
+	}
+	if len(config.SmartThings.Sleepers) > 0 {
+		sinks = append(sinks, sink.NewSmartThings(&config.SmartThings, schema.FromConfig(config)))
+	}
+	for i := range config.Plugins {
+		pluginSink, err := sink.NewExec(&config.Plugins[i])
+		if err != nil {
+			sinks.Close()
+			return nil, fmt.Errorf("failed to start output plugin %s, %s", config.Plugins[i].Name, err)
+		}
+		sinks = append(sinks, pluginSink)
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("no outputs configured, set influxDB.address, mqtt.broker, stateWebhook.url, textfile.path, hubitat.sleepers, smartThings.sleepers, or at least one plugin")
+	}
+	return sinks, nil
+}
+
+// startOutputs initializes the configured sinks and subscribes them to the
+// bus, taking over from previous, if set, without missing a point; MQTT
+// stops the beds of accounts
+func startOutputs(config *config.Configuration, dryRun string, points *bus.Bus, previous *outputs, accounts []control.Account) (*outputs, error) {
+	var stop sink.StopMotion
+	if config.MQTT.StopMotion {
+		stop = mqttStopMotion(config, accounts)
+	}
+	sinks, err := newSinks(config, dryRun, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]bus.Spec, len(sinks))
+	for i, s := range sinks {
+		specs[i] = bus.Spec{
+			Name:     s.Name(),
+			Buffer:   config.Pipeline.Buffer,
+			SpillDir: config.Pipeline.SpillDir,
+			Overflow: config.Pipeline.Overflow,
+		}
+	}
+	var old []*bus.Subscription
+	if previous != nil {
+		old = previous.subs
+	}
+	subs, err := points.Replace(old, specs)
+	if previous != nil {
+		previous.drain()
+	}
+
+	o := &outputs{}
+	for i, s := range sinks {
+		sub := subs[i]
+		if sub == nil {
+			s.Close()
+			continue
+		}
+		o.sinks = append(o.sinks, s)
+		o.subs = append(o.subs, sub)
+		o.consumers.Go(func() error {
+			for p := range sub.Points() {
+				metrics.QueueDepth(s.Name(), sub.Len())
+				s.Write(context.Background(), p)
+			}
+			return nil
+		})
+		o.monitors.Go(func() error {
+			for err := range s.Errors() {
+				log.WithFields(log.Fields{
+					"op":    "main",
+					"sink":  s.Name(),
+					"error": err,
+				}).Error("encountered error on writing to sink")
+			}
+			return nil
+		})
+	}
+	return o, err
+}
+
+// drain waits for the consumers to write what was queued before the feeds
+// were closed, then flushes and closes every sink
+func (o *outputs) drain() {
+	o.consumers.Wait()
+	o.sinks.Flush()
+	o.sinks.Close()
+	o.monitors.Wait()
+}
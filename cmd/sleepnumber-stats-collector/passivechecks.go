@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/health"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/passive"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/status"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPassiveInterval = 5 * time.Minute
+	defaultPassiveHost     = "sleepnumber-stats-collector"
+	// defaultFreshnessFactor is how many of the longest interval data may
+	// go unwritten before it counts as stale, unless staleness.factor is set
+	defaultFreshnessFactor = 3
+	passiveTimeout         = 30 * time.Second
+)
+
+// submitPassiveChecks submits the results of the passive checks every
+// interval until ctx is cancelled, judging the collector with ready and each
+// bed by its latest points
+func submitPassiveChecks(ctx context.Context, config *config.Configuration, ready health.Check, latest *status.Latest) {
+	var submitters []passive.Submitter
+	if config.PassiveChecks.Icinga.URL != "" {
+		submitters = append(submitters, passive.NewIcinga(&config.PassiveChecks.Icinga))
+	}
+	if config.PassiveChecks.NSCA.Address != "" {
+		submitters = append(submitters, passive.NewNSCA(&config.PassiveChecks.NSCA))
+	}
+	host := config.PassiveChecks.Host
+	if host == "" {
+		host = defaultPassiveHost
+	}
+	interval := config.PassiveChecks.Interval
+	if interval == 0 {
+		interval = defaultPassiveInterval
+	}
+	threshold := stalenessThreshold(config)
+	if threshold == 0 {
+		threshold = defaultFreshnessFactor * longestInterval(config)
+	}
+	names := schema.FromConfig(config)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, passiveTimeout)
+		results := passiveResults(checkCtx, config, names, ready, latest, threshold, time.Now())
+		for _, s := range submitters {
+			err := s.Submit(checkCtx, host, results)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "main.submitPassiveChecks",
+					"error": err,
+				}).Warn("failed to submit passive check results")
+			}
+		}
+		cancel()
+	}
+}
+
+// passiveResults checks that the collector is ready, that every measurement
+// was written within threshold of now, and that every bed reported within
+// it
+func passiveResults(ctx context.Context, config *config.Configuration, names schema.Names, ready health.Check, latest *status.Latest, threshold time.Duration, now time.Time) []passive.Result {
+	var results []passive.Result
+
+	collectorResult := passive.Result{Service: "sleepnumber collector", Status: passive.OK, Output: "polling, and every sink is reachable"}
+	if problems := ready(ctx); len(problems) > 0 {
+		var msgs []string
+		for _, p := range problems {
+			msgs = append(msgs, fmt.Sprintf("%s %s: %s", p.Component, p.Name, p.Error))
+		}
+		collectorResult.Status = passive.Critical
+		collectorResult.Output = strings.Join(msgs, "; ")
+	}
+	results = append(results, collectorResult)
+
+	ignored := make(map[string]bool, len(config.Staleness.Ignore))
+	for _, measurement := range config.Staleness.Ignore {
+		ignored[measurement] = true
+	}
+	freshness := passive.Result{Service: "sleepnumber freshness", Status: passive.Unknown, Output: "nothing has been written yet"}
+	var oldest time.Duration
+	var stale []string
+	for _, write := range metrics.LastWrites() {
+		if ignored[write.Measurement] {
+			continue
+		}
+		age := now.Sub(write.Time)
+		if age > oldest {
+			oldest = age
+		}
+		if age > threshold {
+			stale = append(stale, fmt.Sprintf("%s %s (%s)", write.Sink, write.Measurement, age.Round(time.Second)))
+		}
+		freshness.Status = passive.OK
+		freshness.Output = fmt.Sprintf("every measurement was written within %s", threshold)
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		freshness.Status = passive.Critical
+		freshness.Output = "not written recently: " + strings.Join(stale, ", ")
+	}
+	if freshness.Status != passive.Unknown {
+		freshness.PerfData = []string{fmt.Sprintf("oldest_write=%ds;;%d", int(oldest.Seconds()), int(threshold.Seconds()))}
+	}
+	results = append(results, freshness)
+
+	measurement := names.Renamed("bed_sleeper_state")
+	for _, group := range latest.Groups() {
+		for _, p := range group.Points {
+			if p.Measurement != measurement {
+				continue
+			}
+			bed := p.Tags[names.Tag("name")]
+			if account := p.Tags[names.Tag("account")]; account != "" {
+				bed = account + "/" + bed
+			}
+			age := now.Sub(p.Time)
+			r := passive.Result{
+				Service:  "sleepnumber bed " + bed,
+				Status:   passive.OK,
+				Output:   fmt.Sprintf("reported %s ago", age.Round(time.Second)),
+				PerfData: []string{fmt.Sprintf("age=%ds;;%d", int(age.Seconds()), int(threshold.Seconds()))},
+			}
+			if age > threshold {
+				r.Status = passive.Critical
+				r.Output = fmt.Sprintf("has not reported for %s", age.Round(time.Second))
+			}
+			results = append(results, r)
+		}
+	}
+	return results
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// secretsRetry is how long to wait before trying again to fetch secrets that
+// failed to refresh
+const secretsRetry = time.Minute
+
+// reloader applies a changed config file to the running collectors and
+// sinks
+type reloader struct {
+	path       string
+	overrides  map[string]string
+	dryRun     string
+	config     *config.Configuration
+	accounts   []config.Account
+	collectors []*collector.Collector
+	state      collector.StateStore
+	points     *bus.Bus
+
+	// mu guards out, which health checks read while reload replaces it
+	mu  sync.Mutex
+	out *outputs
+
+	// secretsExpire is when leased secrets are due to be fetched again
+	secretsExpire time.Time
+}
+
+// reload re-reads the config file and applies the poll settings of every
+// existing account and, if they changed, the sink settings. Settings that
+// can only take effect on restart are reported as such. A config file that
+// fails to load or apply leaves the running configuration in place.
+func (r *reloader) reload() {
+	next, secretsExpire, err := loadConfiguration(r.path, r.overrides)
+	if err != nil {
+		logConfigErrors("main.reload", err)
+		log.WithFields(log.Fields{
+			"op": "main.reload",
+		}).Error("failed to reload configuration, keeping the current one")
+		return
+	}
+
+	// Check everything before applying anything
+	opts := make([]collector.Options, len(r.accounts))
+	nextAccounts := make(map[string]config.Account)
+	for _, account := range next.SleepIQAccounts() {
+		nextAccounts[account.Name] = account
+	}
+	for i, account := range r.accounts {
+		nextAccount, ok := nextAccounts[account.Name]
+		if !ok {
+			nextAccount = account
+		}
+		opts[i], err = collectorOptions(next, nextAccount, r.state)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":      "main.reload",
+				"account": account.Name,
+				"error":   err,
+			}).Error("failed to reload configuration, keeping the current one")
+			return
+		}
+	}
+
+	err = setLogging(next)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main.reload",
+			"error": err,
+		}).Error("failed to reload configuration, keeping the current one")
+		return
+	}
+
+	for i, c := range r.collectors {
+		c.Reload(opts[i])
+	}
+
+	if sinksChanged(r.config, next) {
+		out, err := startOutputs(next, r.dryRun, r.points, r.out, controlAccounts(r.accounts, r.collectors))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.reload",
+				"error": err,
+			}).Error("failed to apply reloaded sink settings")
+		}
+		if out != nil {
+			r.mu.Lock()
+			r.out = out
+			r.mu.Unlock()
+		}
+	}
+
+	for _, setting := range restartRequired(r.config, next) {
+		log.WithFields(log.Fields{
+			"op":      "main.reload",
+			"setting": setting,
+		}).Warn("changed setting takes effect on restart")
+	}
+
+	r.config = next
+	r.secretsExpire = secretsExpire
+	log.WithFields(log.Fields{
+		"op":   "main.reload",
+		"path": r.path,
+	}).Info("reloaded configuration")
+}
+
+// outputs returns the sinks currently in use
+func (r *reloader) outputs() *outputs {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.out
+}
+
+// secretsRefresh fires when leased secrets are due to be fetched again, and
+// never if none expire
+func (r *reloader) secretsRefresh() <-chan time.Time {
+	if r.secretsExpire.IsZero() {
+		return nil
+	}
+	return time.After(time.Until(r.secretsExpire))
+}
+
+// refreshSecrets fetches leased secrets again by reloading the configuration,
+// retrying a minute later if that fails
+func (r *reloader) refreshSecrets() {
+	log.WithFields(log.Fields{
+		"op": "main.refreshSecrets",
+	}).Info("fetching secrets again before their lease expires")
+	expire := r.secretsExpire
+	r.reload()
+	if r.secretsExpire.Equal(expire) {
+		r.secretsExpire = time.Now().Add(secretsRetry)
+	}
+}
+
+func sinksChanged(current, next *config.Configuration) bool {
+	return !reflect.DeepEqual(current.InfluxDB, next.InfluxDB) ||
+		current.MQTT != next.MQTT ||
+		!reflect.DeepEqual(current.StateWebhook, next.StateWebhook) ||
+		current.Textfile != next.Textfile ||
+		!reflect.DeepEqual(current.Hubitat, next.Hubitat) ||
+		!reflect.DeepEqual(current.SmartThings, next.SmartThings) ||
+		!reflect.DeepEqual(current.Plugins, next.Plugins) ||
+		!reflect.DeepEqual(current.Pipeline, next.Pipeline)
+}
+
+// restartRequired lists the changed settings that reload can't apply
+func restartRequired(current, next *config.Configuration) []string {
+	var settings []string
+	if !reflect.DeepEqual(withoutPasswords(current.SleepIQAccounts()), withoutPasswords(next.SleepIQAccounts())) {
+		settings = append(settings, "accounts")
+	}
+	if !reflect.DeepEqual(current.SleepIQClient, next.SleepIQClient) ||
+		current.CircuitBreaker != next.CircuitBreaker ||
+		current.RateLimit != next.RateLimit {
+		settings = append(settings, "sleepIQClient")
+	}
+	if !reflect.DeepEqual(current.Tags, next.Tags) || !reflect.DeepEqual(current.Rename, next.Rename) ||
+		!reflect.DeepEqual(current.Cardinality, next.Cardinality) {
+		settings = append(settings, "tags")
+	}
+	if current.Delta != next.Delta || !reflect.DeepEqual(current.Dedup, next.Dedup) ||
+		!reflect.DeepEqual(current.Drop, next.Drop) {
+		settings = append(settings, "delta")
+	}
+	if !reflect.DeepEqual(current.Aggregate, next.Aggregate) {
+		settings = append(settings, "aggregate")
+	}
+	if current.StateFile != next.StateFile || current.PersistSession != next.PersistSession {
+		settings = append(settings, "stateFile")
+	}
+	if current.LeaderElection != next.LeaderElection {
+		settings = append(settings, "leaderElection")
+	}
+	if current.HomeAssistant != next.HomeAssistant {
+		settings = append(settings, "homeAssistant")
+	}
+	if current.HTTP != next.HTTP {
+		settings = append(settings, "http")
+	}
+	if current.Metrics != next.Metrics {
+		settings = append(settings, "metrics")
+	}
+	if current.Deadman != next.Deadman {
+		settings = append(settings, "deadman")
+	}
+	if !reflect.DeepEqual(current.Staleness, next.Staleness) {
+		settings = append(settings, "staleness")
+	}
+	if !reflect.DeepEqual(current.GoogleFit, next.GoogleFit) {
+		settings = append(settings, "googleFit")
+	}
+	if !reflect.DeepEqual(current.Fitbit, next.Fitbit) {
+		settings = append(settings, "fitbit")
+	}
+	if !reflect.DeepEqual(current.Report, next.Report) {
+		settings = append(settings, "report")
+	}
+	if !reflect.DeepEqual(current.Telegram, next.Telegram) {
+		settings = append(settings, "telegram")
+	}
+	if current.PassiveChecks != next.PassiveChecks {
+		settings = append(settings, "passiveChecks")
+	}
+	if current.GRPC != next.GRPC {
+		settings = append(settings, "grpc")
+	}
+	if current.HomeKit != next.HomeKit {
+		settings = append(settings, "homeKit")
+	}
+	if !reflect.DeepEqual(current.Tracing, next.Tracing) {
+		settings = append(settings, "tracing")
+	}
+	return settings
+}
+
+// withoutPasswords clears account passwords, which reload applies in place
+func withoutPasswords(accounts []config.Account) []config.Account {
+	for i := range accounts {
+		accounts[i].Password = ""
+		accounts[i].PasswordFile = ""
+	}
+	return accounts
+}
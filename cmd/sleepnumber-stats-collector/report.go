@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	influxAPI "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/report"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"time"
+)
+
+const (
+	// defaultReportSchedule sends the report on Monday mornings
+	defaultReportSchedule = "0 8 * * 1"
+	reportPeriod          = 7 * 24 * time.Hour
+	reportQueryTimeout    = time.Minute
+)
+
+// emailReports emails the weekly report on schedule until ctx is cancelled
+func emailReports(ctx context.Context, config *config.Configuration) {
+	schedule := config.Report.Schedule
+	if schedule == "" {
+		schedule = defaultReportSchedule
+	}
+	fail := func(err error) {
+		log.WithFields(log.Fields{
+			"op":    "main.emailReports",
+			"error": err,
+		}).Error("not emailing sleep reports")
+	}
+	cron, err := collector.ParseCron(schedule)
+	if err != nil {
+		fail(err)
+		return
+	}
+	influxConfig := config.InfluxDB
+	client, _, err := sink.InfluxConnect(&influxConfig)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer client.Close()
+	queryAPI := client.QueryAPI(influxConfig.Organization)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(cron.Next(time.Now()))):
+		}
+		err = sendReport(ctx, config, queryAPI, time.Now())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.emailReports",
+				"error": err,
+			}).Warn("failed to email sleep report")
+			continue
+		}
+		log.WithFields(log.Fields{
+			"op": "main.emailReports",
+			"to": config.Report.To,
+		}).Info("emailed sleep report")
+	}
+}
+
+// sendReport emails the report of the week up to end
+func sendReport(ctx context.Context, config *config.Configuration, queryAPI influxAPI.QueryAPI, end time.Time) error {
+	subject, html, err := renderReport(ctx, config, queryAPI, end)
+	if err != nil {
+		return err
+	}
+	return report.Send(config.Report.SMTP, config.Report.From, config.Report.To, subject, html)
+}
+
+// renderReport summarizes the sleep of the week up to end as the subject and
+// HTML body of the report
+func renderReport(ctx context.Context, config *config.Configuration, queryAPI influxAPI.QueryAPI, end time.Time) (string, []byte, error) {
+	start := end.Add(-reportPeriod)
+	ctx, cancel := context.WithTimeout(ctx, reportQueryTimeout)
+	defer cancel()
+	samples, err := sleep.Query(ctx, queryAPI, schema.FromConfig(config), start, end)
+	if err != nil {
+		return "", nil, err
+	}
+	sessions := sleep.Sessions(samples, sleep.DefaultMinDuration, sleep.DefaultMergeGap)
+	summary := report.Summarize(sessions, start, end, time.Local)
+	var html bytes.Buffer
+	err = report.HTML(&html, summary)
+	if err != nil {
+		return "", nil, err
+	}
+	subject := fmt.Sprintf("Sleep report, %s to %s", start.Format("Jan 2"), end.Format("Jan 2"))
+	return subject, html.Bytes(), nil
+}
+
+// sleepReport implements the report subcommand, which prints the weekly
+// report as HTML, or with -send emails it right away
+func sleepReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	configLocation := flags.String("config", "config.yaml", "path to the configuration file with the InfluxDB and report settings")
+	send := flags.Bool("send", false, "email the report as configured in report instead of printing it")
+	flags.Parse(args)
+
+	config, _, err := loadConfiguration(*configLocation, nil)
+	if err != nil {
+		return err
+	}
+	if config.InfluxDB.Address == "" {
+		return errors.New("influxDB.address is not set, so there is no stored data to report on")
+	}
+	if *send && len(config.Report.To) == 0 {
+		return errors.New("report.to is not set, so there is no one to email")
+	}
+	influxConfig := config.InfluxDB
+	client, _, err := sink.InfluxConnect(&influxConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	queryAPI := client.QueryAPI(influxConfig.Organization)
+
+	if *send {
+		return sendReport(context.Background(), config, queryAPI, time.Now())
+	}
+	_, html, err := renderReport(context.Background(), config, queryAPI, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(html)
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	log "github.com/sirupsen/logrus"
+	"path/filepath"
+	"time"
+)
+
+// secretSettle is how long secret files must stay unchanged before they are
+// read again, since rotating a mounted secret touches several files
+const secretSettle = time.Second
+
+// secretFiles lists the files secrets are read from
+func secretFiles(config *config.Configuration) []string {
+	var files []string
+	if config.SleepIQPasswordFile != "" {
+		files = append(files, config.SleepIQPasswordFile)
+	}
+	for _, account := range config.Accounts {
+		if account.PasswordFile != "" {
+			files = append(files, account.PasswordFile)
+		}
+	}
+	if config.InfluxDB.TokenFile != "" {
+		files = append(files, config.InfluxDB.TokenFile)
+	}
+	return files
+}
+
+// watchSecretFiles signals on the returned channel once the given files have
+// changed and settled, until ctx is cancelled. The directories holding the
+// files are watched rather than the files themselves, since Kubernetes
+// rotates a mounted secret by swapping a symlink, which a watch on the old
+// file would never see.
+func watchSecretFiles(ctx context.Context, files []string) (<-chan struct{}, error) {
+	changed := make(chan struct{}, 1)
+	if len(files) == 0 {
+		return changed, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		err = watcher.Add(dir)
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		dirs[dir] = true
+	}
+
+	go func() {
+		defer watcher.Close()
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-watcher.Events:
+				settle = time.After(secretSettle)
+			case err := <-watcher.Errors:
+				log.WithFields(log.Fields{
+					"op":    "main.watchSecretFiles",
+					"error": err,
+				}).Warn("error watching secret files")
+			case <-settle:
+				settle = nil
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed, nil
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// serviceContext returns ctx unchanged; only Windows has services to run as
+func serviceContext(ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+// serviceStopped does nothing outside Windows
+func serviceStopped(exitCode int) {
+}
+
+// manageService fails outside Windows, where a service manager such as
+// systemd runs the collector instead
+func manageService(args []string) error {
+	return errors.New("the service subcommand manages a Windows service and is only available on Windows; use systemd or another service manager instead")
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	serviceName        = "sleepnumber-stats-collector"
+	serviceDisplayName = "Sleep Number stats collector"
+	serviceDescription = "Collects Sleep Number bed data from SleepIQ and writes it to InfluxDB."
+)
+
+// serviceStopTimeout bounds waiting for the service to stop on uninstall
+const serviceStopTimeout = 30 * time.Second
+
+// service is set while running under the Windows service control manager
+var service *serviceHandler
+
+// serviceHandler relays stop requests from the service control manager to
+// the collector and reports back once it has shut down
+type serviceHandler struct {
+	cancel   context.CancelFunc
+	stopped  chan uint32
+	finished chan struct{}
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case exitCode := <-h.stopped:
+			return false, exitCode
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				h.cancel()
+			}
+		}
+	}
+}
+
+// serviceContext returns a context cancelled when the service control
+// manager asks the service to stop, if running as a Windows service, and
+// sends the log to the Windows event log as well
+func serviceContext(ctx context.Context) (context.Context, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return ctx, err
+	}
+
+	events, err := eventlog.Open(serviceName)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to open the event log, %s", err)
+	}
+	log.AddHook(&eventLogHook{events: events})
+	// Report the exit code of a fatal error, which skips the usual shutdown
+	log.RegisterExitHandler(func() {
+		serviceStopped(1)
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	service = &serviceHandler{
+		cancel:   cancel,
+		stopped:  make(chan uint32),
+		finished: make(chan struct{}),
+	}
+	go func() {
+		defer close(service.finished)
+		err := svc.Run(serviceName, service)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "main.serviceContext",
+				"error": err,
+			}).Error("failed to run as a Windows service")
+			cancel()
+		}
+	}()
+	return ctx, nil
+}
+
+// serviceStopped reports to the service control manager that the collector
+// has shut down with the given exit code
+func serviceStopped(exitCode int) {
+	if service == nil {
+		return
+	}
+	select {
+	case service.stopped <- uint32(exitCode):
+		<-service.finished
+	case <-service.finished:
+	}
+}
+
+// eventLogHook copies log entries of info level and above to the Windows
+// event log
+type eventLogHook struct {
+	events *eventlog.Log
+}
+
+func (h *eventLogHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel, log.InfoLevel}
+}
+
+func (h *eventLogHook) Fire(entry *log.Entry) error {
+	msg, err := entry.String()
+	if err != nil {
+		return err
+	}
+	switch entry.Level {
+	case log.InfoLevel:
+		return h.events.Info(1, msg)
+	case log.WarnLevel:
+		return h.events.Warning(1, msg)
+	}
+	return h.events.Error(1, msg)
+}
+
+// manageService implements the service subcommand, which installs the
+// collector as a Windows service running with the given flags, or
+// uninstalls it
+func manageService(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: sleepnumber-stats-collector service install [-config path] [flags] | service uninstall")
+	}
+
+	switch args[0] {
+	case "install":
+		return installService(args[1:])
+	case "uninstall":
+		return uninstallService()
+	}
+	return fmt.Errorf("unknown service command %s, must be install or uninstall", args[0])
+}
+
+// installService registers the service to start automatically, running the
+// collector with args, and registers its event log source
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the executable, %s", err)
+	}
+
+	// Services start in the system directory, so the config path must be
+	// absolute
+	args, configPath, err := absConfigArgs(args)
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager, %s", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service %s, %s", serviceName, err)
+	}
+	defer s.Close()
+
+	err = eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register the event log source, %s", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Installed service %s using %s; start it with: sc start %s\n", serviceName, configPath, serviceName)
+	return nil
+}
+
+// absConfigArgs makes the -config flag in args absolute, adding one for
+// config.yaml in the working directory if there is none, and returns the
+// updated args along with the config path
+func absConfigArgs(args []string) ([]string, string, error) {
+	updated := make([]string, 0, len(args)+2)
+	configPath := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			updated = append(updated, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, "", errors.New("flag needs an argument: -config")
+			}
+			i++
+			value = args[i]
+		}
+		configPath = value
+	}
+	if configPath == "" {
+		configPath = "config.yaml"
+	}
+
+	abs, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve %s, %s", configPath, err)
+	}
+	return append([]string{"-config", abs}, updated...), abs, nil
+}
+
+// uninstallService stops the service if it is running, then removes it and
+// its event log source
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager, %s", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed, %s", serviceName, err)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err == nil {
+		deadline := time.Now().Add(serviceStopTimeout)
+		for status.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(500 * time.Millisecond)
+			status, err = s.Query()
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	err = s.Delete()
+	if err != nil {
+		return fmt.Errorf("failed to delete service %s, %s", serviceName, err)
+	}
+	err = eventlog.Remove(serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to remove the event log source, %s", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Uninstalled service %s\n", serviceName)
+	return nil
+}
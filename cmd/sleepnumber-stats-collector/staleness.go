@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// stalenessCheckInterval is how often the last writes are checked
+const stalenessCheckInterval = time.Minute
+
+// stalenessThreshold is how long a measurement may go unwritten: the
+// configured factor times the longest interval
+func stalenessThreshold(config *config.Configuration) time.Duration {
+	return time.Duration(config.Staleness.Factor) * longestInterval(config)
+}
+
+// longestInterval is the longest interval any account polls or, with delta
+// enabled, rewrites unchanged points at; sleep sessions and firmware are left
+// out, since sessions are only written once a night however often they are
+// polled, and firmware is only checked daily
+func longestInterval(config *config.Configuration) time.Duration {
+	longest := config.Adaptive.MaxInterval
+	if config.Delta.Enabled && config.Delta.Heartbeat > longest {
+		longest = config.Delta.Heartbeat
+	}
+	for _, account := range config.SleepIQAccounts() {
+		for _, interval := range []time.Duration{
+			account.PollInterval,
+			account.PollIntervals.FamilyStatus,
+			account.PollIntervals.Foundation,
+			account.PollIntervals.FootWarmer,
+			account.PollIntervals.Pump,
+			account.PollIntervals.Climate,
+		} {
+			if interval > longest {
+				longest = interval
+			}
+		}
+	}
+	return longest
+}
+
+// watchStaleness logs a warning once a sink has gone threshold without
+// writing a measurement it wrote before, and again once it writes it once
+// more, so silent failures show up in the log
+func watchStaleness(ctx context.Context, threshold time.Duration, ignore []string) {
+	ignored := make(map[string]bool, len(ignore))
+	for _, measurement := range ignore {
+		ignored[measurement] = true
+	}
+	stale := make(map[[2]string]bool)
+
+	ticker := time.NewTicker(stalenessCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, write := range metrics.LastWrites() {
+				if ignored[write.Measurement] {
+					continue
+				}
+				key := [2]string{write.Sink, write.Measurement}
+				age := now.Sub(write.Time)
+				fields := log.Fields{
+					"op":          "main.watchStaleness",
+					"sink":        write.Sink,
+					"measurement": write.Measurement,
+					"lastWrite":   write.Time.Format(time.RFC3339),
+				}
+				if age > threshold && !stale[key] {
+					stale[key] = true
+					fields["age"] = age.Round(time.Second).String()
+					log.WithFields(fields).Warn("measurement has not been written recently, its data is stale")
+				} else if age <= threshold && stale[key] {
+					delete(stale, key)
+					log.WithFields(fields).Info("measurement is being written again")
+				}
+			}
+		}
+	}
+}
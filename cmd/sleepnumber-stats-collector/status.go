@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/status"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"sync/atomic"
+	"time"
+)
+
+// statusErrors is how many recent warnings and errors the status page shows
+const statusErrors = 20
+
+// statusReport gathers what the status page shows from the collectors, the
+// sinks currently in use, and what has been published and logged
+func statusReport(version string, accounts []config.Account, collectors []*collector.Collector, polling *atomic.Bool, r *reloader, latest *status.Latest, recent *status.RecentErrors) func(ctx context.Context) status.Report {
+	started := time.Now()
+	return func(ctx context.Context) status.Report {
+		report := status.Report{
+			Version: version,
+			Started: started,
+			Latest:  latest.Groups(),
+			Errors:  recent.Entries(),
+		}
+		for i, c := range collectors {
+			report.Accounts = append(report.Accounts, status.Account{
+				Name:    accountName(accounts[i]),
+				Standby: !polling.Load(),
+				Health:  c.Health(),
+			})
+		}
+		for _, s := range r.outputs().sinks {
+			report.Sinks = append(report.Sinks, status.Sink{
+				Name: s.Name(),
+				Err:  s.Check(ctx),
+			})
+		}
+		return report
+	}
+}
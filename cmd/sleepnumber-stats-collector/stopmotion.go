@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"net/http"
+	"time"
+)
+
+// stopMotionTimeout bounds stopping motion, covering finding the beds of
+// every account and stopping both sides of each
+const stopMotionTimeout = 30 * time.Second
+
+// stopMotionHandler returns the handler of /stop-motion, authorized by
+// http.controlToken, stopping the beds of accounts; the func returned closes
+// the audit log
+func stopMotionHandler(config *config.Configuration, accounts []control.Account) (http.Handler, func(), error) {
+	actions, closeAudit, err := openAudit(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := func(ctx context.Context, bed, client string) error {
+		ctx, cancel := context.WithTimeout(ctx, stopMotionTimeout)
+		defer cancel()
+		return control.StopMotion(ctx, accounts, bed, actions, audit.Origin{Source: audit.SourceHTTP, Client: client})
+	}
+	return control.StopMotionHandler(stop, config.HTTP.ControlToken), closeAudit, nil
+}
+
+// mqttStopMotion returns the func the MQTT sink stops the beds of accounts
+// through. The sink comes and goes with reloads, so the audit log is opened
+// for each command rather than held open.
+func mqttStopMotion(config *config.Configuration, accounts []control.Account) sink.StopMotion {
+	return func(ctx context.Context, bed, client string) error {
+		actions, closeAudit, err := openAudit(config)
+		if err != nil {
+			return err
+		}
+		defer closeAudit()
+		ctx, cancel := context.WithTimeout(ctx, stopMotionTimeout)
+		defer cancel()
+		return control.StopMotion(ctx, accounts, bed, actions, audit.Origin{Source: audit.SourceMQTT, Client: client})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/bus"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/stream"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+)
+
+// streamPoints subscribes to points and broadcasts each to the clients of
+// the event stream, closing them once the bus closes
+func streamPoints(points *bus.Bus) (*stream.Broadcaster[collector.Point], error) {
+	sub, err := points.Subscribe("events", 0, "")
+	if err != nil {
+		return nil, err
+	}
+	b := stream.NewBroadcaster[collector.Point]()
+	go func() {
+		defer b.Close()
+		for p := range sub.Points() {
+			b.Send(p)
+		}
+	}()
+	return b, nil
+}
+
+// streamState subscribes to points and broadcasts every version of the state
+// document built from them to the clients of the state stream, closing them
+// once the bus closes, and returns a func giving the latest version; tags
+// are read under names
+func streamState(points *bus.Bus, names schema.Names) (*stream.Broadcaster[[]byte], func() []byte, error) {
+	sub, err := points.Subscribe("state", 0, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	b := stream.NewBroadcaster[[]byte]()
+	doc := sink.NewStateDocument(names, b.Send)
+	go func() {
+		defer b.Close()
+		defer doc.Close()
+		for p := range sub.Points() {
+			doc.Update(p)
+		}
+	}()
+	return b, doc.Latest, nil
+}
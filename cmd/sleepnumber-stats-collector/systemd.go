@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/systemd"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"sync/atomic"
+	"time"
+)
+
+// notifySystemd sends state to systemd when running as a Type=notify unit
+func notifySystemd(state string) {
+	_, err := systemd.Notify(state)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main.notifySystemd",
+			"error": err,
+		}).Warn("failed to notify systemd")
+	}
+}
+
+// feedWatchdog pings the systemd watchdog every interval until ctx is
+// cancelled, but only while no poll loop is stalled, so systemd restarts the
+// service if one hangs
+func feedWatchdog(ctx context.Context, interval time.Duration, accounts []config.Account, collectors []*collector.Collector, polling *atomic.Bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stalled := false
+			if polling.Load() {
+				for i, c := range collectors {
+					if c.Health().Stalled(now) {
+						stalled = true
+						log.WithFields(log.Fields{
+							"op":      "main.feedWatchdog",
+							"account": accounts[i].Name,
+						}).Error("poll loop stalled, withholding watchdog ping so systemd restarts the service")
+					}
+				}
+			}
+			if !stalled {
+				notifySystemd("WATCHDOG=1")
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	influxAPI "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/report"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/status"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/telegram"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// lastNightWindow is how far back to look for last night's sessions,
+	// enough to cover a night from its evening even when asked late
+	lastNightWindow = 36 * time.Hour
+	telegramTimeout = time.Minute
+)
+
+const telegramHelp = `/inbed - who's in bed
+/lastnight - how long everyone slept last night
+/sleepnumber [bed] <left|right> <5-100> - set a sleep number
+/preset [bed] <left|right> <%s> - move the foundation to a preset
+
+The bed can be left out when there is only one.`
+
+// telegramBot answers the Telegram bot's messages from the latest points
+// published, the sessions stored in InfluxDB, and by controlling the beds
+type telegramBot struct {
+	names    schema.Names
+	latest   *status.Latest
+	accounts []control.Account
+	queryAPI influxAPI.QueryAPI
+	actions  *audit.Log
+}
+
+// runTelegram answers the Telegram bot's messages until ctx is cancelled,
+// telling who's in bed from latest and controlling the beds of accounts
+func runTelegram(ctx context.Context, config *config.Configuration, latest *status.Latest, accounts []control.Account) {
+	fail := func(err error) {
+		log.WithFields(log.Fields{
+			"op":    "main.runTelegram",
+			"error": err,
+		}).Error("not running the Telegram bot")
+	}
+	actions, closeAudit, err := openAudit(config)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer closeAudit()
+
+	t := &telegramBot{
+		names:    schema.FromConfig(config),
+		latest:   latest,
+		accounts: accounts,
+		actions:  actions,
+	}
+	if config.InfluxDB.Address != "" {
+		influxConfig := config.InfluxDB
+		client, _, err := sink.InfluxConnect(&influxConfig)
+		if err != nil {
+			fail(err)
+			return
+		}
+		defer client.Close()
+		t.queryAPI = client.QueryAPI(influxConfig.Organization)
+	}
+
+	log.WithFields(log.Fields{
+		"op":    "main.runTelegram",
+		"chats": config.Telegram.ChatIDs,
+	}).Info("running the Telegram bot")
+	telegram.New(config.Telegram.Token, config.Telegram.ChatIDs, t.answer).Run(ctx)
+}
+
+// answer answers a command, or a question such as "who's in bed?"
+func (t *telegramBot) answer(ctx context.Context, msg telegram.Message) string {
+	command, args, _ := strings.Cut(strings.TrimSpace(msg.Text), " ")
+	// Commands in group chats may name the bot they're for
+	command, _, _ = strings.Cut(strings.ToLower(command), "@")
+	text := strings.ToLower(msg.Text)
+	ctx, cancel := context.WithTimeout(ctx, telegramTimeout)
+	defer cancel()
+
+	switch {
+	case command == "/inbed" || strings.Contains(text, "in bed"):
+		return t.inBed()
+	case command == "/lastnight" || strings.Contains(text, "last night"):
+		return t.lastNight(ctx)
+	case command == "/sleepnumber":
+		return t.setSleepNumber(ctx, msg, args)
+	case command == "/preset":
+		return t.setPreset(ctx, msg, args)
+	}
+	return fmt.Sprintf(telegramHelp, strings.Join(control.PresetNames(), "|"))
+}
+
+// inBed tells who is in bed as of the latest poll
+func (t *telegramBot) inBed() string {
+	measurement := t.names.Renamed("bed_sleeper_state")
+	var lines []string
+	for _, group := range t.latest.Groups() {
+		for _, p := range group.Points {
+			if p.Measurement != measurement {
+				continue
+			}
+			bed := p.Tags[t.names.Tag("name")]
+			if account := p.Tags[t.names.Tag("account")]; account != "" {
+				bed = account + "/" + bed
+			}
+			var sides []string
+			for _, side := range []string{"left", "right"} {
+				occupied := fmt.Sprint(p.Fields[t.names.Field("bed_sleeper_state", side+"_sleeper_is_in_bed")])
+				state := "out of bed"
+				if occupied == "1" || occupied == "true" {
+					state = "in bed"
+				}
+				if number, ok := p.Fields[t.names.Field("bed_sleeper_state", side+"_sleep_number")]; ok {
+					state += fmt.Sprintf(", sleep number %v", number)
+				}
+				sides = append(sides, fmt.Sprintf("  %s: %s", side, state))
+			}
+			lines = append(lines, fmt.Sprintf("%s, as of %s\n%s", bed, p.Time.Local().Format("15:04"), strings.Join(sides, "\n")))
+		}
+	}
+	if len(lines) == 0 {
+		return "No beds have been polled yet."
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n\n")
+}
+
+// lastNight tells how long each sleeper slept on their latest night; SleepIQ
+// scores aren't collected, so the time in bed stands in for them
+func (t *telegramBot) lastNight(ctx context.Context) string {
+	if t.queryAPI == nil {
+		return "Sessions are read back from InfluxDB, and influxDB.address is not set."
+	}
+	end := time.Now()
+	start := end.Add(-lastNightWindow)
+	samples, err := sleep.Query(ctx, t.queryAPI, t.names, start, end)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "main.lastNight",
+			"error": err,
+		}).Warn("failed to query sleep sessions")
+		return "Failed to query sleep sessions: " + err.Error()
+	}
+	sessions := sleep.Sessions(samples, sleep.DefaultMinDuration, sleep.DefaultMergeGap)
+	summary := report.Summarize(sessions, start, end, time.Local)
+	var lines []string
+	for _, sleeper := range summary.Sleepers {
+		n := sleeper.Nights[len(sleeper.Nights)-1]
+		lines = append(lines, fmt.Sprintf("%s %s: %s to %s, %dh%02dm in bed", sleeper.Bed, sleeper.Side,
+			n.Bedtime.Format("15:04"), n.Wake.Format("15:04"), int(n.Duration.Hours()), int(n.Duration.Minutes())%60))
+	}
+	if len(lines) == 0 {
+		return "No one slept in a bed last night."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setSleepNumber handles /sleepnumber [bed] <side> <number>
+func (t *telegramBot) setSleepNumber(ctx context.Context, msg telegram.Message, args string) string {
+	bed, side, value, ok := controlArgs(args)
+	if !ok {
+		return "Usage: /sleepnumber [bed] <left|right> <5-100>"
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Sprintf("%q is not a sleep number.", value)
+	}
+	err = control.SetSleepNumber(ctx, t.accounts, bed, side, number, t.actions, telegramOrigin(msg))
+	if err != nil {
+		return "Failed: " + err.Error()
+	}
+	return fmt.Sprintf("Set the %s side to %d.", side, number)
+}
+
+// setPreset handles /preset [bed] <side> <preset>
+func (t *telegramBot) setPreset(ctx context.Context, msg telegram.Message, args string) string {
+	bed, side, preset, ok := controlArgs(args)
+	if !ok {
+		return fmt.Sprintf("Usage: /preset [bed] <left|right> <%s>", strings.Join(control.PresetNames(), "|"))
+	}
+	err := control.SetPreset(ctx, t.accounts, bed, side, strings.ToLower(preset), t.actions, telegramOrigin(msg))
+	if err != nil {
+		return "Failed: " + err.Error()
+	}
+	return fmt.Sprintf("Moving the %s side to %s.", side, strings.ToLower(preset))
+}
+
+// controlArgs splits the arguments of a control command into the bed name,
+// which may have spaces or be left out, the side, and the value
+func controlArgs(args string) (bed, side, value string, ok bool) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return "", "", "", false
+	}
+	n := len(fields)
+	return strings.Join(fields[:n-2], " "), strings.ToLower(fields[n-2]), fields[n-1], true
+}
+
+// telegramOrigin is the origin of control actions asked for in msg, naming
+// the sender, or the chat if they have no username
+func telegramOrigin(msg telegram.Message) audit.Origin {
+	client := msg.Username
+	if client == "" {
+		client = strconv.FormatInt(msg.ChatID, 10)
+	}
+	return audit.Origin{Source: audit.SourceTelegram, Client: client}
+}
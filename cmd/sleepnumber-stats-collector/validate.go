@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sink"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const validateTimeout = 30 * time.Second
+
+// validateConfig checks the config file, listing every invalid setting, then
+// the InfluxDB connection and a test login to every SleepIQ account,
+// printing the result of each check; it reports whether all of them passed
+func validateConfig(ctx context.Context, path string, overrides map[string]string) bool {
+	passed := true
+	check := func(what string, err error) {
+		if err != nil {
+			passed = false
+			fmt.Fprintf(os.Stdout, "FAIL  %s: %s\n", what, err)
+			return
+		}
+		fmt.Fprintf(os.Stdout, "ok    %s\n", what)
+	}
+
+	what := "parse " + path
+	if path == "" {
+		what = "parse environment"
+	}
+	config, _, err := loadConfiguration(path, overrides)
+	if err != nil {
+		errs := []error{err}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = flattenErrors(joined.Unwrap())
+		}
+		for _, err := range errs {
+			check(what, err)
+		}
+		return false
+	}
+	check(what, nil)
+
+	if config.InfluxDB.Address != "" {
+		ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+		check("InfluxDB at "+config.InfluxDB.Address, sink.CheckInfluxDB(ctx, &config.InfluxDB))
+		cancel()
+	}
+	for _, plugin := range config.Plugins {
+		_, err := exec.LookPath(plugin.Command)
+		if err != nil {
+			err = fmt.Errorf("command %s not found, %s", plugin.Command, err)
+		}
+		check(fmt.Sprintf("plugin %s", plugin.Name), err)
+	}
+
+	accounts := config.SleepIQAccounts()
+	for _, account := range accounts {
+		if account.Password == "" {
+			check(fmt.Sprintf("SleepIQ account %q settings", account.Username), fmt.Errorf("no password set; set one in the config, or enable keyring and save one with -login -save"))
+		}
+	}
+
+	if !passed {
+		// Don't try logging in with settings already known to be broken
+		return false
+	}
+
+	api, err := sleepIQOptions(config)
+	check("SleepIQ client settings", err)
+	if err != nil {
+		return false
+	}
+	for _, account := range accounts {
+		ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+		err = sleepiq.New(api).Login(ctx, account.Username, account.Password)
+		cancel()
+		check(fmt.Sprintf("SleepIQ login as %q", account.Username), loginHint(err))
+	}
+
+	return passed
+}
+
+// loginHint adds what to do next to common login failures
+func loginHint(err error) error {
+	if errors.Is(err, sleepiq.ErrCredentialsRejected) {
+		return fmt.Errorf("%s; check the username and password", err)
+	}
+	switch sleepiq.Classify(err) {
+	case sleepiq.ClassNone:
+		return nil
+	case sleepiq.ClassFatal:
+		return fmt.Errorf("%s; if the account uses two-factor authentication, enable sleepIQClient.tokenAuth and run with -login", err)
+	}
+	return fmt.Errorf("%s; check network access to the SleepIQ API and any proxy settings", err)
+}
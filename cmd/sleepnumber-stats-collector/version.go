@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at build time with
+//
+//	-ldflags "-X main.version=v1.2.3 -X main.commit=abc1234 -X main.date=2024-01-02T15:04:05Z"
+//
+// and otherwise filled in from what the Go toolchain embeds, such as by go
+// install
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo returns the version, commit, and build date of this binary,
+// falling back to the module version and VCS details embedded by the Go
+// toolchain for anything not set at build time
+func buildInfo() (string, string, string) {
+	v, c, d := version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		settings := make(map[string]string)
+		for _, setting := range info.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		if c == "" && settings["vcs.revision"] != "" {
+			c = settings["vcs.revision"]
+			if settings["vcs.modified"] == "true" {
+				c += "-dirty"
+			}
+		}
+		if d == "" {
+			d = settings["vcs.time"]
+		}
+	}
+	if v == "" {
+		v = "dev"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return v, c, d
+}
+
+// versionString describes the build for -version
+func versionString() string {
+	v, c, d := buildInfo()
+	return fmt.Sprintf("sleepnumber-stats-collector %s (commit %s, built %s, %s %s/%s)", v, c, d, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/control"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/status"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/voice"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// voiceTimeout bounds setting a sleep number, well within how long the
+// assistants wait for an answer
+const voiceTimeout = 7 * time.Second
+
+// voiceBackend presents each side of the beds in the latest points to voice
+// assistants, and sets sleep numbers through SleepIQ
+type voiceBackend struct {
+	names    schema.Names
+	latest   *status.Latest
+	accounts []control.Account
+	actions  *audit.Log
+}
+
+// voiceHandlers returns the handlers of the Alexa and Google Home webhooks,
+// telling occupancy from latest and setting sleep numbers through accounts;
+// the func returned closes the audit log
+func voiceHandlers(config *config.Configuration, latest *status.Latest, accounts []control.Account) (alexa, google http.Handler, close func(), err error) {
+	actions, closeAudit, err := openAudit(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b := &voiceBackend{
+		names:    schema.FromConfig(config),
+		latest:   latest,
+		accounts: accounts,
+		actions:  actions,
+	}
+	return voice.AlexaHandler(b, config.HTTP.VoiceToken), voice.GoogleHandler(b, config.HTTP.VoiceToken), closeAudit, nil
+}
+
+// Devices lists both sides of every bed polled so far
+func (b *voiceBackend) Devices() []voice.Device {
+	measurement := b.names.Renamed("bed_sleeper_state")
+	var devices []voice.Device
+	for _, group := range b.latest.Groups() {
+		for _, p := range group.Points {
+			if p.Measurement != measurement {
+				continue
+			}
+			bed := p.Tags[b.names.Tag("name")]
+			account := p.Tags[b.names.Tag("account")]
+			for _, side := range []string{"left", "right"} {
+				occupied := fmt.Sprint(p.Fields[b.names.Field("bed_sleeper_state", side+"_sleeper_is_in_bed")])
+				number, _ := strconv.Atoi(fmt.Sprint(p.Fields[b.names.Field("bed_sleeper_state", side+"_sleep_number")]))
+				devices = append(devices, voice.Device{
+					ID:          voice.DeviceID(account, bed, side),
+					Name:        bed + " " + side,
+					Bed:         bed,
+					Side:        side,
+					Occupied:    occupied == "1" || occupied == "true",
+					SleepNumber: number,
+					Time:        p.Time,
+				})
+			}
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+	return devices
+}
+
+// SetSleepNumber sets the sleep number of d, recording it as asked for by
+// client, the assistant
+func (b *voiceBackend) SetSleepNumber(ctx context.Context, d voice.Device, number int, client string) error {
+	if number < voice.MinSleepNumber || number > voice.MaxSleepNumber || number%voice.SleepNumberStep != 0 {
+		return voice.ErrOutOfRange
+	}
+	ctx, cancel := context.WithTimeout(ctx, voiceTimeout)
+	defer cancel()
+	return control.SetSleepNumber(ctx, b.accounts, d.Bed, d.Side, number, b.actions, audit.Origin{Source: audit.SourceVoice, Client: client})
+}
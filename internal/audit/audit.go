@@ -0,0 +1,133 @@
+// Package audit records every control action taken on a bed, with who or
+// what asked for it, to a dedicated log and optionally as points.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sources of control actions
+const (
+	SourceCLI      = "cli"
+	SourceTelegram = "telegram"
+	SourceVoice    = "voice"
+	SourceGRPC     = "grpc"
+	SourceHTTP     = "http"
+	SourceMQTT     = "mqtt"
+	SourceHomeKit  = "homekit"
+)
+
+// Origin is who or what asked for a control action
+type Origin struct {
+	// Source is how the action was asked for, such as cli, and Client who
+	// or what asked, such as the user running the command
+	Source string `json:"source"`
+	Client string `json:"client,omitempty"`
+}
+
+// Action is a control action taken on a bed
+type Action struct {
+	Time time.Time `json:"time"`
+	// Action names what was done, such as stop_motion
+	Action string `json:"action"`
+	Origin
+	// Account and BedID are the bed acted on
+	Account string `json:"account,omitempty"`
+	BedID   string `json:"bedId"`
+	// Params holds the settings of the action, such as the side of the bed
+	Params map[string]interface{} `json:"params,omitempty"`
+	// Error is why the action failed, or empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// Log appends actions to a file as one JSON object per line and, if it has
+// a sink, writes each as a control_action point
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	sink collector.Sink
+}
+
+// Open returns a Log appending to path, if set, and writing points to sink,
+// if not nil
+func Open(path string, sink collector.Sink) (*Log, error) {
+	l := &Log{sink: sink}
+	if path != "" {
+		var err error
+		l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log %s, %s", path, err)
+		}
+	}
+	return l, nil
+}
+
+// Record logs action, with err as its outcome; a nil Log records nothing
+func (l *Log) Record(ctx context.Context, action Action, err error) error {
+	if l == nil {
+		return nil
+	}
+	if action.Time.IsZero() {
+		action.Time = time.Now()
+	}
+	if err != nil {
+		action.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		line, err := json.Marshal(action)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit entry, %s", err)
+		}
+		_, err = l.file.Write(append(line, '\n'))
+		if err != nil {
+			return fmt.Errorf("failed to write audit log, %s", err)
+		}
+	}
+	if l.sink != nil {
+		l.sink.Write(ctx, point(action))
+	}
+	return nil
+}
+
+// point is the control_action point of action, tagged with what was done to
+// which bed and from where
+func point(action Action) collector.Point {
+	fields := map[string]interface{}{
+		"success": collector.BoolToInt(action.Error == ""),
+		"client":  action.Client,
+	}
+	if action.Error != "" {
+		fields["error"] = action.Error
+	}
+	for k, v := range action.Params {
+		fields[k] = v
+	}
+	return collector.Point{
+		Measurement: "control_action",
+		Tags: map[string]string{
+			"action":  action.Action,
+			"source":  action.Source,
+			"account": action.Account,
+			"bed_id":  action.BedID,
+		},
+		Fields: fields,
+		Time:   action.Time,
+	}
+}
+
+// Close closes the audit log file
+func (l *Log) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
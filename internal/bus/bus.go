@@ -0,0 +1,342 @@
+// Package bus is the in-process publish/subscribe hub between collectors and
+// everything that consumes their points.
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultBuffer = 1024
+
+// What happens to a point published while a subscriber's feed is full
+const (
+	// OverflowBlock waits for room, pushing back on collection
+	OverflowBlock = "block"
+	// OverflowDropOldest drops the oldest queued point to make room
+	OverflowDropOldest = "drop-oldest"
+	// OverflowDropNewest drops the point being published
+	OverflowDropNewest = "drop-newest"
+)
+
+// Bus delivers every published point to each subscriber. It is a
+// collector.Sink, so collectors publish by writing to it, and new consumers
+// subscribe without any change to the poll loop.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   []*Subscription
+	closed bool
+}
+
+// Subscription is one consumer's feed of points
+type Subscription struct {
+	name     string
+	ch       chan collector.Point
+	done     chan struct{}
+	once     sync.Once
+	overflow string
+
+	// dropping is set while points are being dropped for a full feed, so
+	// that is logged once rather than for every point
+	dropping atomic.Bool
+
+	// spool holds points while the feed is full, moved back into the feed
+	// by the pump goroutine
+	spool      *spool
+	pumpQuit   chan struct{}
+	pumpExited chan struct{}
+}
+
+// New returns an empty Bus
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a consumer whose feed buffers up to buffer points;
+// buffer defaults to 1024. Once the feed is full, publishing blocks until the
+// consumer catches up, unless spillDir is set, in which case further points
+// are spilled to a file there and fed back as the consumer frees up room.
+func (b *Bus) Subscribe(name string, buffer int, spillDir string) (*Subscription, error) {
+	s, err := newSubscription(Spec{Name: name, Buffer: buffer, SpillDir: spillDir, Overflow: OverflowBlock})
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		s.stop()
+		return s, nil
+	}
+	b.subs = append(b.subs, s)
+	return s, nil
+}
+
+// Spec describes a subscription for Replace, with the same meaning as the
+// arguments of Subscribe, along with what happens to points published while
+// the feed is full and nothing is spilled: one of the Overflow policies,
+// defaulting to OverflowBlock
+type Spec struct {
+	Name     string
+	Buffer   int
+	SpillDir string
+	Overflow string
+}
+
+// Replace swaps the old subscriptions for new ones in one step, with
+// publishing paused in between so no point is missed. The old feeds are
+// closed once their queued points are consumed, and any old spill file is
+// taken over by the new subscription of the same name. The result lines up
+// with specs, holding nil for subscriptions that failed, which are reported
+// in the error.
+func (b *Bus) Replace(old []*Subscription, specs []Spec) ([]*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, s := range old {
+		for i, sub := range b.subs {
+			if sub == s {
+				b.subs = append(b.subs[:i], b.subs[i+1:]...)
+				s.stop()
+				break
+			}
+		}
+	}
+
+	subs := make([]*Subscription, len(specs))
+	var errs []error
+	for i, spec := range specs {
+		s, err := newSubscription(spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to subscribe %s, %w", spec.Name, err))
+			continue
+		}
+		if b.closed {
+			s.stop()
+		} else {
+			b.subs = append(b.subs, s)
+		}
+		subs[i] = s
+	}
+	return subs, errors.Join(errs...)
+}
+
+func newSubscription(spec Spec) (*Subscription, error) {
+	buffer := spec.Buffer
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+	s := &Subscription{
+		name:     spec.Name,
+		ch:       make(chan collector.Point, buffer),
+		done:     make(chan struct{}),
+		overflow: spec.Overflow,
+	}
+	if spec.SpillDir != "" {
+		var err error
+		s.spool, err = openSpool(spec.SpillDir, spec.Name)
+		if err != nil {
+			return nil, err
+		}
+		s.pumpQuit = make(chan struct{})
+		s.pumpExited = make(chan struct{})
+		go s.pump()
+	}
+	return s, nil
+}
+
+// Unsubscribe stops delivery to s and closes its feed
+func (b *Bus) Unsubscribe(s *Subscription) {
+	// Release any Write blocked on this subscriber before taking the lock
+	s.once.Do(func() { close(s.done) })
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, sub := range b.subs {
+		if sub == s {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			s.stop()
+			return
+		}
+	}
+}
+
+// Write publishes a point to every subscriber, waiting for room in each feed
+// so consumers apply backpressure, spilling it for subscribers with a spill
+// file, or dropping a point for subscribers with a drop policy; the point is
+// dropped for a subscriber if ctx is cancelled first
+func (b *Bus) Write(ctx context.Context, p collector.Point) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+
+	for _, s := range b.subs {
+		if s.spool != nil {
+			s.spill(p)
+			continue
+		}
+		if s.overflow == OverflowDropOldest || s.overflow == OverflowDropNewest {
+			s.offer(p)
+			continue
+		}
+		select {
+		case s.ch <- p:
+		case <-s.done:
+		case <-ctx.Done():
+			metrics.Dropped(s.name, 1)
+			log.WithFields(log.Fields{
+				"op":          "bus.Write",
+				"subscriber":  s.name,
+				"measurement": p.Measurement,
+			}).Warn("dropped point for subscriber during shutdown")
+		}
+	}
+}
+
+// Close closes every subscriber's feed once the points already queued are
+// consumed; publishing after Close is a no-op
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, s := range b.subs {
+		s.stop()
+	}
+	b.subs = nil
+}
+
+// Name returns the name the subscriber registered with
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// Len returns the number of points waiting in the feed, not counting any
+// spilled to disk
+func (s *Subscription) Len() int {
+	return len(s.ch)
+}
+
+// Points returns the feed, which is closed on Unsubscribe or Bus.Close
+func (s *Subscription) Points() <-chan collector.Point {
+	return s.ch
+}
+
+// offer queues p without waiting, dropping the oldest queued point or p
+// itself, according to the overflow policy, while the feed is full
+func (s *Subscription) offer(p collector.Point) {
+	full := false
+	for {
+		select {
+		case s.ch <- p:
+			if !full {
+				s.dropping.Store(false)
+			}
+			return
+		default:
+		}
+
+		dropped := p
+		if s.overflow == OverflowDropOldest {
+			select {
+			case dropped = <-s.ch:
+			default:
+				// The consumer just made room
+				continue
+			}
+		}
+		full = true
+		metrics.Dropped(s.name, 1)
+		if !s.dropping.Swap(true) {
+			log.WithFields(log.Fields{
+				"op":          "bus.Write",
+				"subscriber":  s.name,
+				"policy":      s.overflow,
+				"measurement": dropped.Measurement,
+			}).Warn("queue for subscriber is full, dropping points until it catches up")
+		}
+		if s.overflow == OverflowDropNewest {
+			return
+		}
+	}
+}
+
+// spill sends p straight to the feed while nothing is spilled and the feed
+// has room, and appends it to the spill file otherwise. Points can be
+// delivered slightly out of order around the moment the spill file empties,
+// which time series sinks don't mind since every point carries its time.
+func (s *Subscription) spill(p collector.Point) {
+	if s.spool.empty() {
+		select {
+		case s.ch <- p:
+			return
+		default:
+		}
+	}
+	err := s.spool.push(p)
+	if err != nil {
+		metrics.Dropped(s.name, 1)
+		log.WithFields(log.Fields{
+			"op":          "bus.Write",
+			"subscriber":  s.name,
+			"measurement": p.Measurement,
+			"error":       err,
+		}).Error("dropped point that could not be spilled")
+	}
+}
+
+// pump feeds spilled points back into the feed as the consumer frees up room.
+// A point is only removed from the spill file once it is in the feed, so one
+// waiting for room when the subscription stops stays spilled.
+func (s *Subscription) pump() {
+	defer close(s.pumpExited)
+	logger := log.WithFields(log.Fields{
+		"op":         "bus.pump",
+		"subscriber": s.name,
+	})
+	for {
+		p, ok, err := s.spool.peek()
+		if err != nil {
+			logger.WithField("error", err).Error("failed to read spilled point")
+			continue
+		}
+		if !ok {
+			select {
+			case <-s.pumpQuit:
+				return
+			case <-s.spool.notify:
+			}
+			continue
+		}
+		select {
+		case <-s.pumpQuit:
+			return
+		case s.ch <- p:
+			err = s.spool.remove()
+			if err != nil {
+				logger.WithField("error", err).Error("failed to remove spilled point")
+			}
+		}
+	}
+}
+
+// stop closes the feed, leaving anything still spilled on disk for the next
+// run
+func (s *Subscription) stop() {
+	if s.spool != nil {
+		close(s.pumpQuit)
+		<-s.pumpExited
+		s.spool.close()
+	}
+	close(s.ch)
+}
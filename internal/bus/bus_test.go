@@ -0,0 +1,239 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func point(i int) collector.Point {
+	return collector.Point{
+		Measurement: fmt.Sprintf("m%d", i),
+		Tags:        map[string]string{"name": "Master"},
+		Fields:      map[string]interface{}{"value": int64(i)},
+		Time:        time.Unix(int64(i), 0),
+	}
+}
+
+func TestCloseWhileSpilled(t *testing.T) {
+	tests := []struct {
+		name   string
+		buffer int
+		points int
+	}{
+		{
+			name:   "one point spilled",
+			buffer: 1,
+			points: 2,
+		},
+		{
+			name:   "several points spilled",
+			buffer: 1,
+			points: 5,
+		},
+		{
+			name:   "feed larger than one",
+			buffer: 3,
+			points: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			b := New()
+			s, err := b.Subscribe("sink", test.buffer, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.points; i++ {
+				b.Write(context.Background(), point(i))
+			}
+			// Give the pump time to take up a spilled point and wait for room
+			time.Sleep(50 * time.Millisecond)
+			b.Close()
+
+			seen := make(map[string]bool)
+			for p := range s.Points() {
+				seen[p.Measurement] = true
+			}
+
+			// The points still spilled are replayed by the next run
+			b = New()
+			s, err = b.Subscribe("sink", test.points, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			timeout := time.After(5 * time.Second)
+			for len(seen) < test.points {
+				select {
+				case p := <-s.Points():
+					seen[p.Measurement] = true
+				case <-timeout:
+					b.Close()
+					t.Fatalf("got %d of %d points, want all of them", len(seen), test.points)
+				}
+			}
+			b.Close()
+		})
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow string
+		buffer   int
+		points   int
+		want     []string
+	}{
+		{
+			name:     "drop oldest",
+			overflow: OverflowDropOldest,
+			buffer:   2,
+			points:   4,
+			want:     []string{"m2", "m3"},
+		},
+		{
+			name:     "drop newest",
+			overflow: OverflowDropNewest,
+			buffer:   2,
+			points:   4,
+			want:     []string{"m0", "m1"},
+		},
+		{
+			name:     "room for every point",
+			overflow: OverflowDropOldest,
+			buffer:   4,
+			points:   3,
+			want:     []string{"m0", "m1", "m2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := New()
+			subs, err := b.Replace(nil, []Spec{{Name: "sink", Buffer: test.buffer, Overflow: test.overflow}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.points; i++ {
+				b.Write(context.Background(), point(i))
+			}
+			b.Close()
+
+			var got []string
+			for p := range subs[0].Points() {
+				got = append(got, p.Measurement)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		name string
+		// spill sets a spill directory on both subscriptions
+		spill  bool
+		buffer int
+		points int
+	}{
+		{
+			name:   "queued points",
+			buffer: 4,
+			points: 3,
+		},
+		{
+			name:   "spilled points",
+			spill:  true,
+			buffer: 1,
+			points: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := Spec{Name: "sink", Buffer: test.buffer}
+			if test.spill {
+				spec.SpillDir = t.TempDir()
+			}
+			b := New()
+			old, err := b.Replace(nil, []Spec{spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.points; i++ {
+				b.Write(context.Background(), point(i))
+			}
+
+			// Without taking the spill file along, the new subscription
+			// would only see the point published after the swap
+			spec.Buffer = test.points + 1
+			subs, err := b.Replace(old, []Spec{spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Write(context.Background(), point(test.points))
+
+			seen := make(map[string]bool)
+			for p := range old[0].Points() {
+				seen[p.Measurement] = true
+			}
+			timeout := time.After(5 * time.Second)
+			for len(seen) <= test.points {
+				select {
+				case p := <-subs[0].Points():
+					seen[p.Measurement] = true
+				case <-timeout:
+					b.Close()
+					t.Fatalf("got %d of %d points, want all of them", len(seen), test.points+1)
+				}
+			}
+			b.Close()
+		})
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	tests := []struct {
+		name  string
+		spill bool
+	}{
+		{name: "feed"},
+		{name: "spill file", spill: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := ""
+			if test.spill {
+				dir = t.TempDir()
+			}
+			b := New()
+			s, err := b.Subscribe("sink", 1, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Close()
+			b.Write(context.Background(), point(0))
+			if p, ok := <-s.Points(); ok {
+				t.Errorf("got %s after Close, want the feed closed", p.Measurement)
+			}
+
+			// Subscribing to a closed bus hands back a closed feed
+			s, err = b.Subscribe("late", 1, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := <-s.Points(); ok {
+				t.Errorf("got a point on a late subscription, want the feed closed")
+			}
+		})
+	}
+}
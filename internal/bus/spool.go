@@ -0,0 +1,264 @@
+package bus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// spool is a disk-backed FIFO of points for a subscriber that has fallen
+// behind. Points left in it at shutdown are replayed on the next start;
+// since the read position is not saved, some may be delivered twice.
+type spool struct {
+	path string
+
+	mu      sync.Mutex
+	writer  *os.File
+	file    *os.File
+	reader  *bufio.Reader
+	pending int
+	// head is the point peek read from the file, until it is removed
+	head   *collector.Point
+	notify chan struct{}
+}
+
+// spoolRecord is a point as stored on disk, keeping each field's type so
+// integers don't come back as floats
+type spoolRecord struct {
+	Measurement string                `json:"measurement"`
+	Tags        map[string]string     `json:"tags"`
+	Fields      map[string]spoolField `json:"fields"`
+	Time        time.Time             `json:"time"`
+}
+
+type spoolField struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+func openSpool(dir, name string) (*spool, error) {
+	path := filepath.Join(dir, unsafeFileChars.ReplaceAllString(name, "_")+".spool")
+	writer, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill file %s, %s", path, err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to open spill file %s, %s", path, err)
+	}
+
+	s := &spool{
+		path:   path,
+		writer: writer,
+		file:   file,
+		reader: bufio.NewReader(file),
+		notify: make(chan struct{}, 1),
+	}
+
+	// Count what an earlier run left behind so it is replayed first
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		s.pending++
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *spool) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending == 0
+}
+
+func (s *spool) push(p collector.Point) error {
+	record := spoolRecord{
+		Measurement: p.Measurement,
+		Tags:        p.Tags,
+		Fields:      make(map[string]spoolField, len(p.Fields)),
+		Time:        p.Time,
+	}
+	for k, v := range p.Fields {
+		field, err := encodeField(v)
+		if err != nil {
+			return fmt.Errorf("failed to spill field %s, %s", k, err)
+		}
+		record.Fields[k] = field
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.writer.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write spill file %s, %s", s.path, err)
+	}
+	s.pending++
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// peek returns the oldest spilled point, leaving it spilled until remove is
+// called, so a point that can't be delivered before shutdown is replayed on
+// the next start rather than lost
+func (s *spool) peek() (collector.Point, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.head != nil {
+		return *s.head, true, nil
+	}
+	if s.pending == 0 {
+		return collector.Point{}, false, nil
+	}
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		// Start over rather than retrying a file that can't be read
+		lost := s.pending
+		s.pending = 0
+		resetErr := s.reset()
+		if resetErr != nil {
+			err = resetErr
+		}
+		return collector.Point{}, false, fmt.Errorf("discarded %d spilled points, failed to read spill file %s, %s", lost, s.path, err)
+	}
+
+	p, err := decodeRecord(line)
+	if err != nil {
+		resetErr := s.consumed()
+		if resetErr != nil {
+			return collector.Point{}, false, resetErr
+		}
+		return collector.Point{}, false, fmt.Errorf("skipped corrupt spilled point, %s", err)
+	}
+	s.head = &p
+	return p, true, nil
+}
+
+// remove removes the point peek returned, truncating the file once
+// everything in it has been delivered
+func (s *spool) remove() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.head == nil {
+		return nil
+	}
+	s.head = nil
+	return s.consumed()
+}
+
+// consumed counts off a point read from the file; s.mu must be held
+func (s *spool) consumed() error {
+	s.pending--
+	if s.pending == 0 {
+		return s.reset()
+	}
+	return nil
+}
+
+func decodeRecord(line []byte) (collector.Point, error) {
+	var record spoolRecord
+	err := json.Unmarshal(line, &record)
+	if err != nil {
+		return collector.Point{}, err
+	}
+	p := collector.Point{
+		Measurement: record.Measurement,
+		Tags:        record.Tags,
+		Fields:      make(map[string]interface{}, len(record.Fields)),
+		Time:        record.Time,
+	}
+	for k, field := range record.Fields {
+		v, err := decodeField(field)
+		if err != nil {
+			return collector.Point{}, err
+		}
+		p.Fields[k] = v
+	}
+	return p, nil
+}
+
+func (s *spool) reset() error {
+	err := s.writer.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("failed to truncate spill file %s, %s", s.path, err)
+	}
+	_, err = s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	s.reader.Reset(s.file)
+	return nil
+}
+
+func (s *spool) close() {
+	s.writer.Close()
+	s.file.Close()
+}
+
+func encodeField(v interface{}) (spoolField, error) {
+	var kind string
+	switch v := v.(type) {
+	case int, int8, int16, int32, int64:
+		kind = "i"
+	case uint, uint8, uint16, uint32, uint64:
+		kind = "u"
+	case float32, float64:
+		kind = "f"
+	case bool:
+		kind = "b"
+	case string:
+		kind = "s"
+	default:
+		return spoolField{}, fmt.Errorf("unsupported type %T", v)
+	}
+	raw, err := json.Marshal(v)
+	return spoolField{Type: kind, Value: raw}, err
+}
+
+func decodeField(field spoolField) (interface{}, error) {
+	var err error
+	switch field.Type {
+	case "i":
+		var v int64
+		err = json.Unmarshal(field.Value, &v)
+		return v, err
+	case "u":
+		var v uint64
+		err = json.Unmarshal(field.Value, &v)
+		return v, err
+	case "f":
+		var v float64
+		err = json.Unmarshal(field.Value, &v)
+		return v, err
+	case "b":
+		var v bool
+		err = json.Unmarshal(field.Value, &v)
+		return v, err
+	case "s":
+		var v string
+		err = json.Unmarshal(field.Value, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unknown field type %q", field.Type)
+}
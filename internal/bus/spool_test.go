@@ -0,0 +1,217 @@
+package bus
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpoolFieldTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{name: "int", value: 42, want: int64(42)},
+		{name: "int8", value: int8(1), want: int64(1)},
+		{name: "large int64", value: int64(1) << 60, want: int64(1) << 60},
+		{name: "uint64", value: uint64(1) << 63, want: uint64(1) << 63},
+		{name: "float64", value: 0.5, want: 0.5},
+		{name: "whole float64", value: 2.0, want: 2.0},
+		{name: "bool", value: true, want: true},
+		{name: "string", value: "Flat", want: "Flat"},
+		{name: "unsupported", value: []int{1}, wantErr: "unsupported type []int"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := openSpool(t.TempDir(), "sink")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.close()
+
+			err = s.push(collector.Point{
+				Measurement: "m",
+				Fields:      map[string]interface{}{"value": test.value},
+				Time:        time.Unix(1, 0),
+			})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				if !s.empty() {
+					t.Errorf("got a point spilled, want none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, ok, err := s.peek()
+			if err != nil || !ok {
+				t.Fatalf("got %t, %v from peek, want a point", ok, err)
+			}
+			if got := p.Fields["value"]; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v (%T), want %v (%T)", got, got, test.want, test.want)
+			}
+		})
+	}
+}
+
+func TestSpoolOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// pushed are the points pushed before reopening the spool, and
+		// reopened those pushed after
+		pushed   int
+		reopened int
+		// removed is how many points are removed before reopening
+		removed int
+	}{
+		{name: "empty", pushed: 0},
+		{name: "one point", pushed: 1},
+		{name: "several points", pushed: 5},
+		{name: "replayed after restart", pushed: 3, reopened: 2},
+		{name: "partly delivered before restart", pushed: 4, removed: 2, reopened: 1},
+		{name: "all delivered before restart", pushed: 3, removed: 3, reopened: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := openSpool(dir, "sink")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.pushed; i++ {
+				err = s.push(point(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < test.removed; i++ {
+				_, _, err = s.peek()
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = s.remove()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.close()
+
+			s, err = openSpool(dir, "sink")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.close()
+			for i := test.pushed; i < test.pushed+test.reopened; i++ {
+				err = s.push(point(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The file is only truncated once everything in it has been
+			// delivered, so a restart replays the points delivered before it
+			// unless all of them were
+			start := 0
+			if test.removed == test.pushed {
+				start = test.pushed
+			}
+			for i := start; i < test.pushed+test.reopened; i++ {
+				p, ok, err := s.peek()
+				if err != nil || !ok {
+					t.Fatalf("got %t, %v from peek %d, want a point", ok, err, i)
+				}
+				// Peeking again returns the same point until it is removed
+				again, _, _ := s.peek()
+				if again.Measurement != p.Measurement {
+					t.Errorf("got %s on peeking again, want %s", again.Measurement, p.Measurement)
+				}
+				if want := point(i).Measurement; p.Measurement != want {
+					t.Errorf("got %s, want %s", p.Measurement, want)
+				}
+				err = s.remove()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, ok, _ := s.peek(); ok {
+				t.Errorf("got a point left over, want none")
+			}
+			if !s.empty() {
+				t.Errorf("got spool not empty, want it empty")
+			}
+		})
+	}
+}
+
+func TestSpoolCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "corrupt line skipped",
+			content: "not json\n",
+			want:    []string{"m0"},
+		},
+		{
+			name:    "unknown field type skipped",
+			content: `{"measurement":"bad","fields":{"value":{"t":"x","v":1}}}` + "\n",
+			want:    []string{"m0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := openSpool(dir, "sink")
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := s.path
+			s.close()
+			err = os.WriteFile(path, []byte(test.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = openSpool(dir, "sink")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.close()
+			err = s.push(point(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for i := 0; i < 5; i++ {
+				p, ok, err := s.peek()
+				if err != nil {
+					continue
+				}
+				if !ok {
+					break
+				}
+				got = append(got, p.Measurement)
+				err = s.remove()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,628 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Configuration represents a YAML, TOML, or JSON config file, optionally
+// encrypted with age or sops
+type Configuration struct {
+	SleepIQUsername     string
+	SleepIQPassword     string
+	SleepIQPasswordFile string
+	Keyring             bool
+	Accounts            []Account
+	Tags                map[string]string
+	Rename              Rename
+	SessionLifetime     time.Duration
+	PollInterval        time.Duration
+	PollIntervals       PollIntervals
+	Schedule            []string
+	Adaptive            Adaptive
+	ShutdownTimeout     time.Duration
+	LogLevel            string
+	LogFormat           string
+	LogFile             string
+	LogRotation         LogRotation
+	Syslog              Syslog
+	StateFile           string
+	PersistSession      bool
+	LeaderElection      LeaderElection
+	HTTP                HTTP
+	Metrics             Metrics
+	Deadman             Deadman
+	Staleness           Staleness
+	Tracing             Tracing
+	Audit               Audit
+	BedConcurrency      int
+	BedsRefresh         time.Duration
+	RecordAPIRequests   bool
+	Collectors          map[string]bool
+	Beds                BedFilter
+	Pipeline            Pipeline
+	Delta               Delta
+	Aggregate           Aggregate
+	Dedup               []string
+	Drop                Drop
+	Cardinality         Cardinality
+	CircuitBreaker      CircuitBreaker
+	RateLimit           RateLimit
+	Proxy               Proxy
+	Vault               Vault
+	SleepIQClient       SleepIQClient
+	InfluxDB            InfluxDB
+	MQTT                MQTT
+	StateWebhook        StateWebhook
+	Textfile            Textfile
+	Hubitat             Hubitat
+	SmartThings         SmartThings
+	HomeAssistant       HomeAssistant
+	GoogleFit           GoogleFit
+	Fitbit              Fitbit
+	Report              Report
+	Telegram            Telegram
+	PassiveChecks       PassiveChecks
+	GRPC                GRPC
+	HomeKit             HomeKit
+	Plugins             []Plugin
+}
+
+// Account is an additional SleepIQ account to collect from; poll settings
+// left at zero inherit the top-level values
+type Account struct {
+	Name            string
+	Username        string
+	Password        string
+	PasswordFile    string
+	SessionLifetime time.Duration
+	PollInterval    time.Duration
+	PollIntervals   PollIntervals
+}
+
+type InfluxDB struct {
+	Address           string
+	Username          string
+	Password          string
+	MeasurementPrefix string
+	Database          string
+	RetentionPolicy   string
+	Token             string
+	TokenFile         string
+	Organization      string
+	Bucket            string
+	SkipVerifySsl     bool
+	FlushInterval     time.Duration
+	BatchSize         int
+	Gzip              bool
+	Precision         string
+	Transport         Transport
+	MaxRetries        int
+	RetryInterval     time.Duration
+	MaxRetryInterval  time.Duration
+	MaxRetryBuffer    int
+	Proxy             Proxy
+	Routes            []InfluxRoute
+}
+
+// InfluxRoute writes some measurements to another bucket, or for InfluxDB v1
+// another database and retention policy
+type InfluxRoute struct {
+	Measurements    []string
+	Bucket          string
+	Database        string
+	RetentionPolicy string
+}
+
+// PollIntervals overrides PollInterval for individual endpoints
+type PollIntervals struct {
+	FamilyStatus time.Duration
+	Foundation   time.Duration
+	FootWarmer   time.Duration
+	Pump         time.Duration
+	Climate      time.Duration
+	Sessions     time.Duration
+	Firmware     time.Duration
+}
+
+// Adaptive follows bed occupancy with the poll interval
+type Adaptive struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// Delta enables writing points only when their fields change
+type Delta struct {
+	Enabled   bool
+	Heartbeat time.Duration
+}
+
+// Aggregate writes one point per Window for each series of Measurements
+// instead of every sample, with the Functions of each numeric field; changes
+// of the Events fields end a window early
+type Aggregate struct {
+	Window       time.Duration
+	Measurements []string
+	Functions    []string
+	Events       []string
+}
+
+// BedFilter restricts collection to beds by name or ID
+type BedFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Pipeline sizes the queue between collectors and each sink
+type Pipeline struct {
+	Buffer   int
+	SpillDir string
+	Overflow string
+}
+
+// Rename renames outgoing measurements and the keys of tags and fields, from
+// the collector's name to the one wanted
+type Rename struct {
+	Measurements map[string]string
+	Tags         map[string]string
+	Fields       map[string]string
+}
+
+// Drop leaves measurements or individual fields, keyed by measurement, out of
+// what is written
+type Drop struct {
+	Measurements []string
+	Fields       map[string][]string
+}
+
+// Cardinality keeps series cardinality down by leaving tags off every point,
+// or writing them as fields instead
+type Cardinality struct {
+	DropTags     []string
+	TagsAsFields []string
+}
+
+// CircuitBreaker controls when polling backs off from a failing SleepIQ API
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// RateLimit caps the request rate across all SleepIQ API calls
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// SleepIQClient holds the HTTP settings for SleepIQ API calls
+type SleepIQClient struct {
+	BaseURL        string
+	RequestTimeout time.Duration
+	ConnectTimeout time.Duration
+	SkipVerifySsl  bool
+	CAFile         string
+	TokenAuth      bool
+	Proxy          Proxy
+	Transport      Transport
+	Record         string
+	Replay         string
+}
+
+// Transport tunes how HTTP connections are kept open and reused across poll
+// cycles; zero values keep the defaults
+type Transport struct {
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+	KeepAlive       time.Duration
+}
+
+// LogRotation rotates LogFile once it grows past MaxSize megabytes or every
+// Interval, keeping at most MaxBackups old files for at most MaxAge
+type LogRotation struct {
+	MaxSize    int
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+	Interval   time.Duration
+}
+
+// Enabled reports whether any rotation setting is set
+func (r LogRotation) Enabled() bool {
+	return r != LogRotation{}
+}
+
+// Syslog sends logs as RFC 5424 messages to Address, such as
+// udp://host:514, tcp://host:601, or unix:///dev/log, as well as to the log
+// file or stderr; it is disabled unless Address is set
+type Syslog struct {
+	Address  string
+	Facility string
+	AppName  string
+}
+
+// HTTP configures the server for health check endpoints and, with
+// StatusPage set, a status page, with Calendar, an iCalendar feed of sleep
+// sessions, with VoiceToken, webhooks for Alexa and Google Home smart home
+// skills authorized by that token, with ControlToken, an endpoint stopping
+// foundation motion authorized by that token, with Events, a live stream of
+// points as Server-Sent Events, and with State, the state document over a
+// WebSocket, which browsers may open from StateOrigin as well as the
+// server's own origin; it is disabled unless Address is set
+type HTTP struct {
+	Address      string
+	StatusPage   bool
+	Calendar     bool
+	VoiceToken   string
+	ControlToken string
+	Events       bool
+	State        bool
+	StateOrigin  string
+}
+
+// Metrics exports counts of what the collector does: to Prometheus on the
+// HTTP server, and as a collector_stats measurement written every Interval
+type Metrics struct {
+	Prometheus bool
+	Interval   time.Duration
+}
+
+// Deadman pings URL after every successful poll cycle, for an external dead
+// man's switch such as healthchecks.io; it is disabled unless URL is set
+type Deadman struct {
+	URL     string
+	Timeout time.Duration
+	Proxy   Proxy
+}
+
+// Staleness warns when a sink hasn't written a measurement for Factor times
+// the longest poll interval, apart from the Ignore measurements; it is
+// disabled unless Factor is set
+type Staleness struct {
+	Factor int
+	Ignore []string
+}
+
+// Tracing exports OpenTelemetry spans to an OTLP/HTTP receiver; it is
+// disabled unless Endpoint is set
+type Tracing struct {
+	Endpoint    string
+	Headers     map[string]string
+	SampleRatio float64
+	Proxy       Proxy
+}
+
+// Audit records every control action taken on a bed as a JSON line in File
+// and, with Measurement set, as a control_action point in every sink
+type Audit struct {
+	File        string
+	Measurement bool
+}
+
+// LeaderElection lets only one of several redundant instances poll
+type LeaderElection struct {
+	Backend    string
+	Identity   string
+	TTL        time.Duration
+	File       string
+	Consul     ConsulLock
+	Kubernetes KubernetesLock
+}
+
+// Vault locates secrets kept in HashiCorp Vault instead of the config file
+type Vault struct {
+	Address         string
+	Token           string
+	Namespace       string
+	KubernetesRole  string
+	KubernetesMount string
+	SleepIQPassword VaultSecret
+	InfluxDBToken   VaultSecret
+}
+
+// VaultSecret is one key of a secret in Vault; Key defaults to "value"
+type VaultSecret struct {
+	Path string
+	Key  string
+}
+
+// ConsulLock is a leader election lock held on a Consul KV key
+type ConsulLock struct {
+	Address string
+	Token   string
+	Key     string
+}
+
+// KubernetesLock is a leader election lock held on a Kubernetes Lease
+type KubernetesLock struct {
+	Namespace string
+	Lease     string
+}
+
+// MQTT publishes the latest fields of every point as JSON to an MQTT broker,
+// with Home Assistant discovery when Discovery is set, and the latest state
+// of every bed as one document to StateTopic if set, taking stop motion
+// commands when StopMotion is set; it is disabled unless Broker is set
+type MQTT struct {
+	Broker          string
+	Username        string
+	Password        string
+	ClientID        string
+	TopicPrefix     string
+	Discovery       bool
+	DiscoveryPrefix string
+	Retain          bool
+	QoS             int
+	StateTopic      string
+	StopMotion      bool
+}
+
+// StateWebhook POSTs the latest state of every bed as one JSON document to
+// URL, with Headers, after each poll cycle; it is disabled unless URL is set
+type StateWebhook struct {
+	URL     string
+	Headers map[string]string
+}
+
+// Textfile writes the latest value of every numeric field, and the
+// collector's own metrics, to the file at Path in the Prometheus text format
+// after each poll cycle, for the textfile collector of node_exporter; it is
+// disabled unless Path is set
+type Textfile struct {
+	Path string
+}
+
+// Hubitat pushes the presence and pressure of each of Sleepers to devices on
+// a Hubitat hub through the Maker API instance at URL, such as
+// http://hubitat.local/apps/api/12, authorized by AccessToken; pressure is
+// sent with PressureCommand. It is disabled unless Sleepers are set.
+type Hubitat struct {
+	URL             string
+	AccessToken     string
+	PressureCommand string
+	Sleepers        []HubSleeper
+}
+
+// SmartThings pushes the presence of each of Sleepers to SmartThings virtual
+// presence sensors, authorized by the personal access Token; it is disabled
+// unless Sleepers are set
+type SmartThings struct {
+	Token    string
+	Sleepers []HubSleeper
+}
+
+// HubSleeper is the Side of the bed named Bed, whose presence is pushed to
+// the hub's Device and pressure to its PressureDevice, if set
+type HubSleeper struct {
+	Bed            string
+	Side           string
+	Device         string
+	PressureDevice string
+}
+
+// HomeAssistant runs the collector as a Home Assistant add-on when Addon is
+// set: MQTT defaults to the Supervisor's broker with discovery, and the status
+// page is served to ingress on IngressPort
+type HomeAssistant struct {
+	Addon       bool
+	IngressPort int
+}
+
+// GoogleFit uploads the sleep sessions of each of Sleepers, read back from
+// InfluxDB, to their Google Fit account on Schedule, covering the Lookback
+// before; it is disabled unless Sleepers are set
+type GoogleFit struct {
+	ClientID     string
+	ClientSecret string
+	Schedule     string
+	Lookback     time.Duration
+	Sleepers     []GoogleFitSleeper
+}
+
+// GoogleFitSleeper is the Side of the bed named Bed whose sessions are
+// uploaded with the OAuth token in TokenFile
+type GoogleFitSleeper struct {
+	Bed       string
+	Side      string
+	TokenFile string
+}
+
+// Fitbit imports the sleep logs of each of Users on Schedule, covering the
+// nights within Lookback, as wearable_sleep points next to the bed's; it is
+// disabled unless Users are set
+type Fitbit struct {
+	ClientID     string
+	ClientSecret string
+	Schedule     string
+	Lookback     time.Duration
+	Users        []FitbitUser
+}
+
+// FitbitUser is the Fitbit account, authorized by the OAuth token in
+// TokenFile, of whoever sleeps on the Side of the bed named Bed; its sleep
+// logs are in Timezone, or the collector's local time zone if unset
+type FitbitUser struct {
+	Bed       string
+	Side      string
+	TokenFile string
+	Timezone  string
+}
+
+// Report emails a summary of each sleeper's week, read back from InfluxDB,
+// From one address To the others through SMTP on Schedule; it is disabled
+// unless To is set
+type Report struct {
+	Schedule string
+	From     string
+	To       []string
+	SMTP     SMTP
+}
+
+// SMTP is a mail server, reached over implicit TLS on port 465 and otherwise
+// with STARTTLS when offered
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// Telegram runs a bot with the bot Token that answers questions about the
+// beds and takes control commands from the chats in ChatIDs, ignoring all
+// others; it is disabled unless Token is set
+type Telegram struct {
+	Token   string
+	ChatIDs []int64
+}
+
+// PassiveChecks submits the results of checks of the collector, the
+// freshness of its data, and each bed as passive checks of services of Host
+// every Interval, to Icinga or NSCA; it is disabled unless either is set
+type PassiveChecks struct {
+	Host     string
+	Interval time.Duration
+	Icinga   Icinga
+	NSCA     NSCA
+}
+
+// Icinga is the Icinga 2 API at URL, with an API user allowed the
+// actions/process-check-result permission
+type Icinga struct {
+	URL           string
+	Username      string
+	Password      string
+	SkipVerifySsl bool
+}
+
+// NSCA is the NSCA daemon at Address, with its Password and Encryption,
+// none or xor
+type NSCA struct {
+	Address    string
+	Password   string
+	Encryption string
+}
+
+// GRPC serves the gRPC API of pkg/sleepnumberpb on Address, over TLS with
+// CertFile and KeyFile if they are set; calls must carry Token as a bearer
+// token if it is set, and the beds can only be controlled when it is. It is
+// disabled unless Address is set
+type GRPC struct {
+	Address  string
+	Token    string
+	CertFile string
+	KeyFile  string
+}
+
+// HomeKit serves a HomeKit bridge on Address, with an occupancy sensor for
+// each side of the beds and, if Light is set, their underbed lights;
+// controllers pair with Pin, and the bridge keeps its identity and pairings
+// in StateFile. It is disabled unless Address is set
+type HomeKit struct {
+	Address   string
+	Pin       string
+	Name      string
+	StateFile string
+	Light     bool
+}
+
+// Plugin is an external output process fed points as JSON over stdin
+type Plugin struct {
+	Name    string
+	Command string
+	Args    []string
+}
+
+// Load a config file and return the Config struct; every value can also be
+// set from the environment, and with an empty configPath the environment is
+// the only source. Overrides, keyed like the config file, take precedence
+// over both.
+func LoadConfiguration(configPath string, overrides map[string]string) (*Configuration, error) {
+	v := viper.New()
+	bindEnv(v)
+	for key, value := range overrides {
+		v.Set(key, value)
+	}
+
+	if configPath != "" {
+		data, format, err := readConfigFile(configPath)
+		if err == nil {
+			v.SetConfigType(format)
+			err = v.ReadConfig(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file %s, %s", configPath, err)
+		}
+	}
+
+	var configuration Configuration
+	err := v.Unmarshal(&configuration, viper.DecodeHook(decodeHook()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode config into struct, %s", err)
+	}
+
+	return &configuration, nil
+}
+
+// configType picks the config format from the file extension, falling back
+// to YAML
+func configType(configPath string) string {
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".toml":
+		return "toml"
+	case ".json":
+		return "json"
+	}
+	return "yaml"
+}
+
+// SleepIQAccounts returns every account to collect from: the top-level
+// sleepIQUsername account, if set, followed by each entry of accounts with
+// unset poll settings inherited from the top level
+func (c *Configuration) SleepIQAccounts() []Account {
+	var accounts []Account
+	if c.SleepIQUsername != "" {
+		accounts = append(accounts, Account{
+			Username:        c.SleepIQUsername,
+			Password:        c.SleepIQPassword,
+			SessionLifetime: c.SessionLifetime,
+			PollInterval:    c.PollInterval,
+			PollIntervals:   c.PollIntervals,
+		})
+	}
+
+	for _, account := range c.Accounts {
+		if account.SessionLifetime == 0 {
+			account.SessionLifetime = c.SessionLifetime
+		}
+		if account.PollInterval == 0 {
+			account.PollInterval = c.PollInterval
+		}
+		if account.PollIntervals.FamilyStatus == 0 {
+			account.PollIntervals.FamilyStatus = c.PollIntervals.FamilyStatus
+		}
+		if account.PollIntervals.Foundation == 0 {
+			account.PollIntervals.Foundation = c.PollIntervals.Foundation
+		}
+		if account.PollIntervals.FootWarmer == 0 {
+			account.PollIntervals.FootWarmer = c.PollIntervals.FootWarmer
+		}
+		if account.PollIntervals.Pump == 0 {
+			account.PollIntervals.Pump = c.PollIntervals.Pump
+		}
+		if account.PollIntervals.Climate == 0 {
+			account.PollIntervals.Climate = c.PollIntervals.Climate
+		}
+		if account.PollIntervals.Sessions == 0 {
+			account.PollIntervals.Sessions = c.PollIntervals.Sessions
+		}
+		if account.PollIntervals.Firmware == 0 {
+			account.PollIntervals.Firmware = c.PollIntervals.Firmware
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts
+}
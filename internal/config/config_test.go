@@ -0,0 +1,409 @@
+package config
+
+import (
+	"github.com/go-viper/mapstructure/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes content to a file named name in a new directory,
+// returning its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfiguration(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		env       map[string]string
+		overrides map[string]string
+		check     func(t *testing.T, c *Configuration)
+		wantErr   string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `
+sleepIQUsername: sleeper@example.com
+sleepIQPassword: secret
+pollInterval: 2m
+shutdownTimeout: 15s
+influxDB:
+  address: http://localhost:8086
+  bucket: sleep
+  flushInterval: 10s
+  batchSize: 500
+`,
+			check: func(t *testing.T, c *Configuration) {
+				if c.SleepIQUsername != "sleeper@example.com" || c.SleepIQPassword != "secret" {
+					t.Errorf("got account %s/%s, want sleeper@example.com/secret", c.SleepIQUsername, c.SleepIQPassword)
+				}
+				if c.PollInterval != 2*time.Minute {
+					t.Errorf("got pollInterval %s, want 2m", c.PollInterval)
+				}
+				if c.ShutdownTimeout != 15*time.Second {
+					t.Errorf("got shutdownTimeout %s, want 15s", c.ShutdownTimeout)
+				}
+				if c.InfluxDB.Address != "http://localhost:8086" || c.InfluxDB.Bucket != "sleep" {
+					t.Errorf("got influxDB %s/%s, want http://localhost:8086/sleep", c.InfluxDB.Address, c.InfluxDB.Bucket)
+				}
+				if c.InfluxDB.FlushInterval != 10*time.Second {
+					t.Errorf("got influxDB.flushInterval %s, want 10s", c.InfluxDB.FlushInterval)
+				}
+				if c.InfluxDB.BatchSize != 500 {
+					t.Errorf("got influxDB.batchSize %d, want 500", c.InfluxDB.BatchSize)
+				}
+			},
+		},
+		{
+			name: "bare numbers are seconds",
+			file: "config.yaml",
+			content: `
+pollInterval: 60
+sessionLifetime: 1.5
+influxDB:
+  flushInterval: 30
+`,
+			check: func(t *testing.T, c *Configuration) {
+				if c.PollInterval != time.Minute {
+					t.Errorf("got pollInterval %s, want 1m", c.PollInterval)
+				}
+				if c.SessionLifetime != 1500*time.Millisecond {
+					t.Errorf("got sessionLifetime %s, want 1.5s", c.SessionLifetime)
+				}
+				if c.InfluxDB.FlushInterval != 30*time.Second {
+					t.Errorf("got influxDB.flushInterval %s, want 30s", c.InfluxDB.FlushInterval)
+				}
+			},
+		},
+		{
+			name:    "json",
+			file:    "config.json",
+			content: `{"sleepIQUsername": "sleeper@example.com", "accounts": [{"name": "guest", "username": "guest@example.com", "pollInterval": "5m"}]}`,
+			check: func(t *testing.T, c *Configuration) {
+				if len(c.Accounts) != 1 {
+					t.Fatalf("got %d accounts, want 1", len(c.Accounts))
+				}
+				if c.Accounts[0].Name != "guest" || c.Accounts[0].PollInterval != 5*time.Minute {
+					t.Errorf("got account %+v, want guest polled every 5m", c.Accounts[0])
+				}
+			},
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			content: `
+sleepIQUsername = "sleeper@example.com"
+[influxDB]
+address = "http://localhost:8086"
+`,
+			check: func(t *testing.T, c *Configuration) {
+				if c.InfluxDB.Address != "http://localhost:8086" {
+					t.Errorf("got influxDB.address %q, want http://localhost:8086", c.InfluxDB.Address)
+				}
+			},
+		},
+		{
+			name: "environment",
+			file: "config.yaml",
+			content: `
+sleepIQUsername: sleeper@example.com
+influxDB:
+  address: http://localhost:8086
+`,
+			env: map[string]string{
+				"INFLUXDB_ADDRESS": "http://influxdb:8086",
+				"INFLUXDB_BUCKET":  "from-env",
+				"COLLECTORS":       `{"foundation": false}`,
+				"DEDUP":            "bed_sleeper_state,bed_foundation_state",
+			},
+			check: func(t *testing.T, c *Configuration) {
+				if c.InfluxDB.Address != "http://influxdb:8086" {
+					t.Errorf("got influxDB.address %q, want the environment's http://influxdb:8086", c.InfluxDB.Address)
+				}
+				if c.InfluxDB.Bucket != "from-env" {
+					t.Errorf("got influxDB.bucket %q, want from-env", c.InfluxDB.Bucket)
+				}
+				if enabled, ok := c.Collectors["foundation"]; !ok || enabled {
+					t.Errorf("got collectors %v, want foundation disabled", c.Collectors)
+				}
+				want := []string{"bed_sleeper_state", "bed_foundation_state"}
+				if !reflect.DeepEqual(c.Dedup, want) {
+					t.Errorf("got dedup %v, want %v", c.Dedup, want)
+				}
+			},
+		},
+		{
+			name: "overrides win",
+			file: "config.yaml",
+			content: `
+influxDB:
+  address: http://localhost:8086
+`,
+			env:       map[string]string{"INFLUXDB_ADDRESS": "http://influxdb:8086"},
+			overrides: map[string]string{"influxDB.address": "http://override:8086"},
+			check: func(t *testing.T, c *Configuration) {
+				if c.InfluxDB.Address != "http://override:8086" {
+					t.Errorf("got influxDB.address %q, want the override", c.InfluxDB.Address)
+				}
+			},
+		},
+		{
+			name:    "environment only",
+			env:     map[string]string{"SLEEPIQUSERNAME": "sleeper@example.com", "POLLINTERVAL": "45s"},
+			content: "",
+			check: func(t *testing.T, c *Configuration) {
+				if c.SleepIQUsername != "sleeper@example.com" {
+					t.Errorf("got sleepIQUsername %q, want sleeper@example.com", c.SleepIQUsername)
+				}
+				if c.PollInterval != 45*time.Second {
+					t.Errorf("got pollInterval %s, want 45s", c.PollInterval)
+				}
+			},
+		},
+		{
+			name:    "invalid duration",
+			file:    "config.yaml",
+			content: "pollInterval: soon\n",
+			wantErr: "invalid duration",
+		},
+		{
+			name:    "negative duration",
+			file:    "config.yaml",
+			content: "pollInterval: -5s\n",
+			wantErr: "must not be negative",
+		},
+		{
+			name: "cardinality",
+			file: "config.yaml",
+			content: `
+sleepIQUsername: sleeper@example.com
+sleepIQPassword: secret
+cardinality:
+  dropTags: [generation]
+  tagsAsFields: [model]
+`,
+			check: func(t *testing.T, c *Configuration) {
+				want := Cardinality{DropTags: []string{"generation"}, TagsAsFields: []string{"model"}}
+				if !reflect.DeepEqual(c.Cardinality, want) {
+					t.Errorf("got cardinality %+v, want %+v", c.Cardinality, want)
+				}
+			},
+		},
+		{
+			name:    "invalid yaml",
+			file:    "config.yaml",
+			content: "influxDB: [\n",
+			wantErr: "error reading config file",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			var path string
+			if test.file != "" {
+				path = writeConfig(t, test.file, test.content)
+			}
+			c, err := LoadConfiguration(path, test.overrides)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to load config, %s", err)
+			}
+			test.check(t, c)
+		})
+	}
+}
+
+func TestLoadConfigurationMissingFile(t *testing.T) {
+	_, err := LoadConfiguration(filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	if err == nil {
+		t.Fatal("got no error loading a missing config file")
+	}
+}
+
+func TestDecodeHook(t *testing.T) {
+	type target struct {
+		Interval time.Duration
+		Names    []string
+		Enabled  map[string]bool
+		Count    int
+	}
+	tests := []struct {
+		name    string
+		input   map[string]interface{}
+		want    target
+		wantErr string
+	}{
+		{
+			name:  "duration string",
+			input: map[string]interface{}{"interval": "1m30s"},
+			want:  target{Interval: 90 * time.Second},
+		},
+		{
+			name:  "duration of seconds as a string",
+			input: map[string]interface{}{"interval": " 20 "},
+			want:  target{Interval: 20 * time.Second},
+		},
+		{
+			name:  "duration of seconds as an int",
+			input: map[string]interface{}{"interval": 20},
+			want:  target{Interval: 20 * time.Second},
+		},
+		{
+			name:  "duration of fractional seconds",
+			input: map[string]interface{}{"interval": 0.25},
+			want:  target{Interval: 250 * time.Millisecond},
+		},
+		{
+			name:  "empty duration",
+			input: map[string]interface{}{"interval": ""},
+			want:  target{},
+		},
+		{
+			name:    "invalid duration",
+			input:   map[string]interface{}{"interval": "later"},
+			wantErr: "invalid duration",
+		},
+		{
+			name:    "negative duration",
+			input:   map[string]interface{}{"interval": -1},
+			wantErr: "must not be negative",
+		},
+		{
+			name:  "comma-separated list",
+			input: map[string]interface{}{"names": "a,b,c"},
+			want:  target{Names: []string{"a", "b", "c"}},
+		},
+		{
+			name:  "JSON list",
+			input: map[string]interface{}{"names": `["a", "b,c"]`},
+			want:  target{Names: []string{"a", "b,c"}},
+		},
+		{
+			name:  "JSON map",
+			input: map[string]interface{}{"enabled": `{"foundation": true, "sleeper": false}`},
+			want:  target{Enabled: map[string]bool{"foundation": true, "sleeper": false}},
+		},
+		{
+			name:    "invalid JSON map",
+			input:   map[string]interface{}{"enabled": `{"foundation": }`},
+			wantErr: "invalid character",
+		},
+		{
+			name:  "other values untouched",
+			input: map[string]interface{}{"count": 3},
+			want:  target{Count: 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got target
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+				DecodeHook: decodeHook(),
+				Result:     &got,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = decoder.Decode(test.input)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode, %s", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateCardinality(t *testing.T) {
+	tests := []struct {
+		name        string
+		cardinality Cardinality
+		wantErr     string
+	}{
+		{
+			name:        "other tags",
+			cardinality: Cardinality{DropTags: []string{"generation"}, TagsAsFields: []string{"model", "size"}},
+		},
+		{
+			name:        "dropped key tag",
+			cardinality: Cardinality{DropTags: []string{"generation", "name"}},
+			wantErr:     "the name tag tells beds apart and can't be dropped",
+		},
+		{
+			name:        "key tag as field",
+			cardinality: Cardinality{TagsAsFields: []string{"side"}},
+			wantErr:     "the side tag tells beds apart and can't be written as a field",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := Configuration{
+				SleepIQUsername: "sleeper@example.com",
+				SleepIQPassword: "secret",
+				Textfile:        Textfile{Path: filepath.Join(t.TempDir(), "sleepnumber.prom")},
+				Cardinality:     test.cardinality,
+			}
+			err := c.Validate()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %s, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidHomeKitPin(t *testing.T) {
+	tests := []struct {
+		pin  string
+		want bool
+	}{
+		{"031-45-154", true},
+		{"123-45-679", true},
+		{"03145154", false},
+		{"031-45-15", false},
+		{"031-4a-154", false},
+		{"111-11-111", false},
+		{"123-45-678", false},
+		{"876-54-321", false},
+	}
+	for _, test := range tests {
+		if got := validHomeKitPin(test.pin); got != test.want {
+			t.Errorf("got %t for %q, want %t", got, test.pin, test.want)
+		}
+	}
+}
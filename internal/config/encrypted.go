@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sopsMarker appears in every value sops encrypts
+const sopsMarker = "ENC[AES256_GCM,"
+
+// readConfigFile returns the contents of the config file and its format,
+// decrypting it first if needed. A .age file is decrypted with the identity
+// in AGE_KEY or AGE_KEY_FILE, falling back to SOPS_AGE_KEY and
+// SOPS_AGE_KEY_FILE, and a file encrypted with sops is decrypted by running
+// sops, which reads its keys from the environment the same way.
+func readConfigFile(configPath string) ([]byte, string, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if strings.HasSuffix(strings.ToLower(configPath), ".age") {
+		data, err = decryptAge(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decrypt %s, %s", configPath, err)
+		}
+		return data, configType(configPath[:len(configPath)-len(".age")]), nil
+	}
+
+	if bytes.Contains(data, []byte(sopsMarker)) {
+		var stderr bytes.Buffer
+		cmd := exec.Command("sops", "--decrypt", configPath)
+		cmd.Stderr = &stderr
+		data, err = cmd.Output()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decrypt %s with sops, %s: %s", configPath, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return data, configType(configPath), nil
+}
+
+func decryptAge(data []byte) ([]byte, error) {
+	identities, err := ageIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	var in io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		in = armor.NewReader(in)
+	}
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// ageIdentities reads the age identities from the first of the key
+// environment variables that is set
+func ageIdentities() ([]age.Identity, error) {
+	for _, prefix := range []string{"AGE_KEY", "SOPS_AGE_KEY"} {
+		if key := os.Getenv(prefix); key != "" {
+			return age.ParseIdentities(strings.NewReader(key))
+		}
+		if path := os.Getenv(prefix + "_FILE"); path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return age.ParseIdentities(bufio.NewReader(f))
+		}
+	}
+	return nil, fmt.Errorf("no age identity, set AGE_KEY or AGE_KEY_FILE")
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bindEnv registers every config key with viper so each can be set from an
+// environment variable named after its path, upper-cased and joined with
+// underscores: influxDB.address is INFLUXDB_ADDRESS. AutomaticEnv alone only
+// looks up keys viper already knows from the config file, so nested values
+// could not otherwise be set without one.
+func bindEnv(v *viper.Viper) {
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for _, key := range configKeys(reflect.TypeOf(Configuration{}), "") {
+		v.BindEnv(key)
+	}
+}
+
+// configKeys lists the dotted key of every leaf value under t
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.ToLower(field.Name)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(field.Type, key)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeHook converts config values to their Go types. Durations are Go
+// duration strings such as 30s or 2m, or bare numbers of seconds as in older
+// config files. Environment variables are always strings, so lists and maps
+// such as ACCOUNTS or COLLECTORS are given as JSON.
+func decodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		durationHook,
+		func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+			s, ok := data.(string)
+			if !ok || from.Kind() != reflect.String {
+				return data, nil
+			}
+			switch to.Kind() {
+			case reflect.Slice, reflect.Map:
+				trimmed := strings.TrimSpace(s)
+				if !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "{") {
+					return data, nil
+				}
+				var decoded interface{}
+				err := json.Unmarshal([]byte(trimmed), &decoded)
+				if err != nil {
+					return nil, err
+				}
+				return decoded, nil
+			}
+			return data, nil
+		},
+		mapstructure.StringToSliceHookFunc(","),
+	)
+}
+
+func durationHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != durationType {
+		return data, nil
+	}
+
+	var d time.Duration
+	switch v := data.(type) {
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return time.Duration(0), nil
+		}
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			d = time.Duration(seconds * float64(time.Second))
+			break
+		}
+		d, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q, use a number of seconds or a duration such as 30s or 2m", v)
+		}
+	case int:
+		d = time.Duration(v) * time.Second
+	case int64:
+		d = time.Duration(v) * time.Second
+	case uint64:
+		d = time.Duration(v) * time.Second
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	default:
+		return data, nil
+	}
+	if d < 0 {
+		return nil, fmt.Errorf("invalid duration %s, must not be negative", d)
+	}
+	return d, nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ProxyDirect disables proxying for a destination, overriding both the
+// top-level proxy and the proxy environment variables
+const ProxyDirect = "direct"
+
+// Proxy is an outbound proxy URL (http, https, socks5, or socks5h), or
+// "direct" for no proxy
+type Proxy string
+
+// Func parses the proxy into a selector for http.Transport.Proxy; an empty
+// proxy returns nil so the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment
+// variables apply
+func (proxy Proxy) Func() (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return nil, nil
+	case ProxyDirect:
+		return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+	}
+
+	proxyURL, err := url.Parse(string(proxy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse proxy %s, %s", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be http, https, socks5, or socks5h", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy %s has no host", proxy)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
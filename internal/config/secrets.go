@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadSecretFiles fills in the passwords and tokens given as files, such as
+// mounted Docker or Kubernetes secrets. A secret set both directly and as a
+// file is an error, since which one applies would be ambiguous.
+func (c *Configuration) ReadSecretFiles() error {
+	err := readSecretFile("sleepIQPassword", &c.SleepIQPassword, c.SleepIQPasswordFile)
+	if err != nil {
+		return err
+	}
+	for i := range c.Accounts {
+		key := fmt.Sprintf("accounts[%d].password", i)
+		err = readSecretFile(key, &c.Accounts[i].Password, c.Accounts[i].PasswordFile)
+		if err != nil {
+			return err
+		}
+	}
+	return readSecretFile("influxDB.token", &c.InfluxDB.Token, c.InfluxDB.TokenFile)
+}
+
+// readSecretFile reads path into secret, dropping the trailing newline most
+// editors and secret stores leave
+func readSecretFile(key string, secret *string, path string) error {
+	if path == "" {
+		return nil
+	}
+	if *secret != "" {
+		return fmt.Errorf("%s and %sFile are both set, remove one", key, key)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %sFile, %s", key, err)
+	}
+	*secret = strings.TrimRight(string(contents), "\r\n")
+	return nil
+}
@@ -0,0 +1,532 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/syslog"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Validate checks every setting and reports all the problems found at once,
+// joined into one error
+func (c *Configuration) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	checkURL := func(key, value string) {
+		if value == "" {
+			return
+		}
+		err := checkHTTPURL(value)
+		if err != nil {
+			add("%s: %s", key, err)
+		}
+	}
+	checkProxy := func(key string, proxy Proxy) {
+		_, err := proxy.Func()
+		if err != nil {
+			add("%s: %s", key, err)
+		}
+	}
+
+	// SleepIQ accounts
+	accounts := c.SleepIQAccounts()
+	if len(accounts) == 0 {
+		add("no SleepIQ accounts configured, set sleepIQUsername or accounts")
+	}
+	if c.SleepIQPassword != "" && c.SleepIQUsername == "" {
+		add("sleepIQPassword is set without sleepIQUsername")
+	}
+	names := make(map[string]bool)
+	for i, account := range c.Accounts {
+		if account.Username == "" {
+			add("accounts[%d]: username is required", i)
+		}
+		if account.Name == "" {
+			add("accounts[%d]: name is required to tag its points", i)
+		} else if names[account.Name] {
+			add("accounts[%d]: name %q is used by another account", i, account.Name)
+		}
+		names[account.Name] = true
+	}
+
+	// Polling
+	if c.Adaptive.MinInterval > 0 || c.Adaptive.MaxInterval > 0 {
+		if c.Adaptive.MinInterval == 0 || c.Adaptive.MaxInterval == 0 {
+			add("adaptive: minInterval and maxInterval must both be set")
+		} else if c.Adaptive.MinInterval > c.Adaptive.MaxInterval {
+			add("adaptive: minInterval %s is longer than maxInterval %s", c.Adaptive.MinInterval, c.Adaptive.MaxInterval)
+		}
+	}
+	if c.BedConcurrency < 0 {
+		add("bedConcurrency must not be negative")
+	}
+	if c.BedsRefresh < 0 {
+		add("bedsRefresh must not be negative")
+	}
+	if c.Pipeline.Buffer < 0 {
+		add("pipeline.buffer must not be negative")
+	}
+	switch c.Pipeline.Overflow {
+	case "", "block":
+	case "drop-oldest", "drop-newest":
+		if c.Pipeline.SpillDir != "" {
+			add("pipeline: set either spillDir or a drop overflow policy, not both")
+		}
+	default:
+		add("pipeline.overflow %q is unknown, must be block, drop-oldest, or drop-newest", c.Pipeline.Overflow)
+	}
+	if c.CircuitBreaker.Threshold < 0 {
+		add("circuitBreaker.threshold must not be negative")
+	}
+	if c.RateLimit.Burst < 0 {
+		add("rateLimit.burst must not be negative")
+	}
+	if c.Aggregate.Window < 0 {
+		add("aggregate.window must not be negative")
+	}
+	if c.Aggregate.Window > 0 && len(c.Aggregate.Measurements) == 0 {
+		add("aggregate.measurements is required with aggregate.window")
+	}
+	for _, function := range c.Aggregate.Functions {
+		if function != "mean" && function != "min" && function != "max" {
+			add("aggregate.functions: %q is unknown, must be mean, min, or max", function)
+		}
+	}
+	for _, tag := range collector.KeyTags {
+		if slices.Contains(c.Cardinality.DropTags, tag) {
+			add("cardinality.dropTags: the %s tag tells beds apart and can't be dropped", tag)
+		}
+		if slices.Contains(c.Cardinality.TagsAsFields, tag) {
+			add("cardinality.tagsAsFields: the %s tag tells beds apart and can't be written as a field", tag)
+		}
+	}
+	if c.Staleness.Factor < 0 {
+		add("staleness.factor must not be negative")
+	}
+	if c.LogLevel != "" {
+		_, err := log.ParseLevel(c.LogLevel)
+		if err != nil {
+			add("logLevel: %s", err)
+		}
+	}
+	if c.LogFormat != "" && c.LogFormat != "text" && c.LogFormat != "json" {
+		add("logFormat %q is unknown, must be text or json", c.LogFormat)
+	}
+	if c.LogRotation.Enabled() && c.LogFile == "" {
+		add("logRotation needs logFile set")
+	}
+	if c.LogRotation.MaxSize < 0 {
+		add("logRotation.maxSize must not be negative")
+	}
+	if c.LogRotation.MaxBackups < 0 {
+		add("logRotation.maxBackups must not be negative")
+	}
+	if c.Syslog.Address != "" {
+		_, _, err := syslog.ParseAddress(c.Syslog.Address)
+		if err != nil {
+			add("syslog.address: %s", err)
+		}
+	}
+	if c.Syslog.Facility != "" {
+		_, err := syslog.ParseFacility(c.Syslog.Facility)
+		if err != nil {
+			add("syslog.facility: %s", err)
+		}
+	}
+
+	// Network
+	checkTransport := func(key string, t Transport) {
+		if t.MaxIdleConns < 0 || t.IdleConnTimeout < 0 || t.KeepAlive < 0 {
+			add("%s: maxIdleConns, idleConnTimeout, and keepAlive must not be negative", key)
+		}
+	}
+	checkTransport("sleepIQClient.transport", c.SleepIQClient.Transport)
+	checkTransport("influxDB.transport", c.InfluxDB.Transport)
+	checkProxy("proxy", c.Proxy)
+	checkProxy("sleepIQClient.proxy", c.SleepIQClient.Proxy)
+	checkProxy("influxDB.proxy", c.InfluxDB.Proxy)
+	checkProxy("deadman.proxy", c.Deadman.Proxy)
+	checkProxy("tracing.proxy", c.Tracing.Proxy)
+	checkURL("sleepIQClient.baseURL", c.SleepIQClient.BaseURL)
+	if c.SleepIQClient.Record != "" && c.SleepIQClient.Replay != "" {
+		add("sleepIQClient.record and sleepIQClient.replay can't both be set")
+	}
+	if c.SleepIQClient.Replay != "" {
+		_, err := os.Stat(c.SleepIQClient.Replay)
+		if err != nil {
+			add("sleepIQClient.replay: %s", err)
+		}
+	}
+	checkURL("vault.address", c.Vault.Address)
+	checkURL("deadman.url", c.Deadman.URL)
+	checkURL("tracing.endpoint", c.Tracing.Endpoint)
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sampleRatio must be between 0 and 1")
+	}
+	if c.HTTP.Address != "" {
+		_, _, err := net.SplitHostPort(c.HTTP.Address)
+		if err != nil {
+			add("http.address: %s", err)
+		}
+	}
+	if c.Metrics.Prometheus && c.HTTP.Address == "" {
+		add("metrics.prometheus needs http.address set")
+	}
+	if c.HTTP.StatusPage && c.HTTP.Address == "" {
+		add("http.statusPage needs http.address set")
+	}
+	if c.HTTP.Calendar && (c.HTTP.Address == "" || c.InfluxDB.Address == "") {
+		add("http.calendar needs http.address and influxDB.address set, since sessions are read back from InfluxDB")
+	}
+	if c.HTTP.VoiceToken != "" && c.HTTP.Address == "" {
+		add("http.voiceToken needs http.address set")
+	}
+	if c.HTTP.ControlToken != "" && c.HTTP.Address == "" {
+		add("http.controlToken needs http.address set")
+	}
+	if c.HTTP.Events && c.HTTP.Address == "" {
+		add("http.events needs http.address set")
+	}
+	if c.HTTP.State && c.HTTP.Address == "" {
+		add("http.state needs http.address set")
+	}
+	if c.HTTP.StateOrigin != "" && c.HTTP.StateOrigin != "*" {
+		err := checkHTTPURL(c.HTTP.StateOrigin)
+		if err != nil {
+			add("http.stateOrigin: %s", err)
+		}
+	}
+	if c.SleepIQClient.CAFile != "" {
+		_, err := os.Stat(c.SleepIQClient.CAFile)
+		if err != nil {
+			add("sleepIQClient.caFile: %s", err)
+		}
+	}
+
+	// Leader election
+	switch c.LeaderElection.Backend {
+	case "":
+	case "file":
+		if c.LeaderElection.File == "" {
+			add("leaderElection.file is required for the file backend")
+		}
+	case "consul":
+		if c.LeaderElection.Consul.Key == "" {
+			add("leaderElection.consul.key is required for the consul backend")
+		}
+		checkURL("leaderElection.consul.address", c.LeaderElection.Consul.Address)
+	case "kubernetes":
+		if c.LeaderElection.Kubernetes.Lease == "" {
+			add("leaderElection.kubernetes.lease is required for the kubernetes backend")
+		}
+	default:
+		add("leaderElection.backend %q is unknown, must be file, consul, or kubernetes", c.LeaderElection.Backend)
+	}
+	if c.PersistSession && c.StateFile == "" {
+		add("persistSession needs stateFile set")
+	}
+
+	// Outputs
+	if c.InfluxDB.Address == "" && c.MQTT.Broker == "" && c.StateWebhook.URL == "" && c.Textfile.Path == "" &&
+		len(c.Hubitat.Sleepers) == 0 && len(c.SmartThings.Sleepers) == 0 && len(c.Plugins) == 0 {
+		add("no outputs configured, set influxDB.address, mqtt.broker, stateWebhook.url, textfile.path, hubitat.sleepers, or smartThings.sleepers, or add plugins")
+	}
+	if c.InfluxDB.Address != "" {
+		errs = append(errs, c.InfluxDB.validate()...)
+	}
+	if c.MQTT.Broker != "" {
+		u, err := url.Parse(c.MQTT.Broker)
+		if err != nil {
+			add("mqtt.broker: %s", err)
+		} else if u.Host == "" || u.Scheme != "tcp" && u.Scheme != "ssl" && u.Scheme != "ws" && u.Scheme != "wss" {
+			add("mqtt.broker %q must be tcp://, ssl://, ws://, or wss:// and a host", c.MQTT.Broker)
+		}
+		if c.MQTT.QoS < 0 || c.MQTT.QoS > 2 {
+			add("mqtt.qos must be 0, 1, or 2")
+		}
+		if strings.ContainsAny(c.MQTT.StateTopic, "+#") {
+			add("mqtt.stateTopic must not contain wildcards")
+		}
+	}
+	if c.MQTT.StopMotion && c.MQTT.Broker == "" {
+		add("mqtt.stopMotion needs mqtt.broker set")
+	}
+	if c.StateWebhook.URL != "" {
+		u, err := url.Parse(c.StateWebhook.URL)
+		if err != nil {
+			add("stateWebhook.url: %s", err)
+		} else if u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+			add("stateWebhook.url %q must be http:// or https:// and a host", c.StateWebhook.URL)
+		}
+	}
+	if c.Textfile.Path != "" {
+		if !strings.HasSuffix(c.Textfile.Path, ".prom") {
+			add("textfile.path %q must end in .prom, the only files node_exporter reads", c.Textfile.Path)
+		}
+		_, err := os.Stat(filepath.Dir(c.Textfile.Path))
+		if err != nil {
+			add("textfile.path: %s", err)
+		}
+	}
+	checkHubSleepers := func(key string, sleepers []HubSleeper) {
+		for i, sleeper := range sleepers {
+			if sleeper.Bed == "" || sleeper.Device == "" && sleeper.PressureDevice == "" {
+				add("%s.sleepers[%d]: bed and device or pressureDevice are required", key, i)
+			}
+			if sleeper.Side != "left" && sleeper.Side != "right" {
+				add("%s.sleepers[%d]: side must be left or right", key, i)
+			}
+		}
+	}
+	if len(c.Hubitat.Sleepers) > 0 {
+		err := checkHTTPURL(c.Hubitat.URL)
+		if err != nil {
+			add("hubitat.url: %s", err)
+		}
+		if c.Hubitat.AccessToken == "" {
+			add("hubitat.accessToken is required")
+		}
+		checkHubSleepers("hubitat", c.Hubitat.Sleepers)
+	}
+	if len(c.SmartThings.Sleepers) > 0 {
+		if c.SmartThings.Token == "" {
+			add("smartThings.token is required")
+		}
+		checkHubSleepers("smartThings", c.SmartThings.Sleepers)
+	}
+	if len(c.GoogleFit.Sleepers) > 0 {
+		if c.GoogleFit.ClientID == "" || c.GoogleFit.ClientSecret == "" {
+			add("googleFit: clientID and clientSecret are required")
+		}
+		if c.InfluxDB.Address == "" {
+			add("googleFit needs influxDB.address set, since sessions are read back from InfluxDB")
+		}
+		if c.GoogleFit.Schedule != "" {
+			_, err := collector.ParseCron(c.GoogleFit.Schedule)
+			if err != nil {
+				add("googleFit.schedule: %s", err)
+			}
+		}
+		if c.GoogleFit.Lookback < 0 {
+			add("googleFit.lookback must not be negative")
+		}
+		for i, sleeper := range c.GoogleFit.Sleepers {
+			if sleeper.Bed == "" || sleeper.TokenFile == "" {
+				add("googleFit.sleepers[%d]: bed and tokenFile are required", i)
+			}
+			if sleeper.Side != "left" && sleeper.Side != "right" {
+				add("googleFit.sleepers[%d]: side must be left or right", i)
+			}
+		}
+	}
+	if len(c.Fitbit.Users) > 0 {
+		if c.Fitbit.ClientID == "" || c.Fitbit.ClientSecret == "" {
+			add("fitbit: clientID and clientSecret are required")
+		}
+		if c.Fitbit.Schedule != "" {
+			_, err := collector.ParseCron(c.Fitbit.Schedule)
+			if err != nil {
+				add("fitbit.schedule: %s", err)
+			}
+		}
+		if c.Fitbit.Lookback < 0 {
+			add("fitbit.lookback must not be negative")
+		}
+		for i, user := range c.Fitbit.Users {
+			if user.Bed == "" || user.TokenFile == "" {
+				add("fitbit.users[%d]: bed and tokenFile are required", i)
+			}
+			if user.Side != "left" && user.Side != "right" {
+				add("fitbit.users[%d]: side must be left or right", i)
+			}
+			if user.Timezone != "" {
+				_, err := time.LoadLocation(user.Timezone)
+				if err != nil {
+					add("fitbit.users[%d].timezone: %s", i, err)
+				}
+			}
+		}
+	}
+	if len(c.Report.To) > 0 {
+		if c.Report.From == "" || c.Report.SMTP.Host == "" {
+			add("report: from and smtp.host are required")
+		}
+		if c.InfluxDB.Address == "" {
+			add("report needs influxDB.address set, since sessions are read back from InfluxDB")
+		}
+		if c.Report.Schedule != "" {
+			_, err := collector.ParseCron(c.Report.Schedule)
+			if err != nil {
+				add("report.schedule: %s", err)
+			}
+		}
+		if c.Report.SMTP.Port < 0 || c.Report.SMTP.Port > 65535 {
+			add("report.smtp.port must be a port number")
+		}
+	}
+	if c.Telegram.Token != "" && len(c.Telegram.ChatIDs) == 0 {
+		add("telegram.chatIDs is required, since the bot only answers the chats listed there")
+	}
+	if c.PassiveChecks.Icinga.URL != "" {
+		err := checkHTTPURL(c.PassiveChecks.Icinga.URL)
+		if err != nil {
+			add("passiveChecks.icinga.url: %s", err)
+		}
+	}
+	if c.PassiveChecks.NSCA.Address != "" {
+		_, _, err := net.SplitHostPort(c.PassiveChecks.NSCA.Address)
+		if err != nil {
+			add("passiveChecks.nsca.address: %s", err)
+		}
+		switch c.PassiveChecks.NSCA.Encryption {
+		case "", "none", "xor":
+		default:
+			add("passiveChecks.nsca.encryption %q must be none or xor", c.PassiveChecks.NSCA.Encryption)
+		}
+	}
+	if c.PassiveChecks.Interval < 0 {
+		add("passiveChecks.interval must not be negative")
+	}
+	if c.GRPC.Address != "" {
+		_, _, err := net.SplitHostPort(c.GRPC.Address)
+		if err != nil {
+			add("grpc.address: %s", err)
+		}
+	}
+	if (c.GRPC.CertFile == "") != (c.GRPC.KeyFile == "") {
+		add("grpc.certFile and grpc.keyFile must be set together")
+	}
+	if c.HomeKit.Address != "" {
+		_, _, err := net.SplitHostPort(c.HomeKit.Address)
+		if err != nil {
+			add("homeKit.address: %s", err)
+		}
+		if !validHomeKitPin(c.HomeKit.Pin) {
+			add("homeKit.pin %q must be eight digits as 123-45-678, and not a trivial one", c.HomeKit.Pin)
+		}
+		if c.HomeKit.StateFile == "" {
+			add("homeKit.stateFile is required")
+		}
+		if c.HomeKit.Light && !c.Collectors["light"] {
+			add("homeKit.light needs collectors.light enabled")
+		}
+	}
+	if c.HomeAssistant.IngressPort < 0 || c.HomeAssistant.IngressPort > 65535 {
+		add("homeAssistant.ingressPort must be a port number")
+	}
+	for i, plugin := range c.Plugins {
+		if plugin.Name == "" {
+			add("plugins[%d]: name is required", i)
+		}
+		if plugin.Command == "" {
+			add("plugins[%d]: command is required", i)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validHomeKitPin reports whether pin is a setup code HomeKit accepts,
+// which rules out repeated digits and the two sequences
+func validHomeKitPin(pin string) bool {
+	if len(pin) != 10 || pin[3] != '-' || pin[6] != '-' {
+		return false
+	}
+	digits := pin[:3] + pin[4:6] + pin[7:]
+	for _, d := range digits {
+		if d < '0' || d > '9' {
+			return false
+		}
+	}
+	if digits == "12345678" || digits == "87654321" {
+		return false
+	}
+	return strings.Count(digits, digits[:1]) != len(digits)
+}
+
+func (c *InfluxDB) validate() []error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	err := checkHTTPURL(c.Address)
+	if err != nil {
+		add("influxDB.address: %s", err)
+	}
+	// Setting both v1 and v2 credentials or destinations was always allowed,
+	// with the v2 ones winning, so it's only warned about
+	if c.Token != "" && (c.Username != "" || c.Password != "") {
+		log.WithFields(log.Fields{
+			"op": "config.Validate",
+		}).Warn("influxDB: both token (v2) and username and password (v1) are set, using token")
+	}
+	if (c.Username == "") != (c.Password == "") {
+		add("influxDB: username and password must be set together")
+	}
+	if c.Bucket == "" && (c.Database == "" || c.RetentionPolicy == "") {
+		add("influxDB: set bucket (v2) or database and retentionPolicy (v1)")
+	}
+	if c.Bucket != "" && c.Database != "" {
+		log.WithFields(log.Fields{
+			"op": "config.Validate",
+		}).Warn("influxDB: both bucket (v2) and database (v1) are set, writing to bucket")
+	}
+	if c.BatchSize < 0 {
+		add("influxDB.batchSize must not be negative")
+	}
+	switch c.Precision {
+	case "", "ns", "us", "ms", "s":
+	default:
+		add("influxDB.precision %q is unknown, must be ns, us, ms, or s", c.Precision)
+	}
+	if c.MaxRetries < 0 {
+		add("influxDB.maxRetries must not be negative")
+	}
+	if c.RetryInterval < 0 || c.MaxRetryInterval < 0 {
+		add("influxDB.retryInterval and maxRetryInterval must not be negative")
+	}
+	if c.RetryInterval > 0 && c.MaxRetryInterval > 0 && c.RetryInterval > c.MaxRetryInterval {
+		add("influxDB.retryInterval %s is longer than maxRetryInterval %s", c.RetryInterval, c.MaxRetryInterval)
+	}
+	if c.MaxRetryBuffer < 0 {
+		add("influxDB.maxRetryBuffer must not be negative")
+	}
+	if c.MaxRetryBuffer > 0 && c.MaxRetries == 0 {
+		add("influxDB.maxRetryBuffer needs influxDB.maxRetries set, since writes are otherwise retried until they succeed")
+	}
+	for i, route := range c.Routes {
+		if len(route.Measurements) == 0 {
+			add("influxDB.routes[%d]: measurements is required", i)
+		}
+		if route.Bucket == "" && (route.Database == "" || route.RetentionPolicy == "") {
+			add("influxDB.routes[%d]: set bucket (v2) or database and retentionPolicy (v1)", i)
+		}
+	}
+	return errs
+}
+
+// checkHTTPURL checks that value is an absolute http or https URL
+func checkHTTPURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must start with http:// or https://", value)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", value)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+// Presets maps the names of foundation presets to their SleepIQ numbers
+var Presets = map[string]int{
+	"favorite": sleepiq.PresetFavorite,
+	"read":     sleepiq.PresetRead,
+	"watch-tv": sleepiq.PresetWatchTV,
+	"flat":     sleepiq.PresetFlat,
+	"zero-g":   sleepiq.PresetZeroG,
+	"snore":    sleepiq.PresetSnore,
+}
+
+// PresetNames lists the names of the foundation presets
+func PresetNames() []string {
+	var names []string
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Account is a SleepIQ account beds are controlled through, with a client
+// logged into it. The running collectors' clients are shared rather than
+// logging in afresh for every action; Username and Password log the client
+// back in should its session have expired.
+type Account struct {
+	Name     string
+	Username string
+	Password string
+	Client   *sleepiq.Client
+}
+
+// Login logs into every configured account with new clients, for when no
+// collector is running to share the clients of
+func Login(ctx context.Context, config *config.Configuration, api sleepiq.Options) ([]Account, error) {
+	var accounts []Account
+	for _, account := range config.SleepIQAccounts() {
+		siq := sleepiq.New(api)
+		err := siq.Login(ctx, account.Username, account.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to log into SleepIQ account %s, %s", account.Username, err)
+		}
+		accounts = append(accounts, Account{
+			Name:     account.Name,
+			Username: account.Username,
+			Password: account.Password,
+			Client:   siq,
+		})
+	}
+	return accounts, nil
+}
+
+// target is a bed of one of the accounts, with the account's client
+type target struct {
+	siq     *sleepiq.Client
+	account string
+	bed     sleepiq.Bed
+}
+
+// findBeds returns the beds of accounts match accepts
+func findBeds(ctx context.Context, accounts []Account, match func(sleepiq.Bed) bool) ([]target, error) {
+	var targets []target
+	for _, account := range accounts {
+		beds, err := account.Client.Beds(ctx)
+		if errors.Is(err, sleepiq.ErrSessionInvalid) {
+			// The collectors of a standby instance don't poll, so nothing
+			// keeps their sessions from expiring
+			err = account.Client.Login(ctx, account.Username, account.Password)
+			if err == nil {
+				beds, err = account.Client.Beds(ctx)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query the beds of SleepIQ account %s, %s", account.Username, err)
+		}
+		for _, bed := range beds.Beds {
+			if match(bed) {
+				targets = append(targets, target{siq: account.Client, account: account.Name, bed: bed})
+			}
+		}
+	}
+	return targets, nil
+}
+
+// findBed returns the bed named bedName, ignoring case, or the only bed of
+// accounts if bedName is empty
+func findBed(ctx context.Context, accounts []Account, bedName string) (target, error) {
+	targets, err := findBeds(ctx, accounts, func(bed sleepiq.Bed) bool {
+		return bedName == "" || strings.EqualFold(bed.Name, bedName)
+	})
+	if err != nil {
+		return target{}, err
+	}
+	switch {
+	case len(targets) == 0 && bedName == "":
+		return target{}, errors.New("no beds found on any configured account")
+	case len(targets) == 0:
+		return target{}, fmt.Errorf("no bed named %s found on any configured account", bedName)
+	case len(targets) > 1 && bedName == "":
+		return target{}, fmt.Errorf("there are %d beds, name one", len(targets))
+	case len(targets) > 1:
+		return target{}, fmt.Errorf("there are %d beds named %s", len(targets), bedName)
+	}
+	return targets[0], nil
+}
+
+// record records action in actions, logging rather than returning failures
+// so they don't mask the outcome of the action itself
+func record(ctx context.Context, actions *audit.Log, action audit.Action, err error) {
+	auditErr := actions.Record(ctx, action, err)
+	if auditErr != nil {
+		log.WithFields(log.Fields{
+			"op":    "control.record",
+			"error": auditErr,
+		}).Error("failed to record control action")
+	}
+}
+
+// sideCode is the SleepIQ code of side, left or right
+func sideCode(side string) (string, error) {
+	switch side {
+	case "left":
+		return "L", nil
+	case "right":
+		return "R", nil
+	}
+	return "", fmt.Errorf("unknown side %q, must be left or right", side)
+}
+
+// StopMotion halts foundation motion on the bed named bedName, ignoring
+// case, or on every bed of accounts if bedName is empty or "all"; each
+// attempt is recorded in actions as coming from origin
+func StopMotion(ctx context.Context, accounts []Account, bedName string, actions *audit.Log, origin audit.Origin) error {
+	all := bedName == "" || strings.EqualFold(bedName, "all")
+	targets, err := findBeds(ctx, accounts, func(bed sleepiq.Bed) bool {
+		return all || strings.EqualFold(bed.Name, bedName)
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(targets) == 0 && all:
+		return errors.New("no beds found on any configured account")
+	case len(targets) == 0:
+		return fmt.Errorf("no bed named %s found on any configured account", bedName)
+	}
+	return stopMotion(ctx, targets, actions, origin)
+}
+
+// stopMotion halts foundation motion on both sides of every target, going
+// on to the rest when one fails
+func stopMotion(ctx context.Context, targets []target, actions *audit.Log, origin audit.Origin) error {
+	var errs []error
+	for _, t := range targets {
+		stopped := true
+		for _, side := range []string{"L", "R"} {
+			err := t.siq.StopMotion(ctx, t.bed.BedID, side)
+			record(ctx, actions, audit.Action{
+				Action:  "stop_motion",
+				Origin:  origin,
+				Account: t.account,
+				BedID:   t.bed.BedID,
+				Params:  map[string]interface{}{"side": side},
+			}, err)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to stop motion on side %s of bed %s, %s", side, t.bed.BedID, err))
+				stopped = false
+			}
+		}
+		if stopped {
+			log.WithFields(log.Fields{
+				"op":      "control.StopMotion",
+				"account": t.account,
+				"bedId":   t.bed.BedID,
+			}).Info("stopped all foundation motion")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetSleepNumber sets the sleep number of side, left or right, of the bed
+// named bedName, or of the only bed if bedName is empty, to number, a
+// multiple of 5 from 5 to 100; the attempt is recorded in actions as coming
+// from origin
+func SetSleepNumber(ctx context.Context, accounts []Account, bedName, side string, number int, actions *audit.Log, origin audit.Origin) error {
+	code, err := sideCode(side)
+	if err != nil {
+		return err
+	}
+	if number < 5 || number > 100 || number%5 != 0 {
+		return fmt.Errorf("sleep number %d must be a multiple of 5 from 5 to 100", number)
+	}
+	t, err := findBed(ctx, accounts, bedName)
+	if err != nil {
+		return err
+	}
+
+	err = t.siq.SetSleepNumber(ctx, t.bed.BedID, code, number)
+	record(ctx, actions, audit.Action{
+		Action:  "set_sleep_number",
+		Origin:  origin,
+		Account: t.account,
+		BedID:   t.bed.BedID,
+		Params:  map[string]interface{}{"side": code, "sleep_number": number},
+	}, err)
+	if err != nil {
+		return fmt.Errorf("failed to set the sleep number of side %s of bed %s, %s", code, t.bed.BedID, err)
+	}
+	log.WithFields(log.Fields{
+		"op":          "control.SetSleepNumber",
+		"account":     t.account,
+		"bedId":       t.bed.BedID,
+		"side":        side,
+		"sleepNumber": number,
+	}).Info("set sleep number")
+	return nil
+}
+
+// SetPreset moves side, left or right, of the foundation of the bed named
+// bedName, or of the only bed if bedName is empty, to the preset named
+// preset, one of Presets; the attempt is recorded in actions as coming from
+// origin
+func SetPreset(ctx context.Context, accounts []Account, bedName, side, preset string, actions *audit.Log, origin audit.Origin) error {
+	code, err := sideCode(side)
+	if err != nil {
+		return err
+	}
+	number, ok := Presets[preset]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, must be one of %s", preset, strings.Join(PresetNames(), ", "))
+	}
+	t, err := findBed(ctx, accounts, bedName)
+	if err != nil {
+		return err
+	}
+
+	err = t.siq.SetFoundationPreset(ctx, t.bed.BedID, code, number)
+	record(ctx, actions, audit.Action{
+		Action:  "set_preset",
+		Origin:  origin,
+		Account: t.account,
+		BedID:   t.bed.BedID,
+		Params:  map[string]interface{}{"side": code, "preset": preset},
+	}, err)
+	if err != nil {
+		return fmt.Errorf("failed to move side %s of bed %s to preset %s, %s", code, t.bed.BedID, preset, err)
+	}
+	log.WithFields(log.Fields{
+		"op":      "control.SetPreset",
+		"account": t.account,
+		"bedId":   t.bed.BedID,
+		"side":    side,
+		"preset":  preset,
+	}).Info("moved foundation to preset")
+	return nil
+}
+
+// SetLight switches the underbed light of side, left or right, of the bed
+// named bedName, or of the only bed if bedName is empty, on or off; the
+// attempt is recorded in actions as coming from origin
+func SetLight(ctx context.Context, accounts []Account, bedName, side string, on bool, actions *audit.Log, origin audit.Origin) error {
+	outlet := sleepiq.OutletLeftLight
+	switch side {
+	case "left":
+	case "right":
+		outlet = sleepiq.OutletRightLight
+	default:
+		return fmt.Errorf("unknown side %q, must be left or right", side)
+	}
+	t, err := findBed(ctx, accounts, bedName)
+	if err != nil {
+		return err
+	}
+
+	err = t.siq.SetOutlet(ctx, t.bed.BedID, outlet, on)
+	record(ctx, actions, audit.Action{
+		Action:  "set_light",
+		Origin:  origin,
+		Account: t.account,
+		BedID:   t.bed.BedID,
+		Params:  map[string]interface{}{"side": side, "on": on},
+	}, err)
+	if err != nil {
+		return fmt.Errorf("failed to switch the %s light of bed %s, %s", side, t.bed.BedID, err)
+	}
+	log.WithFields(log.Fields{
+		"op":      "control.SetLight",
+		"account": t.account,
+		"bedId":   t.bed.BedID,
+		"side":    side,
+		"on":      on,
+	}).Info("switched underbed light")
+	return nil
+}
@@ -0,0 +1,150 @@
+package control
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/audit"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq/sleepiqtest"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testUsername = "sleeper@example.com"
+	testPassword = "secret"
+)
+
+// newAccounts returns an account logged into a mock SleepIQ server with a
+// bed for each of bedNames, along with the server
+func newAccounts(t *testing.T, bedNames ...string) ([]Account, *sleepiqtest.Server) {
+	t.Helper()
+	server := sleepiqtest.NewServer(testUsername, testPassword, bedNames...)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	siq := sleepiq.New(sleepiq.Options{BaseURL: httpServer.URL + sleepiqtest.BasePath, RateLimit: -1})
+	err := siq.Login(context.Background(), testUsername, testPassword)
+	if err != nil {
+		t.Fatalf("failed to log in, %s", err)
+	}
+	return []Account{{Name: "home", Username: testUsername, Password: testPassword, Client: siq}}, server
+}
+
+// sleepNumbers returns the left sleep number of each bed by name
+func sleepNumbers(t *testing.T, accounts []Account) map[string]int {
+	t.Helper()
+	siq := accounts[0].Client
+	beds, err := siq.Beds(context.Background())
+	if err != nil {
+		t.Fatalf("failed to query beds, %s", err)
+	}
+	numbers := make(map[string]int)
+	for _, bed := range beds.Beds {
+		pump, err := siq.PumpStatus(context.Background(), bed.BedID)
+		if err != nil {
+			t.Fatalf("failed to query the pump of bed %s, %s", bed.Name, err)
+		}
+		numbers[bed.Name] = pump.LeftSideSleepNumber
+	}
+	return numbers
+}
+
+func TestSetSleepNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		bedNames []string
+		bed      string
+		// expire expires the account's session first
+		expire  bool
+		want    map[string]int
+		wantErr string
+	}{
+		{
+			name:     "bed by name",
+			bedNames: []string{"Master", "Guest"},
+			bed:      "Guest",
+			want:     map[string]int{"Master": 50, "Guest": 70},
+		},
+		{
+			name:     "name ignoring case",
+			bedNames: []string{"Master", "Guest"},
+			bed:      "master",
+			want:     map[string]int{"Master": 70, "Guest": 50},
+		},
+		{
+			name:     "only bed",
+			bedNames: []string{"Master"},
+			want:     map[string]int{"Master": 70},
+		},
+		{
+			name:     "bed ID",
+			bedNames: []string{"Master"},
+			bed:      "-9223372036854775800",
+			want:     map[string]int{"Master": 50},
+			wantErr:  "no bed named -9223372036854775800",
+		},
+		{
+			name:     "unnamed bed of several",
+			bedNames: []string{"Master", "Guest"},
+			want:     map[string]int{"Master": 50, "Guest": 50},
+			wantErr:  "there are 2 beds, name one",
+		},
+		{
+			name:     "expired session",
+			bedNames: []string{"Master"},
+			bed:      "Master",
+			expire:   true,
+			want:     map[string]int{"Master": 70},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accounts, server := newAccounts(t, test.bedNames...)
+			if test.expire {
+				server.ExpireSessions()
+			}
+			err := SetSleepNumber(context.Background(), accounts, test.bed, "left", 70, nil, audit.Origin{Source: audit.SourceCLI})
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("got error %s, want none", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+			}
+			got := sleepNumbers(t, accounts)
+			for name, want := range test.want {
+				if got[name] != want {
+					t.Errorf("got sleep number %d on bed %s, want %d", got[name], name, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStopMotion(t *testing.T) {
+	tests := []struct {
+		name    string
+		bed     string
+		wantErr string
+	}{
+		{name: "every bed", bed: "all"},
+		{name: "every bed unnamed", bed: ""},
+		{name: "bed by name", bed: "guest"},
+		{name: "unknown bed", bed: "Attic", wantErr: "no bed named Attic"},
+		{name: "bed ID", bed: "-9223372036854775800", wantErr: "no bed named -9223372036854775800"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accounts, _ := newAccounts(t, "Master", "Guest")
+			err := StopMotion(context.Background(), accounts, test.bed, nil, audit.Origin{Source: audit.SourceCLI})
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("got error %s, want none", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
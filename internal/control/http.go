@@ -0,0 +1,48 @@
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// StopMotionHandler serves POST requests halting foundation motion through
+// stop on the bed named by the bed form value, or on every bed without one,
+// with the address of the caller as the client; requests must carry token
+// as a bearer token
+func StopMotionHandler(stop func(ctx context.Context, bed, client string) error, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !tokenMatches(bearerToken(r), token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or wrong bearer token", http.StatusUnauthorized)
+			return
+		}
+		// A caller giving up must not leave a bed half stopped
+		err := stop(context.WithoutCancel(r.Context()), r.FormValue("bed"), r.RemoteAddr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// bearerToken returns the token of the Authorization header of r, if any
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// tokenMatches reports whether got is want, in constant time
+func tokenMatches(got, want string) bool {
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
@@ -0,0 +1,80 @@
+// Package deadman pings an external dead man's switch, such as
+// healthchecks.io, after each successful poll cycle, so the switch alerts
+// once the collector silently stops producing data.
+package deadman
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTimeout bounds a ping when no timeout is configured
+const defaultTimeout = 10 * time.Second
+
+// Pinger requests a URL to report that the collector is still working
+type Pinger struct {
+	url     string
+	client  *http.Client
+	pinging atomic.Bool
+}
+
+// New returns a Pinger requesting pingURL through proxy, or through the
+// proxy environment variables if proxy is nil
+func New(pingURL string, timeout time.Duration, proxy func(*http.Request) (*url.URL, error)) *Pinger {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+	return &Pinger{
+		url: pingURL,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
+// Ping requests the URL, failing on any response other than 2xx
+func (p *Pinger) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build dead man's switch ping, %s", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to ping dead man's switch, %s", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("dead man's switch ping returned %s", resp.Status)
+	}
+	return nil
+}
+
+// PingAsync pings in the background so polling doesn't wait on it, logging
+// any failure; it skips the ping if the previous one is still in flight
+func (p *Pinger) PingAsync() {
+	if !p.pinging.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer p.pinging.Store(false)
+		err := p.Ping(context.Background())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "deadman.PingAsync",
+				"error": err,
+			}).Warn("failed to ping dead man's switch")
+		}
+	}()
+}
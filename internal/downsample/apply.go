@@ -0,0 +1,149 @@
+package downsample
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	influx "github.com/influxdata/influxdb-client-go/v2"
+	influxAPI "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// CreateTasks creates each task in org, along with the bucket it writes to if
+// missing; tasks that already exist by name have their script replaced, so
+// running it again picks up renamed measurements
+func CreateTasks(ctx context.Context, client influx.Client, org string, tasks []Task) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	organization, err := client.OrganizationsAPI().FindOrganizationByName(ctx, org)
+	if err != nil {
+		return fmt.Errorf("failed to find organization %s, %s", org, err)
+	}
+
+	for _, task := range tasks {
+		_, err = client.BucketsAPI().FindBucketByName(ctx, task.Bucket)
+		if err != nil {
+			_, err = client.BucketsAPI().CreateBucketWithNameWithID(ctx, *organization.Id, task.Bucket, domain.RetentionRule{
+				EverySeconds: int64(task.Retention / time.Second),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create bucket %s, %s", task.Bucket, err)
+			}
+			log.WithFields(log.Fields{
+				"op":        "downsample.CreateTasks",
+				"bucket":    task.Bucket,
+				"retention": task.Retention,
+			}).Info("created bucket")
+		}
+
+		existing, err := client.TasksAPI().FindTasks(ctx, &influxAPI.TaskFilter{Name: task.Name, OrgID: *organization.Id})
+		if err != nil {
+			return fmt.Errorf("failed to look up task %s, %s", task.Name, err)
+		}
+		if len(existing) > 0 {
+			existing[0].Flux = task.Flux
+			_, err = client.TasksAPI().UpdateTask(ctx, &existing[0])
+			if err != nil {
+				return fmt.Errorf("failed to update task %s, %s", task.Name, err)
+			}
+			log.WithFields(log.Fields{
+				"op":   "downsample.CreateTasks",
+				"task": task.Name,
+			}).Info("updated task")
+			continue
+		}
+		_, err = client.TasksAPI().CreateTaskByFlux(ctx, task.Flux, *organization.Id)
+		if err != nil {
+			return fmt.Errorf("failed to create task %s, %s", task.Name, err)
+		}
+		log.WithFields(log.Fields{
+			"op":   "downsample.CreateTasks",
+			"task": task.Name,
+		}).Info("created task")
+	}
+	return nil
+}
+
+// Execute runs each statement against the InfluxDB v1 at address in turn;
+// retention policies and continuous queries that already exist are left as
+// they are
+func Execute(ctx context.Context, address, username, password string, skipVerify bool, statements []string) error {
+	client := &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: skipVerify},
+		},
+	}
+	for _, statement := range statements {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(address, "/")+"/query",
+			strings.NewReader(url.Values{"q": {statement}}.Encode()))
+		if err != nil {
+			return fmt.Errorf("failed to build request, %s", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to reach InfluxDB, %s", err)
+		}
+		err = queryError(resp)
+		resp.Body.Close()
+		if err != nil && strings.Contains(err.Error(), "already exists") {
+			log.WithFields(log.Fields{
+				"op":        "downsample.Execute",
+				"statement": statement,
+			}).Info("already exists, leaving it as it is")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to run %s, %s", statement, err)
+		}
+		log.WithFields(log.Fields{
+			"op":        "downsample.Execute",
+			"statement": statement,
+		}).Info("ran statement")
+	}
+	return nil
+}
+
+// queryError returns the error of an InfluxDB v1 query response, if any
+func queryError(resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Error   string `json:"error"`
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if json.Unmarshal(body, &result) != nil && resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	for _, r := range result.Results {
+		if r.Error != "" {
+			return errors.New(r.Error)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("InfluxDB returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
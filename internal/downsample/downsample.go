@@ -0,0 +1,216 @@
+// Package downsample builds the InfluxDB v2 tasks, or v1 continuous queries,
+// that roll the measurements the collector writes up into hourly and daily
+// means, so the raw points need only be kept for a short time.
+package downsample
+
+import (
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rollup is a downsampling of every measurement into the mean of each
+// window of Every, kept for Retention, or forever if zero
+type Rollup struct {
+	Name      string
+	Every     time.Duration
+	Retention time.Duration
+}
+
+// DefaultRollups keeps hourly means for a year and daily means forever
+func DefaultRollups() []Rollup {
+	return []Rollup{
+		{Name: "hourly", Every: time.Hour, Retention: 365 * 24 * time.Hour},
+		{Name: "daily", Every: 24 * time.Hour},
+	}
+}
+
+// measurements lists the numeric fields worth downsampling of each
+// measurement, with %s for the side; fields such as preset names have no
+// mean
+var measurements = []struct {
+	measurement string
+	fields      []string
+}{
+	{"bed_sleeper_state", []string{"%s_sleeper_is_in_bed", "%s_sleep_number", "%s_pressure"}},
+	{"bed_foundation_state", []string{"is_moving", "%s_head_position", "%s_foot_position"}},
+	{"bed_footwarmers_state", []string{"foot_warming_status_%s"}},
+	{"bed_pump_state", []string{"%s_sleep_number"}},
+}
+
+// source is the measurements and fields, as written, in one destination
+type source struct {
+	destination string
+	fields      map[string][]string
+}
+
+// sources groups the measurements by the destination they are written to,
+// ordered by destination
+func sources(names schema.Names) []source {
+	byDestination := make(map[string]map[string][]string)
+	for _, m := range measurements {
+		dest := names.Destination(m.measurement)
+		if byDestination[dest] == nil {
+			byDestination[dest] = make(map[string][]string)
+		}
+		var fields []string
+		for _, field := range m.fields {
+			if !strings.Contains(field, "%s") {
+				fields = append(fields, names.Field(m.measurement, field))
+				continue
+			}
+			for _, side := range []string{"left", "right"} {
+				fields = append(fields, names.Field(m.measurement, fmt.Sprintf(field, side)))
+			}
+		}
+		byDestination[dest][names.Measurement(m.measurement)] = fields
+	}
+
+	var srcs []source
+	for dest, fields := range byDestination {
+		srcs = append(srcs, source{destination: dest, fields: fields})
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		return srcs[i].destination < srcs[j].destination
+	})
+	return srcs
+}
+
+// sortedKeys returns the measurements of fields in order
+func sortedKeys(fields map[string][]string) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Task is an InfluxDB v2 task writing the rollup of the measurements in
+// bucket Source to Bucket, which keeps them for Retention
+type Task struct {
+	Name      string
+	Source    string
+	Bucket    string
+	Retention time.Duration
+	// Flux is the whole script, including its task options
+	Flux string
+}
+
+// Tasks returns a task per rollup of each bucket the collector writes to,
+// named as in names, rolling up into <bucket>_<rollup name>. Measurements
+// written to InfluxDB v1 databases are left out.
+func Tasks(names schema.Names, rollups []Rollup) []Task {
+	var tasks []Task
+	for _, src := range sources(names) {
+		if strings.Contains(src.destination, "/") {
+			continue
+		}
+		var filter []string
+		for _, m := range sortedKeys(src.fields) {
+			var fields []string
+			for _, field := range src.fields[m] {
+				fields = append(fields, fmt.Sprintf("r._field == %q", field))
+			}
+			filter = append(filter, fmt.Sprintf("r._measurement == %q and (%s)", m, strings.Join(fields, " or ")))
+		}
+
+		for _, rollup := range rollups {
+			bucket := src.destination + "_" + rollup.Name
+			name := "downsample " + src.destination + " " + rollup.Name
+			every := fluxDuration(rollup.Every)
+			tasks = append(tasks, Task{
+				Name:      name,
+				Source:    src.destination,
+				Bucket:    bucket,
+				Retention: rollup.Retention,
+				Flux: fmt.Sprintf(`option task = {name: %q, every: %s, offset: 5m}
+
+from(bucket: %q)
+  |> range(start: -task.every)
+  |> filter(fn: (r) => %s)
+  |> aggregateWindow(every: task.every, fn: mean, createEmpty: false)
+  |> to(bucket: %q)
+`, name, every, src.destination, strings.Join(filter, "\n    or "), bucket),
+			})
+		}
+	}
+	return tasks
+}
+
+// fluxDuration formats d as a Flux duration literal
+func fluxDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// Statements returns the InfluxQL creating a retention policy per rollup in
+// each InfluxDB v1 database the collector writes to, named as in names, and
+// a continuous query per rollup of each measurement writing its means there.
+// Measurements written to InfluxDB v2 buckets are left out.
+func Statements(names schema.Names, rollups []Rollup) []string {
+	var statements []string
+	databases := make(map[string]bool)
+	for _, src := range sources(names) {
+		database, rp, ok := strings.Cut(src.destination, "/")
+		if !ok {
+			continue
+		}
+		if !databases[database] {
+			databases[database] = true
+			for _, rollup := range rollups {
+				duration := "INF"
+				if rollup.Retention > 0 {
+					duration = influxQLDuration(rollup.Retention)
+				}
+				statements = append(statements, fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION 1",
+					quoteIdent(rollup.Name), quoteIdent(database), duration))
+			}
+		}
+
+		for _, m := range sortedKeys(src.fields) {
+			var selects []string
+			for _, field := range src.fields[m] {
+				selects = append(selects, fmt.Sprintf("mean(%s) AS %s", quoteIdent(field), quoteIdent(field)))
+			}
+			from := quoteIdent(database) + "." + quoteIdent(rp) + "." + quoteIdent(m)
+			if rp == "" {
+				from = quoteIdent(database) + ".." + quoteIdent(m)
+			}
+			for _, rollup := range rollups {
+				into := quoteIdent(database) + "." + quoteIdent(rollup.Name) + "." + quoteIdent(m)
+				statements = append(statements, fmt.Sprintf("CREATE CONTINUOUS QUERY %s ON %s BEGIN SELECT %s INTO %s FROM %s GROUP BY time(%s), * END",
+					quoteIdent(m+"_"+rollup.Name), quoteIdent(database), strings.Join(selects, ", "), into, from, influxQLDuration(rollup.Every)))
+			}
+		}
+	}
+	return statements
+}
+
+// influxQLDuration formats d as an InfluxQL duration literal
+func influxQLDuration(d time.Duration) string {
+	switch {
+	case d%(7*24*time.Hour) == 0:
+		return fmt.Sprintf("%dw", d/(7*24*time.Hour))
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+}
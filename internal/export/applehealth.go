@@ -0,0 +1,81 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"io"
+	"time"
+)
+
+// appleHealthTime is the time format of Apple Health exports
+const appleHealthTime = "2006-01-02 15:04:05 -0700"
+
+// sourceName names the collector as the source of exported records
+const sourceName = "sleepnumber-stats-collector"
+
+type healthData struct {
+	XMLName    xml.Name       `xml:"HealthData"`
+	Locale     string         `xml:"locale,attr"`
+	ExportDate attrValue      `xml:"ExportDate"`
+	Records    []healthRecord `xml:"Record"`
+}
+
+type attrValue struct {
+	Value string `xml:"value,attr"`
+}
+
+type healthRecord struct {
+	Type         string          `xml:"type,attr"`
+	SourceName   string          `xml:"sourceName,attr"`
+	Device       string          `xml:"device,attr,omitempty"`
+	CreationDate string          `xml:"creationDate,attr"`
+	StartDate    string          `xml:"startDate,attr"`
+	EndDate      string          `xml:"endDate,attr"`
+	Value        string          `xml:"value,attr"`
+	Metadata     []metadataEntry `xml:"MetadataEntry"`
+}
+
+type metadataEntry struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// AppleHealth writes sessions as sleep analysis records of an Apple Health
+// export, in bed for the whole of each session, for apps importing such
+// exports into Health. The bed and side are kept as metadata.
+func AppleHealth(w io.Writer, sessions []sleep.Session) error {
+	now := time.Now()
+	data := healthData{
+		Locale:     "en_US",
+		ExportDate: attrValue{Value: now.Format(appleHealthTime)},
+	}
+	for _, s := range sessions {
+		data.Records = append(data.Records, healthRecord{
+			Type:         "HKCategoryTypeIdentifierSleepAnalysis",
+			SourceName:   sourceName,
+			Device:       fmt.Sprintf("%s (%s)", s.Bed, s.Side),
+			CreationDate: now.Format(appleHealthTime),
+			StartDate:    s.Start.Local().Format(appleHealthTime),
+			EndDate:      s.End.Local().Format(appleHealthTime),
+			Value:        "HKCategoryValueSleepAnalysisInBed",
+			Metadata: []metadataEntry{
+				{Key: "bed", Value: s.Bed},
+				{Key: "side", Value: s.Side},
+			},
+		})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", " ")
+	err = encoder.Encode(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode Apple Health export, %s", err)
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,41 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader is the header row of the generic sleep CSV
+var csvHeader = []string{"bed", "side", "start", "end", "duration_minutes"}
+
+// CSV writes sessions as a generic sleep CSV with a header row and a row per
+// session: the bed and side, the start and end as RFC 3339 times with the
+// local offset, and the duration in whole minutes
+func CSV(w io.Writer, sessions []sleep.Session) error {
+	out := csv.NewWriter(w)
+	err := out.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		err = out.Write([]string{
+			s.Bed,
+			s.Side,
+			s.Start.Local().Format(time.RFC3339),
+			s.End.Local().Format(time.RFC3339),
+			strconv.FormatInt(int64(s.Duration()/time.Minute), 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	if err = out.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV, %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+// Package export writes sleep sessions in the formats of other platforms, so
+// SleepIQ data can be imported where people already track their sleep.
+package export
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"io"
+	"sort"
+)
+
+// Writer writes sleep sessions to w in an export format
+type Writer func(w io.Writer, sessions []sleep.Session) error
+
+// Formats maps the names of the export formats to their writers
+var Formats = map[string]Writer{
+	"apple-health":     AppleHealth,
+	"csv":              CSV,
+	"ics":              ICS,
+	"sleep-as-android": SleepAsAndroid,
+}
+
+// FormatNames lists the names of the export formats
+func FormatNames() []string {
+	var names []string
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,81 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"io"
+	"strings"
+	"time"
+)
+
+// icsTime is the UTC date-time format of iCalendar
+const icsTime = "20060102T150405Z"
+
+// icsLineLength is the most octets of a content line before it is folded
+const icsLineLength = 75
+
+// ICS writes sessions as an iCalendar feed with an event per session, named
+// after the bed and side, for reviewing sleep timing in a calendar app.
+// Events are identified by their bed, side, and start, so a calendar
+// subscribed to the feed updates them rather than adding duplicates.
+func ICS(w io.Writer, sessions []sleep.Session) error {
+	out := bufio.NewWriter(w)
+	line := func(name, value string) {
+		l := name + ":" + value
+		for len(l) > icsLineLength {
+			cut := icsLineLength
+			// Don't split a UTF-8 sequence
+			for cut > 1 && l[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			out.WriteString(l[:cut] + "\r\n")
+			l = " " + l[cut:]
+		}
+		out.WriteString(l + "\r\n")
+	}
+
+	now := time.Now().UTC().Format(icsTime)
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//"+sourceName+"//sleep sessions//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", "SleepIQ sleep")
+	for _, s := range sessions {
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("%s-%s-%d@%s", slug(s.Bed), s.Side, s.Start.Unix(), sourceName))
+		line("DTSTAMP", now)
+		line("DTSTART", s.Start.UTC().Format(icsTime))
+		line("DTEND", s.End.UTC().Format(icsTime))
+		line("SUMMARY", icsText(fmt.Sprintf("Sleep, %s side", s.Side)))
+		line("LOCATION", icsText(s.Bed))
+		d := s.Duration().Round(time.Minute)
+		line("DESCRIPTION", icsText(fmt.Sprintf("In bed for %dh%02dm on the %s side of %s", int(d.Hours()), int(d.Minutes())%60, s.Side, s.Bed)))
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	err := out.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write iCalendar feed, %s", err)
+	}
+	return nil
+}
+
+// icsText escapes s as an iCalendar text value
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// slug makes s usable in identifiers
+func slug(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
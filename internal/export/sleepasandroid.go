@@ -0,0 +1,81 @@
+package export
+
+import (
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sleepAsAndroidTime is the time format of Sleep as Android backups
+const sleepAsAndroidTime = "02. 01. 2006 15:04"
+
+// sleepAsAndroidHeader names the columns of a record without actigraphy
+var sleepAsAndroidHeader = []string{"Id", "Tz", "From", "To", "Sched", "Hours", "Rating", "Comment", "Framerate", "Snore", "Noise", "Cycles", "DeepSleep", "LenAdjust", "Geo"}
+
+// SleepAsAndroid writes sessions as the records of a Sleep as Android CSV
+// backup, each a header row followed by a row of values, for restoring or
+// merging into the app. Sessions carry no actigraphy, rating, or sleep
+// phases, and are tagged #sleepnumber with the bed and side in the comment.
+func SleepAsAndroid(w io.Writer, sessions []sleep.Session) error {
+	loc, tz := localZone()
+	for _, s := range sessions {
+		start := s.Start.In(loc)
+		end := s.End.In(loc)
+		record := []string{
+			strconv.FormatInt(s.Start.UnixMilli(), 10),
+			tz,
+			start.Format(sleepAsAndroidTime),
+			end.Format(sleepAsAndroidTime),
+			end.Format(sleepAsAndroidTime),
+			strconv.FormatFloat(s.Duration().Hours(), 'f', 3, 64),
+			"0.0",
+			fmt.Sprintf("%s, %s side #sleepnumber", s.Bed, s.Side),
+			"10000",
+			"-1",
+			"-1.0",
+			"-1",
+			"-1.0",
+			"0",
+			"",
+		}
+		_, err := fmt.Fprintf(w, "%s\n%s\n", strings.Join(sleepAsAndroidHeader, ","), quoteAll(record))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteAll joins values as CSV, quoting every one as Sleep as Android does
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, ",")
+}
+
+// localZone returns the local time zone and its IANA name, which Sleep as
+// Android needs, from TZ or the /etc/localtime link; when neither names it,
+// times are written in UTC
+func localZone() (*time.Location, string) {
+	name := strings.TrimPrefix(os.Getenv("TZ"), ":")
+	if name == "" {
+		target, err := os.Readlink("/etc/localtime")
+		if err == nil {
+			_, name, _ = strings.Cut(filepath.ToSlash(target), "zoneinfo/")
+		}
+	}
+	if name != "" {
+		loc, err := time.LoadLocation(name)
+		if err == nil {
+			return loc, name
+		}
+	}
+	return time.UTC, "UTC"
+}
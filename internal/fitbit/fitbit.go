@@ -0,0 +1,142 @@
+// Package fitbit reads nightly sleep logs from the Fitbit Web API, so a
+// wearable's view of the night can be compared with the bed's.
+package fitbit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/oauthtoken"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"golang.org/x/oauth2"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Scope is the OAuth scope the stored token needs
+	Scope = "sleep"
+
+	sleepURL       = "https://api.fitbit.com/1.2/user/-/sleep/date/%s/%s.json"
+	requestTimeout = 30 * time.Second
+	// logTime is the format of times in sleep logs, in the user's time zone
+	logTime = "2006-01-02T15:04:05.000"
+)
+
+var endpoint = oauth2.Endpoint{
+	AuthURL:   "https://www.fitbit.com/oauth2/authorize",
+	TokenURL:  "https://api.fitbit.com/oauth2/token",
+	AuthStyle: oauth2.AuthStyleInHeader,
+}
+
+// Client reads the sleep logs of one Fitbit user
+type Client struct {
+	http *http.Client
+}
+
+// New returns a Client authorized by the OAuth token in tokenFile, as JSON
+// with at least a refresh_token, issued to the OAuth client clientID for
+// Scope. Fitbit refresh tokens work only once, so refreshed tokens are
+// written back to tokenFile straight away.
+func New(clientID, clientSecret, tokenFile string) (*Client, error) {
+	token, err := oauthtoken.Open(&oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     endpoint,
+		Scopes:       []string{Scope},
+	}, tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{http: token.Client()}, nil
+}
+
+// Sleep is one sleep log, a night or a nap
+type Sleep struct {
+	LogID               int64  `json:"logId"`
+	DateOfSleep         string `json:"dateOfSleep"`
+	StartTime           string `json:"startTime"`
+	EndTime             string `json:"endTime"`
+	IsMainSleep         bool   `json:"isMainSleep"`
+	Efficiency          int    `json:"efficiency"`
+	MinutesAsleep       int    `json:"minutesAsleep"`
+	MinutesAwake        int    `json:"minutesAwake"`
+	MinutesToFallAsleep int    `json:"minutesToFallAsleep"`
+	TimeInBed           int    `json:"timeInBed"`
+	Levels              struct {
+		Summary map[string]struct {
+			Minutes int `json:"minutes"`
+		} `json:"summary"`
+	} `json:"levels"`
+}
+
+// Sleep returns the sleep logs of the nights from one date to another, as
+// dates in the user's time zone
+func (c *Client) Sleep(ctx context.Context, from, to time.Time) ([]Sleep, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	url := fmt.Sprintf(sleepURL, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request, %s", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Fitbit, %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("Fitbit returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var body struct {
+		Sleep []Sleep `json:"sleep"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Fitbit sleep logs, %s", err)
+	}
+	return body.Sleep, nil
+}
+
+// Point is the wearable_sleep point of s, timestamped with when it started,
+// taking the times of the log to be in loc, and tagged with tags and
+// source=fitbit. Its end is a field in seconds since the epoch, and the
+// minutes in each sleep stage are fields such as deep_minutes.
+func (s Sleep) Point(tags map[string]string, loc *time.Location) (collector.Point, error) {
+	start, err := time.ParseInLocation(logTime, s.StartTime, loc)
+	if err != nil {
+		return collector.Point{}, fmt.Errorf("failed to parse start of sleep log %d, %s", s.LogID, err)
+	}
+	end, err := time.ParseInLocation(logTime, s.EndTime, loc)
+	if err != nil {
+		return collector.Point{}, fmt.Errorf("failed to parse end of sleep log %d, %s", s.LogID, err)
+	}
+
+	pointTags := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		pointTags[k] = v
+	}
+	pointTags["source"] = "fitbit"
+	fields := map[string]interface{}{
+		"end":                    end.Unix(),
+		"is_main_sleep":          collector.BoolToInt(s.IsMainSleep),
+		"efficiency":             s.Efficiency,
+		"minutes_asleep":         s.MinutesAsleep,
+		"minutes_awake":          s.MinutesAwake,
+		"minutes_to_fall_asleep": s.MinutesToFallAsleep,
+		"time_in_bed":            s.TimeInBed,
+	}
+	for stage, summary := range s.Levels.Summary {
+		fields[stage+"_minutes"] = summary.Minutes
+	}
+	return collector.Point{
+		Measurement: "wearable_sleep",
+		Tags:        pointTags,
+		Fields:      fields,
+		Time:        start,
+	}, nil
+}
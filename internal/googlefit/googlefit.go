@@ -0,0 +1,118 @@
+// Package googlefit uploads sleep sessions to Google Fit through its REST
+// API, authorized by a stored OAuth token that it keeps refreshed.
+package googlefit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/oauthtoken"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"golang.org/x/oauth2"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Scope is the OAuth scope the stored token needs
+	Scope = "https://www.googleapis.com/auth/fitness.sleep.write"
+
+	sessionsURL    = "https://www.googleapis.com/fitness/v1/users/me/sessions/"
+	requestTimeout = 30 * time.Second
+	// activitySleep is the Google Fit activity type of sleep
+	activitySleep = 72
+)
+
+var endpoint = oauth2.Endpoint{
+	AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+	TokenURL: "https://oauth2.googleapis.com/token",
+}
+
+// Client uploads sessions to one Google account
+type Client struct {
+	http *http.Client
+}
+
+// New returns a Client authorized by the OAuth token in tokenFile, as JSON
+// with at least a refresh_token, issued to the OAuth client clientID for
+// Scope. Refreshed tokens are written back to tokenFile.
+func New(clientID, clientSecret, tokenFile string) (*Client, error) {
+	token, err := oauthtoken.Open(&oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     endpoint,
+		Scopes:       []string{Scope},
+	}, tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{http: token.Client()}, nil
+}
+
+type fitSession struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Description     string         `json:"description"`
+	StartTimeMillis int64          `json:"startTimeMillis,string"`
+	EndTimeMillis   int64          `json:"endTimeMillis,string"`
+	ActivityType    int            `json:"activityType"`
+	Application     fitApplication `json:"application"`
+}
+
+type fitApplication struct {
+	Name string `json:"name"`
+}
+
+// Upload creates s as a sleep session in Google Fit, or updates it if it was
+// uploaded before, since its ID follows from its bed, side, and start
+func (c *Client) Upload(ctx context.Context, s sleep.Session) error {
+	id := sessionID(s)
+	body, err := json.Marshal(fitSession{
+		ID:              id,
+		Name:            "Sleep",
+		Description:     fmt.Sprintf("%s, %s side, recorded by SleepIQ", s.Bed, s.Side),
+		StartTimeMillis: s.Start.UnixMilli(),
+		EndTimeMillis:   s.End.UnixMilli(),
+		ActivityType:    activitySleep,
+		Application:     fitApplication{Name: "sleepnumber-stats-collector"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode session, %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionsURL+id, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request, %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Google Fit, %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Google Fit returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sessionID identifies a session in Google Fit from its bed, side, and start
+func sessionID(s sleep.Session) string {
+	var b strings.Builder
+	b.WriteString("sleepnumber-")
+	for _, r := range strings.ToLower(s.Bed) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	fmt.Fprintf(&b, "-%s-%d", s.Side, s.Start.Unix())
+	return b.String()
+}
@@ -0,0 +1,255 @@
+// Package grafana builds a ready-made Grafana dashboard for the points the
+// collector writes to InfluxDB, and pushes it through the Grafana API.
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pushTimeout bounds pushing the dashboard
+const pushTimeout = 30 * time.Second
+
+// Query languages of the dashboard's queries
+const (
+	Flux     = "flux"
+	InfluxQL = "influxql"
+)
+
+// Options selects the query language of the dashboard and the names the
+// collector writes under, so the dashboard queries exactly those
+type Options struct {
+	// Language is Flux for InfluxDB v2 or InfluxQL for v1
+	Language string
+	schema.Names
+}
+
+// panel is a graph of one field per side of the bed, or of one field for
+// the whole bed when the field has no %s for the side; panels not perBed
+// graph a measurement without bed tags
+type panel struct {
+	title       string
+	measurement string
+	field       string
+	unit        string
+	stepped     bool
+	perBed      bool
+}
+
+var panels = []panel{
+	{title: "In bed", measurement: "bed_sleeper_state", field: "%s_sleeper_is_in_bed", unit: "bool_yes_no", stepped: true, perBed: true},
+	{title: "Sleep number", measurement: "bed_sleeper_state", field: "%s_sleep_number", unit: "none", stepped: true, perBed: true},
+	{title: "Pressure", measurement: "bed_sleeper_state", field: "%s_pressure", unit: "none", perBed: true},
+	{title: "Head position", measurement: "bed_foundation_state", field: "%s_head_position", unit: "none", stepped: true, perBed: true},
+	{title: "Foot position", measurement: "bed_foundation_state", field: "%s_foot_position", unit: "none", stepped: true, perBed: true},
+	{title: "Foot warming", measurement: "bed_footwarmers_state", field: "foot_warming_status_%s", unit: "none", stepped: true, perBed: true},
+	{title: "Foundation moving", measurement: "bed_foundation_state", field: "is_moving", unit: "bool_yes_no", stepped: true, perBed: true},
+	{title: "SleepIQ API degraded", measurement: "sleepiq_api_state", field: "degraded", unit: "bool_yes_no", stepped: true},
+}
+
+// Dashboard returns the dashboard model, with a variable selecting beds by
+// name and another selecting sides, repeating each per-side panel per side
+func Dashboard(opts Options) map[string]interface{} {
+	var list []interface{}
+	for i, p := range panels {
+		list = append(list, opts.panel(i, p))
+	}
+	return map[string]interface{}{
+		"uid":           "sleepnumber-stats-collector",
+		"title":         "Sleep Number beds",
+		"tags":          []string{"sleepnumber"},
+		"timezone":      "browser",
+		"schemaVersion": 39,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{
+					"name":  "datasource",
+					"label": "Data source",
+					"type":  "datasource",
+					"query": "influxdb",
+				},
+				map[string]interface{}{
+					"name":       "bed",
+					"label":      "Bed",
+					"type":       "query",
+					"datasource": datasource,
+					"query":      opts.bedQuery(),
+					"refresh":    2,
+					"multi":      true,
+					"includeAll": true,
+					"current":    map[string]interface{}{"text": "All", "value": "$__all"},
+				},
+				map[string]interface{}{
+					"name":       "side",
+					"label":      "Side",
+					"type":       "custom",
+					"query":      "left,right",
+					"multi":      true,
+					"includeAll": true,
+					"current":    map[string]interface{}{"text": "All", "value": "$__all"},
+					"options": []interface{}{
+						map[string]interface{}{"text": "left", "value": "left", "selected": false},
+						map[string]interface{}{"text": "right", "value": "right", "selected": false},
+					},
+				},
+			},
+		},
+		"panels": list,
+	}
+}
+
+// datasource points every query at the data source variable
+var datasource = map[string]string{"type": "influxdb", "uid": "${datasource}"}
+
+// panel returns the model of the i-th panel
+func (o Options) panel(i int, p panel) map[string]interface{} {
+	model := map[string]interface{}{
+		"id":         i + 1,
+		"type":       "timeseries",
+		"title":      p.title,
+		"datasource": datasource,
+		"gridPos":    map[string]int{"x": 0, "y": i * 8, "w": 24, "h": 8},
+		"fieldConfig": map[string]interface{}{
+			"defaults": map[string]interface{}{
+				"unit": p.unit,
+				"custom": map[string]interface{}{
+					"lineInterpolation": map[bool]string{true: "stepAfter", false: "linear"}[p.stepped],
+				},
+			},
+			"overrides": []interface{}{},
+		},
+	}
+
+	if !strings.Contains(p.field, "%s") {
+		model["targets"] = []interface{}{o.target("A", p, o.Field(p.measurement, p.field))}
+		return model
+	}
+
+	// Fields renamed differently per side can't be picked by the side
+	// variable, so they get a query per side instead of a panel per side
+	left := o.Field(p.measurement, fmt.Sprintf(p.field, "left"))
+	right := o.Field(p.measurement, fmt.Sprintf(p.field, "right"))
+	templated := strings.Replace(left, "left", "${side}", 1)
+	if templated != strings.Replace(right, "right", "${side}", 1) {
+		model["targets"] = []interface{}{
+			o.target("A", p, left),
+			o.target("B", p, right),
+		}
+		return model
+	}
+	model["title"] = p.title + " (${side})"
+	model["repeat"] = "side"
+	model["repeatDirection"] = "h"
+	model["maxPerRow"] = 2
+	model["targets"] = []interface{}{o.target("A", p, templated)}
+	return model
+}
+
+// target is a query of one field of the panel's measurement, per bed for
+// panels perBed
+func (o Options) target(refID string, p panel, field string) map[string]interface{} {
+	name := o.Tag("name")
+	dest := o.Destination(p.measurement)
+	m := o.Measurement(p.measurement)
+	if o.Language == Flux {
+		query := fmt.Sprintf("from(bucket: %q)\n"+
+			"  |> range(start: v.timeRangeStart, stop: v.timeRangeStop)\n"+
+			"  |> filter(fn: (r) => r._measurement == %q and r._field == %q)\n", dest, m, field)
+		if p.perBed {
+			query += fmt.Sprintf("  |> filter(fn: (r) => contains(value: r[%q], set: ${bed:json}))\n", name)
+		}
+		query += "  |> aggregateWindow(every: v.windowPeriod, fn: last, createEmpty: false)\n"
+		if p.perBed {
+			query += fmt.Sprintf("  |> group(columns: [%q])\n", name)
+		}
+		return map[string]interface{}{
+			"refId":      refID,
+			"datasource": datasource,
+			"query":      query + fmt.Sprintf(`  |> keep(columns: ["_time", "_value", %q])`, name),
+		}
+	}
+
+	from := quoteIdent(m)
+	if database, rp, ok := strings.Cut(dest, "/"); ok {
+		from = quoteIdent(database) + "." + quoteIdent(rp) + "." + from
+	}
+	target := map[string]interface{}{
+		"refId":        refID,
+		"datasource":   datasource,
+		"rawQuery":     true,
+		"resultFormat": "time_series",
+		"alias":        field,
+		"query": fmt.Sprintf("SELECT last(%s) FROM %s WHERE $timeFilter GROUP BY time($__interval) fill(none)",
+			quoteIdent(field), from),
+	}
+	if p.perBed {
+		target["alias"] = "$tag_" + name + " " + field
+		target["query"] = fmt.Sprintf("SELECT last(%s) FROM %s WHERE %s =~ /^${bed:regex}$/ AND $timeFilter GROUP BY time($__interval), %s fill(none)",
+			quoteIdent(field), from, quoteIdent(name), quoteIdent(name))
+	}
+	return target
+}
+
+// bedQuery lists the names of the beds for the bed variable
+func (o Options) bedQuery() string {
+	name := o.Tag("name")
+	dest := o.Destination("bed_sleeper_state")
+	m := o.Measurement("bed_sleeper_state")
+	if o.Language == Flux {
+		return fmt.Sprintf("import \"influxdata/influxdb/schema\"\n"+
+			"schema.tagValues(bucket: %q, tag: %q, predicate: (r) => r._measurement == %q)", dest, name, m)
+	}
+	query := fmt.Sprintf("SHOW TAG VALUES FROM %s WITH KEY = %s", quoteIdent(m), quoteIdent(name))
+	if database, rp, ok := strings.Cut(dest, "/"); ok {
+		query = fmt.Sprintf("SHOW TAG VALUES ON %s FROM %s.%s WITH KEY = %s", quoteIdent(database), quoteIdent(rp), quoteIdent(m), quoteIdent(name))
+	}
+	return query
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+}
+
+// Push creates or updates the dashboard in the Grafana at baseURL, which
+// must accept token for a service account allowed to write dashboards
+func Push(ctx context.Context, baseURL, token string, dashboard map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"dashboard": dashboard,
+		"overwrite": true,
+		"message":   "Provisioned by sleepnumber-stats-collector",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode dashboard, %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(baseURL, "/") + "/api/dashboards/db"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request to %s, %s", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Grafana at %s, %s", baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Grafana returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
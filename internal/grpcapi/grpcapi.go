@@ -0,0 +1,363 @@
+// Package grpcapi serves the gRPC API defined in pkg/sleepnumberpb: the
+// state of the beds, built from the points the collector publishes, and
+// control of them through a Controller.
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/stream"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepnumberpb"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shutdownTimeout bounds waiting for calls in progress on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Controller controls the beds, recording each action as asked for by
+// client
+type Controller interface {
+	// SetSleepNumber sets the sleep number of side, left or right, of the bed
+	// named bed, or of the only bed if bed is empty
+	SetSleepNumber(ctx context.Context, bed, side string, number int, client string) error
+	// SetPreset moves side of the foundation of the bed named bed, or of the
+	// only bed if bed is empty, to the preset named preset
+	SetPreset(ctx context.Context, bed, side, preset string, client string) error
+	// StopMotion halts foundation motion on the bed named bed, or on every
+	// bed if bed is empty
+	StopMotion(ctx context.Context, bed string, client string) error
+}
+
+// presets maps presets to the names Controller knows them by
+var presets = map[sleepnumberpb.Preset]string{
+	sleepnumberpb.Preset_PRESET_FAVORITE: "favorite",
+	sleepnumberpb.Preset_PRESET_READ:     "read",
+	sleepnumberpb.Preset_PRESET_WATCH_TV: "watch-tv",
+	sleepnumberpb.Preset_PRESET_FLAT:     "flat",
+	sleepnumberpb.Preset_PRESET_ZERO_G:   "zero-g",
+	sleepnumberpb.Preset_PRESET_SNORE:    "snore",
+}
+
+// Server implements sleepnumberpb.SleepNumberServer
+type Server struct {
+	sleepnumberpb.UnimplementedSleepNumberServer
+
+	names   schema.Names
+	control Controller
+	token   string
+
+	mu      sync.Mutex
+	time    time.Time
+	beds    map[string]*sleepnumberpb.Bed
+	changes *stream.Broadcaster[*sleepnumberpb.State]
+}
+
+// NewServer returns a Server with no beds yet, reading points named as
+// names says, controlling the beds through control, or refusing to if it is
+// nil, and requiring calls to carry token as a bearer token if it is set
+func NewServer(names schema.Names, control Controller, token string) *Server {
+	return &Server{
+		names:   names,
+		control: control,
+		token:   token,
+		beds:    make(map[string]*sleepnumberpb.Bed),
+		changes: stream.NewBroadcaster[*sleepnumberpb.State](),
+	}
+}
+
+// Update merges p into the state if it is about a bed's sleepers or
+// foundation, and sends the new state to every WatchState call
+func (s *Server) Update(p collector.Point) {
+	sleepers := p.Measurement == s.names.Renamed("bed_sleeper_state")
+	foundation := p.Measurement == s.names.Renamed("bed_foundation_state")
+	if !sleepers && !foundation {
+		return
+	}
+	name := p.Tags[s.names.Tag("name")]
+	if name == "" {
+		return
+	}
+	account := p.Tags[s.names.Tag("account")]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := account + "/" + name
+	bed := s.beds[key]
+	if bed == nil {
+		bed = &sleepnumberpb.Bed{
+			Name:    name,
+			Account: account,
+			Left:    &sleepnumberpb.BedSide{},
+			Right:   &sleepnumberpb.BedSide{},
+		}
+		s.beds[key] = bed
+	}
+	if bed.Time == nil || p.Time.After(bed.Time.AsTime()) {
+		bed.Time = timestamppb.New(p.Time)
+	}
+	if p.Time.After(s.time) {
+		s.time = p.Time
+	}
+	field := func(f string) int32 {
+		return intValue(p.Fields[s.names.Field(p.Measurement, f)])
+	}
+	for side, state := range map[string]*sleepnumberpb.BedSide{"left": bed.Left, "right": bed.Right} {
+		if sleepers {
+			state.InBed = field(side+"_sleeper_is_in_bed") != 0
+			state.SleepNumber = field(side + "_sleep_number")
+			state.Pressure = field(side + "_pressure")
+		} else {
+			state.HeadPosition = field(side + "_head_position")
+			state.FootPosition = field(side + "_foot_position")
+		}
+	}
+	if foundation {
+		bed.FoundationMoving = field("is_moving") != 0
+	}
+	s.changes.Send(s.state())
+}
+
+// intValue converts a field value to an int32, or 0 if it isn't a number;
+// strings are taken as hex, as SleepIQ sends foundation positions
+func intValue(v interface{}) int32 {
+	switch v := v.(type) {
+	case string:
+		n, _ := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(v), "0x"), 16, 32)
+		return int32(n)
+	case int:
+		return int32(v)
+	case int8:
+		return int32(v)
+	case int16:
+		return int32(v)
+	case int32:
+		return v
+	case int64:
+		return int32(v)
+	case float64:
+		return int32(v)
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+// state returns a copy of the state; s.mu must be held
+func (s *Server) state() *sleepnumberpb.State {
+	keys := make([]string, 0, len(s.beds))
+	for key := range s.beds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	state := &sleepnumberpb.State{Beds: make([]*sleepnumberpb.Bed, 0, len(keys))}
+	if !s.time.IsZero() {
+		state.Time = timestamppb.New(s.time)
+	}
+	for _, key := range keys {
+		state.Beds = append(state.Beds, proto.Clone(s.beds[key]).(*sleepnumberpb.Bed))
+	}
+	return state
+}
+
+// Close ends every WatchState call
+func (s *Server) Close() {
+	s.changes.Close()
+}
+
+// GetState returns the current state
+func (s *Server) GetState(ctx context.Context, req *sleepnumberpb.GetStateRequest) (*sleepnumberpb.State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state(), nil
+}
+
+// WatchState sends the current state and then every change to it
+func (s *Server) WatchState(req *sleepnumberpb.WatchStateRequest, watch grpc.ServerStreamingServer[sleepnumberpb.State]) error {
+	changes, stop := s.changes.Listen()
+	defer stop()
+	s.mu.Lock()
+	state := s.state()
+	s.mu.Unlock()
+	err := watch.Send(state)
+	for err == nil {
+		select {
+		case <-watch.Context().Done():
+			return watch.Context().Err()
+		case state, ok := <-changes:
+			if !ok {
+				return status.Error(codes.Unavailable, "the collector is stopping")
+			}
+			err = watch.Send(state)
+		}
+	}
+	return err
+}
+
+// SetSleepNumber sets a sleep number through the Controller
+func (s *Server) SetSleepNumber(ctx context.Context, req *sleepnumberpb.SetSleepNumberRequest) (*sleepnumberpb.SetSleepNumberResponse, error) {
+	side, err := s.checkControl(req.GetSide())
+	if err != nil {
+		return nil, err
+	}
+	number := req.GetSleepNumber()
+	if number < 5 || number > 100 || number%5 != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "sleep number %d must be a multiple of 5 from 5 to 100", number)
+	}
+	err = s.control.SetSleepNumber(ctx, req.GetBed(), side, int(number), client(ctx))
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &sleepnumberpb.SetSleepNumberResponse{}, nil
+}
+
+// RecallPreset moves a foundation to a preset through the Controller
+func (s *Server) RecallPreset(ctx context.Context, req *sleepnumberpb.RecallPresetRequest) (*sleepnumberpb.RecallPresetResponse, error) {
+	side, err := s.checkControl(req.GetSide())
+	if err != nil {
+		return nil, err
+	}
+	preset, ok := presets[req.GetPreset()]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown preset %s", req.GetPreset())
+	}
+	err = s.control.SetPreset(ctx, req.GetBed(), side, preset, client(ctx))
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &sleepnumberpb.RecallPresetResponse{}, nil
+}
+
+// StopMotion halts foundation motion through the Controller
+func (s *Server) StopMotion(ctx context.Context, req *sleepnumberpb.StopMotionRequest) (*sleepnumberpb.StopMotionResponse, error) {
+	if s.control == nil {
+		return nil, errControlDisabled
+	}
+	err := s.control.StopMotion(ctx, req.GetBed(), client(ctx))
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &sleepnumberpb.StopMotionResponse{}, nil
+}
+
+// errControlDisabled answers control calls without a Controller
+var errControlDisabled = status.Error(codes.PermissionDenied, "control of the beds is disabled")
+
+// checkControl returns the name of side if the beds may be controlled
+func (s *Server) checkControl(side sleepnumberpb.Side) (string, error) {
+	if s.control == nil {
+		return "", errControlDisabled
+	}
+	switch side {
+	case sleepnumberpb.Side_SIDE_LEFT:
+		return "left", nil
+	case sleepnumberpb.Side_SIDE_RIGHT:
+		return "right", nil
+	}
+	return "", status.Error(codes.InvalidArgument, "side must be left or right")
+}
+
+// client is the address of the peer making the call of ctx
+func client(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+// authorize checks the bearer token of the call of ctx, if one is required
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		scheme, t, ok := strings.Cut(v, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(t)
+		}
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		return status.Error(codes.Unauthenticated, "missing or wrong bearer token")
+	}
+	return nil
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := s.authorize(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// Serve serves s on listener until ctx is cancelled, over TLS if creds is
+// not nil, then ends every call, giving those in progress a moment to
+// finish
+func Serve(ctx context.Context, listener net.Listener, s *Server, creds credentials.TransportCredentials) error {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryAuth),
+		grpc.ChainStreamInterceptor(s.streamAuth),
+	}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	server := grpc.NewServer(opts...)
+	sleepnumberpb.RegisterSleepNumberServer(server, s)
+	go func() {
+		<-ctx.Done()
+		s.Close()
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			server.Stop()
+		}
+	}()
+
+	log.WithFields(log.Fields{
+		"op":      "grpcapi.Serve",
+		"address": listener.Addr().String(),
+	}).Info("serving the gRPC API")
+	err := server.Serve(listener)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to serve the gRPC API, %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepnumberpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+// fakeController records the calls made to control the beds, failing them
+// with err if it is set
+type fakeController struct {
+	err error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeController) record(call string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	return f.err
+}
+
+func (f *fakeController) SetSleepNumber(ctx context.Context, bed, side string, number int, client string) error {
+	return f.record("sleep number " + bed + " " + side)
+}
+
+func (f *fakeController) SetPreset(ctx context.Context, bed, side, preset string, client string) error {
+	return f.record("preset " + bed + " " + side + " " + preset)
+}
+
+func (f *fakeController) StopMotion(ctx context.Context, bed string, client string) error {
+	return f.record("stop motion " + bed)
+}
+
+func (f *fakeController) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// startServer serves s on a local port until the test ends and returns a
+// client of it
+func startServer(t *testing.T, s *Server) sleepnumberpb.SleepNumberClient {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, listener, s, nil)
+	}()
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to serve, %s", err)
+		}
+	})
+	return sleepnumberpb.NewSleepNumberClient(conn)
+}
+
+func TestUpdate(t *testing.T) {
+	at := time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC)
+	sleepers := collector.Point{
+		Measurement: "bed_sleeper_state",
+		Tags:        map[string]string{"name": "Master", "account": "home"},
+		Fields: map[string]interface{}{
+			"left_sleeper_is_in_bed":  true,
+			"left_sleep_number":       int64(45),
+			"left_pressure":           int64(1200),
+			"right_sleeper_is_in_bed": false,
+			"right_sleep_number":      int64(60),
+		},
+		Time: at,
+	}
+	foundation := collector.Point{
+		Measurement: "bed_foundation_state",
+		Tags:        map[string]string{"name": "Master", "account": "home"},
+		Fields: map[string]interface{}{
+			"left_head_position":  "0x1e",
+			"right_foot_position": int64(10),
+			"is_moving":           true,
+		},
+		Time: at.Add(time.Minute),
+	}
+
+	tests := []struct {
+		name   string
+		names  schema.Names
+		points []collector.Point
+		want   *sleepnumberpb.State
+	}{
+		{
+			name: "no points",
+			want: &sleepnumberpb.State{Beds: []*sleepnumberpb.Bed{}},
+		},
+		{
+			name:   "sleepers and foundation",
+			points: []collector.Point{sleepers, foundation},
+			want: &sleepnumberpb.State{
+				Time: timestamppb.New(at.Add(time.Minute)),
+				Beds: []*sleepnumberpb.Bed{{
+					Name:             "Master",
+					Account:          "home",
+					Time:             timestamppb.New(at.Add(time.Minute)),
+					Left:             &sleepnumberpb.BedSide{InBed: true, SleepNumber: 45, Pressure: 1200, HeadPosition: 30},
+					Right:            &sleepnumberpb.BedSide{SleepNumber: 60, FootPosition: 10},
+					FoundationMoving: true,
+				}},
+			},
+		},
+		{
+			name:   "other measurements and unnamed beds are ignored",
+			points: []collector.Point{{Measurement: "bed_status", Tags: sleepers.Tags, Time: at}, {Measurement: "bed_sleeper_state", Time: at}},
+			want:   &sleepnumberpb.State{Beds: []*sleepnumberpb.Bed{}},
+		},
+		{
+			name: "renamed measurements and tags",
+			names: schema.Names{
+				RenameMeasurements: map[string]string{"bed_sleeper_state": "sleepers"},
+				RenameTags:         map[string]string{"name": "bed"},
+			},
+			points: []collector.Point{{
+				Measurement: "sleepers",
+				Tags:        map[string]string{"bed": "Guest"},
+				Fields:      map[string]interface{}{"right_sleep_number": 35.0},
+				Time:        at,
+			}},
+			want: &sleepnumberpb.State{
+				Time: timestamppb.New(at),
+				Beds: []*sleepnumberpb.Bed{{
+					Name:  "Guest",
+					Time:  timestamppb.New(at),
+					Left:  &sleepnumberpb.BedSide{},
+					Right: &sleepnumberpb.BedSide{SleepNumber: 35},
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer(test.names, nil, "")
+			for _, p := range test.points {
+				s.Update(p)
+			}
+			got, err := s.GetState(context.Background(), &sleepnumberpb.GetStateRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, test.want) {
+				t.Errorf("got state %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestControl(t *testing.T) {
+	setSleepNumber := func(client sleepnumberpb.SleepNumberClient, ctx context.Context) error {
+		_, err := client.SetSleepNumber(ctx, &sleepnumberpb.SetSleepNumberRequest{Bed: "Master", Side: sleepnumberpb.Side_SIDE_LEFT, SleepNumber: 40})
+		return err
+	}
+
+	tests := []struct {
+		name string
+		// disabled leaves the server without a Controller
+		disabled bool
+		token    string
+		err      error
+		call     func(client sleepnumberpb.SleepNumberClient, ctx context.Context) error
+		want     codes.Code
+		// wantCalls are the calls that reached the Controller
+		wantCalls []string
+	}{
+		{
+			name:      "set sleep number",
+			token:     testToken,
+			call:      setSleepNumber,
+			wantCalls: []string{"sleep number Master left"},
+		},
+		{
+			name:  "wrong token",
+			token: "wrong",
+			call:  setSleepNumber,
+			want:  codes.Unauthenticated,
+		},
+		{
+			name: "no token",
+			call: setSleepNumber,
+			want: codes.Unauthenticated,
+		},
+		{
+			name:     "control disabled",
+			disabled: true,
+			token:    testToken,
+			call:     setSleepNumber,
+			want:     codes.PermissionDenied,
+		},
+		{
+			name:  "sleep number out of range",
+			token: testToken,
+			call: func(client sleepnumberpb.SleepNumberClient, ctx context.Context) error {
+				_, err := client.SetSleepNumber(ctx, &sleepnumberpb.SetSleepNumberRequest{Side: sleepnumberpb.Side_SIDE_RIGHT, SleepNumber: 42})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name:  "no side",
+			token: testToken,
+			call: func(client sleepnumberpb.SleepNumberClient, ctx context.Context) error {
+				_, err := client.SetSleepNumber(ctx, &sleepnumberpb.SetSleepNumberRequest{SleepNumber: 40})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name:  "recall preset",
+			token: testToken,
+			call: func(client sleepnumberpb.SleepNumberClient, ctx context.Context) error {
+				_, err := client.RecallPreset(ctx, &sleepnumberpb.RecallPresetRequest{Side: sleepnumberpb.Side_SIDE_RIGHT, Preset: sleepnumberpb.Preset_PRESET_ZERO_G})
+				return err
+			},
+			wantCalls: []string{"preset  right zero-g"},
+		},
+		{
+			name:  "unknown preset",
+			token: testToken,
+			call: func(client sleepnumberpb.SleepNumberClient, ctx context.Context) error {
+				_, err := client.RecallPreset(ctx, &sleepnumberpb.RecallPresetRequest{Side: sleepnumberpb.Side_SIDE_LEFT})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name:  "stop motion",
+			token: testToken,
+			call: func(client sleepnumberpb.SleepNumberClient, ctx context.Context) error {
+				_, err := client.StopMotion(ctx, &sleepnumberpb.StopMotionRequest{Bed: "Master"})
+				return err
+			},
+			wantCalls: []string{"stop motion Master"},
+		},
+		{
+			name:      "controller error",
+			token:     testToken,
+			err:       errors.New("bed is offline"),
+			call:      setSleepNumber,
+			want:      codes.Unknown,
+			wantCalls: []string{"sleep number Master left"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			control := &fakeController{err: test.err}
+			s := NewServer(schema.Names{}, control, testToken)
+			if test.disabled {
+				s = NewServer(schema.Names{}, nil, testToken)
+			}
+			client := startServer(t, s)
+
+			ctx := context.Background()
+			if test.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+test.token)
+			}
+			err := test.call(client, ctx)
+			if got := status.Code(err); got != test.want {
+				t.Errorf("got code %s from %v, want %s", got, err, test.want)
+			}
+			if got := control.recorded(); !reflect.DeepEqual(got, test.wantCalls) {
+				t.Errorf("got calls %q, want %q", got, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWatchState(t *testing.T) {
+	s := NewServer(schema.Names{}, nil, "")
+	client := startServer(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.WatchState(ctx, &sleepnumberpb.WatchStateRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// update, when set, is the sleep number of the left side published
+		// before receiving
+		update   int64
+		wantBeds int
+	}{
+		{
+			name: "current state first",
+		},
+		{
+			name:     "then every change",
+			update:   50,
+			wantBeds: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.update != 0 {
+				s.Update(collector.Point{
+					Measurement: "bed_sleeper_state",
+					Tags:        map[string]string{"name": "Master"},
+					Fields:      map[string]interface{}{"left_sleep_number": test.update},
+					Time:        time.Now(),
+				})
+			}
+			state, err := watch.Recv()
+			if err != nil {
+				t.Fatalf("failed to receive state, %s", err)
+			}
+			if len(state.GetBeds()) != test.wantBeds {
+				t.Fatalf("got %d beds, want %d", len(state.GetBeds()), test.wantBeds)
+			}
+			if test.update != 0 && int64(state.GetBeds()[0].GetLeft().GetSleepNumber()) != test.update {
+				t.Errorf("got sleep number %d, want %d", state.GetBeds()[0].GetLeft().GetSleepNumber(), test.update)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package health serves liveness and readiness endpoints for Docker and
+// Kubernetes health checks.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// checkTimeout bounds a readiness check, which may reach out to sinks
+const checkTimeout = 5 * time.Second
+
+// shutdownTimeout bounds waiting for in-flight requests when stopping
+const shutdownTimeout = 5 * time.Second
+
+// Cause is the kind of problem keeping the collector from being ready, so
+// orchestrators and people can tell what is wrong without reading logs
+type Cause string
+
+const (
+	// AuthFailing means SleepIQ rejects the account's login or session
+	AuthFailing Cause = "auth_failing"
+	// APIUnreachable means requests to SleepIQ fail for other reasons, such
+	// as network errors, server errors, or an open circuit breaker
+	APIUnreachable Cause = "api_unreachable"
+	// SinkUnreachable means a sink can't be written to
+	SinkUnreachable Cause = "sink_unreachable"
+	// StaleData means polling hasn't succeeded recently without any request
+	// failing, such as while the poll loop is stuck
+	StaleData Cause = "stale_data"
+)
+
+// Problem is one reason the collector isn't ready
+type Problem struct {
+	// Component is the kind of thing with the problem, account or sink
+	Component string `json:"component"`
+	// Name is the account or sink with the problem
+	Name  string `json:"name"`
+	Cause Cause  `json:"cause"`
+	Error string `json:"error"`
+}
+
+// Readiness is the body of every /readyz response
+type Readiness struct {
+	// Status is ready or not_ready
+	Status string `json:"status"`
+	// Causes lists the distinct causes among Problems
+	Causes   []Cause   `json:"causes,omitempty"`
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+// Check reports the problems keeping the collector from being ready, or
+// none if it is
+type Check func(ctx context.Context) []Problem
+
+// Register adds /healthz, which answers as long as the process is up, and
+// /readyz, which answers with the problems found by ready as JSON, with a
+// 503 status while there are any
+func Register(mux *http.ServeMux, ready Check) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		body := Readiness{Status: "ready", Problems: ready(ctx)}
+		status := http.StatusOK
+		if len(body.Problems) > 0 {
+			body.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+			for _, problem := range body.Problems {
+				if !slices.Contains(body.Causes, problem.Cause) {
+					body.Causes = append(body.Causes, problem.Cause)
+				}
+			}
+			log.WithFields(log.Fields{
+				"op":     "health.readyz",
+				"causes": body.Causes,
+			}).Debug("readiness check failed")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// Serve serves handler on listener until ctx is cancelled
+func Serve(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	// Requests share ctx, so long-lived streams end on shutdown rather than
+	// holding it up
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: checkTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.WithFields(log.Fields{
+		"op":      "health.Serve",
+		"address": listener.Addr().String(),
+	}).Info("serving health checks")
+	err := server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
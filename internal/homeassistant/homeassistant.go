@@ -0,0 +1,98 @@
+// Package homeassistant integrates with the Home Assistant Supervisor when the
+// collector runs as an add-on: finding the MQTT broker it provides and
+// restricting the status page to ingress.
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// OptionsPath is where the Supervisor writes the add-on's options
+	OptionsPath = "/data/options.json"
+	// StateFile is kept in the add-on's persistent data directory
+	StateFile = "/data/state.json"
+	// DefaultIngressPort is the port the status page is served on for ingress
+	DefaultIngressPort = 8099
+
+	supervisorURL     = "http://supervisor"
+	supervisorTimeout = 10 * time.Second
+	// ingressGateway is the address ingress requests come from
+	ingressGateway = "172.30.32.2"
+)
+
+// Broker is an MQTT broker provided by another add-on, such as Mosquitto
+type Broker struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	SSL      bool   `json:"ssl"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// URL is the address of the broker in the form the MQTT sink expects
+func (b Broker) URL() string {
+	scheme := "tcp"
+	if b.SSL {
+		scheme = "ssl"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(b.Host, fmt.Sprint(b.Port)))
+}
+
+// MQTTBroker asks the Supervisor for the MQTT broker available to add-ons,
+// which needs mqtt:want in the add-on's config
+func MQTTBroker(ctx context.Context) (Broker, error) {
+	token := os.Getenv("SUPERVISOR_TOKEN")
+	if token == "" {
+		return Broker{}, errors.New("SUPERVISOR_TOKEN is not set, so not running under the Home Assistant Supervisor")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, supervisorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, supervisorURL+"/services/mqtt", nil)
+	if err != nil {
+		return Broker{}, fmt.Errorf("failed to build Supervisor request, %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Broker{}, fmt.Errorf("failed to reach the Supervisor, %s", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Result  string `json:"result"`
+		Message string `json:"message"`
+		Data    Broker `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return Broker{}, fmt.Errorf("failed to decode Supervisor response, %s", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Result != "ok" {
+		return Broker{}, fmt.Errorf("no MQTT broker available, install the Mosquitto broker add-on or set mqtt.broker; the Supervisor returned status %d: %s", resp.StatusCode, body.Message)
+	}
+	return body.Data, nil
+}
+
+// IngressOnly serves next only to Home Assistant's ingress proxy and to
+// local requests, so the page is only reachable through Home Assistant's
+// authentication
+func IngressOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		ip := net.ParseIP(host)
+		if err != nil || ip == nil || !ip.IsLoopback() && host != ingressGateway {
+			http.Error(w, "only available through Home Assistant ingress", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,195 @@
+package homekit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HAP types of the services served, in their short form
+const (
+	serviceAccessoryInformation = "3E"
+	serviceProtocolInformation  = "A2"
+	serviceOccupancySensor      = "86"
+	serviceLightbulb            = "43"
+)
+
+// HAP types of the characteristics served, in their short form
+const (
+	characteristicIdentify          = "14"
+	characteristicManufacturer      = "20"
+	characteristicModel             = "21"
+	characteristicName              = "23"
+	characteristicSerialNumber      = "30"
+	characteristicFirmwareRevision  = "52"
+	characteristicVersion           = "37"
+	characteristicOccupancyDetected = "71"
+	characteristicOn                = "25"
+)
+
+// Permissions of characteristics
+const (
+	permRead   = "pr"
+	permWrite  = "pw"
+	permEvents = "ev"
+)
+
+// firmwareRevision is the firmware revision of every accessory, which HAP
+// requires to be of the form x.y.z
+const firmwareRevision = "1.0.0"
+
+// characteristic is a value of a service
+type characteristic struct {
+	iid    uint64
+	typ    string
+	format string
+	perms  []string
+	// value is nil for characteristics that can't be read
+	value interface{}
+}
+
+// can reports whether perm is among the permissions of ch
+func (ch *characteristic) can(perm string) bool {
+	for _, p := range ch.perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns ch as the accessory database lists it
+func (ch *characteristic) describe() map[string]interface{} {
+	d := map[string]interface{}{
+		"iid":    ch.iid,
+		"type":   ch.typ,
+		"format": ch.format,
+		"perms":  ch.perms,
+	}
+	if ch.can(permRead) {
+		d["value"] = ch.value
+	}
+	return d
+}
+
+// service is a group of characteristics of an accessory
+type service struct {
+	iid             uint64
+	typ             string
+	characteristics []*characteristic
+}
+
+// accessory is the bridge itself or a side of a bed
+type accessory struct {
+	aid uint64
+	// side is the bed side the accessory is, unset for the bridge
+	side     sideKey
+	services []*service
+	// occupancy and light are the characteristics kept up to date from
+	// points; light is nil unless the lights are served
+	occupancy, light *characteristic
+}
+
+// characteristic returns the characteristic iid of a, or nil
+func (a *accessory) characteristic(iid uint64) *characteristic {
+	for _, s := range a.services {
+		for _, ch := range s.characteristics {
+			if ch.iid == iid {
+				return ch
+			}
+		}
+	}
+	return nil
+}
+
+// describe returns a as the accessory database lists it
+func (a *accessory) describe() map[string]interface{} {
+	services := make([]interface{}, 0, len(a.services))
+	for _, s := range a.services {
+		characteristics := make([]interface{}, 0, len(s.characteristics))
+		for _, ch := range s.characteristics {
+			characteristics = append(characteristics, ch.describe())
+		}
+		services = append(services, map[string]interface{}{
+			"iid":             s.iid,
+			"type":            s.typ,
+			"characteristics": characteristics,
+		})
+	}
+	return map[string]interface{}{
+		"aid":      a.aid,
+		"services": services,
+	}
+}
+
+// informationService is the accessory information service every accessory
+// has, with instance IDs 1 to 7
+func informationService(name, model, serial string) *service {
+	return &service{
+		iid: 1,
+		typ: serviceAccessoryInformation,
+		characteristics: []*characteristic{
+			{iid: 2, typ: characteristicIdentify, format: "bool", perms: []string{permWrite}},
+			{iid: 3, typ: characteristicManufacturer, format: "string", perms: []string{permRead}, value: "Sleep Number"},
+			{iid: 4, typ: characteristicModel, format: "string", perms: []string{permRead}, value: model},
+			{iid: 5, typ: characteristicName, format: "string", perms: []string{permRead}, value: name},
+			{iid: 6, typ: characteristicSerialNumber, format: "string", perms: []string{permRead}, value: serial},
+			{iid: 7, typ: characteristicFirmwareRevision, format: "string", perms: []string{permRead}, value: firmwareRevision},
+		},
+	}
+}
+
+// newBridgeAccessory returns the bridge accessory, named name
+func newBridgeAccessory(name, deviceID string) *accessory {
+	return &accessory{
+		aid: 1,
+		services: []*service{
+			informationService(name, "Bridge", deviceID),
+			{
+				iid: 8,
+				typ: serviceProtocolInformation,
+				characteristics: []*characteristic{
+					{iid: 9, typ: characteristicVersion, format: "string", perms: []string{permRead}, value: "1.1.0"},
+				},
+			},
+		},
+	}
+}
+
+// newSideAccessory returns the accessory of a bed side: an occupancy sensor,
+// and the underbed light of that side if light is set
+func newSideAccessory(aid uint64, side sideKey, light bool) *accessory {
+	name := side.Bed + " " + strings.ToUpper(side.Side[:1]) + side.Side[1:]
+	serial := side.Bed + "/" + side.Side
+	if side.Account != "" {
+		serial = side.Account + "/" + serial
+	}
+	a := &accessory{
+		aid:       aid,
+		side:      side,
+		occupancy: &characteristic{iid: 9, typ: characteristicOccupancyDetected, format: "uint8", perms: []string{permRead, permEvents}, value: 0},
+	}
+	a.services = []*service{
+		informationService(name, "Bed side", serial),
+		{iid: 8, typ: serviceOccupancySensor, characteristics: []*characteristic{a.occupancy}},
+	}
+	if light {
+		a.light = &characteristic{iid: 11, typ: characteristicOn, format: "bool", perms: []string{permRead, permWrite, permEvents}, value: false}
+		a.services = append(a.services, &service{iid: 10, typ: serviceLightbulb, characteristics: []*characteristic{a.light}})
+	}
+	return a
+}
+
+// configHash identifies the accessories served, so that the configuration
+// number goes up when they change
+func configHash(accessories map[uint64]*accessory, light bool) string {
+	lines := make([]string, 0, len(accessories))
+	for aid, a := range accessories {
+		lines = append(lines, fmt.Sprintf("%d %q %q %q", aid, a.side.Account, a.side.Bed, a.side.Side))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("light %t\n%s", light, strings.Join(lines, "\n"))))
+	return hex.EncodeToString(sum[:])
+}
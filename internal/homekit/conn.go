@@ -0,0 +1,503 @@
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HAP status codes of characteristic reads and writes
+const (
+	statusSuccess                = 0
+	statusInsufficientPrivileges = -70401
+	statusCommunicationFailure   = -70402
+	statusReadOnly               = -70404
+	statusWriteOnly              = -70405
+	statusNoNotification         = -70406
+	statusNotFound               = -70409
+	statusInvalidValue           = -70410
+)
+
+// statusConnectionAuthorizationRequired answers requests that need pair
+// verify done first
+const statusConnectionAuthorizationRequired = 470
+
+// Content types of HAP requests and responses
+const (
+	contentTypeJSON = "application/hap+json"
+	contentTypeTLV8 = "application/pairing+tlv8"
+)
+
+// maxBodySize bounds the body of requests
+const maxBodySize = 1 << 20
+
+// writeTimeout bounds writing a response or event to a controller
+const writeTimeout = 10 * time.Second
+
+// event is a new value of a characteristic
+type event struct {
+	aid, iid uint64
+	value    interface{}
+}
+
+// response is the answer to a request
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// conn is a controller's connection to the bridge, speaking HTTP in the
+// clear until pair verify is done and encrypted after
+type conn struct {
+	bridge *Bridge
+	net    net.Conn
+	remote string
+	reader *bufio.Reader
+
+	// writeMu serializes responses and events
+	writeMu sync.Mutex
+	writer  io.Writer
+	// encrypted is set once the session is, and only read on the
+	// connection's own goroutine
+	encrypted bool
+
+	// srp and verify are pair setup and pair verify in progress
+	srp    *srpServer
+	verify *verifyState
+	// controller is the pairing ID of the verified controller, set with
+	// bridge.mu held
+	controller string
+	// closeAfterResponse is set when the controller is unpaired by its own
+	// request
+	closeAfterResponse bool
+	// subscriptions are the characteristics the controller listens to,
+	// guarded by bridge.mu
+	subscriptions map[[2]uint64]bool
+}
+
+func newConn(b *Bridge, netConn net.Conn) *conn {
+	return &conn{
+		bridge:        b,
+		net:           netConn,
+		remote:        netConn.RemoteAddr().String(),
+		reader:        bufio.NewReader(netConn),
+		writer:        netConn,
+		subscriptions: make(map[[2]uint64]bool),
+	}
+}
+
+// serve answers requests until the controller disconnects
+func (c *conn) serve(ctx context.Context) {
+	defer c.net.Close()
+	logger := log.WithFields(log.Fields{
+		"op":     "homekit.serve",
+		"client": c.remote,
+	})
+	for {
+		req, err := http.ReadRequest(c.reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Debugf("closing connection, %s", err)
+			}
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize))
+		req.Body.Close()
+		if err != nil {
+			logger.Debugf("closing connection, %s", err)
+			return
+		}
+
+		var secret []byte
+		var res response
+		if req.Method == http.MethodPost && req.URL.Path == "/pair-verify" && !c.encrypted {
+			res, secret = c.handlePairVerify(body)
+		} else {
+			res = c.handle(ctx, req, body)
+		}
+		err = c.write(httpResponse(res))
+		if err != nil {
+			logger.Debugf("closing connection, %s", err)
+			return
+		}
+		if secret != nil {
+			err = c.encrypt(secret)
+			if err != nil {
+				logger.Warnf("closing connection, %s", err)
+				return
+			}
+		}
+		if c.closeAfterResponse {
+			return
+		}
+	}
+}
+
+// encrypt switches the connection to the session keyed from secret
+func (c *conn) encrypt(secret []byte) error {
+	// The controller waits for the end of pair verify before sending
+	// anything else, so nothing can be buffered in the clear
+	if c.reader.Buffered() > 0 {
+		return errors.New("unencrypted data after pair verify")
+	}
+	s, err := newSession(c.net, secret)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	c.writer = s
+	c.writeMu.Unlock()
+	c.reader = bufio.NewReader(s)
+	c.encrypted = true
+	return nil
+}
+
+// write writes data to the controller in one go
+func (c *conn) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.net.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.writer.Write(data)
+	return err
+}
+
+// httpResponse formats res as an HTTP response
+func httpResponse(res response) []byte {
+	text := http.StatusText(res.status)
+	switch res.status {
+	case http.StatusMultiStatus:
+		text = "Multi-Status"
+	case statusConnectionAuthorizationRequired:
+		text = "Connection Authorization Required"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", res.status, text)
+	if res.contentType != "" {
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", res.contentType)
+	}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(res.body))
+	buf.Write(res.body)
+	return buf.Bytes()
+}
+
+// tlvResponse answers a pairing request
+func tlvResponse(res tlv8) response {
+	return response{status: http.StatusOK, contentType: contentTypeTLV8, body: res.encode()}
+}
+
+// jsonResponse answers with v as JSON
+func jsonResponse(status int, v interface{}) response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return response{status: http.StatusInternalServerError}
+	}
+	return response{status: status, contentType: contentTypeJSON, body: body}
+}
+
+// statusResponse answers with a HAP status alone
+func statusResponse(status, hapStatus int) response {
+	return jsonResponse(status, map[string]int{"status": hapStatus})
+}
+
+// handlePairVerify answers a step of pair verify, returning the shared
+// secret of the session once it succeeds
+func (c *conn) handlePairVerify(body []byte) (response, []byte) {
+	req, err := decodeTLV8(body)
+	if err != nil {
+		return response{status: http.StatusBadRequest}, nil
+	}
+	res, secret := c.pairVerify(req)
+	return tlvResponse(res), secret
+}
+
+// handle answers every request but pair verify
+func (c *conn) handle(ctx context.Context, req *http.Request, body []byte) response {
+	path := req.URL.Path
+	if path == "/pair-setup" || path == "/identify" {
+		if c.encrypted || req.Method != http.MethodPost {
+			return response{status: http.StatusBadRequest}
+		}
+		if path == "/identify" {
+			return c.identify()
+		}
+		tlv, err := decodeTLV8(body)
+		if err != nil {
+			return response{status: http.StatusBadRequest}
+		}
+		return tlvResponse(c.pairSetup(tlv))
+	}
+
+	if !c.encrypted {
+		return statusResponse(statusConnectionAuthorizationRequired, statusInsufficientPrivileges)
+	}
+	switch {
+	case path == "/pairings" && req.Method == http.MethodPost:
+		tlv, err := decodeTLV8(body)
+		if err != nil {
+			return response{status: http.StatusBadRequest}
+		}
+		return tlvResponse(c.managePairings(tlv))
+	case path == "/accessories" && req.Method == http.MethodGet:
+		return c.accessories()
+	case path == "/characteristics" && req.Method == http.MethodGet:
+		return c.readCharacteristics(req)
+	case path == "/characteristics" && req.Method == http.MethodPut:
+		return c.writeCharacteristics(ctx, body)
+	}
+	return response{status: http.StatusNotFound}
+}
+
+// identify answers an unpaired controller asking the bridge to identify
+// itself, which it can only do by logging it
+func (c *conn) identify() response {
+	if c.bridge.store.paired() {
+		return statusResponse(http.StatusBadRequest, statusInsufficientPrivileges)
+	}
+	log.WithFields(log.Fields{
+		"op":     "homekit.identify",
+		"client": c.remote,
+	}).Info("identify requested")
+	return response{status: http.StatusNoContent}
+}
+
+// accessories answers with the accessory database
+func (c *conn) accessories() response {
+	b := c.bridge
+	b.mu.Lock()
+	aids := make([]uint64, 0, len(b.accessories))
+	for aid := range b.accessories {
+		aids = append(aids, aid)
+	}
+	sort.Slice(aids, func(i, j int) bool {
+		return aids[i] < aids[j]
+	})
+	accessories := []interface{}{b.bridge.describe()}
+	for _, aid := range aids {
+		accessories = append(accessories, b.accessories[aid].describe())
+	}
+	b.mu.Unlock()
+	return jsonResponse(http.StatusOK, map[string]interface{}{"accessories": accessories})
+}
+
+// readCharacteristics answers with the characteristics of the id parameter,
+// as aid.iid separated by commas
+func (c *conn) readCharacteristics(req *http.Request) response {
+	query := req.URL.Query()
+	flag := func(name string) bool {
+		return query.Get(name) == "1"
+	}
+	b := c.bridge
+	var items []map[string]interface{}
+	failed := false
+	b.mu.Lock()
+	for _, id := range strings.Split(query.Get("id"), ",") {
+		aidText, iidText, _ := strings.Cut(id, ".")
+		aid, err1 := strconv.ParseUint(aidText, 10, 64)
+		iid, err2 := strconv.ParseUint(iidText, 10, 64)
+		if err1 != nil || err2 != nil {
+			b.mu.Unlock()
+			return statusResponse(http.StatusBadRequest, statusInvalidValue)
+		}
+		item := map[string]interface{}{"aid": aid, "iid": iid}
+		items = append(items, item)
+		var ch *characteristic
+		if a := b.accessory(aid); a != nil {
+			ch = a.characteristic(iid)
+		}
+		switch {
+		case ch == nil:
+			item["status"] = statusNotFound
+			failed = true
+			continue
+		case !ch.can(permRead):
+			item["status"] = statusWriteOnly
+			failed = true
+			continue
+		}
+		item["value"] = ch.value
+		item["status"] = statusSuccess
+		if flag("meta") {
+			item["format"] = ch.format
+		}
+		if flag("perms") {
+			item["perms"] = ch.perms
+		}
+		if flag("type") {
+			item["type"] = ch.typ
+		}
+		if flag("ev") {
+			item["ev"] = c.subscriptions[[2]uint64{aid, iid}]
+		}
+	}
+	b.mu.Unlock()
+
+	if !failed {
+		for _, item := range items {
+			delete(item, "status")
+		}
+		return jsonResponse(http.StatusOK, map[string]interface{}{"characteristics": items})
+	}
+	return jsonResponse(http.StatusMultiStatus, map[string]interface{}{"characteristics": items})
+}
+
+// characteristicWrite is a write or subscription of a characteristic
+type characteristicWrite struct {
+	AID   uint64          `json:"aid"`
+	IID   uint64          `json:"iid"`
+	Value json.RawMessage `json:"value"`
+	Ev    *bool           `json:"ev"`
+}
+
+// writeCharacteristics handles writes of values and subscriptions to
+// changes
+func (c *conn) writeCharacteristics(ctx context.Context, body []byte) response {
+	var req struct {
+		Characteristics []characteristicWrite `json:"characteristics"`
+	}
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return statusResponse(http.StatusBadRequest, statusInvalidValue)
+	}
+	items := make([]map[string]interface{}, 0, len(req.Characteristics))
+	failed := false
+	for _, w := range req.Characteristics {
+		status := c.writeCharacteristic(ctx, w)
+		if status != statusSuccess {
+			failed = true
+		}
+		items = append(items, map[string]interface{}{"aid": w.AID, "iid": w.IID, "status": status})
+	}
+	if !failed {
+		return response{status: http.StatusNoContent}
+	}
+	return jsonResponse(http.StatusMultiStatus, map[string]interface{}{"characteristics": items})
+}
+
+// writeCharacteristic handles one write, returning its HAP status
+func (c *conn) writeCharacteristic(ctx context.Context, w characteristicWrite) int {
+	b := c.bridge
+	b.mu.Lock()
+	a := b.accessory(w.AID)
+	var ch *characteristic
+	if a != nil {
+		ch = a.characteristic(w.IID)
+	}
+	if ch == nil {
+		b.mu.Unlock()
+		return statusNotFound
+	}
+	if w.Ev != nil {
+		if !ch.can(permEvents) {
+			b.mu.Unlock()
+			return statusNoNotification
+		}
+		key := [2]uint64{w.AID, w.IID}
+		if *w.Ev {
+			c.subscriptions[key] = true
+		} else {
+			delete(c.subscriptions, key)
+		}
+	}
+	side := a.side
+	isLight := ch == a.light
+	b.mu.Unlock()
+
+	if w.Value == nil {
+		return statusSuccess
+	}
+	if !ch.can(permWrite) {
+		return statusReadOnly
+	}
+	on, ok := boolValue(w.Value)
+	if !ok {
+		return statusInvalidValue
+	}
+	logger := log.WithFields(log.Fields{
+		"op":     "homekit.writeCharacteristic",
+		"client": c.remote,
+		"aid":    w.AID,
+		"iid":    w.IID,
+	})
+	if !isLight {
+		// The only other writable characteristic is Identify
+		logger.Info("identify requested")
+		return statusSuccess
+	}
+
+	err := b.control.SetLight(ctx, side.Bed, side.Side, on, c.remote)
+	if err != nil {
+		logger.Errorf("failed to switch the underbed light, %s", err)
+		return statusCommunicationFailure
+	}
+	b.mu.Lock()
+	changed := ch.value != on
+	ch.value = on
+	b.mu.Unlock()
+	if changed {
+		b.notify([]event{{w.AID, w.IID, on}}, c)
+	}
+	return statusSuccess
+}
+
+// boolValue parses a bool written as true, false, 1 or 0
+func boolValue(raw json.RawMessage) (bool, bool) {
+	switch strings.TrimSpace(string(raw)) {
+	case "true", "1":
+		return true, true
+	case "false", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// notify sends events to the controllers listening to them, but for
+// except, which caused them
+func (b *Bridge) notify(events []event, except *conn) {
+	if len(events) == 0 {
+		return
+	}
+	pending := make(map[*conn][]map[string]interface{})
+	b.mu.Lock()
+	for c := range b.conns {
+		if c == except {
+			continue
+		}
+		for _, e := range events {
+			if c.subscriptions[[2]uint64{e.aid, e.iid}] {
+				pending[c] = append(pending[c], map[string]interface{}{"aid": e.aid, "iid": e.iid, "value": e.value})
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for c, items := range pending {
+		body, err := json.Marshal(map[string]interface{}{"characteristics": items})
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "EVENT/1.0 200 OK\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n", contentTypeJSON, len(body))
+		buf.Write(body)
+		err = c.write(buf.Bytes())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":     "homekit.notify",
+				"client": c.remote,
+			}).Debugf("closing connection, %s", err)
+			c.net.Close()
+		}
+	}
+}
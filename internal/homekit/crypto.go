@@ -0,0 +1,47 @@
+package homekit
+
+import (
+	"crypto/sha512"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"io"
+)
+
+// deriveKey derives a 32-byte key from secret with HKDF-SHA512, as pairing
+// does at every step
+func deriveKey(secret []byte, salt, info string) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha512.New, secret, []byte(salt), []byte(info)), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// pairingNonce pads the nonce names pairing messages use, such as
+// PS-Msg05, to the 12 bytes of ChaCha20-Poly1305
+func pairingNonce(name string) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	copy(nonce[4:], name)
+	return nonce
+}
+
+// seal encrypts and authenticates plaintext with key under the nonce named
+// name
+func seal(key []byte, name string, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, pairingNonce(name), plaintext, nil), nil
+}
+
+// open decrypts and authenticates ciphertext sealed with key under the nonce
+// named name
+func open(key []byte, name string, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, pairingNonce(name), ciphertext, nil)
+}
@@ -0,0 +1,323 @@
+// Package homekit serves a HomeKit Accessory Protocol bridge: an occupancy
+// sensor for each side of the beds, built from the points the collector
+// publishes, and their underbed lights, switched through a Controller. It
+// pairs with the setup code, keeps its identity and pairings in a state
+// file, and advertises itself over multicast DNS.
+package homekit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Controller switches the underbed lights, recording each action as asked
+// for by client
+type Controller interface {
+	// SetLight switches the underbed light of side, left or right, of the bed
+	// named bed
+	SetLight(ctx context.Context, bed, side string, on bool, client string) error
+}
+
+// Bridge is a HomeKit bridge of the bed sides seen in points
+type Bridge struct {
+	name    string
+	pin     string
+	light   bool
+	names   schema.Names
+	control Controller
+	store   *store
+
+	// setupMu guards pair setup, which only one connection may do at a time
+	setupMu    sync.Mutex
+	setupOwner *conn
+
+	mu          sync.Mutex
+	accessories map[uint64]*accessory
+	bridge      *accessory
+	conns       map[*conn]struct{}
+	// changed is signalled when the accessories or pairings change, for the
+	// advertisement to follow
+	changed chan struct{}
+}
+
+// NewBridge returns a Bridge serving the bed sides of earlier runs until
+// points tell about them, reading points named as names says, and switching
+// the lights through control if config.Light is set
+func NewBridge(config *config.HomeKit, names schema.Names, control Controller) (*Bridge, error) {
+	store, err := openStore(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	name := config.Name
+	if name == "" {
+		name = "Sleep Number"
+	}
+	b := &Bridge{
+		name:        name,
+		pin:         config.Pin,
+		light:       config.Light && control != nil,
+		names:       names,
+		control:     control,
+		store:       store,
+		accessories: make(map[uint64]*accessory),
+		bridge:      newBridgeAccessory(name, store.deviceID()),
+		conns:       make(map[*conn]struct{}),
+		changed:     make(chan struct{}, 1),
+	}
+	for _, a := range store.accessories() {
+		b.accessories[a.AID] = newSideAccessory(a.AID, a.sideKey, b.light)
+	}
+	_, err = store.configNumber(configHash(b.accessories, b.light))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Update sets the occupancy sensors or lights of a bed from p, if it is
+// about its sleepers or its lights, and notifies the controllers listening
+func (b *Bridge) Update(p collector.Point) {
+	sleepers := p.Measurement == b.names.Renamed("bed_sleeper_state")
+	lights := b.light && p.Measurement == b.names.Renamed("bed_light_state")
+	if !sleepers && !lights {
+		return
+	}
+	name := p.Tags[b.names.Tag("name")]
+	if name == "" {
+		return
+	}
+	account := p.Tags[b.names.Tag("account")]
+	field := func(f string) (bool, bool) {
+		v, ok := p.Fields[b.names.Field(p.Measurement, f)]
+		return truthy(v), ok
+	}
+
+	var events []event
+	added := false
+	b.mu.Lock()
+	for _, side := range []string{"left", "right"} {
+		a, isNew, err := b.sideAccessory(sideKey{Account: account, Bed: name, Side: side})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":  "homekit.Update",
+				"bed": name,
+			}).Error(err)
+			continue
+		}
+		added = added || isNew
+		if sleepers {
+			inBed, ok := field(side + "_sleeper_is_in_bed")
+			value := 0
+			if inBed {
+				value = 1
+			}
+			if ok && a.occupancy.value != value {
+				a.occupancy.value = value
+				events = append(events, event{a.aid, a.occupancy.iid, value})
+			}
+		} else {
+			on, ok := field(side + "_underbed_light")
+			if ok && a.light.value != on {
+				a.light.value = on
+				events = append(events, event{a.aid, a.light.iid, on})
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	if added {
+		b.signalChange()
+	}
+	b.notify(events, nil)
+}
+
+// sideAccessory returns the accessory of side, adding it if it is new; b.mu
+// must be held
+func (b *Bridge) sideAccessory(side sideKey) (*accessory, bool, error) {
+	for _, a := range b.accessories {
+		if a.side == side {
+			return a, false, nil
+		}
+	}
+	aid, err := b.store.accessoryID(side)
+	if err != nil {
+		return nil, false, err
+	}
+	a := newSideAccessory(aid, side, b.light)
+	b.accessories[aid] = a
+	return a, true, nil
+}
+
+// truthy reports whether a field value is true or a non-zero number
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case int8:
+		return v != 0
+	case int16:
+		return v != 0
+	case int32:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+// accessory returns the accessory aid; b.mu must be held
+func (b *Bridge) accessory(aid uint64) *accessory {
+	if aid == b.bridge.aid {
+		return b.bridge
+	}
+	return b.accessories[aid]
+}
+
+// signalChange tells the advertisement the accessories or pairings changed
+func (b *Bridge) signalChange() {
+	select {
+	case b.changed <- struct{}{}:
+	default:
+	}
+}
+
+// pairingsChanged follows a change to the pairings made on current: the
+// advertisement says whether the bridge is paired, and the connections of
+// unpaired controllers are closed, current's once it is done answering
+func (b *Bridge) pairingsChanged(current *conn) {
+	b.signalChange()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		if c.controller == "" {
+			continue
+		}
+		if _, ok := b.store.pairing(c.controller); ok {
+			continue
+		}
+		if c == current {
+			c.closeAfterResponse = true
+		} else {
+			c.net.Close()
+		}
+	}
+}
+
+// txtRecord returns the TXT record of the advertisement
+func (b *Bridge) txtRecord() []string {
+	b.mu.Lock()
+	hash := configHash(b.accessories, b.light)
+	b.mu.Unlock()
+	number, err := b.store.configNumber(hash)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op": "homekit.txtRecord",
+		}).Error(err)
+	}
+	statusFlags := "1"
+	if b.store.paired() {
+		statusFlags = "0"
+	}
+	return []string{
+		fmt.Sprintf("c#=%d", number),
+		"ff=0",
+		"id=" + b.store.deviceID(),
+		"md=" + b.name,
+		"pv=1.1",
+		"s#=1",
+		"sf=" + statusFlags,
+		// Bridge
+		"ci=2",
+	}
+}
+
+// Serve serves b on listener until ctx is cancelled, advertising it over
+// multicast DNS, then closes every connection
+func Serve(ctx context.Context, listener net.Listener, b *Bridge) error {
+	addr := listener.Addr().(*net.TCPAddr)
+	host := "SleepNumber-" + strings.ReplaceAll(b.store.deviceID(), ":", "")[6:]
+	responder, err := newResponder(strings.ReplaceAll(b.name, ".", " "), host, addr.IP, addr.Port, b.txtRecord)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	advertised := make(chan struct{})
+	go func() {
+		defer close(advertised)
+		responder.run(ctx, b.changed)
+	}()
+	defer func() {
+		cancel()
+		<-advertised
+	}()
+
+	log.WithFields(log.Fields{
+		"op":      "homekit.Serve",
+		"address": listener.Addr().String(),
+		"paired":  b.store.paired(),
+	}).Info("serving the HomeKit bridge")
+	return b.serve(ctx, listener)
+}
+
+// serve accepts controllers' connections on listener until ctx is
+// cancelled, then closes them
+func (b *Bridge) serve(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for c := range b.conns {
+			c.net.Close()
+		}
+	}()
+
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("failed to serve the HomeKit bridge, %s", err)
+		}
+		c := newConn(b, netConn)
+		b.mu.Lock()
+		if ctx.Err() != nil {
+			b.mu.Unlock()
+			netConn.Close()
+			continue
+		}
+		b.conns[c] = struct{}{}
+		b.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.serve(ctx)
+			c.endSetup()
+			b.mu.Lock()
+			delete(b.conns, c)
+			b.mu.Unlock()
+		}()
+	}
+}
@@ -0,0 +1,670 @@
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPin = "031-45-154"
+
+// lightCall is a SetLight call of fakeController
+type lightCall struct {
+	Bed, Side string
+	On        bool
+}
+
+// fakeController records the lights switched
+type fakeController struct {
+	mu    sync.Mutex
+	calls []lightCall
+}
+
+func (f *fakeController) SetLight(ctx context.Context, bed, side string, on bool, client string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, lightCall{bed, side, on})
+	return nil
+}
+
+func (f *fakeController) lights() []lightCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]lightCall(nil), f.calls...)
+}
+
+// startBridge serves a new bridge on a local port until the test ends
+func startBridge(t *testing.T, control Controller) (*Bridge, string) {
+	t.Helper()
+	b, err := NewBridge(&config.HomeKit{
+		Pin:       testPin,
+		StateFile: filepath.Join(t.TempDir(), "homekit.json"),
+		Light:     true,
+	}, schema.Names{}, control)
+	if err != nil {
+		t.Fatalf("failed to create bridge, %s", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- b.serve(ctx, listener)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to serve, %s", err)
+		}
+	})
+	return b, listener.Addr().String()
+}
+
+// testController is the controller's side of the protocol
+type testController struct {
+	t    *testing.T
+	id   string
+	key  ed25519.PrivateKey
+	conn net.Conn
+	r    *bufio.Reader
+	w    io.Writer
+}
+
+func newTestController(t *testing.T, address string) *testController {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testController{t: t, id: "0E6D3A4C-1D7B-4C0E-9B5E-5C3B1F0A2D11", key: key}
+	c.connect(address)
+	return c
+}
+
+// connect opens a new connection to the bridge, in the clear
+func (c *testController) connect(address string) {
+	c.t.Helper()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { conn.Close() })
+	c.conn, c.r, c.w = conn, bufio.NewReader(conn), conn
+}
+
+// message is a response or event read from the bridge
+type message struct {
+	start string
+	body  []byte
+}
+
+// read reads a response or event
+func (c *testController) read() message {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := textproto.NewReader(c.r)
+	start, err := r.ReadLine()
+	if err != nil {
+		c.t.Fatalf("failed to read response, %s", err)
+	}
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("failed to read response headers, %s", err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	body := make([]byte, length)
+	_, err = io.ReadFull(c.r, body)
+	if err != nil {
+		c.t.Fatalf("failed to read response body, %s", err)
+	}
+	return message{start: start, body: body}
+}
+
+// request sends a request and reads its response
+func (c *testController) request(method, path, contentType string, body []byte) message {
+	c.t.Helper()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\nHost: bridge\r\n", method, path)
+	if contentType != "" {
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", contentType)
+	}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(body))
+	buf.Write(body)
+	_, err := c.w.Write(buf.Bytes())
+	if err != nil {
+		c.t.Fatalf("failed to send request, %s", err)
+	}
+	return c.read()
+}
+
+// pairing sends a pairing request, returning the response
+func (c *testController) pairing(path string, req tlv8) tlv8 {
+	c.t.Helper()
+	res := c.request("POST", path, contentTypeTLV8, req.encode())
+	if res.start != "HTTP/1.1 200 OK" {
+		c.t.Fatalf("got %q to %s, want 200 OK", res.start, path)
+	}
+	items, err := decodeTLV8(res.body)
+	if err != nil {
+		c.t.Fatalf("failed to decode %s response, %s", path, err)
+	}
+	return items
+}
+
+// pairSetup runs pair setup with pin, returning the error code the bridge
+// answered with, 0 if it paired
+func (c *testController) pairSetup(pin string) byte {
+	c.t.Helper()
+	var m1 tlv8
+	m1.addByte(tlvState, 1)
+	m1.addByte(tlvMethod, methodPairSetup)
+	m2 := c.pairing("/pair-setup", m1)
+	if code := m2.byteValue(tlvError); code != 0 {
+		return code
+	}
+	salt := m2.get(tlvSalt)
+	B := new(big.Int).SetBytes(m2.get(tlvPublicKey))
+
+	// The SRP client, as the controller computes it
+	a, err := rand.Int(rand.Reader, srpN)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	A := srpPad(new(big.Int).Exp(srpG, a, srpN))
+	u := new(big.Int).SetBytes(srpHash(A, srpPad(B)))
+	k := new(big.Int).SetBytes(srpHash(srpPad(srpN), srpPad(srpG)))
+	x := new(big.Int).SetBytes(srpHash(salt, srpHash([]byte(srpUsername+":"+pin))))
+	base := new(big.Int).Sub(B, new(big.Int).Mul(k, new(big.Int).Exp(srpG, x, srpN)))
+	base.Mod(base, srpN)
+	S := new(big.Int).Exp(base, new(big.Int).Add(a, new(big.Int).Mul(u, x)), srpN)
+	K := srpHash(srpPad(S))
+	hN, hG := srpHash(srpN.Bytes()), srpHash(srpG.Bytes())
+	for i := range hN {
+		hN[i] ^= hG[i]
+	}
+	proof := srpHash(hN, srpHash([]byte(srpUsername)), salt, A, srpPad(B), K)
+
+	var m3 tlv8
+	m3.addByte(tlvState, 3)
+	m3.add(tlvPublicKey, A)
+	m3.add(tlvProof, proof)
+	m4 := c.pairing("/pair-setup", m3)
+	if code := m4.byteValue(tlvError); code != 0 {
+		return code
+	}
+	if !bytes.Equal(m4.get(tlvProof), srpHash(A, proof, K)) {
+		c.t.Fatal("got wrong bridge proof")
+	}
+
+	key, _ := deriveKey(K, "Pair-Setup-Encrypt-Salt", "Pair-Setup-Encrypt-Info")
+	controllerX, _ := deriveKey(K, "Pair-Setup-Controller-Sign-Salt", "Pair-Setup-Controller-Sign-Info")
+	public := c.key.Public().(ed25519.PublicKey)
+	var sub tlv8
+	sub.add(tlvIdentifier, []byte(c.id))
+	sub.add(tlvPublicKey, public)
+	sub.add(tlvSignature, ed25519.Sign(c.key, append(append(controllerX, c.id...), public...)))
+	encrypted, _ := seal(key, "PS-Msg05", sub.encode())
+	var m5 tlv8
+	m5.addByte(tlvState, 5)
+	m5.add(tlvEncryptedData, encrypted)
+	m6 := c.pairing("/pair-setup", m5)
+	if code := m6.byteValue(tlvError); code != 0 {
+		return code
+	}
+	data, err := open(key, "PS-Msg06", m6.get(tlvEncryptedData))
+	if err != nil {
+		c.t.Fatalf("failed to decrypt bridge keys, %s", err)
+	}
+	reply, _ := decodeTLV8(data)
+	accessoryX, _ := deriveKey(K, "Pair-Setup-Accessory-Sign-Salt", "Pair-Setup-Accessory-Sign-Info")
+	info := append(append(accessoryX, reply.get(tlvIdentifier)...), reply.get(tlvPublicKey)...)
+	if !ed25519.Verify(reply.get(tlvPublicKey), info, reply.get(tlvSignature)) {
+		c.t.Fatal("got wrong bridge signature")
+	}
+	return 0
+}
+
+// pairVerify runs pair verify, switching to the encrypted session if it
+// succeeds, and returns the error code the bridge answered with
+func (c *testController) pairVerify() byte {
+	c.t.Helper()
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var m1 tlv8
+	m1.addByte(tlvState, 1)
+	m1.add(tlvPublicKey, private.PublicKey().Bytes())
+	m2 := c.pairing("/pair-verify", m1)
+	if code := m2.byteValue(tlvError); code != 0 {
+		return code
+	}
+	bridgeKey, err := ecdh.X25519().NewPublicKey(m2.get(tlvPublicKey))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	shared, _ := private.ECDH(bridgeKey)
+	key, _ := deriveKey(shared, "Pair-Verify-Encrypt-Salt", "Pair-Verify-Encrypt-Info")
+	if _, err := open(key, "PV-Msg02", m2.get(tlvEncryptedData)); err != nil {
+		c.t.Fatalf("failed to decrypt bridge proof, %s", err)
+	}
+
+	var sub tlv8
+	sub.add(tlvIdentifier, []byte(c.id))
+	info := append(append(private.PublicKey().Bytes(), c.id...), bridgeKey.Bytes()...)
+	sub.add(tlvSignature, ed25519.Sign(c.key, info))
+	encrypted, _ := seal(key, "PV-Msg03", sub.encode())
+	var m3 tlv8
+	m3.addByte(tlvState, 3)
+	m3.add(tlvEncryptedData, encrypted)
+	m4 := c.pairing("/pair-verify", m3)
+	if code := m4.byteValue(tlvError); code != 0 {
+		return code
+	}
+
+	// The controller writes with the key the bridge reads with, and reads
+	// with the one it writes with
+	s, err := newSession(c.conn, shared)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	s.read, s.write = s.write, s.read
+	c.r, c.w = bufio.NewReader(s), s
+	return 0
+}
+
+// json sends a request with a JSON body, if v is set, decoding the response
+// body into out, if it is set
+func (c *testController) json(method, path string, v, out interface{}) string {
+	c.t.Helper()
+	var body []byte
+	if v != nil {
+		body, _ = json.Marshal(v)
+	}
+	res := c.request(method, path, contentTypeJSON, body)
+	if out != nil {
+		err := json.Unmarshal(res.body, out)
+		if err != nil {
+			c.t.Fatalf("failed to decode %s %s response %q, %s", method, path, res.body, err)
+		}
+	}
+	return res.start
+}
+
+// sleeperPoint is a bed_sleeper_state point of the bed named Bed
+func sleeperPoint(left, right bool) collector.Point {
+	return collector.Point{
+		Measurement: "bed_sleeper_state",
+		Tags:        map[string]string{"name": "Bed"},
+		Fields: map[string]interface{}{
+			"left_sleeper_is_in_bed":  left,
+			"right_sleeper_is_in_bed": right,
+		},
+		Time: time.Now(),
+	}
+}
+
+func TestPairing(t *testing.T) {
+	_, address := startBridge(t, &fakeController{})
+	c := newTestController(t, address)
+
+	if start := c.json("GET", "/accessories", nil, nil); start != "HTTP/1.1 470 Connection Authorization Required" {
+		t.Errorf("got %q reading accessories before pairing, want 470", start)
+	}
+	if code := c.pairSetup("123-45-679"); code != tlvErrorAuthentication {
+		t.Fatalf("got error %d pairing with the wrong setup code, want %d", code, tlvErrorAuthentication)
+	}
+	if code := c.pairSetup(testPin); code != 0 {
+		t.Fatalf("got error %d pairing, want none", code)
+	}
+	if code := c.pairSetup(testPin); code != tlvErrorUnavailable {
+		t.Errorf("got error %d pairing again, want %d", code, tlvErrorUnavailable)
+	}
+
+	stranger := newTestController(t, address)
+	stranger.id = "stranger"
+	if code := stranger.pairVerify(); code != tlvErrorAuthentication {
+		t.Errorf("got error %d verifying an unpaired controller, want %d", code, tlvErrorAuthentication)
+	}
+
+	c.connect(address)
+	if code := c.pairVerify(); code != 0 {
+		t.Fatalf("got error %d verifying, want none", code)
+	}
+	var list tlv8
+	list.addByte(tlvState, 1)
+	list.addByte(tlvMethod, methodListPairings)
+	res := c.pairing("/pairings", list)
+	if id := string(res.get(tlvIdentifier)); id != c.id || res.byteValue(tlvPermissions) != permissionAdmin {
+		t.Errorf("got pairings %v, want %s as admin", res, c.id)
+	}
+
+	var remove tlv8
+	remove.addByte(tlvState, 1)
+	remove.addByte(tlvMethod, methodRemovePairing)
+	remove.add(tlvIdentifier, []byte(c.id))
+	c.pairing("/pairings", remove)
+	c.connect(address)
+	if code := c.pairVerify(); code != tlvErrorAuthentication {
+		t.Errorf("got error %d verifying after unpairing, want %d", code, tlvErrorAuthentication)
+	}
+}
+
+func TestAccessories(t *testing.T) {
+	control := &fakeController{}
+	b, address := startBridge(t, control)
+	c := newTestController(t, address)
+	if code := c.pairSetup(testPin); code != 0 {
+		t.Fatalf("got error %d pairing, want none", code)
+	}
+	c.connect(address)
+	if code := c.pairVerify(); code != 0 {
+		t.Fatalf("got error %d verifying, want none", code)
+	}
+
+	type database struct {
+		Accessories []struct {
+			AID      uint64 `json:"aid"`
+			Services []struct {
+				Type string `json:"type"`
+			} `json:"services"`
+		} `json:"accessories"`
+	}
+	var db database
+	c.json("GET", "/accessories", nil, &db)
+	if len(db.Accessories) != 1 || db.Accessories[0].AID != 1 {
+		t.Fatalf("got accessories %+v before any point, want the bridge alone", db)
+	}
+
+	b.Update(sleeperPoint(false, true))
+	c.json("GET", "/accessories", nil, &db)
+	var got []string
+	for _, a := range db.Accessories {
+		var services []string
+		for _, s := range a.Services {
+			services = append(services, s.Type)
+		}
+		got = append(got, fmt.Sprintf("%d %s", a.AID, strings.Join(services, ",")))
+	}
+	want := []string{"1 3E,A2", "2 3E,86,43", "3 3E,86,43"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got accessories %v, want %v", got, want)
+	}
+
+	type value struct {
+		AID    uint64      `json:"aid"`
+		IID    uint64      `json:"iid"`
+		Value  interface{} `json:"value,omitempty"`
+		Status int         `json:"status,omitempty"`
+		Ev     *bool       `json:"ev,omitempty"`
+	}
+	type values struct {
+		Characteristics []value `json:"characteristics"`
+	}
+	var read values
+	c.json("GET", "/characteristics?id=2.9,3.9,2.11", nil, &read)
+	wantRead := values{[]value{{AID: 2, IID: 9, Value: 0.0}, {AID: 3, IID: 9, Value: 1.0}, {AID: 2, IID: 11, Value: false}}}
+	if !reflect.DeepEqual(read, wantRead) {
+		t.Errorf("got characteristics %+v, want %+v", read, wantRead)
+	}
+	start := c.json("GET", "/characteristics?id=2.9,7.9", nil, &read)
+	if start != "HTTP/1.1 207 Multi-Status" || len(read.Characteristics) != 2 || read.Characteristics[1].Status != statusNotFound {
+		t.Errorf("got %q %+v reading a missing characteristic, want 207 with %d", start, read, statusNotFound)
+	}
+
+	on := true
+	start = c.json("PUT", "/characteristics", values{[]value{{AID: 2, IID: 9, Ev: &on}}}, nil)
+	if start != "HTTP/1.1 204 No Content" {
+		t.Fatalf("got %q subscribing, want 204", start)
+	}
+	b.Update(sleeperPoint(true, true))
+	event := c.read()
+	if event.start != "EVENT/1.0 200 OK" || string(event.body) != `{"characteristics":[{"aid":2,"iid":9,"value":1}]}` {
+		t.Errorf("got event %q %s, want the left side occupied", event.start, event.body)
+	}
+
+	start = c.json("PUT", "/characteristics", values{[]value{{AID: 3, IID: 11, Value: true}}}, nil)
+	if start != "HTTP/1.1 204 No Content" {
+		t.Fatalf("got %q switching the light, want 204", start)
+	}
+	wantCalls := []lightCall{{"Bed", "right", true}}
+	if got := control.lights(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("got lights switched %v, want %v", got, wantCalls)
+	}
+	start = c.json("PUT", "/characteristics", values{[]value{{AID: 2, IID: 9, Value: 1}}}, &read)
+	if start != "HTTP/1.1 207 Multi-Status" || read.Characteristics[0].Status != statusReadOnly {
+		t.Errorf("got %q %+v writing occupancy, want 207 with %d", start, read, statusReadOnly)
+	}
+}
+
+func TestFailedPairSetups(t *testing.T) {
+	tests := []struct {
+		name string
+		// failed is how many setups failed before, on earlier runs
+		failed     int
+		wantSetup  byte
+		wantFailed int
+	}{
+		{
+			name:       "tries left",
+			wantSetup:  0,
+			wantFailed: 1,
+		},
+		{
+			name:       "tries used up on earlier runs",
+			failed:     maxFailedPairSetups - 1,
+			wantSetup:  tlvErrorMaxTries,
+			wantFailed: maxFailedPairSetups,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, address := startBridge(t, &fakeController{})
+			b.store.mu.Lock()
+			b.store.data.FailedSetups = test.failed
+			b.store.mu.Unlock()
+
+			c := newTestController(t, address)
+			if code := c.pairSetup("123-45-679"); code != tlvErrorAuthentication {
+				t.Fatalf("got error %d pairing with the wrong setup code, want %d", code, tlvErrorAuthentication)
+			}
+			if code := c.pairSetup(testPin); code != test.wantSetup {
+				t.Errorf("got error %d pairing, want %d", code, test.wantSetup)
+			}
+
+			// The count is read back as a restarted bridge would
+			reopened, err := openStore(b.store.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reopened.failedSetups(); got != test.wantFailed {
+				t.Errorf("got %d failed setups in the state file, want %d", got, test.wantFailed)
+			}
+		})
+	}
+}
+
+// TestSRP checks the SRP exchange against the test vectors of the HomeKit
+// Accessory Protocol Specification, which are those of RFC 5054 with the
+// 3072-bit group and SHA-512
+func TestSRP(t *testing.T) {
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	salt := unhex("BEB25379 D1A8581E B5A72767 3A2441EE")
+	clientPrivate := unhex("60975527 035CF2AD 1989806F 0407210B C81EDC04 E2762A56 AFD529DD DA2D4393")
+	serverPrivate := unhex("E487CB59 D31AC550 471E81F0 0F6928E0 1DDA08E9 74A004F4 9E61F5D1 05284D20")
+	wantV := unhex("" +
+		"9B5E0617 01EA7AEB 39CF6E35 19655A85 3CF94C75 CAF2555E F1FAF759 BB79CB47" +
+		"7014E04A 88D68FFC 05323891 D4C205B8 DE81C2F2 03D8FAD1 B24D2C10 9737F1BE" +
+		"BBD71F91 2447C4A0 3C26B9FA D8EDB3E7 80778E30 2529ED1E E138CCFC 36D4BA31" +
+		"3CC48B14 EA8C22A0 186B222E 655F2DF5 603FD75D F76B3B08 FF895006 9ADD03A7" +
+		"54EE4AE8 8587CCE1 BFDE3679 4DBAE459 2B7B904F 442B041C B17AEBAD 1E3AEBE3" +
+		"CBE99DE6 5F4BB1FA 00B0E7AF 06863DB5 3B02254E C66E781E 3B62A821 2C86BEB0" +
+		"D50B5BA6 D0B478D8 C4E9BBCE C2176532 6FBD1405 8D2BBDE2 C33045F0 3873E539" +
+		"48D78B79 4F0790E4 8C36AED6 E880F557 427B2FC0 6DB5E1E2 E1D7E661 AC482D18" +
+		"E528D729 5EF74372 95FF1A72 D4027717 13F16876 DD050AE5 B7AD53CC B90855C9" +
+		"39566483 58ADFD96 6422F524 98732D68 D1D7FBEF 10D78034 AB8DCB6F 0FCF885C" +
+		"C2B2EA2C 3E6AC866 09EA058A 9DA8CC63 531DC915 414DF568 B09482DD AC1954DE" +
+		"C7EB714F 6FF7D44C D5B86F6B D1158109 30637C01 D0F6013B C9740FA2 C633BA89")
+	wantU := unhex("" +
+		"03AE5F3C 3FA9EFF1 A50D7DBB 8D2F60A1 EA66EA71 2D50AE97 6EE34641 A1CD0E51" +
+		"C4683DA3 83E8595D 6CB56A15 D5FBC754 3E07FBDD D316217E 01A391A1 8EF06DFF")
+	wantK := unhex("" +
+		"5CBC219D B052138E E1148C71 CD449896 3D682549 CE91CA24 F098468F 06015BEB" +
+		"6AF245C2 093F98C3 651BCA83 AB8CAB2B 580BBF02 184FEFDF 26142F73 DF95AC50")
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{
+			name:     "right password",
+			password: "password123",
+		},
+		{
+			name:     "wrong password",
+			password: "password124",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := startSRP("alice", test.password, salt, serverPrivate)
+			if !test.wantErr && !bytes.Equal(s.v.Bytes(), wantV) {
+				t.Errorf("got verifier %X, want %X", s.v.Bytes(), wantV)
+			}
+
+			// The client, which knows the right password
+			A := srpPad(new(big.Int).Exp(srpG, new(big.Int).SetBytes(clientPrivate), srpN))
+			if u := srpHash(A, s.publicKey()); !test.wantErr && !bytes.Equal(u, wantU) {
+				t.Errorf("got scrambling parameter %X, want %X", u, wantU)
+			}
+			hN, hG := srpHash(srpN.Bytes()), srpHash(srpG.Bytes())
+			for i := range hN {
+				hN[i] ^= hG[i]
+			}
+			proof := srpHash(hN, srpHash([]byte("alice")), salt, A, srpPad(s.B), wantK)
+
+			serverProof, err := s.verify(A, proof)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v verifying the client, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(s.key, wantK) {
+				t.Errorf("got session key %X, want %X", s.key, wantK)
+			}
+			if want := srpHash(A, proof, wantK); !bytes.Equal(serverProof, want) {
+				t.Errorf("got server proof %X, want %X", serverProof, want)
+			}
+		})
+	}
+}
+
+func TestTLV8(t *testing.T) {
+	long := bytes.Repeat([]byte{0xab}, 300)
+	tests := []struct {
+		name  string
+		items tlv8
+		want  []byte
+	}{
+		{
+			name:  "short values",
+			items: tlv8{{tlvState, []byte{1}}, {tlvMethod, []byte{0}}},
+			want:  []byte{tlvState, 1, 1, tlvMethod, 1, 0},
+		},
+		{
+			name:  "empty value",
+			items: tlv8{{tlvSeparator, nil}},
+			want:  []byte{tlvSeparator, 0},
+		},
+		{
+			name:  "fragmented value",
+			items: tlv8{{tlvPublicKey, long}, {tlvState, []byte{2}}},
+			want: append(append(append([]byte{tlvPublicKey, 255}, long[:255]...), tlvPublicKey, 45),
+				append(long[255:], tlvState, 1, 2)...),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := test.items.encode()
+			if !bytes.Equal(encoded, test.want) {
+				t.Fatalf("got encoding %x, want %x", encoded, test.want)
+			}
+			decoded, err := decodeTLV8(encoded)
+			if err != nil {
+				t.Fatalf("failed to decode, %s", err)
+			}
+			if len(decoded) != len(test.items) {
+				t.Fatalf("got %d items decoded, want %d", len(decoded), len(test.items))
+			}
+			for i, item := range decoded {
+				if item.typ != test.items[i].typ || !bytes.Equal(item.value, test.items[i].value) {
+					t.Errorf("got item %d %x, want %x", i, item, test.items[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSession(t *testing.T) {
+	bridgeConn, controllerConn := net.Pipe()
+	defer bridgeConn.Close()
+	defer controllerConn.Close()
+	secret := bytes.Repeat([]byte{7}, 32)
+	bridge, err := newSession(bridgeConn, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, _ := newSession(controllerConn, secret)
+	controller.read, controller.write = controller.write, controller.read
+
+	// Three frames, each sealed under the next nonce
+	message := bytes.Repeat([]byte("sleep number "), 200)
+	go bridge.Write(message)
+	got := make([]byte, len(message))
+	_, err = io.ReadFull(controller, got)
+	if err != nil {
+		t.Fatalf("failed to read, %s", err)
+	}
+	if !bytes.Equal(got, message) {
+		t.Error("got a different message back")
+	}
+	if controller.readCount != 3 {
+		t.Errorf("got %d frames, want 3", controller.readCount)
+	}
+}
@@ -0,0 +1,331 @@
+package homekit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mdnsPort is the port of multicast DNS
+const mdnsPort = 5353
+
+// mdnsGroup is the IPv4 multicast group of multicast DNS
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// TTLs of the records advertised, as RFC 6762 recommends for records with
+// and without a host name in them
+const (
+	hostTTL    = 120
+	serviceTTL = 4500
+)
+
+// cacheFlush is the class bit marking records no other host answers for
+const cacheFlush = 0x8000
+
+// responder answers multicast DNS queries for the bridge's service
+type responder struct {
+	conn   *ipv4.PacketConn
+	ifaces []net.Interface
+	// bind is the address the bridge listens on, or unspecified for all of
+	// them
+	bind     net.IP
+	services dnsmessage.Name
+	service  dnsmessage.Name
+	instance dnsmessage.Name
+	host     dnsmessage.Name
+	port     uint16
+	txt      func() []string
+
+	// writeMu guards choosing the interface to send on and sending
+	writeMu sync.Mutex
+}
+
+// newResponder joins the multicast DNS group on every multicast interface,
+// to advertise the bridge named instance, listening on bind and port, on
+// host.local
+func newResponder(instance, host string, bind net.IP, port int, txt func() []string) (*responder, error) {
+	lc := net.ListenConfig{Control: reuseAddress}
+	packetConn, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf("0.0.0.0:%d", mdnsPort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for multicast DNS, %s", err)
+	}
+	r := &responder{
+		conn:     ipv4.NewPacketConn(packetConn),
+		port:     uint16(port),
+		txt:      txt,
+		services: dnsmessage.MustNewName("_services._dns-sd._udp.local."),
+		service:  dnsmessage.MustNewName("_hap._tcp.local."),
+	}
+	if !bind.IsUnspecified() {
+		r.bind = bind
+	}
+	r.instance, err = dnsmessage.NewName(instance + "._hap._tcp.local.")
+	if err != nil {
+		packetConn.Close()
+		return nil, fmt.Errorf("invalid HomeKit bridge name %q, %s", instance, err)
+	}
+	r.host = dnsmessage.MustNewName(host + ".local.")
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		packetConn.Close()
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || len(r.addresses(&iface)) == 0 {
+			continue
+		}
+		err = r.conn.JoinGroup(&iface, mdnsGroup)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":        "homekit.newResponder",
+				"interface": iface.Name,
+			}).Warnf("failed to join the multicast DNS group, %s", err)
+			continue
+		}
+		r.ifaces = append(r.ifaces, iface)
+	}
+	if len(r.ifaces) == 0 {
+		packetConn.Close()
+		return nil, errors.New("failed to join the multicast DNS group on any interface")
+	}
+	err = r.conn.SetControlMessage(ipv4.FlagInterface, true)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op": "homekit.newResponder",
+		}).Debugf("can't tell the interface of queries, %s", err)
+	}
+	r.conn.SetMulticastTTL(255)
+	r.conn.SetMulticastLoopback(true)
+	return r, nil
+}
+
+// addresses returns the IPv4 addresses of iface to advertise
+func (r *responder) addresses(iface *net.Interface) []net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP.To4()
+		if ip == nil || (r.bind != nil && !ip.Equal(r.bind)) {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// run answers queries until ctx is cancelled, announcing the bridge at the
+// start and whenever changed is signalled, and saying goodbye at the end
+func (r *responder) run(ctx context.Context, changed <-chan struct{}) {
+	logger := log.WithFields(log.Fields{
+		"op":       "homekit.advertise",
+		"instance": r.instance.String(),
+	})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		buf := make([]byte, 9000)
+		for {
+			n, cm, src, err := r.conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Errorf("failed to read multicast DNS, %s", err)
+				}
+				return
+			}
+			ifIndex := 0
+			if cm != nil {
+				ifIndex = cm.IfIndex
+			}
+			r.answer(buf[:n], ifIndex, src)
+		}
+	}()
+
+	// Announcements are repeated a second apart in case one is lost
+	announce := time.NewTimer(0)
+	announcements := 0
+	for {
+		select {
+		case <-ctx.Done():
+			announce.Stop()
+			r.announce(0)
+			r.conn.Close()
+			<-read
+			return
+		case <-changed:
+			announcements = 0
+			announce.Reset(0)
+		case <-announce.C:
+			r.announce(1)
+			announcements++
+			if announcements < 2 {
+				announce.Reset(time.Second)
+			}
+		}
+	}
+}
+
+// announce sends every record on every interface, with their TTLs scaled
+// by scale, 0 saying goodbye
+func (r *responder) announce(scale uint32) {
+	for i := range r.ifaces {
+		iface := &r.ifaces[i]
+		answers := append(r.serviceRecords(scale), r.addressRecords(iface, scale)...)
+		r.send(iface, mdnsGroup, dnsmessage.Message{
+			Header:  dnsmessage.Header{Response: true, Authoritative: true},
+			Answers: answers,
+		})
+	}
+}
+
+// answer answers the query in packet, received on the interface ifIndex from
+// src
+func (r *responder) answer(packet []byte, ifIndex int, src net.Addr) {
+	var query dnsmessage.Message
+	err := query.Unpack(packet)
+	if err != nil || query.Header.Response || query.Header.OpCode != 0 {
+		return
+	}
+	iface := r.iface(ifIndex)
+	if iface == nil {
+		return
+	}
+
+	var answers, additionals []dnsmessage.Resource
+	unicast := false
+	for _, q := range query.Questions {
+		if uint16(q.Class)&cacheFlush != 0 {
+			unicast = true
+		}
+		all := q.Type == dnsmessage.TypeALL
+		switch {
+		case nameEqual(q.Name, r.services) && (q.Type == dnsmessage.TypePTR || all):
+			answers = append(answers, r.resource(r.services, dnsmessage.TypePTR, serviceTTL, false, &dnsmessage.PTRResource{PTR: r.service}))
+		case nameEqual(q.Name, r.service) && (q.Type == dnsmessage.TypePTR || all):
+			answers = append(answers, r.serviceRecords(1)[0])
+			additionals = append(additionals, r.serviceRecords(1)[1:]...)
+			additionals = append(additionals, r.addressRecords(iface, 1)...)
+		case nameEqual(q.Name, r.instance) && (q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeTXT || all):
+			for _, rr := range r.serviceRecords(1)[1:] {
+				if all || rr.Header.Type == q.Type {
+					answers = append(answers, rr)
+				}
+			}
+			additionals = append(additionals, r.addressRecords(iface, 1)...)
+		case nameEqual(q.Name, r.host) && (q.Type == dnsmessage.TypeA || all):
+			answers = append(answers, r.addressRecords(iface, 1)...)
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+
+	res := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: additionals,
+	}
+	to := net.Addr(mdnsGroup)
+	if udp, ok := src.(*net.UDPAddr); ok && udp.Port != mdnsPort {
+		// A legacy resolver, answered directly as unicast DNS would
+		res.Header.ID = query.Header.ID
+		res.Questions = query.Questions
+		to = src
+	} else if unicast {
+		to = src
+	}
+	r.send(iface, to, res)
+}
+
+// iface returns the joined interface of index, or the only one if index is
+// unknown
+func (r *responder) iface(index int) *net.Interface {
+	for i := range r.ifaces {
+		if r.ifaces[i].Index == index || (index == 0 && len(r.ifaces) == 1) {
+			return &r.ifaces[i]
+		}
+	}
+	return nil
+}
+
+// serviceRecords returns the PTR, SRV and TXT records of the service, in
+// that order
+func (r *responder) serviceRecords(scale uint32) []dnsmessage.Resource {
+	var txt []string
+	for _, s := range r.txt() {
+		if len(s) > 255 {
+			s = s[:255]
+		}
+		txt = append(txt, s)
+	}
+	return []dnsmessage.Resource{
+		r.resource(r.service, dnsmessage.TypePTR, serviceTTL*scale, false, &dnsmessage.PTRResource{PTR: r.instance}),
+		r.resource(r.instance, dnsmessage.TypeSRV, hostTTL*scale, true, &dnsmessage.SRVResource{Target: r.host, Port: r.port}),
+		r.resource(r.instance, dnsmessage.TypeTXT, serviceTTL*scale, true, &dnsmessage.TXTResource{TXT: txt}),
+	}
+}
+
+// addressRecords returns the A records of the host on iface
+func (r *responder) addressRecords(iface *net.Interface, scale uint32) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+	for _, ip := range r.addresses(iface) {
+		var a dnsmessage.AResource
+		copy(a.A[:], ip)
+		records = append(records, r.resource(r.host, dnsmessage.TypeA, hostTTL*scale, true, &a))
+	}
+	return records
+}
+
+// resource returns a record of name, of type typ
+func (r *responder) resource(name dnsmessage.Name, typ dnsmessage.Type, ttl uint32, unique bool, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	class := dnsmessage.ClassINET
+	if unique {
+		class |= cacheFlush
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: name, Type: typ, Class: class, TTL: ttl},
+		Body:   body,
+	}
+}
+
+// send sends msg to to out of iface
+func (r *responder) send(iface *net.Interface, to net.Addr, msg dnsmessage.Message) {
+	packet, err := msg.Pack()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op": "homekit.advertise",
+		}).Errorf("failed to pack multicast DNS response, %s", err)
+		return
+	}
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	err = r.conn.SetMulticastInterface(iface)
+	if err == nil {
+		_, err = r.conn.WriteTo(packet, nil, to)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":        "homekit.advertise",
+			"interface": iface.Name,
+		}).Debugf("failed to send multicast DNS response, %s", err)
+	}
+}
+
+// nameEqual compares DNS names without regard to case
+func nameEqual(a, b dnsmessage.Name) bool {
+	return strings.EqualFold(a.String(), b.String())
+}
@@ -0,0 +1,350 @@
+package homekit
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Methods of pairing requests
+const (
+	methodPairSetup     = 0x00
+	methodAddPairing    = 0x03
+	methodRemovePairing = 0x04
+	methodListPairings  = 0x05
+)
+
+// permissionAdmin is the permission of controllers that may manage pairings
+const permissionAdmin = 0x01
+
+// maxFailedPairSetups is how many times a wrong setup code may be tried
+// before pair setup is refused for good, counted in the state file so that
+// restarts don't reset it
+const maxFailedPairSetups = 100
+
+// pairingError answers a pairing request at state with a TLV8 error
+func pairingError(state, code byte) tlv8 {
+	var res tlv8
+	res.addByte(tlvState, state)
+	res.addByte(tlvError, code)
+	return res
+}
+
+// pairSetup handles a step of pair setup, which authenticates a controller
+// with the setup code and exchanges the long-term keys of both
+func (c *conn) pairSetup(req tlv8) tlv8 {
+	b := c.bridge
+	state := req.byteValue(tlvState)
+	logger := log.WithFields(log.Fields{
+		"op":     "homekit.pairSetup",
+		"client": c.remote,
+		"state":  state,
+	})
+	switch state {
+	case 1:
+		if req.byteValue(tlvMethod) != methodPairSetup {
+			return pairingError(2, tlvErrorUnknown)
+		}
+		if b.store.paired() {
+			return pairingError(2, tlvErrorUnavailable)
+		}
+		b.setupMu.Lock()
+		defer b.setupMu.Unlock()
+		if b.store.failedSetups() >= maxFailedPairSetups {
+			return pairingError(2, tlvErrorMaxTries)
+		}
+		if b.setupOwner != nil && b.setupOwner != c {
+			return pairingError(2, tlvErrorBusy)
+		}
+		srp, err := newSRPServer(b.pin)
+		if err != nil {
+			logger.Errorf("failed to start pair setup, %s", err)
+			return pairingError(2, tlvErrorUnknown)
+		}
+		b.setupOwner = c
+		c.srp = srp
+		var res tlv8
+		res.addByte(tlvState, 2)
+		res.add(tlvSalt, srp.salt)
+		res.add(tlvPublicKey, srp.publicKey())
+		return res
+
+	case 3:
+		if !c.settingUp() {
+			return pairingError(4, tlvErrorUnknown)
+		}
+		proof, err := c.srp.verify(req.get(tlvPublicKey), req.get(tlvProof))
+		if err != nil {
+			logger.Warnf("pair setup failed, %s", err)
+			err = b.store.addFailedSetup()
+			if err != nil {
+				logger.Errorf("failed to count the failed pair setup, %s", err)
+			}
+			c.endSetup()
+			return pairingError(4, tlvErrorAuthentication)
+		}
+		var res tlv8
+		res.addByte(tlvState, 4)
+		res.add(tlvProof, proof)
+		return res
+
+	case 5:
+		if !c.settingUp() || c.srp.key == nil {
+			return pairingError(6, tlvErrorUnknown)
+		}
+		defer c.endSetup()
+		res, err := c.exchangeKeys(req)
+		if err != nil {
+			logger.Warnf("pair setup failed, %s", err)
+			return pairingError(6, tlvErrorAuthentication)
+		}
+		return res
+	}
+	return pairingError(state+1, tlvErrorUnknown)
+}
+
+// settingUp reports whether c is the connection pair setup is in progress on
+func (c *conn) settingUp() bool {
+	b := c.bridge
+	b.setupMu.Lock()
+	defer b.setupMu.Unlock()
+	return b.setupOwner == c && c.srp != nil
+}
+
+// endSetup ends pair setup on c, if it is in progress on it
+func (c *conn) endSetup() {
+	b := c.bridge
+	b.setupMu.Lock()
+	defer b.setupMu.Unlock()
+	if b.setupOwner == c {
+		b.setupOwner = nil
+	}
+	c.srp = nil
+}
+
+// exchangeKeys handles the last step of pair setup: it checks the
+// controller's signature over its long-term key, pairs it as an admin, and
+// returns the bridge's long-term key signed in turn
+func (c *conn) exchangeKeys(req tlv8) (tlv8, error) {
+	b := c.bridge
+	key, err := deriveKey(c.srp.key, "Pair-Setup-Encrypt-Salt", "Pair-Setup-Encrypt-Info")
+	if err != nil {
+		return nil, err
+	}
+	data, err := open(key, "PS-Msg05", req.get(tlvEncryptedData))
+	if err != nil {
+		return nil, errors.New("failed to decrypt the controller's keys")
+	}
+	sub, err := decodeTLV8(data)
+	if err != nil {
+		return nil, err
+	}
+	id := sub.get(tlvIdentifier)
+	publicKey := sub.get(tlvPublicKey)
+	if len(id) == 0 || len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("missing controller identifier or key")
+	}
+	controllerX, err := deriveKey(c.srp.key, "Pair-Setup-Controller-Sign-Salt", "Pair-Setup-Controller-Sign-Info")
+	if err != nil {
+		return nil, err
+	}
+	info := append(append(append([]byte(nil), controllerX...), id...), publicKey...)
+	if !ed25519.Verify(publicKey, info, sub.get(tlvSignature)) {
+		return nil, errors.New("wrong controller signature")
+	}
+	err = b.store.addPairing(pairing{ID: string(id), PublicKey: publicKey, Admin: true})
+	if err != nil {
+		return nil, err
+	}
+
+	accessoryX, err := deriveKey(c.srp.key, "Pair-Setup-Accessory-Sign-Salt", "Pair-Setup-Accessory-Sign-Info")
+	if err != nil {
+		return nil, err
+	}
+	bridgeKey := b.store.key.Public().(ed25519.PublicKey)
+	info = append(append(append([]byte(nil), accessoryX...), b.store.deviceID()...), bridgeKey...)
+	var reply tlv8
+	reply.add(tlvIdentifier, []byte(b.store.deviceID()))
+	reply.add(tlvPublicKey, bridgeKey)
+	reply.add(tlvSignature, ed25519.Sign(b.store.key, info))
+	encrypted, err := seal(key, "PS-Msg06", reply.encode())
+	if err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"op":         "homekit.pairSetup",
+		"client":     c.remote,
+		"controller": string(id),
+	}).Info("paired HomeKit controller")
+	b.pairingsChanged(c)
+
+	var res tlv8
+	res.addByte(tlvState, 6)
+	res.add(tlvEncryptedData, encrypted)
+	return res, nil
+}
+
+// pairVerify handles a step of pair verify, which authenticates a paired
+// controller and agrees on the keys of the session, returning the shared
+// secret to derive them from once it succeeds
+func (c *conn) pairVerify(req tlv8) (res tlv8, secret []byte) {
+	b := c.bridge
+	state := req.byteValue(tlvState)
+	logger := log.WithFields(log.Fields{
+		"op":     "homekit.pairVerify",
+		"client": c.remote,
+		"state":  state,
+	})
+	switch state {
+	case 1:
+		controllerKey, err := ecdh.X25519().NewPublicKey(req.get(tlvPublicKey))
+		if err != nil {
+			return pairingError(2, tlvErrorAuthentication), nil
+		}
+		private, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			logger.Errorf("failed to start pair verify, %s", err)
+			return pairingError(2, tlvErrorUnknown), nil
+		}
+		shared, err := private.ECDH(controllerKey)
+		if err != nil {
+			return pairingError(2, tlvErrorAuthentication), nil
+		}
+		key, err := deriveKey(shared, "Pair-Verify-Encrypt-Salt", "Pair-Verify-Encrypt-Info")
+		if err != nil {
+			logger.Errorf("failed to start pair verify, %s", err)
+			return pairingError(2, tlvErrorUnknown), nil
+		}
+		public := private.PublicKey().Bytes()
+		info := append(append(append([]byte(nil), public...), b.store.deviceID()...), controllerKey.Bytes()...)
+		var reply tlv8
+		reply.add(tlvIdentifier, []byte(b.store.deviceID()))
+		reply.add(tlvSignature, ed25519.Sign(b.store.key, info))
+		encrypted, err := seal(key, "PV-Msg02", reply.encode())
+		if err != nil {
+			logger.Errorf("failed to start pair verify, %s", err)
+			return pairingError(2, tlvErrorUnknown), nil
+		}
+		c.verify = &verifyState{
+			publicKey:           public,
+			controllerPublicKey: controllerKey.Bytes(),
+			shared:              shared,
+			key:                 key,
+		}
+		res.addByte(tlvState, 2)
+		res.add(tlvPublicKey, public)
+		res.add(tlvEncryptedData, encrypted)
+		return res, nil
+
+	case 3:
+		v := c.verify
+		c.verify = nil
+		if v == nil {
+			return pairingError(4, tlvErrorUnknown), nil
+		}
+		data, err := open(v.key, "PV-Msg03", req.get(tlvEncryptedData))
+		if err != nil {
+			logger.Warn("pair verify failed, failed to decrypt the controller's proof")
+			return pairingError(4, tlvErrorAuthentication), nil
+		}
+		sub, err := decodeTLV8(data)
+		if err != nil {
+			return pairingError(4, tlvErrorAuthentication), nil
+		}
+		id := string(sub.get(tlvIdentifier))
+		p, ok := b.store.pairing(id)
+		if !ok {
+			logger.WithField("controller", id).Warn("pair verify failed, the controller is not paired")
+			return pairingError(4, tlvErrorAuthentication), nil
+		}
+		info := append(append(append([]byte(nil), v.controllerPublicKey...), id...), v.publicKey...)
+		if !ed25519.Verify(p.PublicKey, info, sub.get(tlvSignature)) {
+			logger.WithField("controller", id).Warn("pair verify failed, wrong controller signature")
+			return pairingError(4, tlvErrorAuthentication), nil
+		}
+		b.mu.Lock()
+		c.controller = id
+		b.mu.Unlock()
+		res.addByte(tlvState, 4)
+		return res, v.shared
+	}
+	return pairingError(state+1, tlvErrorUnknown), nil
+}
+
+// verifyState is pair verify in progress on a connection
+type verifyState struct {
+	publicKey           []byte
+	controllerPublicKey []byte
+	shared              []byte
+	key                 []byte
+}
+
+// managePairings handles a request of an admin controller to add, remove,
+// or list pairings
+func (c *conn) managePairings(req tlv8) tlv8 {
+	b := c.bridge
+	if req.byteValue(tlvState) != 1 {
+		return pairingError(2, tlvErrorUnknown)
+	}
+	self, ok := b.store.pairing(c.controller)
+	if !ok || !self.Admin {
+		return pairingError(2, tlvErrorAuthentication)
+	}
+	logger := log.WithFields(log.Fields{
+		"op":     "homekit.managePairings",
+		"client": c.remote,
+	})
+
+	var res tlv8
+	switch req.byteValue(tlvMethod) {
+	case methodAddPairing:
+		id := string(req.get(tlvIdentifier))
+		publicKey := req.get(tlvPublicKey)
+		if id == "" || len(publicKey) != ed25519.PublicKeySize {
+			return pairingError(2, tlvErrorUnknown)
+		}
+		admin := req.byteValue(tlvPermissions)&permissionAdmin != 0
+		err := b.store.addPairing(pairing{ID: id, PublicKey: publicKey, Admin: admin})
+		if err != nil {
+			logger.Warnf("failed to add pairing, %s", err)
+			return pairingError(2, tlvErrorUnknown)
+		}
+		logger.WithFields(log.Fields{
+			"controller": id,
+			"admin":      admin,
+		}).Info("paired HomeKit controller")
+		b.pairingsChanged(c)
+
+	case methodRemovePairing:
+		id := string(req.get(tlvIdentifier))
+		removed, err := b.store.removePairing(id)
+		if err != nil {
+			logger.Errorf("failed to remove pairing, %s", err)
+			return pairingError(2, tlvErrorUnknown)
+		}
+		for _, removedID := range removed {
+			logger.WithField("controller", removedID).Info("unpaired HomeKit controller")
+		}
+		b.pairingsChanged(c)
+
+	case methodListPairings:
+		for i, p := range b.store.pairings() {
+			if i > 0 {
+				res.add(tlvSeparator, nil)
+			}
+			var permissions byte
+			if p.Admin {
+				permissions = permissionAdmin
+			}
+			res.add(tlvIdentifier, []byte(p.ID))
+			res.add(tlvPublicKey, p.PublicKey)
+			res.addByte(tlvPermissions, permissions)
+		}
+
+	default:
+		return pairingError(2, tlvErrorUnknown)
+	}
+	return append(tlv8{{typ: tlvState, value: []byte{2}}}, res...)
+}
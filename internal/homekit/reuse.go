@@ -0,0 +1,24 @@
+//go:build !windows
+
+package homekit
+
+import (
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+// reuseAddress lets the multicast DNS socket share its port with other
+// responders on the host, such as Avahi or mDNSResponder
+func reuseAddress(network, address string, c syscall.RawConn) error {
+	var err error
+	controlErr := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+		if err == nil {
+			err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
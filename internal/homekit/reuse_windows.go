@@ -0,0 +1,18 @@
+package homekit
+
+import (
+	"syscall"
+)
+
+// reuseAddress lets the multicast DNS socket share its port with other
+// responders on the host, such as Bonjour
+func reuseAddress(network, address string, c syscall.RawConn) error {
+	var err error
+	controlErr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
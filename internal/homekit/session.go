@@ -0,0 +1,105 @@
+package homekit
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"io"
+	"net"
+)
+
+// maxFrameLength is the most plaintext one encrypted frame carries
+const maxFrameLength = 1024
+
+// session encrypts a connection once pair verify is done: each frame is a
+// two-byte little-endian length, which is authenticated too, and the
+// ChaCha20-Poly1305 sealed data, with each side counting its frames as the
+// nonce
+type session struct {
+	conn net.Conn
+	// read and write decrypt what the controller sends and encrypt what the
+	// bridge sends
+	read, write cipher.AEAD
+	// readCount and writeCount are the nonces of the next frames
+	readCount, writeCount uint64
+	// pending is what is left of the last frame read
+	pending []byte
+}
+
+// newSession derives the keys of a session from the shared secret of pair
+// verify
+func newSession(conn net.Conn, secret []byte) (*session, error) {
+	readKey, err := deriveKey(secret, "Control-Salt", "Control-Write-Encryption-Key")
+	if err != nil {
+		return nil, err
+	}
+	writeKey, err := deriveKey(secret, "Control-Salt", "Control-Read-Encryption-Key")
+	if err != nil {
+		return nil, err
+	}
+	s := &session{conn: conn}
+	s.read, err = chacha20poly1305.New(readKey)
+	if err != nil {
+		return nil, err
+	}
+	s.write, err = chacha20poly1305.New(writeKey)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// frameNonce is the nonce of frame count
+func frameNonce(count uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], count)
+	return nonce
+}
+
+// Read decrypts frames from the connection
+func (s *session) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		header := make([]byte, 2)
+		_, err := io.ReadFull(s.conn, header)
+		if err != nil {
+			return 0, err
+		}
+		length := int(binary.LittleEndian.Uint16(header))
+		if length > maxFrameLength {
+			return 0, errors.New("encrypted frame too long")
+		}
+		frame := make([]byte, length+s.read.Overhead())
+		_, err = io.ReadFull(s.conn, frame)
+		if err != nil {
+			return 0, err
+		}
+		s.pending, err = s.read.Open(frame[:0], frameNonce(s.readCount), frame, header)
+		if err != nil {
+			return 0, errors.New("failed to decrypt frame")
+		}
+		s.readCount++
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write encrypts p into frames, writing them to the connection at once;
+// callers must not write concurrently
+func (s *session) Write(p []byte) (int, error) {
+	var out []byte
+	for rest := p; len(rest) > 0; {
+		n := min(len(rest), maxFrameLength)
+		header := binary.LittleEndian.AppendUint16(nil, uint16(n))
+		out = append(out, header...)
+		out = s.write.Seal(out, frameNonce(s.writeCount), rest[:n], header)
+		s.writeCount++
+		rest = rest[n:]
+	}
+	_, err := s.conn.Write(out)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,126 @@
+package homekit
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+)
+
+// srpUsername is the SRP username of pair setup, which authenticates with
+// the setup code as the password
+const srpUsername = "Pair-Setup"
+
+// srpN and srpG are the 3072-bit group of RFC 5054, used with SHA-512
+var (
+	srpN, _ = new(big.Int).SetString(""+
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05"+
+		"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB"+
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718"+
+		"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33"+
+		"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7"+
+		"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864"+
+		"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2"+
+		"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF", 16)
+	srpG = big.NewInt(5)
+)
+
+// srpHash is SHA-512 over the concatenation of parts
+func srpHash(parts ...[]byte) []byte {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// srpPad returns n as big-endian bytes, zero-padded to the length of N
+func srpPad(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, (srpN.BitLen()+7)/8))
+}
+
+// srpServer is the accessory's side of an SRP-6a exchange, as HomeKit pair
+// setup does it: k = H(N | PAD(g)), u = H(PAD(A) | PAD(B)), K = H(PAD(S)),
+// and M1 = H(H(N) xor H(g) | H(I) | s | A | PAD(B) | K)
+type srpServer struct {
+	username string
+	salt     []byte
+	v        *big.Int
+	b        *big.Int
+	B        *big.Int
+	// key is K, set once the client's proof checks out
+	key []byte
+}
+
+// newSRPServer starts an exchange for the setup code pin with a new salt
+// and ephemeral key
+func newSRPServer(pin string) (*srpServer, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	private := make([]byte, 32)
+	_, err = rand.Read(private)
+	if err != nil {
+		return nil, err
+	}
+	return startSRP(srpUsername, pin, salt, private), nil
+}
+
+// startSRP starts an exchange for username and password with the given salt
+// and ephemeral private key b
+func startSRP(username, password string, salt, private []byte) *srpServer {
+	s := &srpServer{username: username, salt: salt}
+	x := new(big.Int).SetBytes(srpHash(salt, srpHash([]byte(username+":"+password))))
+	s.v = new(big.Int).Exp(srpG, x, srpN)
+
+	s.b = new(big.Int).SetBytes(private)
+	k := new(big.Int).SetBytes(srpHash(srpPad(srpN), srpPad(srpG)))
+	// B = k*v + g^b mod N
+	s.B = new(big.Int).Mul(k, s.v)
+	s.B.Add(s.B, new(big.Int).Exp(srpG, s.b, srpN))
+	s.B.Mod(s.B, srpN)
+	return s
+}
+
+// publicKey is B, padded to the length of N
+func (s *srpServer) publicKey() []byte {
+	return srpPad(s.B)
+}
+
+// verify checks the client's public key A and proof M1, returning the
+// server's proof M2 and keeping the shared key if they check out
+func (s *srpServer) verify(clientPublic, clientProof []byte) ([]byte, error) {
+	A := new(big.Int).SetBytes(clientPublic)
+	if new(big.Int).Mod(A, srpN).Sign() == 0 {
+		return nil, errors.New("invalid SRP public key")
+	}
+	u := new(big.Int).SetBytes(srpHash(srpPad(A), srpPad(s.B)))
+	if u.Sign() == 0 {
+		return nil, errors.New("invalid SRP public key")
+	}
+	// S = (A * v^u) ^ b mod N
+	S := new(big.Int).Exp(s.v, u, srpN)
+	S.Mul(S, A)
+	S.Mod(S, srpN)
+	S.Exp(S, s.b, srpN)
+	key := srpHash(srpPad(S))
+
+	hN := srpHash(srpN.Bytes())
+	hG := srpHash(srpG.Bytes())
+	for i := range hN {
+		hN[i] ^= hG[i]
+	}
+	proof := srpHash(hN, srpHash([]byte(s.username)), s.salt, clientPublic, srpPad(s.B), key)
+	if subtle.ConstantTimeCompare(proof, clientProof) != 1 {
+		return nil, errors.New("wrong setup code")
+	}
+	s.key = key
+	return srpHash(clientPublic, proof, key), nil
+}
@@ -0,0 +1,258 @@
+package homekit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// pairing is a controller paired with the bridge
+type pairing struct {
+	ID        string            `json:"id"`
+	PublicKey ed25519.PublicKey `json:"publicKey"`
+	Admin     bool              `json:"admin"`
+}
+
+// sideKey identifies a side of a bed
+type sideKey struct {
+	Account string `json:"account"`
+	Bed     string `json:"bed"`
+	Side    string `json:"side"`
+}
+
+// storedAccessory is the accessory ID of a bed side
+type storedAccessory struct {
+	sideKey
+	AID uint64 `json:"aid"`
+}
+
+// storeData is what the state file holds
+type storeData struct {
+	// DeviceID identifies the bridge to controllers, as a MAC address does
+	DeviceID string `json:"deviceId"`
+	// Seed is the seed of the bridge's long-term Ed25519 key
+	Seed     []byte    `json:"seed"`
+	Pairings []pairing `json:"pairings"`
+	// Accessories keeps the accessory ID of every bed side seen, which
+	// controllers expect to stay the same
+	Accessories []storedAccessory `json:"accessories"`
+	// ConfigHash and ConfigNumber track the accessories served, the number
+	// going up whenever they change so that controllers fetch them again
+	ConfigHash   string `json:"configHash"`
+	ConfigNumber int    `json:"configNumber"`
+	// FailedSetups counts pair setups that failed on a wrong setup code,
+	// kept so that restarting the bridge doesn't allow more guesses
+	FailedSetups int `json:"failedSetups,omitempty"`
+}
+
+// store keeps the identity and pairings of the bridge in a file, which must
+// survive restarts for controllers to stay paired
+type store struct {
+	path string
+	key  ed25519.PrivateKey
+
+	mu   sync.Mutex
+	data storeData
+}
+
+// openStore reads the state file at path, creating it with a new identity if
+// it does not exist
+func openStore(path string) (*store, error) {
+	s := &store{path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		s.data.DeviceID, err = newDeviceID()
+		if err != nil {
+			return nil, err
+		}
+		s.data.Seed = make([]byte, ed25519.SeedSize)
+		_, err = rand.Read(s.data.Seed)
+		if err != nil {
+			return nil, err
+		}
+		s.data.ConfigNumber = 1
+		err = s.save()
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to read HomeKit state, %s", err)
+	default:
+		err = json.Unmarshal(data, &s.data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HomeKit state %s, %s", path, err)
+		}
+		if len(s.data.Seed) != ed25519.SeedSize || s.data.DeviceID == "" {
+			return nil, fmt.Errorf("HomeKit state %s has no identity", path)
+		}
+	}
+	s.key = ed25519.NewKeyFromSeed(s.data.Seed)
+	return s, nil
+}
+
+// newDeviceID returns a random device ID, formatted as a locally
+// administered MAC address
+func newDeviceID() (string, error) {
+	id := make([]byte, 6)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	id[0] = id[0]&^0x01 | 0x02
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", id[0], id[1], id[2], id[3], id[4], id[5]), nil
+}
+
+// save writes the state file, replacing it whole; s.mu must be held unless
+// s is not shared yet
+func (s *store) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save HomeKit state, %s", err)
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return fmt.Errorf("failed to save HomeKit state, %s", err)
+	}
+	return nil
+}
+
+// deviceID is the device ID of the bridge
+func (s *store) deviceID() string {
+	return s.data.DeviceID
+}
+
+// paired reports whether any controller is paired
+func (s *store) paired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.data.Pairings) > 0
+}
+
+// pairing returns the controller paired as id
+func (s *store) pairing(id string) (pairing, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.data.Pairings {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return pairing{}, false
+}
+
+// pairings returns every paired controller
+func (s *store) pairings() []pairing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pairing(nil), s.data.Pairings...)
+}
+
+// addPairing pairs a controller, or changes its permissions if it is
+// already paired with the same key
+func (s *store) addPairing(p pairing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.data.Pairings {
+		if existing.ID == p.ID {
+			if !existing.PublicKey.Equal(p.PublicKey) {
+				return fmt.Errorf("controller %s is already paired with another key", p.ID)
+			}
+			s.data.Pairings[i].Admin = p.Admin
+			return s.save()
+		}
+	}
+	s.data.Pairings = append(s.data.Pairings, p)
+	return s.save()
+}
+
+// removePairing unpairs the controller paired as id, and every other one if
+// no admin is left, returning the IDs of the controllers unpaired
+func (s *store) removePairing(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed []string
+	kept := s.data.Pairings[:0]
+	admins := 0
+	for _, p := range s.data.Pairings {
+		if p.ID == id {
+			removed = append(removed, p.ID)
+			continue
+		}
+		if p.Admin {
+			admins++
+		}
+		kept = append(kept, p)
+	}
+	if admins == 0 {
+		for _, p := range kept {
+			removed = append(removed, p.ID)
+		}
+		kept = kept[:0]
+	}
+	s.data.Pairings = kept
+	return removed, s.save()
+}
+
+// failedSetups returns how many pair setups failed on a wrong setup code
+func (s *store) failedSetups() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.FailedSetups
+}
+
+// addFailedSetup counts a pair setup that failed on a wrong setup code
+func (s *store) addFailedSetup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.FailedSetups++
+	return s.save()
+}
+
+// accessories returns the bed sides seen so far, with their accessory IDs
+func (s *store) accessories() []storedAccessory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]storedAccessory(nil), s.data.Accessories...)
+}
+
+// accessoryID returns the accessory ID of the bed side key, assigning the
+// next free one the first time it is seen
+func (s *store) accessoryID(key sideKey) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The bridge itself is accessory 1
+	aid := uint64(1)
+	for _, a := range s.data.Accessories {
+		if a.sideKey == key {
+			return a.AID, nil
+		}
+		aid = max(aid, a.AID)
+	}
+	aid++
+	s.data.Accessories = append(s.data.Accessories, storedAccessory{sideKey: key, AID: aid})
+	return aid, s.save()
+}
+
+// configNumber returns the configuration number for the accessories hashed
+// as hash, going up if they changed since last time
+func (s *store) configNumber(hash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.ConfigHash == hash {
+		return s.data.ConfigNumber, nil
+	}
+	s.data.ConfigHash = hash
+	// It must stay within 1 to 65535
+	s.data.ConfigNumber = s.data.ConfigNumber%65535 + 1
+	return s.data.ConfigNumber, s.save()
+}
@@ -0,0 +1,113 @@
+package homekit
+
+import (
+	"bytes"
+	"errors"
+)
+
+// TLV8 types of the pairing messages
+const (
+	tlvMethod        = 0x00
+	tlvIdentifier    = 0x01
+	tlvSalt          = 0x02
+	tlvPublicKey     = 0x03
+	tlvProof         = 0x04
+	tlvEncryptedData = 0x05
+	tlvState         = 0x06
+	tlvError         = 0x07
+	tlvSignature     = 0x0a
+	tlvPermissions   = 0x0b
+	tlvSeparator     = 0xff
+)
+
+// TLV8 error codes
+const (
+	tlvErrorUnknown        = 0x01
+	tlvErrorAuthentication = 0x02
+	tlvErrorMaxTries       = 0x05
+	tlvErrorUnavailable    = 0x06
+	tlvErrorBusy           = 0x07
+)
+
+// tlvItem is one item of a TLV8 message
+type tlvItem struct {
+	typ   byte
+	value []byte
+}
+
+// tlv8 is a TLV8 message, its items in order
+type tlv8 []tlvItem
+
+// decodeTLV8 parses data, joining the fragments of values longer than 255
+// bytes, which come as consecutive items of the same type
+func decodeTLV8(data []byte) (tlv8, error) {
+	var items tlv8
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("truncated TLV8 item")
+		}
+		typ, length := data[0], int(data[1])
+		if len(data) < 2+length {
+			return nil, errors.New("truncated TLV8 value")
+		}
+		value := data[2 : 2+length]
+		data = data[2+length:]
+		if n := len(items); n > 0 && items[n-1].typ == typ && len(items[n-1].value)%255 == 0 && len(items[n-1].value) > 0 {
+			items[n-1].value = append(items[n-1].value, value...)
+			continue
+		}
+		items = append(items, tlvItem{typ: typ, value: append([]byte(nil), value...)})
+	}
+	return items, nil
+}
+
+// get returns the value of the first item of typ, or nil
+func (t tlv8) get(typ byte) []byte {
+	for _, item := range t {
+		if item.typ == typ {
+			return item.value
+		}
+	}
+	return nil
+}
+
+// byteValue returns the one-byte value of the first item of typ, or 0
+func (t tlv8) byteValue(typ byte) byte {
+	value := t.get(typ)
+	if len(value) != 1 {
+		return 0
+	}
+	return value[0]
+}
+
+// add appends an item
+func (t *tlv8) add(typ byte, value []byte) {
+	*t = append(*t, tlvItem{typ: typ, value: value})
+}
+
+// addByte appends an item with a one-byte value
+func (t *tlv8) addByte(typ byte, value byte) {
+	t.add(typ, []byte{value})
+}
+
+// encode serializes the message, splitting values longer than 255 bytes
+// into fragments
+func (t tlv8) encode() []byte {
+	var buf bytes.Buffer
+	for _, item := range t {
+		value := item.value
+		if len(value) == 0 {
+			buf.WriteByte(item.typ)
+			buf.WriteByte(0)
+			continue
+		}
+		for len(value) > 0 {
+			n := min(len(value), 255)
+			buf.WriteByte(item.typ)
+			buf.WriteByte(byte(n))
+			buf.Write(value[:n])
+			value = value[n:]
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,155 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultConsulAddress = "http://127.0.0.1:8500"
+
+// ConsulLock elects the instance holding a Consul KV lock through a session
+// that expires after the TTL if its holder stops renewing it
+type ConsulLock struct {
+	address  string
+	token    string
+	key      string
+	identity string
+	ttl      time.Duration
+	client   *http.Client
+
+	mu      sync.Mutex
+	session string
+}
+
+// NewConsulLock returns a ConsulLock on the configured key
+func NewConsulLock(cfg *config.ConsulLock, identity string, ttl time.Duration) (*ConsulLock, error) {
+	if cfg.Key == "" {
+		return nil, errors.New("leader election Consul key is not set")
+	}
+	address := cfg.Address
+	if address == "" {
+		address = defaultConsulAddress
+	}
+	return &ConsulLock{
+		address:  strings.TrimSuffix(address, "/"),
+		token:    cfg.Token,
+		key:      strings.TrimPrefix(cfg.Key, "/"),
+		identity: identity,
+		ttl:      ttl,
+		client:   &http.Client{Timeout: ttl / 3},
+	}, nil
+}
+
+func (l *ConsulLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Renew the session, starting a new one if it expired
+	if l.session != "" {
+		status, err := l.put(ctx, "/v1/session/renew/"+l.session, nil, nil, nil)
+		if err != nil {
+			return false, err
+		}
+		if status == http.StatusNotFound {
+			l.session = ""
+		}
+	}
+	if l.session == "" {
+		var created struct {
+			ID string `json:"ID"`
+		}
+		_, err := l.put(ctx, "/v1/session/create", nil, map[string]string{
+			"Name":      "sleepnumber-stats-collector " + l.identity,
+			"TTL":       l.ttl.String(),
+			"Behavior":  "release",
+			"LockDelay": "0s",
+		}, &created)
+		if err != nil {
+			return false, err
+		}
+		l.session = created.ID
+	}
+
+	var acquired bool
+	_, err := l.put(ctx, "/v1/kv/"+l.key, url.Values{"acquire": {l.session}}, l.identity, &acquired)
+	if err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
+
+func (l *ConsulLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.session == "" {
+		return nil
+	}
+
+	_, err := l.put(ctx, "/v1/kv/"+l.key, url.Values{"release": {l.session}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = l.put(ctx, "/v1/session/destroy/"+l.session, nil, nil, nil)
+	l.session = ""
+	return err
+}
+
+// put sends a PUT request to the Consul HTTP API, returning the status of a
+// 404 response instead of an error
+func (l *ConsulLock) put(ctx context.Context, path string, query url.Values, body interface{}, result interface{}) (int, error) {
+	var reqBody io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reqBody = strings.NewReader(b)
+	default:
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+
+	reqURL := l.address + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, reqURL, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	if l.token != "" {
+		req.Header.Set("X-Consul-Token", l.token)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach Consul, %s", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("Consul returned %s for %s, %s", resp.Status, path, strings.TrimSpace(string(respBody)))
+	}
+	if result != nil {
+		return resp.StatusCode, json.Unmarshal(respBody, result)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,190 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul serves the session and KV endpoints a ConsulLock uses, for one
+// key
+type fakeConsul struct {
+	mu       sync.Mutex
+	sessions map[string]bool
+	next     int
+	holder   string
+	token    string
+	// fail answers every request with this status when set
+	fail int
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail != 0 {
+		http.Error(w, "unavailable", c.fail)
+		return
+	}
+	if r.Header.Get("X-Consul-Token") != c.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		c.next++
+		id := fmt.Sprintf("session-%d", c.next)
+		c.sessions[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		if !c.sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")] {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("[]"))
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		c.expire(strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/"))
+		w.Write([]byte("true"))
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		if session := r.URL.Query().Get("acquire"); session != "" {
+			acquired := c.sessions[session] && (c.holder == "" || c.holder == session)
+			if acquired {
+				c.holder = session
+			}
+			json.NewEncoder(w).Encode(acquired)
+			return
+		}
+		if session := r.URL.Query().Get("release"); session != "" && session == c.holder {
+			c.holder = ""
+		}
+		w.Write([]byte("true"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// expire ends session, releasing the key if it holds it as with
+// Behavior release; c.mu must be held
+func (c *fakeConsul) expire(session string) {
+	delete(c.sessions, session)
+	if c.holder == session {
+		c.holder = ""
+	}
+}
+
+// expireAll ends every session, as when their holders stop renewing them
+func (c *fakeConsul) expireAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for session := range c.sessions {
+		c.expire(session)
+	}
+}
+
+func TestConsulLock(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []lockStep
+		// expireAfter expires every session after that many steps, if set
+		expireAfter int
+	}{
+		{
+			name: "first instance leads",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "b", action: doAcquire, want: false},
+				{instance: "a", action: doAcquire, want: true},
+			},
+		},
+		{
+			name: "standby takes over on release",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "b", action: doAcquire, want: false},
+				{instance: "a", action: doRelease},
+				{instance: "b", action: doAcquire, want: true},
+				{instance: "a", action: doAcquire, want: false},
+			},
+		},
+		{
+			name: "standby takes over from an expired session",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "b", action: doAcquire, want: false},
+				{instance: "b", action: doAcquire, want: true},
+				{instance: "a", action: doAcquire, want: false},
+			},
+			expireAfter: 2,
+		},
+		{
+			name: "leader starts a new session once its own expired",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "a", action: doAcquire, want: true},
+			},
+			expireAfter: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consul := &fakeConsul{sessions: make(map[string]bool), token: "secret"}
+			server := httptest.NewServer(consul)
+			defer server.Close()
+
+			locks := make(map[string]Lock)
+			for _, instance := range []string{"a", "b"} {
+				lock, err := NewConsulLock(&config.ConsulLock{Address: server.URL + "/", Token: "secret", Key: "/sleepnumber/leader"}, instance, 15*time.Second)
+				if err != nil {
+					t.Fatal(err)
+				}
+				locks[instance] = lock
+			}
+			steps := test.steps
+			if test.expireAfter > 0 {
+				runSteps(t, locks, steps[:test.expireAfter])
+				consul.expireAll()
+				steps = steps[test.expireAfter:]
+			}
+			runSteps(t, locks, steps)
+		})
+	}
+}
+
+func TestConsulLockErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		fail    int
+		wantErr string
+	}{
+		{name: "wrong token", token: "wrong", wantErr: "403"},
+		{name: "Consul failing", token: "secret", fail: http.StatusInternalServerError, wantErr: "500"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consul := &fakeConsul{sessions: make(map[string]bool), token: "secret", fail: test.fail}
+			server := httptest.NewServer(consul)
+			defer server.Close()
+
+			lock, err := NewConsulLock(&config.ConsulLock{Address: server.URL, Token: test.token, Key: "leader"}, "a", 15*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leading, err := lock.TryAcquire(context.Background())
+			if leading {
+				t.Errorf("got leading, want not")
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// FileLock elects the instance holding an exclusive flock on a shared file;
+// the operating system releases it if the holder dies
+type FileLock struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileLock returns a FileLock on the file at path, which is created if it
+// does not exist
+func NewFileLock(path string) (*FileLock, error) {
+	if path == "" {
+		return nil, errors.New("leader election file is not set")
+	}
+	return &FileLock{path: path}, nil
+}
+
+func (l *FileLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to open leader election file %s, %s", l.path, err)
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+		return false, nil
+	}
+	if err != nil {
+		file.Close()
+		return false, fmt.Errorf("failed to lock leader election file %s, %s", l.path, err)
+	}
+	l.file = file
+	return true, nil
+}
+
+func (l *FileLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,74 @@
+//go:build !windows
+
+package leader
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLock(t *testing.T) {
+	tests := []struct {
+		name string
+		// steps are run in order, each by instance a or b, and want is
+		// whether it then holds leadership
+		steps []lockStep
+	}{
+		{
+			name: "first instance leads",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "b", action: doAcquire, want: false},
+			},
+		},
+		{
+			name: "leader renews",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "b", action: doAcquire, want: false},
+			},
+		},
+		{
+			name: "standby takes over on release",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "b", action: doAcquire, want: false},
+				{instance: "a", action: doRelease},
+				{instance: "b", action: doAcquire, want: true},
+				{instance: "a", action: doAcquire, want: false},
+			},
+		},
+		{
+			name: "release without leading",
+			steps: []lockStep{
+				{instance: "b", action: doRelease},
+				{instance: "b", action: doAcquire, want: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "leader.lock")
+			locks := make(map[string]Lock)
+			for _, instance := range []string{"a", "b"} {
+				lock, err := NewFileLock(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				locks[instance] = lock
+				t.Cleanup(func() { lock.Release(context.Background()) })
+			}
+			runSteps(t, locks, test.steps)
+		})
+	}
+}
+
+func TestNewFileLockWithoutPath(t *testing.T) {
+	_, err := NewFileLock("")
+	if err == nil {
+		t.Errorf("got no error, want one for the missing path")
+	}
+}
@@ -0,0 +1,22 @@
+package leader
+
+import (
+	"context"
+	"errors"
+)
+
+// FileLock is not supported on Windows
+type FileLock struct{}
+
+// NewFileLock always fails on Windows, which has no flock
+func NewFileLock(path string) (*FileLock, error) {
+	return nil, errors.New("file leader election is not supported on Windows")
+}
+
+func (l *FileLock) TryAcquire(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+func (l *FileLock) Release(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,229 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// microTime is the timestamp format of Lease renewals
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// KubernetesLock elects the instance holding a coordination.k8s.io Lease,
+// using the in-cluster service account
+type KubernetesLock struct {
+	leaseURL  string
+	namespace string
+	name      string
+	identity  string
+	ttl       time.Duration
+	client    *http.Client
+
+	mu sync.Mutex
+}
+
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+// transportWithToken authenticates every request with the service account
+// token, re-read each time since Kubernetes rotates it
+type transportWithToken struct {
+	next http.RoundTripper
+}
+
+func (t transportWithToken) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token, %s", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	return t.next.RoundTrip(req)
+}
+
+// NewKubernetesLock returns a KubernetesLock on the configured Lease; the
+// namespace defaults to the pod's own
+func NewKubernetesLock(cfg *config.KubernetesLock, identity string, ttl time.Duration) (*KubernetesLock, error) {
+	if cfg.Lease == "" {
+		return nil, errors.New("leader election Kubernetes lease is not set")
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("Kubernetes leader election must run inside a cluster")
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod namespace, %s", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA, %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates found in cluster CA")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	return &KubernetesLock{
+		leaseURL: fmt.Sprintf("https://%s/apis/coordination.k8s.io/v1/namespaces/%s/leases",
+			net.JoinHostPort(host, port), namespace),
+		namespace: namespace,
+		name:      cfg.Lease,
+		identity:  identity,
+		ttl:       ttl,
+		client: &http.Client{
+			Transport: transportWithToken{next: transport},
+			Timeout:   ttl / 3,
+		},
+	}, nil
+}
+
+func (l *KubernetesLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var current lease
+	status, err := l.do(ctx, http.MethodGet, l.leaseURL+"/"+l.name, nil, &current)
+	if err != nil {
+		return false, err
+	}
+
+	if status == http.StatusNotFound {
+		status, err = l.do(ctx, http.MethodPost, l.leaseURL, &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata: leaseMetadata{
+				Name:      l.name,
+				Namespace: l.namespace,
+			},
+			Spec: leaseSpec{
+				HolderIdentity:       l.identity,
+				LeaseDurationSeconds: int(l.ttl / time.Second),
+				AcquireTime:          now.UTC().Format(microTime),
+				RenewTime:            now.UTC().Format(microTime),
+			},
+		}, nil)
+		if err != nil {
+			return false, err
+		}
+		// Another instance created it first
+		return status != http.StatusConflict, nil
+	}
+
+	if current.Spec.HolderIdentity != l.identity && current.Spec.HolderIdentity != "" {
+		renewed, err := time.Parse(microTime, current.Spec.RenewTime)
+		expiry := renewed.Add(time.Duration(current.Spec.LeaseDurationSeconds) * time.Second)
+		if err == nil && now.Before(expiry) {
+			return false, nil
+		}
+	}
+
+	if current.Spec.HolderIdentity != l.identity {
+		current.Spec.AcquireTime = now.UTC().Format(microTime)
+	}
+	current.Spec.HolderIdentity = l.identity
+	current.Spec.LeaseDurationSeconds = int(l.ttl / time.Second)
+	current.Spec.RenewTime = now.UTC().Format(microTime)
+
+	// The resourceVersion makes the update fail with a conflict if another
+	// instance changed the Lease since it was read
+	status, err = l.do(ctx, http.MethodPut, l.leaseURL+"/"+l.name, &current, nil)
+	if err != nil {
+		return false, err
+	}
+	return status != http.StatusConflict, nil
+}
+
+func (l *KubernetesLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var current lease
+	status, err := l.do(ctx, http.MethodGet, l.leaseURL+"/"+l.name, nil, &current)
+	if err != nil || status == http.StatusNotFound || current.Spec.HolderIdentity != l.identity {
+		return err
+	}
+	current.Spec.HolderIdentity = ""
+	_, err = l.do(ctx, http.MethodPut, l.leaseURL+"/"+l.name, &current, nil)
+	return err
+}
+
+// do sends a request to the Kubernetes API, returning the status of a 404 or
+// 409 response instead of an error
+func (l *KubernetesLock) do(ctx context.Context, method, reqURL string, body interface{}, result interface{}) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach the Kubernetes API, %s", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound, http.StatusConflict:
+		return resp.StatusCode, nil
+	default:
+		return resp.StatusCode, fmt.Errorf("Kubernetes API returned %s for lease %s, %s", resp.Status, l.name, strings.TrimSpace(string(respBody)))
+	}
+	if result != nil {
+		return resp.StatusCode, json.Unmarshal(respBody, result)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,193 @@
+package leader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testLeasesPath = "/apis/coordination.k8s.io/v1/namespaces/home/leases"
+
+// fakeLeases serves the Lease endpoints a KubernetesLock uses, rejecting
+// updates of an outdated resourceVersion as the API server does
+type fakeLeases struct {
+	mu     sync.Mutex
+	leases map[string]*lease
+	// version counts the changes made, as resourceVersion
+	version int
+	// conflict answers the next update with a conflict when set, as if
+	// another instance changed the Lease first
+	conflict bool
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, testLeasesPath), "/")
+	switch r.Method {
+	case http.MethodGet:
+		current, ok := f.leases[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(current)
+	case http.MethodPost, http.MethodPut:
+		var next lease
+		err := json.NewDecoder(r.Body).Decode(&next)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		current, exists := f.leases[next.Metadata.Name]
+		switch {
+		case r.Method == http.MethodPost && exists,
+			r.Method == http.MethodPut && (!exists || current.Metadata.ResourceVersion != next.Metadata.ResourceVersion),
+			f.conflict:
+			f.conflict = false
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		f.version++
+		next.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.leases[next.Metadata.Name] = &next
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(next)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// put stores a Lease held by holder, last renewed at renewed
+func (f *fakeLeases) put(holder string, renewed time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version++
+	f.leases["leader"] = &lease{
+		Metadata: leaseMetadata{Name: "leader", Namespace: "home", ResourceVersion: strconv.Itoa(f.version)},
+		Spec: leaseSpec{
+			HolderIdentity:       holder,
+			LeaseDurationSeconds: 15,
+			RenewTime:            renewed.UTC().Format(microTime),
+		},
+	}
+}
+
+func (f *fakeLeases) holder() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if current, ok := f.leases["leader"]; ok {
+		return current.Spec.HolderIdentity
+	}
+	return ""
+}
+
+// newTestKubernetesLock returns a KubernetesLock on the Lease named leader
+// of server for identity, bypassing the in-cluster setup
+func newTestKubernetesLock(server *httptest.Server, identity string) *KubernetesLock {
+	return &KubernetesLock{
+		leaseURL:  server.URL + testLeasesPath,
+		namespace: "home",
+		name:      "leader",
+		identity:  identity,
+		ttl:       15 * time.Second,
+		client:    server.Client(),
+	}
+}
+
+func TestKubernetesLock(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup prepares the Lease before the steps, if set
+		setup      func(f *fakeLeases)
+		steps      []lockStep
+		wantHolder string
+	}{
+		{
+			name: "lease created by the first instance",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "b", action: doAcquire, want: false},
+				{instance: "a", action: doAcquire, want: true},
+			},
+			wantHolder: "a",
+		},
+		{
+			name: "standby takes over on release",
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+				{instance: "a", action: doRelease},
+				{instance: "b", action: doAcquire, want: true},
+				{instance: "a", action: doAcquire, want: false},
+			},
+			wantHolder: "b",
+		},
+		{
+			name: "standby leaves a renewed lease alone",
+			setup: func(f *fakeLeases) {
+				f.put("c", time.Now())
+			},
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: false},
+			},
+			wantHolder: "c",
+		},
+		{
+			name: "standby takes over an expired lease",
+			setup: func(f *fakeLeases) {
+				f.put("c", time.Now().Add(-time.Minute))
+			},
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: true},
+			},
+			wantHolder: "a",
+		},
+		{
+			name: "lease changed by another instance first",
+			setup: func(f *fakeLeases) {
+				f.put("", time.Time{})
+				f.conflict = true
+			},
+			steps: []lockStep{
+				{instance: "a", action: doAcquire, want: false},
+				{instance: "a", action: doAcquire, want: true},
+			},
+			wantHolder: "a",
+		},
+		{
+			name: "release of a lease held by another",
+			setup: func(f *fakeLeases) {
+				f.put("c", time.Now())
+			},
+			steps: []lockStep{
+				{instance: "a", action: doRelease},
+			},
+			wantHolder: "c",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			leases := &fakeLeases{leases: make(map[string]*lease)}
+			if test.setup != nil {
+				test.setup(leases)
+			}
+			server := httptest.NewServer(leases)
+			defer server.Close()
+
+			locks := map[string]Lock{
+				"a": newTestKubernetesLock(server, "a"),
+				"b": newTestKubernetesLock(server, "b"),
+			}
+			runSteps(t, locks, test.steps)
+			if got := leases.holder(); got != test.wantHolder {
+				t.Errorf("got holder %q, want %q", got, test.wantHolder)
+			}
+		})
+	}
+}
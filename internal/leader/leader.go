@@ -0,0 +1,127 @@
+// Package leader elects one active instance among redundant deployments so
+// only the leader polls SleepIQ.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"time"
+)
+
+const defaultTTL = 15 * time.Second
+
+// Lock is a leadership lock shared between instances
+type Lock interface {
+	// TryAcquire takes or renews leadership without blocking, reporting
+	// whether this instance holds it
+	TryAcquire(ctx context.Context) (bool, error)
+	// Release gives up leadership so a standby can take over immediately
+	Release(ctx context.Context) error
+}
+
+// New returns the Lock for the configured backend
+func New(cfg *config.LeaderElection) (Lock, error) {
+	identity := cfg.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine leader election identity, %s", err)
+		}
+		identity = hostname
+	}
+
+	switch cfg.Backend {
+	case "file":
+		return NewFileLock(cfg.File)
+	case "consul":
+		return NewConsulLock(&cfg.Consul, identity, ttl(cfg))
+	case "kubernetes":
+		return NewKubernetesLock(&cfg.Kubernetes, identity, ttl(cfg))
+	}
+	return nil, fmt.Errorf("unknown leader election backend %s, must be file, consul, or kubernetes", cfg.Backend)
+}
+
+func ttl(cfg *config.LeaderElection) time.Duration {
+	if cfg.TTL == 0 {
+		return defaultTTL
+	}
+	return cfg.TTL
+}
+
+// Run calls lead with a context that stays alive while this instance holds
+// leadership, checking lock every third of cfg.TTL, until ctx is cancelled.
+// Leadership is given up as soon as a renewal fails, before the TTL lets a
+// standby take over. If lead returns an error while still leading, Run
+// releases leadership and returns it.
+func Run(ctx context.Context, lock Lock, cfg *config.LeaderElection, lead func(ctx context.Context) error) error {
+	interval := ttl(cfg) / 3
+
+	var cancelLead context.CancelFunc
+	var done chan struct{}
+	var leadErr error
+	stepDown := func() {
+		if cancelLead != nil {
+			cancelLead()
+			<-done
+			cancelLead = nil
+			done = nil
+		}
+	}
+
+	for {
+		leading, err := lock.TryAcquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.WithFields(log.Fields{
+				"op":    "leader.Run",
+				"error": err,
+			}).Warn("failed to check leadership")
+		}
+
+		switch {
+		case leading && cancelLead == nil:
+			log.WithFields(log.Fields{
+				"op": "leader.Run",
+			}).Info("acquired leadership, starting collection")
+			leadCtx, cancel := context.WithCancel(ctx)
+			cancelLead = cancel
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				leadErr = lead(leadCtx)
+			}()
+		case !leading && cancelLead != nil:
+			log.WithFields(log.Fields{
+				"op": "leader.Run",
+			}).Warn("lost leadership, standing by")
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+			stepDown()
+			release(lock, interval)
+			return nil
+		case <-done:
+			// The leader stopped on its own; hand over to another instance
+			stepDown()
+			release(lock, interval)
+			return leadErr
+		case <-time.After(interval):
+		}
+	}
+}
+
+func release(lock Lock, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := lock.Release(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "leader.Run",
+			"error": err,
+		}).Warn("failed to release leadership")
+	}
+}
@@ -0,0 +1,187 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockAction is what a lockStep does with its instance's Lock
+type lockAction int
+
+const (
+	doAcquire lockAction = iota
+	doRelease
+)
+
+// lockStep is one step of a test of a Lock shared by several instances
+type lockStep struct {
+	instance string
+	action   lockAction
+	// want is whether doAcquire takes or keeps leadership
+	want bool
+}
+
+// runSteps runs steps against the Locks of each instance in turn
+func runSteps(t *testing.T, locks map[string]Lock, steps []lockStep) {
+	t.Helper()
+	for i, step := range steps {
+		lock := locks[step.instance]
+		switch step.action {
+		case doAcquire:
+			got, err := lock.TryAcquire(context.Background())
+			if err != nil {
+				t.Fatalf("step %d: failed to acquire as %s, %s", i, step.instance, err)
+			}
+			if got != step.want {
+				t.Fatalf("step %d: got leading %t for %s, want %t", i, got, step.instance, step.want)
+			}
+		case doRelease:
+			err := lock.Release(context.Background())
+			if err != nil {
+				t.Fatalf("step %d: failed to release as %s, %s", i, step.instance, err)
+			}
+		}
+	}
+}
+
+// scriptedLock answers TryAcquire from a script of results, repeating the
+// last one, and counts releases
+type scriptedLock struct {
+	mu       sync.Mutex
+	results  []bool
+	calls    int
+	releases int
+}
+
+func (l *scriptedLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := l.results[min(l.calls, len(l.results)-1)]
+	l.calls++
+	return result, nil
+}
+
+func (l *scriptedLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releases++
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	errLead := errors.New("lead failed")
+	tests := []struct {
+		name    string
+		results []bool
+		// leadErr is returned by lead right away, and otherwise lead runs
+		// until its context is cancelled
+		leadErr error
+		// cancelAfter cancels Run's context, if set
+		cancelAfter time.Duration
+		wantErr     error
+		wantLeads   int
+		// wantStepDown is whether lead saw its context cancelled before
+		// Run's was
+		wantStepDown bool
+	}{
+		{
+			name:        "standby never leads",
+			results:     []bool{false},
+			cancelAfter: 50 * time.Millisecond,
+		},
+		{
+			name:        "leader leads until shutdown",
+			results:     []bool{true},
+			cancelAfter: 50 * time.Millisecond,
+			wantLeads:   1,
+		},
+		{
+			name:        "standby takes over",
+			results:     []bool{false, false, true},
+			cancelAfter: 100 * time.Millisecond,
+			wantLeads:   1,
+		},
+		{
+			name:         "leadership lost",
+			results:      []bool{true, false},
+			cancelAfter:  100 * time.Millisecond,
+			wantLeads:    1,
+			wantStepDown: true,
+		},
+		{
+			name:      "lead fails",
+			results:   []bool{true},
+			leadErr:   errLead,
+			wantErr:   errLead,
+			wantLeads: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lock := &scriptedLock{results: test.results}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelAfter > 0 {
+				time.AfterFunc(test.cancelAfter, cancel)
+			}
+
+			var mu sync.Mutex
+			leads := 0
+			steppedDown := false
+			err := Run(ctx, lock, &config.LeaderElection{TTL: 30 * time.Millisecond}, func(leadCtx context.Context) error {
+				mu.Lock()
+				leads++
+				mu.Unlock()
+				if test.leadErr != nil {
+					return test.leadErr
+				}
+				<-leadCtx.Done()
+				mu.Lock()
+				steppedDown = steppedDown || ctx.Err() == nil
+				mu.Unlock()
+				return nil
+			})
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if leads != test.wantLeads {
+				t.Errorf("got %d leads, want %d", leads, test.wantLeads)
+			}
+			if steppedDown != test.wantStepDown {
+				t.Errorf("got stepped down %t, want %t", steppedDown, test.wantStepDown)
+			}
+			if lock.releases != 1 {
+				t.Errorf("got %d releases, want 1", lock.releases)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  config.LeaderElection
+		wantErr bool
+	}{
+		{name: "unknown backend", config: config.LeaderElection{Backend: "etcd"}, wantErr: true},
+		{name: "consul without key", config: config.LeaderElection{Backend: "consul"}, wantErr: true},
+		{name: "consul", config: config.LeaderElection{Backend: "consul", Consul: config.ConsulLock{Key: "sleepnumber/leader"}}},
+		{name: "kubernetes without lease", config: config.LeaderElection{Backend: "kubernetes"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(&test.config)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package metrics counts what the collector does, for Prometheus to scrape
+// and for the collector_stats measurement written to the sinks.
+package metrics
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const namespace = "sleepnumber_collector"
+
+// registry holds the collector's own metrics, which also make up
+// collector_stats, apart from those about the Go runtime
+var registry = prometheus.NewRegistry()
+
+var (
+	pollCycles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "poll_cycles_total",
+		Help:      "Poll cycles run, by account.",
+	}, []string{"account"})
+	pollFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "poll_failures_total",
+		Help:      "Poll cycles with at least one failed SleepIQ request, by account.",
+	}, []string{"account"})
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Attempts to log into SleepIQ, including session refreshes, by account.",
+	}, []string{"account"})
+	loginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Failed attempts to log into SleepIQ, by account.",
+	}, []string{"account"})
+	apiRequests = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of SleepIQ API requests, by endpoint.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint"})
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_errors_total",
+		Help:      "Failed SleepIQ API requests, by endpoint and error class.",
+	}, []string{"endpoint", "class"})
+	pointsWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_written_total",
+		Help:      "Points written, by sink.",
+	}, []string{"sink"})
+	pointsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_dropped_total",
+		Help:      "Points given up on without being written, by sink.",
+	}, []string{"sink"})
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Points queued in memory for each sink.",
+	}, []string{"sink"})
+)
+
+// freshness holds when each measurement was last written, which is served
+// to Prometheus but left out of collector_stats since a sum of timestamps
+// means nothing
+var freshness = prometheus.NewRegistry()
+
+var lastWrite = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "last_write_timestamp_seconds",
+	Help:      "Unix time of the last successful write, by sink and measurement.",
+}, []string{"sink", "measurement"})
+
+// LastWrite is when a sink last wrote a measurement
+type LastWrite struct {
+	Sink        string
+	Measurement string
+	Time        time.Time
+}
+
+var (
+	lastWritesMu sync.Mutex
+	lastWrites   = make(map[[2]string]time.Time)
+)
+
+func init() {
+	freshness.MustRegister(lastWrite)
+	registry.MustRegister(pollCycles, pollFailures, logins, loginFailures,
+		apiRequests, apiErrors, pointsWritten, pointsDropped, queueDepth)
+}
+
+// Observer counts poll cycles and logins; it is a collector.Observer
+type Observer struct{}
+
+func (Observer) PollCycle(account string, elapsed time.Duration, err error) {
+	pollCycles.WithLabelValues(account).Inc()
+	if err != nil {
+		pollFailures.WithLabelValues(account).Inc()
+	}
+}
+
+func (Observer) Login(account string, err error) {
+	logins.WithLabelValues(account).Inc()
+	if err != nil {
+		loginFailures.WithLabelValues(account).Inc()
+	}
+}
+
+// ObserveAPI records a SleepIQ API request; it is sleepiq.Options.Observe
+func ObserveAPI(endpoint string, elapsed time.Duration, err error) {
+	apiRequests.WithLabelValues(endpoint).Observe(elapsed.Seconds())
+	if err != nil {
+		apiErrors.WithLabelValues(endpoint, sleepiq.Classify(err).String()).Inc()
+	}
+}
+
+// Written counts points a sink has written
+func Written(sink string, n int) {
+	pointsWritten.WithLabelValues(sink).Add(float64(n))
+}
+
+// MarkWritten records that a sink has just written the given measurements
+func MarkWritten(sink string, measurements ...string) {
+	now := time.Now()
+	lastWritesMu.Lock()
+	defer lastWritesMu.Unlock()
+	for _, measurement := range measurements {
+		lastWrites[[2]string{sink, measurement}] = now
+		lastWrite.WithLabelValues(sink, measurement).Set(float64(now.UnixNano()) / 1e9)
+	}
+}
+
+// LastWrites returns when each sink last wrote each measurement, for those
+// written since startup
+func LastWrites() []LastWrite {
+	lastWritesMu.Lock()
+	defer lastWritesMu.Unlock()
+	writes := make([]LastWrite, 0, len(lastWrites))
+	for key, t := range lastWrites {
+		writes = append(writes, LastWrite{Sink: key[0], Measurement: key[1], Time: t})
+	}
+	return writes
+}
+
+// Dropped counts points a sink, or the queue in front of it, gave up on
+func Dropped(sink string, n int) {
+	pointsDropped.WithLabelValues(sink).Add(float64(n))
+}
+
+// QueueDepth records how many points are queued for a sink
+func QueueDepth(sink string, n int) {
+	queueDepth.WithLabelValues(sink).Set(float64(n))
+}
+
+// Handler serves every metric, along with those about the Go runtime and the
+// process, in the Prometheus exposition format
+func Handler() http.Handler {
+	runtime := prometheus.NewRegistry()
+	runtime.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return promhttp.HandlerFor(prometheus.Gatherers{registry, freshness, runtime}, promhttp.HandlerOpts{})
+}
+
+// Gatherer gathers every metric but those about the Go runtime and the
+// process, which would clash with those of whatever exports them
+func Gatherer() prometheus.Gatherer {
+	return prometheus.Gatherers{registry, freshness}
+}
+
+// Stats returns the fields of the collector_stats measurement: each metric
+// summed across its labels, named without the common prefix, and histograms
+// as their count and sum, such as api_request_duration_seconds_count
+func Stats() (map[string]interface{}, error) {
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	add := func(name string, value float64) {
+		sum, _ := fields[name].(float64)
+		fields[name] = sum + value
+	}
+	for _, family := range families {
+		name := strings.TrimPrefix(family.GetName(), namespace+"_")
+		for _, m := range family.GetMetric() {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				add(name+"_count", float64(m.GetHistogram().GetSampleCount()))
+				add(name+"_sum", m.GetHistogram().GetSampleSum())
+			}
+		}
+	}
+	return fields, nil
+}
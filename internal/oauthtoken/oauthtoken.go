@@ -0,0 +1,75 @@
+// Package oauthtoken keeps OAuth tokens in files, writing them back whenever
+// they are refreshed, for integrations authorized once by hand.
+package oauthtoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/oauth2"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// File is a token source refreshing the token stored in a file and saving
+// every new token back to it, since some providers issue refresh tokens that
+// only work once
+type File struct {
+	path   string
+	source oauth2.TokenSource
+
+	mu    sync.Mutex
+	saved string
+}
+
+// Open reads the token in path, as JSON with at least a refresh_token,
+// issued to the client of conf
+func Open(conf *oauth2.Config, path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OAuth token, %s", err)
+	}
+	var token oauth2.Token
+	err = json.Unmarshal(data, &token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OAuth token %s, %s", path, err)
+	}
+	if token.RefreshToken == "" {
+		return nil, fmt.Errorf("OAuth token %s has no refresh_token", path)
+	}
+	return &File{
+		path:   path,
+		source: conf.TokenSource(context.Background(), &token),
+		saved:  string(data),
+	}, nil
+}
+
+// Token returns a valid token, refreshing it and saving the new one to the
+// file if needed
+func (f *File) Token() (*oauth2.Token, error) {
+	token, err := f.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OAuth token, %s", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if string(data) != f.saved {
+		err = os.WriteFile(f.path, data, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save refreshed OAuth token to %s, %s", f.path, err)
+		}
+		f.saved = string(data)
+	}
+	return token, nil
+}
+
+// Client returns an HTTP client authorizing its requests with the token
+func (f *File) Client() *http.Client {
+	return oauth2.NewClient(context.Background(), f)
+}
@@ -0,0 +1,92 @@
+package passive
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const icingaTimeout = 10 * time.Second
+
+// Icinga submits results through the process-check-result action of the
+// Icinga 2 API
+type Icinga struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewIcinga returns an Icinga submitting to the API at config.URL, such as
+// https://icinga.example.com:5665
+func NewIcinga(config *config.Icinga) *Icinga {
+	return &Icinga{
+		url:      strings.TrimSuffix(config.URL, "/") + "/v1/actions/process-check-result",
+		username: config.Username,
+		password: config.Password,
+		client: &http.Client{
+			Timeout: icingaTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: config.SkipVerifySsl},
+			},
+		},
+	}
+}
+
+// Submit submits each result to the service of host it is for, which must
+// already exist in Icinga, reporting every result that failed
+func (i *Icinga) Submit(ctx context.Context, host string, results []Result) error {
+	var errs []error
+	for _, r := range results {
+		err := i.submit(ctx, host, r)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (i *Icinga) submit(ctx context.Context, host string, r Result) error {
+	perfData := r.PerfData
+	if perfData == nil {
+		perfData = []string{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"type":             "Service",
+		"filter":           "host.name == h && service.name == s",
+		"filter_vars":      map[string]string{"h": host, "s": r.Service},
+		"exit_status":      int(r.Status),
+		"plugin_output":    r.Status.String() + " - " + r.Output,
+		"performance_data": perfData,
+		"check_source":     host,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(i.username, i.password)
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Icinga, %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Icinga returned status %d for service %s!%s: %s", resp.StatusCode, host, r.Service, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
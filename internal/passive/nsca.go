@@ -0,0 +1,104 @@
+package passive
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+// NSCA protocol version 3, as spoken by send_nsca
+const (
+	nscaTimeout    = 10 * time.Second
+	nscaVersion    = 3
+	nscaIVSize     = 128
+	nscaHostSize   = 64
+	nscaSvcSize    = 128
+	nscaOutputSize = 512
+	// nscaPacketSize is the size of send_nsca's data packet struct, padded
+	// to a multiple of 4
+	nscaPacketSize = 720
+)
+
+// Encryption methods supported
+const (
+	NSCAEncryptionNone = "none"
+	NSCAEncryptionXOR  = "xor"
+)
+
+// NSCA submits results to an NSCA daemon, unencrypted or with its XOR
+// method, the only ones not needing libmcrypt
+type NSCA struct {
+	address  string
+	password string
+	xor      bool
+}
+
+// NewNSCA returns an NSCA submitting to config.Address, such as
+// nagios.example.com:5667
+func NewNSCA(config *config.NSCA) *NSCA {
+	return &NSCA{
+		address:  config.Address,
+		password: config.Password,
+		xor:      config.Encryption == NSCAEncryptionXOR,
+	}
+}
+
+// Submit sends every result over one connection
+func (n *NSCA) Submit(ctx context.Context, host string, results []Result) error {
+	ctx, cancel := context.WithTimeout(ctx, nscaTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.address)
+	if err != nil {
+		return fmt.Errorf("failed to reach NSCA, %s", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// The daemon opens with the IV to encrypt with and its timestamp
+	init := make([]byte, nscaIVSize+4)
+	_, err = io.ReadFull(conn, init)
+	if err != nil {
+		return fmt.Errorf("failed to read NSCA initialization packet, %s", err)
+	}
+	iv, timestamp := init[:nscaIVSize], init[nscaIVSize:]
+
+	for _, r := range results {
+		packet := make([]byte, nscaPacketSize)
+		binary.BigEndian.PutUint16(packet[0:], nscaVersion)
+		copy(packet[8:12], timestamp)
+		binary.BigEndian.PutUint16(packet[12:], uint16(r.Status))
+		putString(packet[14:14+nscaHostSize], host)
+		putString(packet[14+nscaHostSize:14+nscaHostSize+nscaSvcSize], r.Service)
+		putString(packet[14+nscaHostSize+nscaSvcSize:14+nscaHostSize+nscaSvcSize+nscaOutputSize], pluginOutput(r))
+		binary.BigEndian.PutUint32(packet[4:], crc32.ChecksumIEEE(packet))
+		if n.xor {
+			for i := range packet {
+				packet[i] ^= iv[i%nscaIVSize]
+			}
+			for i := 0; n.password != "" && i < len(packet); i++ {
+				packet[i] ^= n.password[i%len(n.password)]
+			}
+		}
+		_, err = conn.Write(packet)
+		if err != nil {
+			return fmt.Errorf("failed to send result for service %s to NSCA, %s", r.Service, err)
+		}
+	}
+	return nil
+}
+
+// putString copies s into field, truncated to leave room for the NUL
+// terminator
+func putString(field []byte, s string) {
+	if len(s) > len(field)-1 {
+		s = s[:len(field)-1]
+	}
+	copy(field, s)
+}
@@ -0,0 +1,56 @@
+// Package passive submits passive check results, as Nagios plugins would
+// report them, to an Icinga 2 API or an NSCA daemon, so classic monitoring
+// stacks can alarm on collector or bed problems.
+package passive
+
+import (
+	"context"
+	"strings"
+)
+
+// Status is the exit status of a check, as defined for Nagios plugins
+type Status int
+
+// Statuses of checks
+const (
+	OK Status = iota
+	Warning
+	Critical
+	Unknown
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// Result is the outcome of a check of Service: its Status, a line of Output,
+// and PerfData labels such as age=30s
+type Result struct {
+	Service  string
+	Status   Status
+	Output   string
+	PerfData []string
+}
+
+// Submitter submits the results of checks of the services of host
+type Submitter interface {
+	Submit(ctx context.Context, host string, results []Result) error
+}
+
+// pluginOutput formats r as a plugin prints it: status, output, and
+// performance data after a pipe
+func pluginOutput(r Result) string {
+	out := r.Status.String() + " - " + r.Output
+	if len(r.PerfData) > 0 {
+		out += " | " + strings.Join(r.PerfData, " ")
+	}
+	return out
+}
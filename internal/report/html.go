@@ -0,0 +1,59 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"clock":    clock,
+	"duration": duration,
+	"date":     func(t time.Time) string { return t.Format("Mon Jan 2") },
+	"time":     func(t time.Time) string { return t.Format("15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sleep, {{date .Start}} to {{date .End}}</title></head>
+<body style="font-family: sans-serif; color: #222;">
+<h1 style="font-size: 1.4em;">Sleep, {{date .Start}} to {{date .End}}</h1>
+{{range .Sleepers}}
+<h2 style="font-size: 1.2em;">{{.Bed}}, {{.Side}} side</h2>
+<p>{{len .Nights}} night{{if ne (len .Nights) 1}}s{{end}} in bed, {{duration .AvgDuration}} on average.
+Bedtime {{clock .AvgBedtime}} on average, give or take {{duration .BedtimeSpread}};
+up at {{clock .AvgWake}}, give or take {{duration .WakeSpread}}.</p>
+<table style="border-collapse: collapse;">
+<tr><th style="text-align: left; padding: 2px 12px 2px 0;">Night</th><th style="text-align: left; padding: 2px 12px 2px 0;">Bedtime</th><th style="text-align: left; padding: 2px 12px 2px 0;">Up</th><th style="text-align: left; padding: 2px 12px 2px 0;">In bed</th></tr>
+{{range .Nights}}<tr><td style="padding: 2px 12px 2px 0;">{{date .Date}}</td><td style="padding: 2px 12px 2px 0;">{{time .Bedtime}}</td><td style="padding: 2px 12px 2px 0;">{{time .Wake}}</td><td style="padding: 2px 12px 2px 0;">{{duration .Duration}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No sleep was recorded.</p>
+{{end}}
+<p style="color: #888; font-size: 0.8em;">Sent by sleepnumber-stats-collector</p>
+</body>
+</html>
+`))
+
+// HTML renders summary as an HTML page suited to email clients
+func HTML(w io.Writer, summary Summary) error {
+	err := page.Execute(w, summary)
+	if err != nil {
+		return fmt.Errorf("failed to render report, %s", err)
+	}
+	return nil
+}
+
+// clock formats an offset from midnight as a time of day
+func clock(d time.Duration) string {
+	d = d.Round(time.Minute) % (24 * time.Hour)
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// duration formats d in hours and minutes
+func duration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,95 @@
+package report
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSMTPPort = 587
+	// smtpsPort is the port of SMTP over implicit TLS; other ports start
+	// TLS when the server offers it
+	smtpsPort   = 465
+	mailTimeout = 30 * time.Second
+)
+
+// Send emails an HTML body through the SMTP server of mail, authenticating
+// if it has a username
+func Send(mail config.SMTP, from string, to []string, subject string, html []byte) error {
+	port := mail.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	address := net.JoinHostPort(mail.Host, strconv.Itoa(port))
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.Write(html)
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: mailTimeout}
+	if port == smtpsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: mail.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s, %s", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	client, err := smtp.NewClient(conn, mail.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet SMTP server %s, %s", address, err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && port != smtpsPort {
+		err = client.StartTLS(&tls.Config{ServerName: mail.Host})
+		if err != nil {
+			return fmt.Errorf("failed to start TLS with SMTP server %s, %s", address, err)
+		}
+	}
+	if mail.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", mail.Username, mail.Password, mail.Host))
+		if err != nil {
+			return fmt.Errorf("failed to log into SMTP server %s, %s", address, err)
+		}
+	}
+	err = client.Mail(from)
+	if err != nil {
+		return fmt.Errorf("SMTP server %s refused sender %s, %s", address, from, err)
+	}
+	for _, rcpt := range to {
+		err = client.Rcpt(rcpt)
+		if err != nil {
+			return fmt.Errorf("SMTP server %s refused recipient %s, %s", address, rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send report, %s", err)
+	}
+	_, err = w.Write(msg.Bytes())
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send report, %s", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,119 @@
+// Package report summarizes a week of sleep sessions per sleeper, how long
+// and how regularly each slept, and renders the summary as an HTML email.
+package report
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/sleep"
+	"math"
+	"sort"
+	"time"
+)
+
+// nightOffset shifts times so that a night, from noon to noon, falls on one
+// date: the date its evening belongs to
+const nightOffset = 12 * time.Hour
+
+// Summary is the sleep of every sleeper from Start to End
+type Summary struct {
+	Start    time.Time
+	End      time.Time
+	Sleepers []Sleeper
+}
+
+// Sleeper is the sleep of one side of a bed over the nights it was used.
+// Bedtime and Wake are times of day, as offsets from midnight that may
+// exceed a day for bedtimes after midnight; their spread is the standard
+// deviation across nights.
+type Sleeper struct {
+	Bed           string
+	Side          string
+	Nights        []Night
+	AvgDuration   time.Duration
+	AvgBedtime    time.Duration
+	AvgWake       time.Duration
+	BedtimeSpread time.Duration
+	WakeSpread    time.Duration
+}
+
+// Night is one night of a sleeper: from the start of its first session to
+// the end of its last, and the time spent in bed in between
+type Night struct {
+	Date     time.Time
+	Bedtime  time.Time
+	Wake     time.Time
+	Duration time.Duration
+}
+
+// Summarize groups sessions into the nights of each sleeper, in loc, from
+// start to end; nights are counted by the session that begins them
+func Summarize(sessions []sleep.Session, start, end time.Time, loc *time.Location) Summary {
+	type key struct{ bed, side string }
+	nights := make(map[key]map[time.Time]*Night)
+	for _, s := range sessions {
+		if s.Start.Before(start) || !s.Start.Before(end) {
+			continue
+		}
+		k := key{s.Bed, s.Side}
+		shifted := s.Start.In(loc).Add(-nightOffset)
+		date := time.Date(shifted.Year(), shifted.Month(), shifted.Day(), 0, 0, 0, 0, loc)
+		if nights[k] == nil {
+			nights[k] = make(map[time.Time]*Night)
+		}
+		n := nights[k][date]
+		if n == nil {
+			n = &Night{Date: date, Bedtime: s.Start.In(loc), Wake: s.End.In(loc)}
+			nights[k][date] = n
+		}
+		if s.Start.Before(n.Bedtime) {
+			n.Bedtime = s.Start.In(loc)
+		}
+		if s.End.After(n.Wake) {
+			n.Wake = s.End.In(loc)
+		}
+		n.Duration += s.Duration()
+	}
+
+	summary := Summary{Start: start, End: end}
+	for k, byDate := range nights {
+		sleeper := Sleeper{Bed: k.bed, Side: k.side}
+		var bedtimes, wakes []float64
+		var total time.Duration
+		for _, n := range byDate {
+			sleeper.Nights = append(sleeper.Nights, *n)
+			total += n.Duration
+			bedtimes = append(bedtimes, float64(n.Bedtime.Sub(n.Date)))
+			wakes = append(wakes, float64(n.Wake.Sub(n.Date)))
+		}
+		sort.Slice(sleeper.Nights, func(i, j int) bool {
+			return sleeper.Nights[i].Date.Before(sleeper.Nights[j].Date)
+		})
+		sleeper.AvgDuration = total / time.Duration(len(byDate))
+		var mean, spread float64
+		mean, spread = meanSpread(bedtimes)
+		sleeper.AvgBedtime, sleeper.BedtimeSpread = time.Duration(mean), time.Duration(spread)
+		mean, spread = meanSpread(wakes)
+		sleeper.AvgWake, sleeper.WakeSpread = time.Duration(mean), time.Duration(spread)
+		summary.Sleepers = append(summary.Sleepers, sleeper)
+	}
+	sort.Slice(summary.Sleepers, func(i, j int) bool {
+		if summary.Sleepers[i].Bed != summary.Sleepers[j].Bed {
+			return summary.Sleepers[i].Bed < summary.Sleepers[j].Bed
+		}
+		return summary.Sleepers[i].Side < summary.Sleepers[j].Side
+	})
+	return summary
+}
+
+// meanSpread returns the mean and standard deviation of values
+func meanSpread(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
@@ -0,0 +1,149 @@
+// Package schema maps the names of the measurements, tags, and fields the
+// collector produces to those it writes to InfluxDB under a configuration,
+// for tools reading the data back.
+package schema
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"slices"
+)
+
+// Names describes where and under which names the collector writes
+type Names struct {
+	// DefaultDestination is where points are written, a bucket or for
+	// InfluxDB v1 database/retention-policy, and Routes where individual
+	// measurements, keyed by their names after renaming, are written instead
+	DefaultDestination string
+	Routes             map[string]string
+	// MeasurementPrefix is prepended to every measurement
+	MeasurementPrefix string
+	// RenameMeasurements, RenameTags, and RenameFields map the collector's
+	// names to those written
+	RenameMeasurements map[string]string
+	RenameTags         map[string]string
+	RenameFields       map[string]string
+	// DropTags are left off every point and TagsAsFields written as fields
+	// instead; neither ever holds collector.KeyTags
+	DropTags     []string
+	TagsAsFields []string
+	// AggregateMeasurements have their numeric fields written as
+	// <field>_<AggregateFunction>, apart from the AggregateEvents fields
+	AggregateMeasurements []string
+	AggregateFunction     string
+	AggregateEvents       []string
+}
+
+// FromConfig returns the names the collector writes under with c
+func FromConfig(c *config.Configuration) Names {
+	influx := c.InfluxDB
+	names := Names{
+		DefaultDestination: influx.Bucket,
+		Routes:             make(map[string]string),
+		MeasurementPrefix:  influx.MeasurementPrefix,
+		RenameMeasurements: c.Rename.Measurements,
+		RenameTags:         c.Rename.Tags,
+		RenameFields:       c.Rename.Fields,
+		DropTags:           c.Cardinality.DropTags,
+		TagsAsFields:       c.Cardinality.TagsAsFields,
+	}
+	if names.DefaultDestination == "" && influx.Database != "" {
+		names.DefaultDestination = influx.Database + "/" + influx.RetentionPolicy
+	}
+	if names.DefaultDestination == "" {
+		names.DefaultDestination = "sleepnumber"
+	}
+	for _, route := range influx.Routes {
+		dest := route.Bucket
+		if dest == "" {
+			dest = route.Database + "/" + route.RetentionPolicy
+		}
+		for _, measurement := range route.Measurements {
+			names.Routes[measurement] = dest
+		}
+	}
+	if c.Aggregate.Window > 0 {
+		names.AggregateMeasurements = c.Aggregate.Measurements
+		names.AggregateEvents = c.Aggregate.Events
+		if len(c.Aggregate.Functions) > 0 {
+			names.AggregateFunction = c.Aggregate.Functions[0]
+		}
+	}
+	return names
+}
+
+// Measurement is the name measurement is written to InfluxDB under
+func (n Names) Measurement(measurement string) string {
+	return n.MeasurementPrefix + n.Renamed(measurement)
+}
+
+// Renamed is the name measurement goes by on the bus and in every sink but
+// InfluxDB, being renamed but without MeasurementPrefix, which only the
+// InfluxDB sink adds
+func (n Names) Renamed(measurement string) string {
+	if renamed, ok := n.RenameMeasurements[measurement]; ok {
+		return renamed
+	}
+	return measurement
+}
+
+// Tag is the key tag is written under, if it is written as a tag at all;
+// TagValue also finds tags written as fields
+func (n Names) Tag(tag string) string {
+	if renamed, ok := n.RenameTags[tag]; ok {
+		return renamed
+	}
+	return tag
+}
+
+// TagValue is the value of tag on p, which went through the collector's
+// sinks, and whether it has one; tags written as fields are looked up among
+// its fields, while dropped tags have none
+func (n Names) TagValue(p collector.Point, tag string) (string, bool) {
+	if slices.Contains(n.DropTags, tag) && !slices.Contains(collector.KeyTags, tag) {
+		return "", false
+	}
+	if slices.Contains(n.TagsAsFields, tag) && !slices.Contains(collector.KeyTags, tag) {
+		// Tags are moved before renaming, so they take field renames,
+		// but never aggregation, which comes first
+		field := tag
+		if renamed, ok := n.RenameFields[field]; ok {
+			field = renamed
+		}
+		v, ok := p.Fields[field].(string)
+		return v, ok
+	}
+	v, ok := p.Tags[n.Tag(tag)]
+	return v, ok
+}
+
+// Field is the name field of measurement is written under; aggregation
+// comes before renaming, so renames apply to the suffixed name
+func (n Names) Field(measurement, field string) string {
+	if n.Aggregated(measurement, field) {
+		function := n.AggregateFunction
+		if function == "" {
+			function = "mean"
+		}
+		field += "_" + function
+	}
+	if renamed, ok := n.RenameFields[field]; ok {
+		field = renamed
+	}
+	return field
+}
+
+// Aggregated reports whether field of measurement is written aggregated over
+// a window rather than as sampled
+func (n Names) Aggregated(measurement, field string) bool {
+	return slices.Contains(n.AggregateMeasurements, measurement) && !slices.Contains(n.AggregateEvents, field)
+}
+
+// Destination is the bucket, or database/retention-policy, measurement is
+// written to
+func (n Names) Destination(measurement string) string {
+	if dest, ok := n.Routes[n.Renamed(measurement)]; ok {
+		return dest
+	}
+	return n.DefaultDestination
+}
@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq/sleepiqtest"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recorder is a collector.Sink keeping the last point written to it
+type recorder struct {
+	mu sync.Mutex
+	p  collector.Point
+}
+
+func (r *recorder) Write(ctx context.Context, p collector.Point) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.p = p
+}
+
+// foundationPoint polls a mock SleepIQ server for the bed_foundation_state
+// point of its bed named Master, written through the collector's own sinks
+// under c
+func foundationPoint(t *testing.T, c *config.Configuration) collector.Point {
+	t.Helper()
+	httpServer := httptest.NewServer(sleepiqtest.NewServer("sleeper@example.com", "secret", "Master"))
+	t.Cleanup(httpServer.Close)
+
+	sink := &recorder{}
+	col := collector.New(collector.Options{
+		Username:     "sleeper@example.com",
+		Password:     "secret",
+		API:          sleepiq.Options{BaseURL: httpServer.URL + sleepiqtest.BasePath, RateLimit: -1},
+		Collectors:   []collector.BedCollector{collector.FoundationCollector{}},
+		RenameTags:   c.Rename.Tags,
+		RenameFields: c.Rename.Fields,
+		DropTags:     c.Cardinality.DropTags,
+		TagsAsFields: c.Cardinality.TagsAsFields,
+	}, sink)
+	err := col.Login(context.Background())
+	if err != nil {
+		t.Fatalf("failed to log in, %s", err)
+	}
+	err = col.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("failed to poll, %s", err)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return sink.p
+}
+
+func TestTagValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config.Configuration
+		tag    string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "tag",
+			tag:    "model",
+			want:   "C4",
+			wantOK: true,
+		},
+		{
+			name:   "renamed tag",
+			config: config.Configuration{Rename: config.Rename{Tags: map[string]string{"model": "bed_model"}}},
+			tag:    "model",
+			want:   "C4",
+			wantOK: true,
+		},
+		{
+			name:   "tag as field",
+			config: config.Configuration{Cardinality: config.Cardinality{TagsAsFields: []string{"model"}}},
+			tag:    "model",
+			want:   "C4",
+			wantOK: true,
+		},
+		{
+			name: "tag as renamed field",
+			config: config.Configuration{
+				Rename:      config.Rename{Fields: map[string]string{"model": "bed_model"}},
+				Cardinality: config.Cardinality{TagsAsFields: []string{"model"}},
+			},
+			tag:    "model",
+			want:   "C4",
+			wantOK: true,
+		},
+		{
+			name:   "dropped tag",
+			config: config.Configuration{Cardinality: config.Cardinality{DropTags: []string{"generation"}}},
+			tag:    "generation",
+			wantOK: false,
+		},
+		{
+			name: "key tag dropped",
+			config: config.Configuration{Cardinality: config.Cardinality{
+				DropTags: []string{"name"},
+			}},
+			tag:    "name",
+			want:   "Master",
+			wantOK: true,
+		},
+		{
+			name: "key tag as field",
+			config: config.Configuration{Cardinality: config.Cardinality{
+				TagsAsFields: []string{"name"},
+			}},
+			tag:    "name",
+			want:   "Master",
+			wantOK: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := foundationPoint(t, &test.config)
+			names := FromConfig(&test.config)
+			got, ok := names.TagValue(p, test.tag)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("got %q, %t, want %q, %t", got, ok, test.want, test.wantOK)
+			}
+			// Everything reading points back finds the bed by its name tag
+			if got := p.Tags[names.Tag("name")]; got != "Master" {
+				t.Errorf("got name tag %q, want %q", got, "Master")
+			}
+		})
+	}
+}
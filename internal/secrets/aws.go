@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"strings"
+)
+
+const (
+	// secretsManagerPrefix marks a secret held in AWS Secrets Manager, as
+	// aws-sm:<name or ARN>, optionally followed by #<key> to pick one key of
+	// a JSON secret
+	secretsManagerPrefix = "aws-sm:"
+	// parameterStorePrefix marks a secret held in AWS Systems Manager
+	// Parameter Store, as aws-ssm:<name or ARN>
+	parameterStorePrefix = "aws-ssm:"
+)
+
+// ResolveAWS replaces the passwords and tokens in the configuration that
+// reference AWS Secrets Manager or Parameter Store with their values, using
+// the standard AWS credential chain. AWS is only contacted when something
+// references it.
+func ResolveAWS(ctx context.Context, c *config.Configuration) error {
+	secrets := map[string]*string{
+		"sleepIQPassword":   &c.SleepIQPassword,
+		"influxDB.password": &c.InfluxDB.Password,
+		"influxDB.token":    &c.InfluxDB.Token,
+	}
+	for i := range c.Accounts {
+		secrets[fmt.Sprintf("accounts[%d].password", i)] = &c.Accounts[i].Password
+	}
+
+	var r *awsResolver
+	for key, secret := range secrets {
+		if !strings.HasPrefix(*secret, secretsManagerPrefix) && !strings.HasPrefix(*secret, parameterStorePrefix) {
+			continue
+		}
+		if r == nil {
+			cfg, err := awsConfig.LoadDefaultConfig(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to load AWS configuration, %s", err)
+			}
+			r = &awsResolver{cfg: cfg}
+		}
+		value, err := r.resolve(ctx, *secret)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s from AWS, %s", key, err)
+		}
+		*secret = value
+	}
+	return nil
+}
+
+type awsResolver struct {
+	cfg aws.Config
+}
+
+func (r *awsResolver) resolve(ctx context.Context, ref string) (string, error) {
+	if id, ok := strings.CutPrefix(ref, parameterStorePrefix); ok {
+		client := ssm.NewFromConfig(r.cfg, func(o *ssm.Options) {
+			o.Region = r.arnRegion(id)
+		})
+		out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(id),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.ToString(out.Parameter.Value), nil
+	}
+
+	id, key, _ := strings.Cut(strings.TrimPrefix(ref, secretsManagerPrefix), "#")
+	client := secretsmanager.NewFromConfig(r.cfg, func(o *secretsmanager.Options) {
+		o.Region = r.arnRegion(id)
+	})
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+	value := aws.ToString(out.SecretString)
+	if key == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal([]byte(value), &fields)
+	if err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, %s", id, err)
+	}
+	field, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string key %s", id, key)
+	}
+	return field, nil
+}
+
+// arnRegion returns the region an ARN names, which requests for it must go
+// to even if the default region differs, or the default region for a plain
+// name
+func (r *awsResolver) arnRegion(id string) string {
+	parts := strings.SplitN(id, ":", 5)
+	if len(parts) == 5 && parts[0] == "arn" && parts[3] != "" {
+		return parts[3]
+	}
+	return r.cfg.Region
+}
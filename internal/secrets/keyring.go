@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringService is the service name SleepIQ passwords are stored under in
+// the OS keyring, keyed by username
+const KeyringService = "sleepnumber-stats-collector"
+
+// ResolveKeyring reads the SleepIQ password of every account without one
+// from the OS keyring (Secret Service, Keychain, or Windows Credential
+// Manager) when enabled. Accounts with no saved password are left without
+// one, to be saved with -login -save.
+func ResolveKeyring(c *config.Configuration) error {
+	if !c.Keyring {
+		return nil
+	}
+
+	read := func(username string, password *string) error {
+		if username == "" || *password != "" {
+			return nil
+		}
+		saved, err := keyring.Get(KeyringService, username)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the password of %s from the keyring, %s", username, err)
+		}
+		*password = saved
+		return nil
+	}
+
+	err := read(c.SleepIQUsername, &c.SleepIQPassword)
+	if err != nil {
+		return err
+	}
+	for i := range c.Accounts {
+		err = read(c.Accounts[i].Username, &c.Accounts[i].Password)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePassword stores the SleepIQ password of username in the OS keyring
+func SavePassword(username, password string) error {
+	err := keyring.Set(KeyringService, username, password)
+	if err != nil {
+		return fmt.Errorf("failed to save the password of %s in the keyring, %s", username, err)
+	}
+	return nil
+}
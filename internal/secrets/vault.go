@@ -0,0 +1,145 @@
+// Package secrets resolves credentials kept outside the config file.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKubernetesMount = "kubernetes"
+	serviceAccountToken    = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// ResolveVault reads the SleepIQ password and InfluxDB token from Vault into
+// the configuration when Vault paths are configured for them. It returns when
+// the secrets should be fetched again, two thirds into the shortest lease, or
+// the zero time if they don't expire.
+func ResolveVault(ctx context.Context, c *config.Configuration) (time.Time, error) {
+	cfg := &c.Vault
+	if cfg.SleepIQPassword.Path == "" && cfg.InfluxDBToken.Path == "" {
+		return time.Time{}, nil
+	}
+
+	client, err := vaultClient(ctx, cfg)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var lease time.Duration
+	read := func(key string, ref config.VaultSecret, secret *string) error {
+		if ref.Path == "" {
+			return nil
+		}
+		if *secret != "" {
+			return fmt.Errorf("%s is set both directly and in Vault, remove one", key)
+		}
+		value, ttl, err := readVaultSecret(ctx, client, ref)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from Vault, %s", key, err)
+		}
+		*secret = value
+		if ttl > 0 && (lease == 0 || ttl < lease) {
+			lease = ttl
+		}
+		return nil
+	}
+	err = read("sleepIQPassword", cfg.SleepIQPassword, &c.SleepIQPassword)
+	if err != nil {
+		return time.Time{}, err
+	}
+	err = read("influxDB.token", cfg.InfluxDBToken, &c.InfluxDB.Token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if lease == 0 {
+		return time.Time{}, nil
+	}
+	return time.Now().Add(lease * 2 / 3), nil
+}
+
+// vaultClient connects to Vault, logging in with the pod's service account
+// when a Kubernetes role is configured and otherwise using the configured
+// token or VAULT_TOKEN
+func vaultClient(ctx context.Context, cfg *config.Vault) (*vault.Client, error) {
+	vaultConfig := vault.DefaultConfig()
+	if vaultConfig.Error != nil {
+		return nil, fmt.Errorf("failed to configure Vault client, %s", vaultConfig.Error)
+	}
+	if cfg.Address != "" {
+		vaultConfig.Address = cfg.Address
+	}
+	client, err := vault.NewClient(vaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault client, %s", err)
+	}
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
+	}
+	if cfg.Token != "" {
+		client.SetToken(cfg.Token)
+	}
+
+	if cfg.KubernetesRole != "" {
+		jwt, err := os.ReadFile(serviceAccountToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token for Vault login, %s", err)
+		}
+		mount := cfg.KubernetesMount
+		if mount == "" {
+			mount = defaultKubernetesMount
+		}
+		auth, err := client.Logical().WriteWithContext(ctx, "auth/"+mount+"/login", map[string]interface{}{
+			"role": cfg.KubernetesRole,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to log into Vault with role %s, %s", cfg.KubernetesRole, err)
+		}
+		if auth == nil || auth.Auth == nil {
+			return nil, fmt.Errorf("Vault login with role %s returned no token", cfg.KubernetesRole)
+		}
+		client.SetToken(auth.Auth.ClientToken)
+	}
+
+	if client.Token() == "" {
+		return nil, fmt.Errorf("no Vault token, set vault.token, VAULT_TOKEN, or vault.kubernetesRole")
+	}
+	return client, nil
+}
+
+// readVaultSecret reads one key of a secret, from either a KV version 1 or
+// version 2 engine, and returns it with its lease duration
+func readVaultSecret(ctx context.Context, client *vault.Client, ref config.VaultSecret) (string, time.Duration, error) {
+	secret, err := client.Logical().ReadWithContext(ctx, ref.Path)
+	if err != nil {
+		return "", 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", 0, fmt.Errorf("no secret at %s", ref.Path)
+	}
+
+	data := secret.Data
+	// KV version 2 nests the values under data, next to metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = "value"
+	}
+	value, ok := data[key].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("secret at %s has no string key %s", ref.Path, key)
+	}
+	return value, time.Duration(secret.LeaseDuration) * time.Second, nil
+}
@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"sync"
+)
+
+// errorReporter is the channel a sink reports its errors on. report never
+// blocks, so a stalled error reader can't stall writes, and drops errors
+// reported once close has been called, such as by a write racing Close,
+// rather than sending on the closed channel.
+type errorReporter struct {
+	mu     sync.Mutex
+	closed bool
+	ch     chan error
+}
+
+func newErrorReporter() *errorReporter {
+	return &errorReporter{ch: make(chan error, 16)}
+}
+
+// report sends err to the reader if there is room for it
+func (r *errorReporter) report(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.ch <- err:
+	default:
+	}
+}
+
+// errors returns the channel errors are reported on
+func (r *errorReporter) errors() <-chan error {
+	return r.ch
+}
+
+// close closes the channel, telling the reader no more errors will come
+func (r *errorReporter) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.closed = true
+		close(r.ch)
+	}
+}
@@ -0,0 +1,177 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Message types sent to exec plugins, one JSON object per line on stdin
+const (
+	execMessagePoint = "point"
+	execMessageFlush = "flush"
+)
+
+type execMessage struct {
+	Type        string                 `json:"type"`
+	Measurement string                 `json:"measurement,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	Time        *time.Time             `json:"time,omitempty"`
+}
+
+// execResponse is read from the plugin's stdout, one JSON object per line
+type execResponse struct {
+	Error string `json:"error"`
+}
+
+// Exec is a sink that streams points as JSON to an external plugin process
+type Exec struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	encoder *json.Encoder
+	mu      sync.Mutex
+	errors  *errorReporter
+	done    chan struct{}
+}
+
+// NewExec starts the plugin process and returns a sink feeding it
+func NewExec(config *config.Plugin) (*Exec, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("plugin %s has no command configured", config.Name)
+	}
+
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s, %s", config.Name, err)
+	}
+
+	s := &Exec{
+		name:    config.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		encoder: json.NewEncoder(stdin),
+		errors:  newErrorReporter(),
+		done:    make(chan struct{}),
+	}
+	go s.readResponses(stdout)
+
+	return s, nil
+}
+
+func (s *Exec) Name() string {
+	return "plugin:" + s.name
+}
+
+func (s *Exec) Write(ctx context.Context, p collector.Point) {
+	if ctx.Err() != nil {
+		metrics.Dropped(s.Name(), 1)
+		s.errors.report(fmt.Errorf("dropped %s point, %s", p.Measurement, ctx.Err()))
+		return
+	}
+	err := s.send(execMessage{
+		Type:        execMessagePoint,
+		Measurement: p.Measurement,
+		Tags:        p.Tags,
+		Fields:      p.Fields,
+		Time:        &p.Time,
+	})
+	if err != nil {
+		metrics.Dropped(s.Name(), 1)
+		return
+	}
+	metrics.Written(s.Name(), 1)
+	metrics.MarkWritten(s.Name(), p.Measurement)
+}
+
+// Errors returns the channel of errors reported by or about the plugin
+func (s *Exec) Errors() <-chan error {
+	return s.errors.errors()
+}
+
+// Flush asks the plugin to flush anything it has buffered
+func (s *Exec) Flush() {
+	_, span := tracer.Start(context.Background(), "plugin.flush", trace.WithAttributes(attribute.String("plugin", s.name)))
+	defer span.End()
+	err := s.send(execMessage{Type: execMessageFlush})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Check reports whether the plugin is still running, judging by whether it
+// has closed its stdout
+func (s *Exec) Check(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return fmt.Errorf("plugin %s is no longer running", s.name)
+	default:
+		return nil
+	}
+}
+
+// Close closes the plugin's stdin and waits for it to exit
+func (s *Exec) Close() {
+	s.mu.Lock()
+	s.stdin.Close()
+	s.mu.Unlock()
+
+	<-s.done
+	err := s.cmd.Wait()
+	if err != nil {
+		s.errors.report(fmt.Errorf("plugin exited with error, %s", err))
+	}
+	s.errors.close()
+}
+
+// send writes msg to the plugin, reporting and returning any error
+func (s *Exec) send(msg execMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.encoder.Encode(msg)
+	if err != nil {
+		s.errors.report(fmt.Errorf("failed to send %s to plugin, %s", msg.Type, err))
+	}
+	return err
+}
+
+func (s *Exec) readResponses(stdout io.Reader) {
+	defer close(s.done)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var resp execResponse
+		err := json.Unmarshal(scanner.Bytes(), &resp)
+		if err != nil {
+			s.errors.report(fmt.Errorf("invalid plugin response %q, %s", scanner.Text(), err))
+			continue
+		}
+		if resp.Error != "" {
+			s.errors.report(fmt.Errorf("%s", resp.Error))
+		}
+	}
+}
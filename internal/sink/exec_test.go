@@ -0,0 +1,70 @@
+//go:build !windows
+
+package sink
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"testing"
+	"time"
+)
+
+func TestExecWriteAfterClose(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{
+			name:    "plugin reading points",
+			command: "cat",
+		},
+		{
+			name:    "plugin exited early",
+			command: "true",
+		},
+		{
+			name:    "plugin failing",
+			command: "sh",
+			args:    []string{"-c", `echo '{"error":"broken"}'; exit 1`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewExec(&config.Plugin{Name: "test", Command: test.command, Args: test.args})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := collector.Point{
+				Measurement: "bed_sleeper_state",
+				Tags:        map[string]string{"name": "Master"},
+				Fields:      map[string]interface{}{"left_sleeper_is_in_bed": true},
+				Time:        time.Now(),
+			}
+			s.Write(context.Background(), p)
+			s.Close()
+
+			// Writing to the closed plugin fails, and reporting that must
+			// not send on the closed errors channel
+			s.Write(context.Background(), p)
+			s.Flush()
+			cancelled, cancel := context.WithCancel(context.Background())
+			cancel()
+			s.Write(cancelled, p)
+
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case _, ok := <-s.Errors():
+					if !ok {
+						return
+					}
+				case <-timeout:
+					t.Fatal("errors channel not closed")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	hubTimeout             = 10 * time.Second
+	smartThingsAPI         = "https://api.smartthings.com/v1"
+	defaultPressureCommand = "setVariable"
+)
+
+// Hub is a collector.Sink pushing whether each configured sleeper is in bed,
+// and their pressure, to devices on a home automation hub, so its
+// automations can use bed presence. Only changes are pushed; a failed push
+// is retried with the next point.
+type Hub struct {
+	name     string
+	names    schema.Names
+	sleepers []config.HubSleeper
+	client   *http.Client
+	// presence and pressure push to a device, and pressure is nil for hubs
+	// with no device to take it
+	presence func(ctx context.Context, device string, inBed bool) error
+	pressure func(ctx context.Context, device string, value string) error
+	errors   *errorReporter
+
+	mu      sync.Mutex
+	sent    map[string]string
+	lastErr error
+}
+
+func newHub(name string, names schema.Names, sleepers []config.HubSleeper) *Hub {
+	return &Hub{
+		name:     name,
+		names:    names,
+		sleepers: sleepers,
+		client:   &http.Client{Timeout: hubTimeout},
+		errors:   newErrorReporter(),
+		sent:     make(map[string]string),
+	}
+}
+
+// NewHubitat returns a Hub sending commands to Hubitat devices through the
+// Maker API instance at config.URL: arrived or departed for presence, and
+// config.PressureCommand, setVariable by default, with the pressure
+func NewHubitat(config *config.Hubitat, names schema.Names) *Hub {
+	h := newHub("hubitat", names, config.Sleepers)
+	command := config.PressureCommand
+	if command == "" {
+		command = defaultPressureCommand
+	}
+	base := strings.TrimSuffix(config.URL, "/")
+	send := func(ctx context.Context, device, action, value string) error {
+		u := base + "/devices/" + url.PathEscape(device) + "/" + url.PathEscape(action)
+		if value != "" {
+			u += "/" + url.PathEscape(value)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u+"?"+url.Values{"access_token": {config.AccessToken}}.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		return h.do(req, base)
+	}
+	h.presence = func(ctx context.Context, device string, inBed bool) error {
+		if inBed {
+			return send(ctx, device, "arrived", "")
+		}
+		return send(ctx, device, "departed", "")
+	}
+	h.pressure = func(ctx context.Context, device string, value string) error {
+		return send(ctx, device, command, value)
+	}
+	return h
+}
+
+// NewSmartThings returns a Hub setting the presence of SmartThings virtual
+// presence sensors through the SmartThings API with config.Token.
+// SmartThings virtual devices have no capability for a raw pressure, so
+// pressure isn't pushed.
+func NewSmartThings(config *config.SmartThings, names schema.Names) *Hub {
+	h := newHub("smartThings", names, config.Sleepers)
+	h.presence = func(ctx context.Context, device string, inBed bool) error {
+		value := "not present"
+		if inBed {
+			value = "present"
+		}
+		body, err := json.Marshal(map[string]interface{}{
+			"deviceEvents": []interface{}{
+				map[string]string{
+					"component":  "main",
+					"capability": "presenceSensor",
+					"attribute":  "presence",
+					"value":      value,
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, smartThingsAPI+"/virtualdevices/"+url.PathEscape(device)+"/events", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+		return h.do(req, smartThingsAPI)
+	}
+	return h
+}
+
+func (h *Hub) Name() string {
+	return h.name
+}
+
+// Write pushes the presence and pressure of the sleepers on the bed of p
+// that changed since they were last pushed
+func (h *Hub) Write(ctx context.Context, p collector.Point) {
+	if p.Measurement != h.names.Renamed("bed_sleeper_state") {
+		return
+	}
+	bed := p.Tags[h.names.Tag("name")]
+	ctx, span := tracer.Start(ctx, h.name+".push")
+	defer span.End()
+	for _, sleeper := range h.sleepers {
+		if sleeper.Bed != bed {
+			continue
+		}
+		if v, ok := p.Fields[h.names.Field("bed_sleeper_state", sleeper.Side+"_sleeper_is_in_bed")]; ok && sleeper.Device != "" {
+			inBed := fmt.Sprint(v) == "1" || fmt.Sprint(v) == "true"
+			h.push(sleeper.Device+" presence", strconv.FormatBool(inBed), func() error {
+				return h.presence(ctx, sleeper.Device, inBed)
+			})
+		}
+		if v, ok := p.Fields[h.names.Field("bed_sleeper_state", sleeper.Side+"_pressure")]; ok && sleeper.PressureDevice != "" && h.pressure != nil {
+			value := fmt.Sprint(v)
+			h.push(sleeper.PressureDevice+" pressure", value, func() error {
+				return h.pressure(ctx, sleeper.PressureDevice, value)
+			})
+		}
+	}
+	metrics.Written(h.Name(), 1)
+	metrics.MarkWritten(h.Name(), p.Measurement)
+}
+
+// push runs send unless value was the last pushed under key
+func (h *Hub) push(key, value string, send func() error) {
+	h.mu.Lock()
+	unchanged := h.sent[key] == value
+	h.mu.Unlock()
+	if unchanged {
+		return
+	}
+	err := send()
+	h.mu.Lock()
+	h.lastErr = err
+	if err == nil {
+		h.sent[key] = value
+	}
+	h.mu.Unlock()
+	if err != nil {
+		h.errors.report(fmt.Errorf("failed to push %s, %s", key, err))
+	}
+}
+
+// do sends req, naming the hub by base rather than the full URL in errors
+// since it may hold a token
+func (h *Hub) do(req *http.Request, base string) error {
+	resp, err := h.client.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to reach %s, %s", base, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s returned status %d: %s", base, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Errors returns the channel of failed pushes
+func (h *Hub) Errors() <-chan error {
+	return h.errors.errors()
+}
+
+// Flush does nothing, since every change is pushed as it is written
+func (h *Hub) Flush() {}
+
+// Check reports the error of the last push, if it failed
+func (h *Hub) Check(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastErr
+}
+
+func (h *Hub) Close() {
+	h.errors.close()
+}
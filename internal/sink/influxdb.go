@@ -0,0 +1,406 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	influx "github.com/influxdata/influxdb-client-go/v2"
+	influxAPI "github.com/influxdata/influxdb-client-go/v2/api"
+	influxHTTP "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type InfluxWriteConfigError struct{}
+
+func (r *InfluxWriteConfigError) Error() string {
+	return "must configure at least one of bucket or database/retention policy"
+}
+
+func InfluxConnect(config *config.InfluxDB) (influx.Client, influxAPI.WriteAPIBlocking, error) {
+	var auth string
+	if config.Token != "" {
+		auth = config.Token
+	} else if config.Username != "" && config.Password != "" {
+		auth = fmt.Sprintf("%s:%s", config.Username, config.Password)
+	} else {
+		auth = ""
+	}
+
+	writeDest, err := influxDestination(config.Bucket, config.Database, config.RetentionPolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.FlushInterval == 0 {
+		config.FlushInterval = 30 * time.Second
+	}
+
+	options := influx.DefaultOptions().
+		SetFlushInterval(uint(config.FlushInterval.Milliseconds())).
+		SetUseGZip(config.Gzip).
+		SetPrecision(influxPrecisions[config.Precision]).
+		SetTLSConfig(&tls.Config{
+			InsecureSkipVerify: config.SkipVerifySsl,
+		})
+	proxy, err := config.Proxy.Func()
+	if err != nil {
+		return nil, nil, err
+	}
+	transport := options.HTTPClient().Transport.(*http.Transport)
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+	if config.Transport.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.Transport.MaxIdleConns
+		transport.MaxIdleConnsPerHost = config.Transport.MaxIdleConns
+	}
+	if config.Transport.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.Transport.IdleConnTimeout
+	}
+	if config.Transport.KeepAlive > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   influxConnectTimeout,
+			KeepAlive: config.Transport.KeepAlive,
+		}).DialContext
+	}
+	client := influx.NewClientWithOptions(config.Address, auth, options)
+
+	writeAPI := client.WriteAPIBlocking(config.Organization, writeDest)
+
+	return client, writeAPI, nil
+}
+
+// influxPrecisions maps influxDB.precision to the precision points are
+// written with; unset means nanoseconds
+var influxPrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// influxDestination returns the bucket to write to, which for InfluxDB v1 is
+// database/retention-policy
+func influxDestination(bucket, database, retentionPolicy string) (string, error) {
+	if bucket != "" {
+		return bucket, nil
+	} else if database != "" && retentionPolicy != "" {
+		return fmt.Sprintf("%s/%s", database, retentionPolicy), nil
+	}
+	return "", &InfluxWriteConfigError{}
+}
+
+const (
+	defaultInfluxBatchSize = 1000
+	// influxConnectTimeout matches the client's own dial timeout
+	influxConnectTimeout = 5 * time.Second
+	influxRetryMin       = time.Second
+	influxRetryMax       = 30 * time.Second
+)
+
+// InfluxDB is a collector.Sink writing points to InfluxDB in batches. A batch
+// that fails to write is retried with backoff, and Write blocks meanwhile, so
+// a slow or unreachable database pushes back on the pipeline instead of
+// buffering without bound. By default a batch is retried until it succeeds;
+// with maxRetries set it is given up on after that many retries and kept in
+// a retry buffer of at most maxRetryBuffer points per destination, written
+// ahead of the next batch, or dropped if there is no room.
+type InfluxDB struct {
+	client    influx.Client
+	prefix    string
+	batchSize int
+	errors    *errorReporter
+
+	retryMin       time.Duration
+	retryMax       time.Duration
+	maxRetries     int
+	maxRetryBuffer int
+
+	// writeAPIs holds a write API per destination bucket, and routes maps
+	// the measurements routed away from the default destination to theirs
+	writeAPIs   map[string]influxAPI.WriteAPIBlocking
+	routes      map[string]string
+	defaultDest string
+
+	mu      sync.Mutex
+	batches map[string][]*write.Point
+	pending int
+	retries map[string][]*write.Point
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewInfluxDB connects to InfluxDB and returns a sink for the configured
+// destinations
+func NewInfluxDB(config *config.InfluxDB) (*InfluxDB, error) {
+	client, writeAPI, err := InfluxConnect(config)
+	if err != nil {
+		return nil, err
+	}
+	defaultDest, _ := influxDestination(config.Bucket, config.Database, config.RetentionPolicy)
+
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultInfluxBatchSize
+	}
+	retryMin := config.RetryInterval
+	if retryMin <= 0 {
+		retryMin = influxRetryMin
+	}
+	retryMax := config.MaxRetryInterval
+	if retryMax <= 0 {
+		retryMax = max(influxRetryMax, retryMin)
+	}
+	s := &InfluxDB{
+		client:         client,
+		prefix:         config.MeasurementPrefix,
+		batchSize:      batchSize,
+		errors:         newErrorReporter(),
+		retryMin:       retryMin,
+		retryMax:       retryMax,
+		maxRetries:     config.MaxRetries,
+		maxRetryBuffer: config.MaxRetryBuffer,
+		writeAPIs:      map[string]influxAPI.WriteAPIBlocking{defaultDest: writeAPI},
+		routes:         make(map[string]string),
+		defaultDest:    defaultDest,
+		batches:        make(map[string][]*write.Point),
+		retries:        make(map[string][]*write.Point),
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+	for i, route := range config.Routes {
+		dest, err := influxDestination(route.Bucket, route.Database, route.RetentionPolicy)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("invalid InfluxDB route %d, %s", i, err)
+		}
+		if _, ok := s.writeAPIs[dest]; !ok {
+			s.writeAPIs[dest] = client.WriteAPIBlocking(config.Organization, dest)
+		}
+		for _, measurement := range route.Measurements {
+			s.routes[measurement] = dest
+		}
+	}
+	go s.flushPeriodically(config.FlushInterval)
+	return s, nil
+}
+
+func (s *InfluxDB) Name() string {
+	return "influxdb"
+}
+
+// Write adds the point to the batch for its destination, writing every batch
+// once they hold batchSize points between them; points already collected are
+// still written during shutdown so ctx is not consulted
+func (s *InfluxDB) Write(ctx context.Context, p collector.Point) {
+	dest, ok := s.routes[p.Measurement]
+	if !ok {
+		dest = s.defaultDest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches[dest] = append(s.batches[dest], influx.NewPoint(s.prefix+p.Measurement, p.Tags, p.Fields, p.Time))
+	s.pending++
+	if s.pending >= s.batchSize {
+		s.writeBatches()
+	}
+}
+
+// Errors returns the channel of write errors
+func (s *InfluxDB) Errors() <-chan error {
+	return s.errors.errors()
+}
+
+// Flush writes the pending batches
+func (s *InfluxDB) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeBatches()
+}
+
+// Check reports whether InfluxDB answers a ping
+func (s *InfluxDB) Check(ctx context.Context) error {
+	ok, err := s.client.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reach InfluxDB, %s", err)
+	}
+	if !ok {
+		return errors.New("InfluxDB did not answer ping")
+	}
+	return nil
+}
+
+// Close writes the pending batches, dropping those still failing after their
+// retries, and releases the client
+func (s *InfluxDB) Close() {
+	close(s.stop)
+	<-s.stopped
+	s.Flush()
+	s.mu.Lock()
+	for dest, points := range s.retries {
+		metrics.Dropped(s.Name(), len(points))
+		s.errors.report(fmt.Errorf("dropped %d points left in the retry buffer for %s", len(points), dest))
+	}
+	s.mu.Unlock()
+	s.client.Close()
+	s.errors.close()
+}
+
+func (s *InfluxDB) flushPeriodically(interval time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+// writeBatches writes and clears the batch of every destination, after the
+// points left in its retry buffer; s.mu must be held
+func (s *InfluxDB) writeBatches() {
+	for dest, batch := range s.batches {
+		points := batch
+		if retry := s.retries[dest]; len(retry) > 0 {
+			points = append(retry, batch...)
+			delete(s.retries, dest)
+		}
+		for len(points) > 0 {
+			n := min(len(points), s.batchSize)
+			err := s.writeBatch(dest, points[:n])
+			if err != nil {
+				s.keepForRetry(dest, points)
+				break
+			}
+			points = points[n:]
+		}
+		s.batches[dest] = batch[:0]
+	}
+	s.pending = 0
+}
+
+// keepForRetry puts points in the retry buffer of dest, dropping the oldest
+// beyond maxRetryBuffer; s.mu must be held
+func (s *InfluxDB) keepForRetry(dest string, points []*write.Point) {
+	if excess := len(points) - s.maxRetryBuffer; excess > 0 {
+		metrics.Dropped(s.Name(), excess)
+		s.errors.report(fmt.Errorf("dropped %d points, the retry buffer is full", excess))
+		points = points[excess:]
+	}
+	if len(points) > 0 {
+		// Copied since the batch it came from is reused
+		s.retries[dest] = append([]*write.Point(nil), points...)
+	}
+}
+
+// writeBatch writes a batch to dest, retrying with backoff while the error is
+// one retrying can fix, up to maxRetries times if set; it returns the last
+// error if it gave up retrying, and nil once the batch is written or dropped
+// as invalid. The shutdown timeout bounds how long the collector waits on a
+// database that stays down.
+func (s *InfluxDB) writeBatch(dest string, batch []*write.Point) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	ctx, span := tracer.Start(context.Background(), "influxdb.write", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("destination", dest), attribute.Int("points", len(batch))))
+	defer span.End()
+
+	delay := s.retryMin
+	for retries := 0; ; retries++ {
+		err := s.writeAPIs[dest].WritePoint(ctx, batch...)
+		if err == nil {
+			metrics.Written(s.Name(), len(batch))
+			metrics.MarkWritten(s.Name(), s.measurements(batch)...)
+			return nil
+		}
+		span.RecordError(err)
+		s.errors.report(err)
+		if !influxRetryable(err) {
+			span.SetStatus(codes.Error, err.Error())
+			metrics.Dropped(s.Name(), len(batch))
+			s.errors.report(fmt.Errorf("dropped %d points", len(batch)))
+			return nil
+		}
+		if s.maxRetries > 0 && retries >= s.maxRetries {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > s.retryMax {
+			delay = s.retryMax
+		}
+	}
+}
+
+// measurements returns the distinct measurements in batch, without the
+// configured prefix
+func (s *InfluxDB) measurements(batch []*write.Point) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, p := range batch {
+		name := strings.TrimPrefix(p.Name(), s.prefix)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// influxRetryable reports whether a failed write may succeed later; requests
+// InfluxDB rejected as invalid never will
+func influxRetryable(err error) bool {
+	var httpErr *influxHTTP.Error
+	if errors.As(err, &httpErr) && httpErr.StatusCode > 0 {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	return true
+}
+
+// CheckInfluxDB verifies that InfluxDB is reachable and, with a token, that
+// the bucket exists and the token can see it
+func CheckInfluxDB(ctx context.Context, config *config.InfluxDB) error {
+	client, _, err := InfluxConnect(config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ok, err := client.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reach InfluxDB at %s, %s", config.Address, err)
+	}
+	if !ok {
+		return fmt.Errorf("InfluxDB at %s did not answer ping", config.Address)
+	}
+
+	if config.Token != "" && config.Bucket != "" {
+		_, err = client.BucketsAPI().FindBucketByName(ctx, config.Bucket)
+		if err != nil {
+			return fmt.Errorf("failed to find bucket %s, check that it exists and the token can read it, %s", config.Bucket, err)
+		}
+	}
+	return nil
+}
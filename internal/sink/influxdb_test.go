@@ -0,0 +1,269 @@
+package sink
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeRequest is a write InfluxDB received, with the measurements of its
+// points in order
+type writeRequest struct {
+	Status       int
+	Bucket       string
+	Measurements []string
+}
+
+// fakeInfluxDB answers writes with the status statuses gives for each in
+// turn, and 204 once they run out, recording them
+type fakeInfluxDB struct {
+	statuses []int
+
+	mu       sync.Mutex
+	requests []writeRequest
+}
+
+func (f *fakeInfluxDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v2/write" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var measurements []string
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		measurement, _, _ := strings.Cut(line, " ")
+		measurement, _, _ = strings.Cut(measurement, ",")
+		measurements = append(measurements, measurement)
+	}
+
+	f.mu.Lock()
+	status := http.StatusNoContent
+	if n := len(f.requests); n < len(f.statuses) && f.statuses[n] != 0 {
+		status = f.statuses[n]
+	}
+	f.requests = append(f.requests, writeRequest{
+		Status:       status,
+		Bucket:       r.URL.Query().Get("bucket"),
+		Measurements: measurements,
+	})
+	f.mu.Unlock()
+
+	if status != http.StatusNoContent {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, `{"code":"internal error","message":"failed"}`)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+func (f *fakeInfluxDB) received() []writeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]writeRequest(nil), f.requests...)
+}
+
+func TestInfluxDBBatching(t *testing.T) {
+	const (
+		ok          = http.StatusNoContent
+		unavailable = http.StatusServiceUnavailable
+		badRequest  = http.StatusBadRequest
+	)
+	tests := []struct {
+		name   string
+		config config.InfluxDB
+		// statuses answers the writes in turn, with 0 or running out
+		// meaning 204
+		statuses []int
+		// writes are the measurements of the points written, a point each,
+		// and flush whether to flush once they are
+		writes []string
+		flush  bool
+		want   []writeRequest
+	}{
+		{
+			name:   "full batches are written",
+			config: config.InfluxDB{BatchSize: 2},
+			writes: []string{"m1", "m2", "m3", "m4", "m5"},
+			want: []writeRequest{
+				{ok, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m3", "m4"}},
+			},
+		},
+		{
+			name:   "flush writes a partial batch",
+			config: config.InfluxDB{BatchSize: 2},
+			writes: []string{"m1", "m2", "m3"},
+			flush:  true,
+			want: []writeRequest{
+				{ok, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m3"}},
+			},
+		},
+		{
+			name:   "measurement prefix",
+			config: config.InfluxDB{BatchSize: 1, MeasurementPrefix: "sn_"},
+			writes: []string{"m1"},
+			want: []writeRequest{
+				{ok, "sleep", []string{"sn_m1"}},
+			},
+		},
+		{
+			name: "routes",
+			config: config.InfluxDB{
+				BatchSize: 3,
+				Routes:    []config.InfluxRoute{{Measurements: []string{"m2"}, Bucket: "archive"}},
+			},
+			writes: []string{"m1", "m2", "m3"},
+			want: []writeRequest{
+				{ok, "archive", []string{"m2"}},
+				{ok, "sleep", []string{"m1", "m3"}},
+			},
+		},
+		{
+			name:     "retried until written",
+			config:   config.InfluxDB{BatchSize: 2},
+			statuses: []int{unavailable, unavailable},
+			writes:   []string{"m1", "m2"},
+			want: []writeRequest{
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m1", "m2"}},
+			},
+		},
+		{
+			name:     "invalid batch dropped without retrying",
+			config:   config.InfluxDB{BatchSize: 2},
+			statuses: []int{badRequest},
+			writes:   []string{"m1", "m2", "m3", "m4"},
+			want: []writeRequest{
+				{badRequest, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m3", "m4"}},
+			},
+		},
+		{
+			name:     "given up batch written ahead of the next",
+			config:   config.InfluxDB{BatchSize: 2, MaxRetries: 1, MaxRetryBuffer: 10},
+			statuses: []int{unavailable, unavailable},
+			writes:   []string{"m1", "m2", "m3", "m4"},
+			want: []writeRequest{
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m3", "m4"}},
+			},
+		},
+		{
+			name:     "full retry buffer drops the oldest points",
+			config:   config.InfluxDB{BatchSize: 2, MaxRetries: 1, MaxRetryBuffer: 1},
+			statuses: []int{unavailable, unavailable},
+			writes:   []string{"m1", "m2", "m3", "m4"},
+			want: []writeRequest{
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m2", "m3"}},
+				{ok, "sleep", []string{"m4"}},
+			},
+		},
+		{
+			name:     "given up batch dropped without a retry buffer",
+			config:   config.InfluxDB{BatchSize: 2, MaxRetries: 1},
+			statuses: []int{unavailable, unavailable},
+			writes:   []string{"m1", "m2", "m3", "m4"},
+			want: []writeRequest{
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{unavailable, "sleep", []string{"m1", "m2"}},
+				{ok, "sleep", []string{"m3", "m4"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeInfluxDB{statuses: test.statuses}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			c := test.config
+			c.Address = server.URL
+			c.Token = "token"
+			c.Organization = "org"
+			c.Bucket = "sleep"
+			c.FlushInterval = time.Hour
+			c.RetryInterval = time.Millisecond
+			c.MaxRetryInterval = time.Millisecond
+			s, err := NewInfluxDB(&c)
+			if err != nil {
+				t.Fatalf("failed to create sink, %s", err)
+			}
+			defer s.Close()
+
+			ts := time.Unix(1700000000, 0)
+			for i, measurement := range test.writes {
+				s.Write(context.Background(), collector.Point{
+					Measurement: measurement,
+					Tags:        map[string]string{"name": "Bed"},
+					Fields:      map[string]interface{}{"n": i},
+					Time:        ts.Add(time.Duration(i) * time.Second),
+				})
+			}
+			if test.flush {
+				s.Flush()
+			}
+
+			got := fake.received()
+			// Destinations are written in no particular order
+			if len(test.config.Routes) > 0 {
+				sort.SliceStable(got, func(i, j int) bool {
+					return got[i].Bucket < got[j].Bucket
+				})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got writes\n%v\nwant\n%v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInfluxDBCloseFlushes(t *testing.T) {
+	fake := &fakeInfluxDB{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s, err := NewInfluxDB(&config.InfluxDB{
+		Address:       server.URL,
+		Token:         "token",
+		Organization:  "org",
+		Bucket:        "sleep",
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink, %s", err)
+	}
+	s.Write(context.Background(), collector.Point{
+		Measurement: "m1",
+		Fields:      map[string]interface{}{"n": 1},
+		Time:        time.Now(),
+	})
+	if got := fake.received(); len(got) != 0 {
+		t.Fatalf("got %d writes before closing, want 0", len(got))
+	}
+	s.Close()
+	want := []writeRequest{{http.StatusNoContent, "sleep", []string{"m1"}}}
+	if got := fake.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes %v, want %v", got, want)
+	}
+}
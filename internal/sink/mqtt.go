@@ -0,0 +1,387 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMQTTTopicPrefix     = "sleepnumber"
+	defaultMQTTDiscoveryPrefix = "homeassistant"
+	mqttTimeout                = 10 * time.Second
+	mqttRetryInterval          = 10 * time.Second
+	mqttOnline                 = "online"
+	mqttOffline                = "offline"
+	mqttStopMotionTopic        = "stop_motion/set"
+	mqttStopMotionAll          = "all"
+)
+
+// StopMotion halts foundation motion on the bed named bed, or on every bed
+// if it is empty or "all", as asked for by client
+type StopMotion func(ctx context.Context, bed, client string) error
+
+// MQTT is a collector.Sink publishing the fields of every point as a JSON
+// object, retained if configured, to <topicPrefix>/<device>/<measurement>,
+// where the device is the bed named by the point's name tag, prefixed with
+// its account if any, or "collector" for points about the collector itself.
+// With a state topic, the latest fields of every bed are also published
+// there as one JSON document after each poll cycle. With discovery, each
+// field is announced to Home Assistant as a sensor, or a binary sensor for
+// flags such as left_sleeper_is_in_bed, the first time it is published after
+// connecting or after Home Assistant restarts. With stopMotion, a message to
+// <topicPrefix>/stop_motion/set halts foundation motion on the bed it names,
+// or on every bed if it is empty or "all", announced to Home Assistant as a
+// button.
+type MQTT struct {
+	client          mqtt.Client
+	broker          string
+	topicPrefix     string
+	discovery       bool
+	discoveryPrefix string
+	retain          bool
+	qos             byte
+	stopMotion      StopMotion
+	errors          *errorReporter
+
+	mu         sync.Mutex
+	discovered map[string]bool
+
+	// state is published to the state topic, if set
+	state *stateDocument
+}
+
+// NewMQTT connects to the broker, retrying in the background if it can't be
+// reached yet, taking stop motion commands through stopMotion if it is not
+// nil; the state document reads tags under names
+func NewMQTT(config *config.MQTT, names schema.Names, stopMotion StopMotion) (*MQTT, error) {
+	s := &MQTT{
+		broker:          config.Broker,
+		topicPrefix:     strings.TrimSuffix(config.TopicPrefix, "/"),
+		discovery:       config.Discovery,
+		discoveryPrefix: strings.TrimSuffix(config.DiscoveryPrefix, "/"),
+		retain:          config.Retain,
+		qos:             byte(config.QoS),
+		stopMotion:      stopMotion,
+		errors:          newErrorReporter(),
+		discovered:      make(map[string]bool),
+	}
+	if s.topicPrefix == "" {
+		s.topicPrefix = defaultMQTTTopicPrefix
+	}
+	if s.discoveryPrefix == "" {
+		s.discoveryPrefix = defaultMQTTDiscoveryPrefix
+	}
+	clientID := config.ClientID
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = "sleepnumber-stats-collector-" + slug(hostname)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(clientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(mqttRetryInterval).
+		SetWill(s.availabilityTopic(), mqttOffline, 1, true).
+		SetOnConnectHandler(s.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			s.errors.report(fmt.Errorf("lost connection to MQTT broker %s, %s", s.broker, err))
+		})
+	s.client = mqtt.NewClient(opts)
+	if config.StateTopic != "" {
+		s.state = newStateDocument(names, func(payload []byte) error {
+			return s.publish(config.StateTopic, s.retain, payload)
+		}, func(err error) {
+			s.errors.report(fmt.Errorf("failed to publish state document, %s", err))
+		})
+	}
+	token := s.client.Connect()
+	if token.WaitTimeout(mqttTimeout) && token.Error() != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker %s, %s", config.Broker, token.Error())
+	}
+	return s, nil
+}
+
+func (s *MQTT) Name() string {
+	return "mqtt"
+}
+
+// onConnect marks the collector online and announces every field again,
+// since the broker may have lost retained discovery messages
+func (s *MQTT) onConnect(client mqtt.Client) {
+	s.resetDiscovery()
+	client.Publish(s.availabilityTopic(), 1, true, mqttOnline)
+	if s.stopMotion != nil {
+		client.Subscribe(s.stopMotionTopic(), 1, s.onStopMotion)
+	}
+	if s.discovery {
+		s.announceStopMotion()
+		// Home Assistant announces its restarts, after which it needs the
+		// discovery messages again unless they were retained
+		client.Subscribe(s.discoveryPrefix+"/status", 0, func(_ mqtt.Client, msg mqtt.Message) {
+			if string(msg.Payload()) == mqttOnline {
+				s.resetDiscovery()
+				s.announceStopMotion()
+			}
+		})
+	}
+}
+
+// onStopMotion halts foundation motion on the bed named by msg, in the
+// background so other messages aren't held up. Retained messages are
+// ignored, so a stale command can't stop the beds on every reconnect.
+func (s *MQTT) onStopMotion(_ mqtt.Client, msg mqtt.Message) {
+	if msg.Retained() {
+		return
+	}
+	bed := strings.TrimSpace(string(msg.Payload()))
+	go func() {
+		err := s.stopMotion(context.Background(), bed, s.broker)
+		if err != nil {
+			s.errors.report(fmt.Errorf("failed to stop motion on %q, %s", bed, err))
+		}
+	}()
+}
+
+// announceStopMotion announces the stop motion command to Home Assistant as
+// a button stopping every bed, if commands are taken
+func (s *MQTT) announceStopMotion() {
+	if s.stopMotion == nil {
+		return
+	}
+	device := "collector"
+	id := slug(s.topicPrefix + "_" + device + "_stop_motion")
+	payload, err := json.Marshal(map[string]interface{}{
+		"name":               "stop bed motion",
+		"unique_id":          id,
+		"object_id":          id,
+		"command_topic":      s.stopMotionTopic(),
+		"payload_press":      mqttStopMotionAll,
+		"icon":               "mdi:stop-circle",
+		"availability_topic": s.availabilityTopic(),
+		"device":             mqttDeviceInfo(s.topicPrefix, device, nil),
+	})
+	if err != nil {
+		s.errors.report(fmt.Errorf("failed to announce stop motion to Home Assistant, %s", err))
+		return
+	}
+	// Not waited for, since this runs in the client's callbacks
+	topic := s.discoveryPrefix + "/button/" + slug(s.topicPrefix+"_"+device) + "/stop_motion/config"
+	s.client.Publish(topic, s.qos, true, payload)
+}
+
+func (s *MQTT) resetDiscovery() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.discovered)
+}
+
+// Write publishes the fields of p, announcing new ones first with discovery
+func (s *MQTT) Write(ctx context.Context, p collector.Point) {
+	if s.state != nil {
+		s.state.update(p)
+	}
+	device := mqttDevice(p.Tags)
+	topic := s.topicPrefix + "/" + device + "/" + slug(p.Measurement)
+	if s.discovery {
+		s.announce(device, topic, p)
+	}
+
+	state := make(map[string]interface{}, len(p.Fields)+1)
+	for k, v := range p.Fields {
+		state[k] = v
+	}
+	state["time"] = p.Time.UTC().Format(time.RFC3339Nano)
+	payload, err := json.Marshal(state)
+	if err == nil {
+		err = s.publish(topic, s.retain, payload)
+	}
+	if err != nil {
+		metrics.Dropped(s.Name(), 1)
+		s.errors.report(fmt.Errorf("dropped %s point, %s", p.Measurement, err))
+		return
+	}
+	metrics.Written(s.Name(), 1)
+	metrics.MarkWritten(s.Name(), p.Measurement)
+}
+
+// announce publishes a retained discovery message for each field of p not
+// announced since connecting
+func (s *MQTT) announce(device, stateTopic string, p collector.Point) {
+	for field, value := range p.Fields {
+		key := device + "/" + p.Measurement + "/" + field
+		s.mu.Lock()
+		seen := s.discovered[key]
+		s.mu.Unlock()
+		if seen {
+			continue
+		}
+
+		id := slug(s.topicPrefix + "_" + device + "_" + p.Measurement + "_" + field)
+		component, entity := mqttEntity(field, value)
+		entity["name"] = strings.ReplaceAll(field, "_", " ")
+		entity["unique_id"] = id
+		entity["object_id"] = id
+		entity["state_topic"] = stateTopic
+		entity["value_template"] = "{{ value_json." + field + " }}"
+		entity["availability_topic"] = s.availabilityTopic()
+		entity["device"] = mqttDeviceInfo(s.topicPrefix, device, p.Tags)
+		payload, err := json.Marshal(entity)
+		if err == nil {
+			topic := s.discoveryPrefix + "/" + component + "/" + slug(s.topicPrefix+"_"+device) + "/" + slug(p.Measurement+"_"+field) + "/config"
+			err = s.publish(topic, true, payload)
+		}
+		if err != nil {
+			s.errors.report(fmt.Errorf("failed to announce %s %s to Home Assistant, %s", p.Measurement, field, err))
+			continue
+		}
+		s.mu.Lock()
+		s.discovered[key] = true
+		s.mu.Unlock()
+	}
+}
+
+func (s *MQTT) publish(topic string, retain bool, payload []byte) error {
+	token := s.client.Publish(topic, s.qos, retain, payload)
+	if !token.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+func (s *MQTT) availabilityTopic() string {
+	return s.topicPrefix + "/status"
+}
+
+func (s *MQTT) stopMotionTopic() string {
+	return s.topicPrefix + "/" + mqttStopMotionTopic
+}
+
+// mqttDevice names the device a point belongs to in topics
+func mqttDevice(tags map[string]string) string {
+	device := slug(tags["name"])
+	if device == "" {
+		device = "collector"
+	}
+	if account := slug(tags["account"]); account != "" {
+		device = account + "_" + device
+	}
+	return device
+}
+
+// mqttDeviceInfo describes the device of a point for Home Assistant
+func mqttDeviceInfo(prefix, device string, tags map[string]string) map[string]interface{} {
+	info := map[string]interface{}{
+		"identifiers":  []string{slug(prefix + "_" + device)},
+		"manufacturer": "Sleep Number",
+		"name":         tags["name"],
+	}
+	if tags["name"] == "" {
+		info["name"] = "sleepnumber-stats-collector"
+		info["manufacturer"] = "sleepnumber-stats-collector"
+	}
+	if account := tags["account"]; account != "" {
+		info["name"] = fmt.Sprintf("%s (%s)", info["name"], account)
+	}
+	if tags["model"] != "" {
+		info["model"] = tags["model"]
+	}
+	return info
+}
+
+// mqttEntity returns the Home Assistant component of a field and its
+// component-specific settings: fields written with BoolToInt are binary
+// sensors, and other numbers measurements
+func mqttEntity(field string, value interface{}) (string, map[string]interface{}) {
+	if strings.HasSuffix(field, "_is_in_bed") || strings.HasPrefix(field, "is_") || field == "degraded" {
+		entity := map[string]interface{}{
+			"payload_on":  "1",
+			"payload_off": "0",
+		}
+		if strings.HasSuffix(field, "_is_in_bed") {
+			entity["device_class"] = "occupancy"
+		}
+		if field == "degraded" {
+			entity["device_class"] = "problem"
+		}
+		return "binary_sensor", entity
+	}
+	entity := map[string]interface{}{}
+	if isNumber(value) {
+		entity["state_class"] = "measurement"
+	}
+	return "sensor", entity
+}
+
+// isNumber reports whether v is a number
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// slug makes s usable in topics and IDs
+func slug(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// Errors returns the channel of publish and connection errors
+func (s *MQTT) Errors() <-chan error {
+	return s.errors.errors()
+}
+
+// Flush publishes the state document if it has changes waiting; points are
+// published as they are written
+func (s *MQTT) Flush() {
+	if s.state != nil {
+		s.state.flush()
+	}
+}
+
+// Check reports whether the connection to the broker is up
+func (s *MQTT) Check(ctx context.Context) error {
+	if !s.client.IsConnectionOpen() {
+		return errors.New("not connected to MQTT broker " + s.broker)
+	}
+	return nil
+}
+
+// Close marks the collector offline and disconnects
+func (s *MQTT) Close() {
+	if s.state != nil {
+		s.state.close()
+	}
+	if s.client.IsConnectionOpen() {
+		s.publish(s.availabilityTopic(), true, []byte(mqttOffline))
+	}
+	s.client.Disconnect(250)
+	s.errors.close()
+}
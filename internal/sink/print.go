@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	influx "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Print formats for the points written by a Print sink
+const (
+	PrintLineProtocol = "line"
+	PrintTable        = "table"
+)
+
+// Print is a sink that prints points instead of storing them, for checking
+// what would be written
+type Print struct {
+	format   string
+	mu       sync.Mutex
+	out      io.Writer
+	errorsCh chan error
+}
+
+// printTableRow lays out a row of the table format; the columns are fixed
+// so each row is printed as soon as its point is written
+const printTableRow = "%-25s  %-26s  %-50s  %s\n"
+
+// NewPrint returns a sink printing points to out as InfluxDB line protocol or
+// as a table
+func NewPrint(out io.Writer, format string) (*Print, error) {
+	s := &Print{
+		format:   format,
+		out:      out,
+		errorsCh: make(chan error),
+	}
+	switch format {
+	case PrintLineProtocol:
+	case PrintTable:
+		fmt.Fprintf(out, printTableRow, "TIME", "MEASUREMENT", "TAGS", "FIELDS")
+	default:
+		return nil, fmt.Errorf("unknown print format %s, must be %s or %s", format, PrintLineProtocol, PrintTable)
+	}
+	return s, nil
+}
+
+func (s *Print) Name() string {
+	return "print"
+}
+
+func (s *Print) Write(ctx context.Context, p collector.Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.format == PrintTable {
+		fmt.Fprintf(s.out, printTableRow, p.Time.Format(time.RFC3339), p.Measurement, joinSorted(p.Tags), joinSorted(p.Fields))
+		return
+	}
+	io.WriteString(s.out, write.PointToLineProtocol(influx.NewPoint(p.Measurement, p.Tags, p.Fields, p.Time), time.Nanosecond))
+}
+
+// joinSorted formats a map as comma-separated key=value pairs in key order
+func joinSorted[V any](m map[string]V) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Errors returns a channel that never receives, since printing can't fail in
+// a way worth reporting
+func (s *Print) Errors() <-chan error {
+	return s.errorsCh
+}
+
+func (s *Print) Check(ctx context.Context) error {
+	return nil
+}
+
+func (s *Print) Flush() {
+}
+
+func (s *Print) Close() {
+	close(s.errorsCh)
+}
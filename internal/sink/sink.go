@@ -0,0 +1,58 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"go.opentelemetry.io/otel"
+)
+
+// tracer records a span for every write to a destination outside the process
+var tracer = otel.Tracer("github.com/iwvelando/sleepnumber-stats-collector/internal/sink")
+
+// Sink is an output destination managed by the collector binary
+type Sink interface {
+	collector.Sink
+	Name() string
+	Errors() <-chan error
+	// Check reports whether the destination is reachable
+	Check(ctx context.Context) error
+	Flush()
+	Close()
+}
+
+// Multi writes every point to each of its sinks
+type Multi []Sink
+
+func (m Multi) Write(ctx context.Context, p collector.Point) {
+	for _, s := range m {
+		s.Write(ctx, p)
+	}
+}
+
+// Check checks every sink, reporting each unreachable one
+func (m Multi) Check(ctx context.Context) error {
+	var errs []error
+	for _, s := range m {
+		err := s.Check(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush flushes every sink
+func (m Multi) Flush() {
+	for _, s := range m {
+		s.Flush()
+	}
+}
+
+// Close closes every sink
+func (m Multi) Close() {
+	for _, s := range m {
+		s.Close()
+	}
+}
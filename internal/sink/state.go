@@ -0,0 +1,224 @@
+package sink
+
+import (
+	"encoding/json"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateSettle is how long after the last point a state document waits
+// before publishing, so the points of one poll cycle are published together
+const stateSettle = 2 * time.Second
+
+// stateDocument keeps the latest fields of every bed and side as one JSON
+// document, published a moment after each burst of points:
+//
+//	{
+//	  "time": "<time of the latest point>",
+//	  "beds": {
+//	    "<bed name, prefixed with its account and a slash if any>": {
+//	      "name": "...", "account": "...", "model": "...", "size": "...",
+//	      "time": "...",
+//	      "left": {"sleeper_is_in_bed": 1, "sleep_number": 40, ...},
+//	      "right": {...},
+//	      "<measurement>": {<fields not about a side>}
+//	    }
+//	  },
+//	  "collector": {"<measurement>": {<fields>}}
+//	}
+//
+// Fields named with a left_ or right_ prefix, or a _left or _right suffix,
+// go in that side's object without it, and the fields of points tagged with
+// a side, such as wearable_sleep, go in that side's object under their
+// measurement. Points not tagged with a bed name go in collector. Tags are
+// looked up under the keys names renames them to, but keep their own names
+// in the document.
+type stateDocument struct {
+	names   schema.Names
+	publish func([]byte) error
+	onError func(error)
+
+	// publishing serializes flushes, so the last one is done once close
+	// returns
+	publishing sync.Mutex
+	mu         sync.Mutex
+	doc        stateDoc
+	dirty      bool
+	timer      *time.Timer
+}
+
+type stateDoc struct {
+	Time      time.Time                         `json:"time"`
+	Beds      map[string]map[string]interface{} `json:"beds"`
+	Collector map[string]map[string]interface{} `json:"collector"`
+}
+
+func newStateDocument(names schema.Names, publish func([]byte) error, onError func(error)) *stateDocument {
+	return &stateDocument{
+		names:   names,
+		publish: publish,
+		onError: onError,
+		doc: stateDoc{
+			Beds:      make(map[string]map[string]interface{}),
+			Collector: make(map[string]map[string]interface{}),
+		},
+	}
+}
+
+// update merges p into the document and schedules publishing it
+func (d *stateDocument) update(p collector.Point) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p.Time.After(d.doc.Time) {
+		d.doc.Time = p.Time
+	}
+	d.merge(p)
+	d.dirty = true
+	if d.timer == nil {
+		d.timer = time.AfterFunc(stateSettle, d.flush)
+	} else {
+		d.timer.Reset(stateSettle)
+	}
+}
+
+func (d *stateDocument) merge(p collector.Point) {
+	name := p.Tags[d.names.Tag("name")]
+	if name == "" {
+		d.doc.Collector[p.Measurement] = copyFields(p.Fields)
+		return
+	}
+	key := name
+	if account := p.Tags[d.names.Tag("account")]; account != "" {
+		key = account + "/" + name
+	}
+	bed := d.doc.Beds[key]
+	if bed == nil {
+		bed = map[string]interface{}{
+			"left":  map[string]interface{}{},
+			"right": map[string]interface{}{},
+		}
+		d.doc.Beds[key] = bed
+	}
+	for _, tag := range []string{"name", "account", "model", "size"} {
+		if v, ok := d.names.TagValue(p, tag); ok {
+			bed[tag] = v
+		}
+	}
+	if t, _ := bed["time"].(time.Time); p.Time.After(t) {
+		bed["time"] = p.Time
+	}
+
+	if side := p.Tags[d.names.Tag("side")]; side == "left" || side == "right" {
+		bed[side].(map[string]interface{})[p.Measurement] = copyFields(p.Fields)
+		return
+	}
+	rest := make(map[string]interface{})
+	for field, value := range p.Fields {
+		side, stripped := splitSide(field)
+		if side == "" {
+			rest[field] = value
+			continue
+		}
+		bed[side].(map[string]interface{})[stripped] = value
+	}
+	if len(rest) > 0 {
+		bed[p.Measurement] = rest
+	}
+}
+
+// splitSide returns the side a field is about and its name without it
+func splitSide(field string) (string, string) {
+	for _, side := range []string{"left", "right"} {
+		if rest, ok := strings.CutPrefix(field, side+"_"); ok {
+			return side, rest
+		}
+		if rest, ok := strings.CutSuffix(field, "_"+side); ok {
+			return side, rest
+		}
+	}
+	return "", field
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
+
+// flush publishes the document now if it changed since last published
+func (d *stateDocument) flush() {
+	d.publishing.Lock()
+	defer d.publishing.Unlock()
+	d.mu.Lock()
+	if !d.dirty {
+		d.mu.Unlock()
+		return
+	}
+	payload, err := json.Marshal(d.doc)
+	d.dirty = false
+	d.mu.Unlock()
+	if err == nil {
+		err = d.publish(payload)
+	}
+	if err != nil {
+		d.onError(err)
+	}
+}
+
+// close publishes any pending changes, after which the document is never
+// published again
+func (d *stateDocument) close() {
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.mu.Unlock()
+	d.flush()
+}
+
+// StateDocument keeps the state document laid out as described on
+// stateDocument for consumers other than sinks, such as the WebSocket state
+// stream, handing each version to publish
+type StateDocument struct {
+	doc *stateDocument
+
+	mu     sync.Mutex
+	latest []byte
+}
+
+// NewStateDocument returns an empty StateDocument reading tags under names
+// and calling publish with every version of the document
+func NewStateDocument(names schema.Names, publish func([]byte)) *StateDocument {
+	s := &StateDocument{}
+	s.doc = newStateDocument(names, func(payload []byte) error {
+		s.mu.Lock()
+		s.latest = payload
+		s.mu.Unlock()
+		publish(payload)
+		return nil
+	}, func(error) {})
+	return s
+}
+
+// Update merges p into the document, published once the cycle's points are
+// in
+func (s *StateDocument) Update(p collector.Point) {
+	s.doc.update(p)
+}
+
+// Latest returns the last version published, or nil if none has been
+func (s *StateDocument) Latest() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest
+}
+
+// Close publishes any pending changes
+func (s *StateDocument) Close() {
+	s.doc.close()
+}
@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const stateWebhookTimeout = 10 * time.Second
+
+// StateWebhook is a collector.Sink POSTing the latest fields of every bed as
+// one JSON document, laid out as described on stateDocument, to a URL after
+// each poll cycle, such as to an http in node of Node-RED
+type StateWebhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	state   *stateDocument
+	errors  *errorReporter
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// NewStateWebhook returns a StateWebhook posting to config.URL, reading tags
+// under names
+func NewStateWebhook(config *config.StateWebhook, names schema.Names) *StateWebhook {
+	s := &StateWebhook{
+		url:     config.URL,
+		headers: config.Headers,
+		client:  &http.Client{Timeout: stateWebhookTimeout},
+		errors:  newErrorReporter(),
+	}
+	s.state = newStateDocument(names, s.post, func(err error) {
+		s.errors.report(fmt.Errorf("failed to post state document, %s", err))
+	})
+	return s
+}
+
+func (s *StateWebhook) Name() string {
+	return "stateWebhook"
+}
+
+// Write merges p into the document, posted once the cycle's points are in
+func (s *StateWebhook) Write(ctx context.Context, p collector.Point) {
+	s.state.update(p)
+	metrics.Written(s.Name(), 1)
+	metrics.MarkWritten(s.Name(), p.Measurement)
+}
+
+func (s *StateWebhook) post(payload []byte) error {
+	err := s.send(payload)
+	s.mu.Lock()
+	s.lastErr = err
+	s.mu.Unlock()
+	return err
+}
+
+func (s *StateWebhook) send(payload []byte) error {
+	ctx, span := tracer.Start(context.Background(), "stateWebhook.post")
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s returned status %d: %s", s.url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Errors returns the channel of failed posts
+func (s *StateWebhook) Errors() <-chan error {
+	return s.errors.errors()
+}
+
+// Flush posts the document if it has changes waiting
+func (s *StateWebhook) Flush() {
+	s.state.flush()
+}
+
+// Check reports the error of the last post, if it failed
+func (s *StateWebhook) Check(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// Close posts any changes waiting
+func (s *StateWebhook) Close() {
+	s.state.close()
+	s.errors.close()
+}
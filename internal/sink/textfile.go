@@ -0,0 +1,264 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/metrics"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// textfilePrefix starts the name of every metric made from a field
+const textfilePrefix = "sleepnumber_"
+
+// Textfile is a collector.Sink writing the latest value of every numeric
+// field, along with the collector's own metrics, to a file in the Prometheus
+// text format after each poll cycle, for the textfile collector of
+// node_exporter to expose. A field is the gauge sleepnumber_<measurement>_
+// <field>, labelled with the point's tags.
+type Textfile struct {
+	path   string
+	errors *errorReporter
+
+	// writing serializes writes, so the last one is done once Close returns
+	writing sync.Mutex
+	mu      sync.Mutex
+	series  map[string]*textfileSeries
+	dirty   bool
+	timer   *time.Timer
+	lastErr error
+}
+
+// textfileSeries is the latest numeric fields of a measurement with a set of
+// tags
+type textfileSeries struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]float64
+}
+
+// NewTextfile returns a Textfile writing to config.Path
+func NewTextfile(config *config.Textfile) *Textfile {
+	return &Textfile{
+		path:   config.Path,
+		errors: newErrorReporter(),
+		series: make(map[string]*textfileSeries),
+	}
+}
+
+func (t *Textfile) Name() string {
+	return "textfile"
+}
+
+// Write records the numeric fields of p, written once the cycle's points
+// are in
+func (t *Textfile) Write(ctx context.Context, p collector.Point) {
+	fields := make(map[string]float64, len(p.Fields))
+	for field, value := range p.Fields {
+		if v, ok := number(value); ok {
+			fields[field] = v
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	tags := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	key := p.Measurement + " " + strings.Join(tags, ",")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.series[key]
+	if s == nil {
+		s = &textfileSeries{measurement: p.Measurement, tags: p.Tags, fields: make(map[string]float64)}
+		t.series[key] = s
+	}
+	for field, v := range fields {
+		s.fields[field] = v
+	}
+	t.dirty = true
+	if t.timer == nil {
+		t.timer = time.AfterFunc(stateSettle, t.Flush)
+	} else {
+		t.timer.Reset(stateSettle)
+	}
+	metrics.Written(t.Name(), 1)
+	metrics.MarkWritten(t.Name(), p.Measurement)
+}
+
+// number converts a field value to a float64, reporting whether it is a
+// number or bool at all; strings count when they are hex numbers starting
+// with 0x, as SleepIQ sends foundation positions
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		hex, ok := strings.CutPrefix(v, "0x")
+		if !ok {
+			return 0, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return 0, false
+		}
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// metricName makes s a valid metric or label name, replacing what isn't
+func metricName(s string) string {
+	name := []rune(s)
+	for i, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || r >= '0' && r <= '9' && i > 0) {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// registry returns a registry of a gauge for every field recorded; t.mu must
+// be held
+func (t *Textfile) registry() (*prometheus.Registry, error) {
+	type sample struct {
+		labels map[string]string
+		value  float64
+	}
+	type family struct {
+		help    string
+		labels  map[string]bool
+		samples []sample
+	}
+	families := make(map[string]*family)
+	for _, s := range t.series {
+		labels := make(map[string]string, len(s.tags))
+		for k, v := range s.tags {
+			labels[metricName(k)] = v
+		}
+		for field, v := range s.fields {
+			name := metricName(textfilePrefix + s.measurement + "_" + field)
+			f := families[name]
+			if f == nil {
+				f = &family{
+					help:   fmt.Sprintf("Field %s of the %s measurement.", field, s.measurement),
+					labels: make(map[string]bool),
+				}
+				families[name] = f
+			}
+			for label := range labels {
+				f.labels[label] = true
+			}
+			f.samples = append(f.samples, sample{labels: labels, value: v})
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	for name, f := range families {
+		labelNames := make([]string, 0, len(f.labels))
+		for label := range f.labels {
+			labelNames = append(labelNames, label)
+		}
+		sort.Strings(labelNames)
+		gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: f.help}, labelNames)
+		for _, s := range f.samples {
+			// Series missing a label of the family get it empty, which
+			// Prometheus treats as not having it
+			values := make([]string, len(labelNames))
+			for i, label := range labelNames {
+				values[i] = s.labels[label]
+			}
+			gauge.WithLabelValues(values...).Set(s.value)
+		}
+		err := reg.Register(gauge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register %s, %s", name, err)
+		}
+	}
+	return reg, nil
+}
+
+// Flush writes the file now if anything changed since it was last written;
+// the file is replaced in one rename, so node_exporter never reads it half
+// written
+func (t *Textfile) Flush() {
+	t.writing.Lock()
+	defer t.writing.Unlock()
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return
+	}
+	reg, err := t.registry()
+	t.dirty = false
+	t.mu.Unlock()
+	if err == nil {
+		err = prometheus.WriteToTextfile(t.path, prometheus.Gatherers{reg, metrics.Gatherer()})
+	}
+	t.mu.Lock()
+	t.lastErr = err
+	t.mu.Unlock()
+	if err != nil {
+		t.errors.report(fmt.Errorf("failed to write %s, %s", t.path, err))
+	}
+}
+
+// Errors returns the channel of failed writes
+func (t *Textfile) Errors() <-chan error {
+	return t.errors.errors()
+}
+
+// Check reports the error of the last write, if it failed
+func (t *Textfile) Check(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastErr
+}
+
+// Close writes any changes waiting
+func (t *Textfile) Close() {
+	t.mu.Lock()
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.mu.Unlock()
+	t.Flush()
+	t.errors.close()
+}
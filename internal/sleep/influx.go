@@ -0,0 +1,72 @@
+package sleep
+
+import (
+	"context"
+	"fmt"
+	influxAPI "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/schema"
+	"time"
+)
+
+// occupancy is the measurement and fields recording whether each side is in
+// bed, as named by the collector
+const (
+	occupancyMeasurement = "bed_sleeper_state"
+	occupancyField       = "%s_sleeper_is_in_bed"
+)
+
+// Query reads the occupancy samples the collector wrote between start and
+// end, named as in names, through the Flux query API of InfluxDB v2, or v1.8
+// with Flux enabled. Occupancy aggregated over windows counts as in bed when
+// it was for at least half of the window.
+func Query(ctx context.Context, queryAPI influxAPI.QueryAPI, names schema.Names, start, end time.Time) ([]Sample, error) {
+	bedTag := names.Tag("name")
+	fields := make(map[string]string)
+	var filter string
+	for _, side := range []string{Left, Right} {
+		field := names.Field(occupancyMeasurement, fmt.Sprintf(occupancyField, side))
+		fields[field] = side
+		if filter != "" {
+			filter += " or "
+		}
+		filter += fmt.Sprintf("r._field == %q", field)
+	}
+	query := fmt.Sprintf(`from(bucket: %q)
+  |> range(start: time(v: %q), stop: time(v: %q))
+  |> filter(fn: (r) => r._measurement == %q and (%s))
+  |> keep(columns: ["_time", "_field", "_value", %q])`,
+		names.Destination(occupancyMeasurement),
+		start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano),
+		names.Measurement(occupancyMeasurement), filter, bedTag)
+
+	result, err := queryAPI.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query occupancy, %s", err)
+	}
+	defer result.Close()
+	var samples []Sample
+	for result.Next() {
+		record := result.Record()
+		side, ok := fields[record.Field()]
+		if !ok {
+			continue
+		}
+		bed, _ := record.ValueByKey(bedTag).(string)
+		var inBed bool
+		switch v := record.Value().(type) {
+		case int64:
+			inBed = v > 0
+		case float64:
+			inBed = v >= 0.5
+		case bool:
+			inBed = v
+		default:
+			continue
+		}
+		samples = append(samples, Sample{Time: record.Time(), Bed: bed, Side: side, InBed: inBed})
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("failed to read occupancy, %s", result.Err())
+	}
+	return samples, nil
+}
@@ -0,0 +1,113 @@
+// Package sleep turns the bed occupancy the collector records into sleep
+// sessions, the spans of time each side of a bed was in use, for exports to
+// health platforms and calendars.
+package sleep
+
+import (
+	"sort"
+	"time"
+)
+
+// Sides of the bed
+const (
+	Left  = "left"
+	Right = "right"
+)
+
+// DefaultMinDuration and DefaultMergeGap are the usual settings of Sessions,
+// skipping brief visits to the bed and joining across short trips out of it
+const (
+	DefaultMinDuration = 15 * time.Minute
+	DefaultMergeGap    = 15 * time.Minute
+)
+
+// Sample is whether a side of a bed was occupied at a point in time
+type Sample struct {
+	Time  time.Time
+	Bed   string
+	Side  string
+	InBed bool
+}
+
+// Session is a span of time a side of a bed was occupied
+type Session struct {
+	Bed   string
+	Side  string
+	Start time.Time
+	End   time.Time
+}
+
+// Duration is how long the session lasted
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Sessions groups samples, in any order, into the sessions of each side of
+// each bed, ordered by start. A session starts at the first sample in bed
+// and ends at the next sample out of bed, or at the last sample if none
+// follows. Sessions less than mergeGap apart are merged, such as across a
+// trip to the bathroom, and merged sessions shorter than minDuration are
+// left out.
+func Sessions(samples []Sample, minDuration, mergeGap time.Duration) []Session {
+	type side struct{ bed, side string }
+	bySide := make(map[side][]Sample)
+	for _, s := range samples {
+		key := side{s.Bed, s.Side}
+		bySide[key] = append(bySide[key], s)
+	}
+
+	var sessions []Session
+	for key, samples := range bySide {
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].Time.Before(samples[j].Time)
+		})
+		var current *Session
+		var spans []Session
+		for _, s := range samples {
+			switch {
+			case s.InBed && current == nil:
+				current = &Session{Bed: key.bed, Side: key.side, Start: s.Time, End: s.Time}
+			case s.InBed:
+				current.End = s.Time
+			case current != nil:
+				current.End = s.Time
+				spans = append(spans, *current)
+				current = nil
+			}
+		}
+		if current != nil {
+			spans = append(spans, *current)
+		}
+		sessions = append(sessions, merge(spans, minDuration, mergeGap)...)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].Start.Equal(sessions[j].Start) {
+			return sessions[i].Start.Before(sessions[j].Start)
+		}
+		if sessions[i].Bed != sessions[j].Bed {
+			return sessions[i].Bed < sessions[j].Bed
+		}
+		return sessions[i].Side < sessions[j].Side
+	})
+	return sessions
+}
+
+// merge joins consecutive spans less than gap apart and drops the results
+// shorter than minDuration
+func merge(spans []Session, minDuration, gap time.Duration) []Session {
+	var merged []Session
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.Start.Sub(merged[n-1].End) < gap {
+			merged[n-1].End = span.End
+			continue
+		}
+		merged = append(merged, span)
+	}
+	kept := merged[:0]
+	for _, s := range merged {
+		if s.Duration() >= minDuration {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
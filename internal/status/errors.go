@@ -0,0 +1,57 @@
+package status
+
+import (
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// Entry is a logged warning or error
+type Entry struct {
+	Time    time.Time
+	Level   string
+	Message string
+	Fields  string
+}
+
+// RecentErrors is a logrus hook keeping the last warnings and errors logged
+type RecentErrors struct {
+	mu      sync.Mutex
+	size    int
+	entries []Entry
+}
+
+// NewRecentErrors returns a hook keeping the last size warnings and errors
+func NewRecentErrors(size int) *RecentErrors {
+	return &RecentErrors{size: size}
+}
+
+func (h *RecentErrors) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel}
+}
+
+func (h *RecentErrors) Fire(entry *log.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, Entry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  formatPairs(entry.Data),
+	})
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+	return nil
+}
+
+// Entries returns the kept warnings and errors, newest first
+func (h *RecentErrors) Entries() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := make([]Entry, len(h.entries))
+	for i, entry := range h.entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return entries
+}
@@ -0,0 +1,68 @@
+package status
+
+import (
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Latest keeps the most recent point of every series published, where a
+// series is a measurement with a set of tags
+type Latest struct {
+	mu     sync.Mutex
+	points map[string]collector.Point
+}
+
+// NewLatest returns an empty Latest
+func NewLatest() *Latest {
+	return &Latest{points: make(map[string]collector.Point)}
+}
+
+// Write records p as the latest of its series
+func (l *Latest) Write(p collector.Point) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.points[p.Measurement+" "+formatPairs(p.Tags)] = p
+}
+
+// Group is the latest points sharing a set of tags, such as those of a bed
+type Group struct {
+	Tags   string
+	Points []collector.Point
+}
+
+// Groups returns the latest points grouped by their tags, in tag and then
+// measurement order
+func (l *Latest) Groups() []Group {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	byTags := make(map[string][]collector.Point)
+	for _, p := range l.points {
+		tags := formatPairs(p.Tags)
+		byTags[tags] = append(byTags[tags], p)
+	}
+	groups := make([]Group, 0, len(byTags))
+	for tags, points := range byTags {
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].Measurement < points[j].Measurement
+		})
+		groups = append(groups, Group{Tags: tags, Points: points})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Tags < groups[j].Tags
+	})
+	return groups
+}
+
+// formatPairs formats a map as space-separated key=value pairs in key order
+func formatPairs[V any](m map[string]V) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
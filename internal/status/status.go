@@ -0,0 +1,139 @@
+// Package status serves a read-only page summarizing what the collector is
+// doing, for quick checks without opening Grafana.
+package status
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	log "github.com/sirupsen/logrus"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// reportTimeout bounds gathering the report, which checks every sink
+const reportTimeout = 5 * time.Second
+
+// Report is everything shown on the status page
+type Report struct {
+	Version  string
+	Started  time.Time
+	Accounts []Account
+	Sinks    []Sink
+	Latest   []Group
+	Errors   []Entry
+}
+
+// Account is the state of the collector for one SleepIQ account
+type Account struct {
+	Name    string
+	Standby bool
+	Health  collector.Health
+}
+
+// Sink is whether a sink is reachable, with Err set if not
+type Sink struct {
+	Name string
+	Err  error
+}
+
+var page = template.Must(template.New("status").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+	"timestamp": func(t time.Time) string {
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"pairs": formatPairs[interface{}],
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30">
+<title>sleepnumber-stats-collector</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.fields, td.tags { font-family: monospace; }
+.ok { color: #17803d; }
+.bad { color: #b42318; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>sleepnumber-stats-collector</h1>
+<p class="muted">{{.Version}}, started {{ago .Started}}</p>
+
+<h2>Accounts</h2>
+<table>
+<tr><th>Account</th><th>Login</th><th>Last poll</th><th>Interval</th></tr>
+{{- range .Accounts}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{if .Standby}}<span class="muted">standby</span>{{else if .Health.LoggedIn}}<span class="ok">logged in</span>{{else}}<span class="bad">logged out</span>{{end}}</td>
+<td>{{ago .Health.LastPoll}}</td>
+<td>{{.Health.Interval}}</td>
+</tr>
+{{- end}}
+</table>
+
+<h2>Sinks</h2>
+<table>
+<tr><th>Sink</th><th>Status</th></tr>
+{{- range .Sinks}}
+<tr><td>{{.Name}}</td><td>{{if .Err}}<span class="bad">{{.Err}}</span>{{else}}<span class="ok">ok</span>{{end}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Latest values</h2>
+{{- range .Latest}}
+<table>
+<tr><th colspan="3" class="tags">{{if .Tags}}{{.Tags}}{{else}}untagged{{end}}</th></tr>
+{{- range .Points}}
+<tr><td>{{.Measurement}}</td><td class="fields">{{pairs .Fields}}</td><td class="muted">{{ago .Time}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">Nothing collected yet.</p>
+{{- end}}
+
+<h2>Recent errors</h2>
+{{- if .Errors}}
+<table>
+<tr><th>Time</th><th>Level</th><th>Message</th><th>Fields</th></tr>
+{{- range .Errors}}
+<tr><td>{{timestamp .Time}}</td><td>{{.Level}}</td><td>{{.Message}}</td><td class="fields">{{.Fields}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">None since startup.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// Handler serves the status page built from the report returned by report
+func Handler(report func(ctx context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), reportTimeout)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := page.Execute(w, report(ctx))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "status.Handler",
+				"error": err,
+			}).Debug("failed to render status page")
+		}
+	})
+}
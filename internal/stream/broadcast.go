@@ -0,0 +1,68 @@
+// Package stream streams what the collector publishes to HTTP clients as it
+// happens, as Server-Sent Events or over WebSockets.
+package stream
+
+import (
+	"sync"
+)
+
+// clientBuffer is how many messages a client may fall behind by before
+// further messages to it are dropped
+const clientBuffer = 256
+
+// Broadcaster fans messages out to every client listening, dropping those a
+// slow client has no room for rather than holding up the others
+type Broadcaster[T any] struct {
+	mu      sync.Mutex
+	clients map[chan T]struct{}
+	closed  bool
+}
+
+// NewBroadcaster returns a Broadcaster with no clients
+func NewBroadcaster[T any]() *Broadcaster[T] {
+	return &Broadcaster[T]{clients: make(map[chan T]struct{})}
+}
+
+// Send sends msg to every client
+func (b *Broadcaster[T]) Send(msg T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		select {
+		case c <- msg:
+		default:
+		}
+	}
+}
+
+// Listen returns a channel receiving every message sent from now on, closed
+// once the Broadcaster is, and a func to stop listening
+func (b *Broadcaster[T]) Listen() (<-chan T, func()) {
+	c := make(chan T, clientBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return c, func() {}
+	}
+	b.clients[c] = struct{}{}
+	return c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.clients[c]; ok {
+			delete(b.clients, c)
+			close(c)
+		}
+	}
+}
+
+// Close closes every client's channel
+func (b *Broadcaster[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for c := range b.clients {
+		delete(b.clients, c)
+		close(c)
+	}
+}
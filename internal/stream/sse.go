@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"net/http"
+	"time"
+)
+
+// keepAlive is how often an idle stream gets a comment, so proxies don't
+// close it
+const keepAlive = 30 * time.Second
+
+// event is a point as sent in an event
+type event struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Time        time.Time              `json:"time"`
+}
+
+// SSEHandler streams every point sent through points as a Server-Sent Event
+// named point, with the point as JSON. The stream can be narrowed to
+// measurements with ?measurement=, repeated for several, and to one bed with
+// ?bed=, matching the bed name held in the bedTag tag.
+func SSEHandler(points *Broadcaster[collector.Point], bedTag string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		measurements := make(map[string]bool)
+		for _, m := range query["measurement"] {
+			measurements[m] = true
+		}
+		bed := query.Get("bed")
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		err := rc.Flush()
+		if err != nil {
+			return
+		}
+
+		feed, stop := points.Listen()
+		defer stop()
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			case p, ok := <-feed:
+				if !ok {
+					return
+				}
+				if len(measurements) > 0 && !measurements[p.Measurement] || bed != "" && p.Tags[bedTag] != bed {
+					continue
+				}
+				var data []byte
+				data, err = json.Marshal(event{Measurement: p.Measurement, Tags: p.Tags, Fields: p.Fields, Time: p.Time})
+				if err != nil {
+					continue
+				}
+				_, err = fmt.Fprintf(w, "event: point\ndata: %s\n\n", data)
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"time"
+)
+
+const (
+	// writeTimeout is how long a client has to take a message before it is
+	// dropped
+	writeTimeout = 10 * time.Second
+	// pongTimeout is how long a client may go without answering a ping
+	pongTimeout = 2 * keepAlive
+)
+
+// WebSocketHandler upgrades each request to a WebSocket and sends it the
+// latest document, if there is one yet, followed by every document sent
+// through docs, each as a text message. Messages from clients are ignored.
+// Browsers are only let in from the server's own origin unless origin names
+// another one allowed, or is * to allow any.
+func WebSocketHandler(docs *Broadcaster[[]byte], latest func() []byte, origin string) http.Handler {
+	upgrader := websocket.Upgrader{}
+	if origin != "" {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			o := r.Header.Get("Origin")
+			return origin == "*" || o == "" || o == origin
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The upgrader answers failed handshakes itself
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		feed, stop := docs.Listen()
+		defer stop()
+
+		// Reading is needed to see pongs and the client closing
+		closed := make(chan struct{})
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		})
+		go func() {
+			defer close(closed)
+			for {
+				_, _, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+			}
+		}()
+
+		send := func(kind int, data []byte) error {
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			return conn.WriteMessage(kind, data)
+		}
+		if doc := latest(); doc != nil {
+			err = send(websocket.TextMessage, doc)
+		}
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for err == nil {
+			select {
+			case <-r.Context().Done():
+				send(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			case <-closed:
+				return
+			case <-ticker.C:
+				err = send(websocket.PingMessage, nil)
+			case doc, ok := <-feed:
+				if !ok {
+					send(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+					return
+				}
+				err = send(websocket.TextMessage, doc)
+			}
+		}
+	})
+}
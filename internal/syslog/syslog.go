@@ -0,0 +1,229 @@
+// Package syslog sends log entries to a local or remote syslog server as
+// RFC 5424 messages, for home setups that collect logs centrally.
+package syslog
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialTimeout bounds connecting to the syslog server
+const dialTimeout = 5 * time.Second
+
+// facilities maps the facility names to their codes
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// ParseFacility returns the code of the named facility, defaulting to daemon
+func ParseFacility(name string) (int, error) {
+	if name == "" {
+		return facilities["daemon"], nil
+	}
+	facility, ok := facilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %s, must be one of kern, user, mail, daemon, auth, syslog, lpr, news, uucp, cron, authpriv, ftp, or local0 to local7", name)
+	}
+	return facility, nil
+}
+
+// ParseAddress returns the network and address to dial for a syslog address
+// given as udp://host:port, tcp://host:port, or unix:///path; the port
+// defaults to 514
+func ParseAddress(address string) (network, addr string, err error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse syslog address %s, %s", address, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Hostname() == "" {
+			return "", "", fmt.Errorf("syslog address %s has no host", address)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "514"
+		}
+		return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("syslog address %s has no socket path", address)
+		}
+		return "unix", u.Path, nil
+	}
+	return "", "", fmt.Errorf("syslog address %s must start with udp://, tcp://, or unix://", address)
+}
+
+// Hook is a logrus hook sending every entry to a syslog server, connecting
+// again after a failed write
+type Hook struct {
+	network  string
+	addr     string
+	facility int
+	appName  string
+	hostname string
+	pid      string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// New returns a Hook sending to address with the named facility, tagged as
+// coming from appName; it connects on the first entry
+func New(address, facility, appName string) (*Hook, error) {
+	network, addr, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	code, err := ParseFacility(facility)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &Hook{
+		network:  network,
+		addr:     addr,
+		facility: code,
+		appName:  header(appName, 48),
+		hostname: header(hostname, 255),
+		pid:      strconv.Itoa(os.Getpid()),
+	}, nil
+}
+
+func (h *Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *Hook) Fire(entry *log.Entry) error {
+	msg, err := entry.String()
+	if err != nil {
+		return err
+	}
+	return h.send(h.format(entry, strings.TrimRight(msg, "\n")))
+}
+
+// format builds the RFC 5424 message of entry, using its op field, if any,
+// as the message ID
+func (h *Hook) format(entry *log.Entry, msg string) string {
+	msgID := "-"
+	if op, ok := entry.Data["op"].(string); ok {
+		msgID = header(op, 32)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		h.facility*8+severity(entry.Level),
+		entry.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		h.hostname, h.appName, h.pid, msgID, msg)
+}
+
+// send writes msg, framed by its length over TCP, connecting first if not
+// connected and retrying once on a fresh connection
+func (h *Hook) send(msg string) error {
+	if h.network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if h.conn == nil {
+			h.conn, err = h.dial()
+			if err != nil {
+				return fmt.Errorf("failed to connect to syslog at %s, %s", h.addr, err)
+			}
+		}
+		_, err = h.conn.Write([]byte(msg))
+		if err == nil {
+			return nil
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+	return fmt.Errorf("failed to write to syslog at %s, %s", h.addr, err)
+}
+
+// dial connects to the syslog server; local sockets such as /dev/log are
+// usually datagram sockets, so unix tries that first
+func (h *Hook) dial() (net.Conn, error) {
+	if h.network == "unix" {
+		conn, err := net.DialTimeout("unixgram", h.addr, dialTimeout)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return net.DialTimeout(h.network, h.addr, dialTimeout)
+}
+
+// Close closes the connection to the syslog server
+func (h *Hook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
+
+// severity maps a log level to its syslog severity
+func severity(level log.Level) int {
+	switch level {
+	case log.PanicLevel, log.FatalLevel:
+		return 2
+	case log.ErrorLevel:
+		return 3
+	case log.WarnLevel:
+		return 4
+	case log.InfoLevel:
+		return 6
+	}
+	return 7
+}
+
+// header makes value fit a header field of at most max printable ASCII
+// characters without spaces, or "-" if nothing is left
+func header(value string, max int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r > ' ' && r <= '~' {
+			b.WriteRune(r)
+		}
+		if b.Len() == max {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
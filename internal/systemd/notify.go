@@ -0,0 +1,50 @@
+// Package systemd implements the sd_notify protocol so the collector can run
+// as a Type=notify unit with a watchdog.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends state, such as READY=1 or WATCHDOG=1, to systemd. It does
+// nothing and reports false when not running under systemd with
+// NOTIFY_SOCKET set.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading @ names a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to systemd notify socket, %s", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, fmt.Errorf("failed to notify systemd, %s", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often systemd expects WATCHDOG=1, which is
+// half of the unit's WatchdogSec, or zero if the watchdog is not enabled for
+// this process
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
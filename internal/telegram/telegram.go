@@ -0,0 +1,192 @@
+// Package telegram runs a Telegram bot through the Bot API, long polling for
+// messages and answering those from allowed chats.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	apiURL = "https://api.telegram.org/bot"
+	// pollTimeout is how long Telegram holds a request for updates open
+	// waiting for messages
+	pollTimeout    = 50 * time.Second
+	requestTimeout = pollTimeout + 10*time.Second
+	retryInterval  = 10 * time.Second
+)
+
+// Message is a text message sent to the bot
+type Message struct {
+	ChatID int64
+	// Username is the sender's, if they have one
+	Username string
+	Text     string
+}
+
+// Handler answers a message from an allowed chat
+type Handler func(ctx context.Context, msg Message) string
+
+// Bot answers messages sent to the bot with a token
+type Bot struct {
+	token   string
+	allowed map[int64]bool
+	handle  Handler
+	client  *http.Client
+}
+
+// New returns a Bot answering messages from the chats in chatIDs with handle,
+// and ignoring everyone else
+func New(token string, chatIDs []int64, handle Handler) *Bot {
+	allowed := make(map[int64]bool, len(chatIDs))
+	for _, id := range chatIDs {
+		allowed[id] = true
+	}
+	return &Bot{
+		token:   token,
+		allowed: allowed,
+		handle:  handle,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+type update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *message `json:"message"`
+}
+
+type message struct {
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	From *struct {
+		Username string `json:"username"`
+	} `json:"from"`
+	Text string `json:"text"`
+}
+
+type response struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// Run answers messages until ctx is cancelled, retrying when Telegram can't
+// be reached
+func (b *Bot) Run(ctx context.Context) {
+	var offset int64
+	for {
+		updates, err := b.updates(ctx, offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "telegram.Run",
+				"error": err,
+			}).Warn("failed to receive Telegram messages")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message == nil || u.Message.Text == "" {
+				continue
+			}
+			msg := Message{ChatID: u.Message.Chat.ID, Text: u.Message.Text}
+			if u.Message.From != nil {
+				msg.Username = u.Message.From.Username
+			}
+			chat := msg.ChatID
+			if !b.allowed[chat] {
+				log.WithFields(log.Fields{
+					"op":       "telegram.Run",
+					"chat":     chat,
+					"username": msg.Username,
+				}).Warn("ignoring Telegram message from a chat not allowed")
+				continue
+			}
+			reply := b.handle(ctx, msg)
+			err = b.send(ctx, chat, reply)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"op":    "telegram.Run",
+					"chat":  chat,
+					"error": err,
+				}).Warn("failed to answer Telegram message")
+			}
+		}
+	}
+}
+
+// updates waits for the messages after offset
+func (b *Bot) updates(ctx context.Context, offset int64) ([]update, error) {
+	query := url.Values{
+		"timeout":         {strconv.Itoa(int(pollTimeout / time.Second))},
+		"offset":          {strconv.FormatInt(offset, 10)},
+		"allowed_updates": {`["message"]`},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+b.token+"/getUpdates?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var updates []update
+	err = b.call(req, &updates)
+	return updates, err
+}
+
+// send sends text to chat
+func (b *Bot) send(ctx context.Context, chat int64, text string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id": chat,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+b.token+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return b.call(req, nil)
+}
+
+// call sends req and decodes the result of the response into result
+func (b *Bot) call(req *http.Request, result interface{}) error {
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The error includes the URL, and so the token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to reach Telegram, %s", err)
+	}
+	defer resp.Body.Close()
+	var body response
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return fmt.Errorf("failed to decode Telegram response, %s", err)
+	}
+	if !body.OK {
+		return fmt.Errorf("Telegram returned status %d: %s", resp.StatusCode, body.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body.Result, result)
+}
@@ -0,0 +1,87 @@
+// Package tracing exports OpenTelemetry spans of poll cycles, SleepIQ API
+// requests, and sink writes over OTLP, to diagnose latency with a tracing
+// backend such as Jaeger or Tempo.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"net/url"
+	"strings"
+)
+
+const serviceName = "sleepnumber-stats-collector"
+
+// tracesPath is where OTLP/HTTP receivers take traces
+const tracesPath = "/v1/traces"
+
+// provider is set once tracing has started
+var provider *sdktrace.TracerProvider
+
+// Start exports spans to the configured OTLP/HTTP endpoint, making it the
+// tracer provider for every package; it does nothing unless tracing.endpoint
+// is set
+func Start(config *config.Tracing, version string) error {
+	if config.Endpoint == "" {
+		return nil
+	}
+
+	// Endpoints given as just the receiver's address get the usual path
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to parse tracing endpoint %s, %s", config.Endpoint, err)
+	}
+	if strings.Trim(endpoint.Path, "/") == "" {
+		endpoint.Path = tracesPath
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpointURL(endpoint.String()),
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(config.Headers))
+	}
+	proxy, err := config.Proxy.Func()
+	if err != nil {
+		return err
+	}
+	if proxy != nil {
+		opts = append(opts, otlptracehttp.WithProxy(proxy))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP trace exporter, %s", err)
+	}
+
+	ratio := config.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+// Shutdown exports the spans still buffered and stops tracing
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	err := provider.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to export remaining spans, %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package voice
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// Alexa instances of the capabilities of a device
+const (
+	alexaSleepNumber = "SleepNumber.Setting"
+	alexaOccupancy   = "Bed.Occupancy"
+	alexaOccupied    = "Occupancy.Occupied"
+	alexaEmpty       = "Occupancy.Empty"
+)
+
+type alexaRequest struct {
+	Directive struct {
+		Header   alexaHeader `json:"header"`
+		Endpoint struct {
+			Scope      alexaScope `json:"scope"`
+			EndpointID string     `json:"endpointId"`
+		} `json:"endpoint"`
+		Payload struct {
+			Scope                  alexaScope `json:"scope"`
+			RangeValue             *float64   `json:"rangeValue"`
+			RangeValueDelta        float64    `json:"rangeValueDelta"`
+			RangeValueDeltaDefault bool       `json:"rangeValueDeltaDefault"`
+		} `json:"payload"`
+	} `json:"directive"`
+}
+
+type alexaHeader struct {
+	Namespace        string `json:"namespace"`
+	Name             string `json:"name"`
+	Instance         string `json:"instance,omitempty"`
+	PayloadVersion   string `json:"payloadVersion"`
+	MessageID        string `json:"messageId"`
+	CorrelationToken string `json:"correlationToken,omitempty"`
+}
+
+type alexaScope struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+type alexaEvent struct {
+	Header   alexaHeader    `json:"header"`
+	Endpoint *alexaEndpoint `json:"endpoint,omitempty"`
+	Payload  interface{}    `json:"payload"`
+}
+
+type alexaEndpoint struct {
+	EndpointID string `json:"endpointId"`
+}
+
+type alexaProperty struct {
+	Namespace                 string      `json:"namespace"`
+	Instance                  string      `json:"instance"`
+	Name                      string      `json:"name"`
+	Value                     interface{} `json:"value"`
+	TimeOfSample              time.Time   `json:"timeOfSample"`
+	UncertaintyInMilliseconds int64       `json:"uncertaintyInMilliseconds"`
+}
+
+type alexaContext struct {
+	Properties []alexaProperty `json:"properties"`
+}
+
+type alexaResponse struct {
+	Event   alexaEvent    `json:"event"`
+	Context *alexaContext `json:"context,omitempty"`
+}
+
+// AlexaHandler fulfills the directives of an Alexa smart home skill, passed
+// on as they are by the skill's Lambda function; the directive's scope
+// token, or failing that an Authorization bearer token, must be token
+func AlexaHandler(backend Backend, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req alexaRequest
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+		if err != nil {
+			http.Error(w, "invalid directive", http.StatusBadRequest)
+			return
+		}
+		d := req.Directive
+		w.Header().Set("Content-Type", "application/json")
+
+		scope := d.Endpoint.Scope.Token
+		if scope == "" {
+			scope = d.Payload.Scope.Token
+		}
+		if scope == "" {
+			scope = bearerToken(r)
+		}
+		if !tokenMatches(scope, token) {
+			writeAlexa(w, alexaError(d.Header, d.Endpoint.EndpointID, "INVALID_AUTHORIZATION_CREDENTIAL", "the token is not valid", nil))
+			return
+		}
+
+		switch d.Header.Namespace + "." + d.Header.Name {
+		case "Alexa.Discovery.Discover":
+			writeAlexa(w, alexaDiscover(backend.Devices()))
+			return
+		case "Alexa.ReportState", "Alexa.RangeController.SetRangeValue", "Alexa.RangeController.AdjustRangeValue":
+		default:
+			writeAlexa(w, alexaError(d.Header, d.Endpoint.EndpointID, "INVALID_DIRECTIVE", "unsupported directive "+d.Header.Namespace+"."+d.Header.Name, nil))
+			return
+		}
+
+		device, ok := find(backend.Devices(), d.Endpoint.EndpointID)
+		if !ok {
+			writeAlexa(w, alexaError(d.Header, d.Endpoint.EndpointID, "NO_SUCH_ENDPOINT", "no such bed side", nil))
+			return
+		}
+		if d.Header.Name == "ReportState" {
+			writeAlexa(w, alexaState(d.Header, "StateReport", device, device.Time))
+			return
+		}
+
+		if d.Header.Instance != alexaSleepNumber {
+			writeAlexa(w, alexaError(d.Header, device.ID, "INVALID_DIRECTIVE", "unknown instance "+d.Header.Instance, nil))
+			return
+		}
+		number := device.SleepNumber
+		switch {
+		case d.Payload.RangeValue != nil:
+			number = int(*d.Payload.RangeValue)
+		case d.Payload.RangeValueDeltaDefault:
+			number += int(d.Payload.RangeValueDelta) * SleepNumberStep
+		default:
+			number += int(d.Payload.RangeValueDelta)
+		}
+		err = backend.SetSleepNumber(r.Context(), device, number, "alexa")
+		if errors.Is(err, ErrOutOfRange) {
+			writeAlexa(w, alexaError(d.Header, device.ID, "VALUE_OUT_OF_RANGE", err.Error(), map[string]int{
+				"minimumValue": MinSleepNumber,
+				"maximumValue": MaxSleepNumber,
+			}))
+			return
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":     "voice.AlexaHandler",
+				"device": device.ID,
+				"error":  err,
+			}).Warn("failed to set sleep number")
+			writeAlexa(w, alexaError(d.Header, device.ID, "ENDPOINT_UNREACHABLE", err.Error(), nil))
+			return
+		}
+		device.SleepNumber = number
+		writeAlexa(w, alexaState(d.Header, "Response", device, time.Now()))
+	})
+}
+
+// alexaDiscover describes every device to Alexa
+func alexaDiscover(devices []Device) alexaResponse {
+	endpoints := make([]interface{}, 0, len(devices))
+	for _, d := range devices {
+		endpoints = append(endpoints, map[string]interface{}{
+			"endpointId":        d.ID,
+			"manufacturerName":  "Sleep Number",
+			"friendlyName":      d.Name,
+			"description":       "The " + d.Side + " side of " + d.Bed,
+			"displayCategories": []string{"OTHER"},
+			"capabilities": []interface{}{
+				map[string]interface{}{
+					"type":      "AlexaInterface",
+					"interface": "Alexa.RangeController",
+					"instance":  alexaSleepNumber,
+					"version":   "3",
+					"properties": map[string]interface{}{
+						"supported":           []interface{}{map[string]string{"name": "rangeValue"}},
+						"proactivelyReported": false,
+						"retrievable":         true,
+					},
+					"capabilityResources": alexaNames("sleep number"),
+					"configuration": map[string]interface{}{
+						"supportedRange": map[string]int{
+							"minimumValue": MinSleepNumber,
+							"maximumValue": MaxSleepNumber,
+							"precision":    SleepNumberStep,
+						},
+					},
+				},
+				map[string]interface{}{
+					"type":      "AlexaInterface",
+					"interface": "Alexa.ModeController",
+					"instance":  alexaOccupancy,
+					"version":   "3",
+					"properties": map[string]interface{}{
+						"supported":           []interface{}{map[string]string{"name": "mode"}},
+						"proactivelyReported": false,
+						"retrievable":         true,
+						"nonControllable":     true,
+					},
+					"capabilityResources": alexaNames("occupancy"),
+					"configuration": map[string]interface{}{
+						"ordered": false,
+						"supportedModes": []interface{}{
+							map[string]interface{}{"value": alexaOccupied, "modeResources": alexaNames("occupied")},
+							map[string]interface{}{"value": alexaEmpty, "modeResources": alexaNames("empty")},
+						},
+					},
+				},
+				map[string]interface{}{
+					"type":      "AlexaInterface",
+					"interface": "Alexa",
+					"version":   "3",
+				},
+			},
+		})
+	}
+	return alexaResponse{Event: alexaEvent{
+		Header: alexaHeader{
+			Namespace:      "Alexa.Discovery",
+			Name:           "Discover.Response",
+			PayloadVersion: "3",
+			MessageID:      messageID(),
+		},
+		Payload: map[string]interface{}{"endpoints": endpoints},
+	}}
+}
+
+// alexaNames is the friendly name of a capability or mode, in English
+func alexaNames(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"friendlyNames": []interface{}{
+			map[string]interface{}{
+				"@type": "text",
+				"value": map[string]string{"text": name, "locale": "en-US"},
+			},
+		},
+	}
+}
+
+// alexaState answers a directive with the state of d, sampled at sampled
+func alexaState(directive alexaHeader, name string, d Device, sampled time.Time) alexaResponse {
+	occupancy := alexaEmpty
+	if d.Occupied {
+		occupancy = alexaOccupied
+	}
+	return alexaResponse{
+		Event: alexaEvent{
+			Header: alexaHeader{
+				Namespace:        "Alexa",
+				Name:             name,
+				PayloadVersion:   "3",
+				MessageID:        messageID(),
+				CorrelationToken: directive.CorrelationToken,
+			},
+			Endpoint: &alexaEndpoint{EndpointID: d.ID},
+			Payload:  struct{}{},
+		},
+		Context: &alexaContext{Properties: []alexaProperty{
+			{Namespace: "Alexa.RangeController", Instance: alexaSleepNumber, Name: "rangeValue", Value: d.SleepNumber, TimeOfSample: sampled.UTC()},
+			{Namespace: "Alexa.ModeController", Instance: alexaOccupancy, Name: "mode", Value: occupancy, TimeOfSample: d.Time.UTC()},
+		}},
+	}
+}
+
+// alexaError answers a directive with an error of errType; extra fields,
+// such as the valid range, are added to the payload
+func alexaError(directive alexaHeader, endpointID, errType, message string, validRange map[string]int) alexaResponse {
+	payload := map[string]interface{}{
+		"type":    errType,
+		"message": message,
+	}
+	if validRange != nil {
+		payload["validRange"] = validRange
+	}
+	var endpoint *alexaEndpoint
+	if endpointID != "" {
+		endpoint = &alexaEndpoint{EndpointID: endpointID}
+	}
+	return alexaResponse{Event: alexaEvent{
+		Header: alexaHeader{
+			Namespace:        "Alexa",
+			Name:             "ErrorResponse",
+			PayloadVersion:   "3",
+			MessageID:        messageID(),
+			CorrelationToken: directive.CorrelationToken,
+		},
+		Endpoint: endpoint,
+		Payload:  payload,
+	}}
+}
+
+func writeAlexa(w http.ResponseWriter, resp alexaResponse) {
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":    "voice.writeAlexa",
+			"error": err,
+		}).Warn("failed to write Alexa response")
+	}
+}
+
+// messageID is a random ID for an Alexa event
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,194 @@
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Google has no trait for setting an arbitrary number, so the sleep number
+// is presented as brightness, which is set as a percentage by voice
+const (
+	googleOccupancy  = "action.devices.traits.OccupancySensing"
+	googleBrightness = "action.devices.traits.Brightness"
+	googleSetCommand = "action.devices.commands.BrightnessAbsolute"
+	// googleAgentUserID identifies the collector's one user to Google
+	googleAgentUserID = "sleepnumber-stats-collector"
+)
+
+type googleRequest struct {
+	RequestID string `json:"requestId"`
+	Inputs    []struct {
+		Intent  string `json:"intent"`
+		Payload struct {
+			Devices  []googleDevice `json:"devices"`
+			Commands []struct {
+				Devices   []googleDevice `json:"devices"`
+				Execution []struct {
+					Command string `json:"command"`
+					Params  struct {
+						Brightness int `json:"brightness"`
+					} `json:"params"`
+				} `json:"execution"`
+			} `json:"commands"`
+		} `json:"payload"`
+	} `json:"inputs"`
+}
+
+type googleDevice struct {
+	ID string `json:"id"`
+}
+
+type googleResponse struct {
+	RequestID string      `json:"requestId"`
+	Payload   interface{} `json:"payload"`
+}
+
+type googleResult struct {
+	IDs       []string               `json:"ids"`
+	Status    string                 `json:"status"`
+	States    map[string]interface{} `json:"states,omitempty"`
+	ErrorCode string                 `json:"errorCode,omitempty"`
+}
+
+// GoogleHandler fulfills the intents of a Google Home smart home action,
+// whose requests must carry token as their Authorization bearer token
+func GoogleHandler(backend Backend, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !tokenMatches(bearerToken(r), token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req googleRequest
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+		if err != nil || len(req.Inputs) == 0 {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		input := req.Inputs[0]
+		resp := googleResponse{RequestID: req.RequestID}
+
+		switch input.Intent {
+		case "action.devices.SYNC":
+			resp.Payload = googleSync(backend.Devices())
+		case "action.devices.QUERY":
+			devices := backend.Devices()
+			states := make(map[string]interface{})
+			for _, requested := range input.Payload.Devices {
+				d, ok := find(devices, requested.ID)
+				if !ok {
+					states[requested.ID] = map[string]interface{}{"online": false, "status": "ERROR", "errorCode": "deviceNotFound"}
+					continue
+				}
+				state := googleState(d)
+				state["status"] = "SUCCESS"
+				states[d.ID] = state
+			}
+			resp.Payload = map[string]interface{}{"devices": states}
+		case "action.devices.EXECUTE":
+			devices := backend.Devices()
+			var results []googleResult
+			for _, command := range input.Payload.Commands {
+				for _, requested := range command.Devices {
+					for _, execution := range command.Execution {
+						results = append(results, googleExecute(r.Context(), backend, devices, requested.ID, execution.Command, execution.Params.Brightness))
+					}
+				}
+			}
+			resp.Payload = map[string]interface{}{"commands": results}
+		case "action.devices.DISCONNECT":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}\n"))
+			return
+		default:
+			resp.Payload = map[string]interface{}{"errorCode": "notSupported"}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":    "voice.GoogleHandler",
+				"error": err,
+			}).Warn("failed to write Google response")
+		}
+	})
+}
+
+// googleSync describes every device to Google
+func googleSync(devices []Device) map[string]interface{} {
+	described := make([]interface{}, 0, len(devices))
+	for _, d := range devices {
+		described = append(described, map[string]interface{}{
+			"id":     d.ID,
+			"type":   "action.devices.types.SENSOR",
+			"traits": []string{googleOccupancy, googleBrightness},
+			"name": map[string]interface{}{
+				"name":         d.Name,
+				"defaultNames": []string{"Sleep Number " + d.Side + " side"},
+			},
+			"deviceInfo":      map[string]string{"manufacturer": "Sleep Number"},
+			"willReportState": false,
+			"attributes": map[string]interface{}{
+				"occupancySensorConfiguration": []interface{}{
+					map[string]interface{}{"occupancySensorType": "PHYSICAL_CONTACT"},
+				},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"agentUserId": googleAgentUserID,
+		"devices":     described,
+	}
+}
+
+// googleState is the state of d as Google expects it
+func googleState(d Device) map[string]interface{} {
+	occupancy := "UNOCCUPIED"
+	if d.Occupied {
+		occupancy = "OCCUPIED"
+	}
+	return map[string]interface{}{
+		"online":     true,
+		"occupancy":  occupancy,
+		"brightness": d.SleepNumber,
+	}
+}
+
+// googleExecute runs command on the device with id
+func googleExecute(ctx context.Context, backend Backend, devices []Device, id, command string, number int) googleResult {
+	result := googleResult{IDs: []string{id}, Status: "ERROR"}
+	d, ok := find(devices, id)
+	if !ok {
+		result.ErrorCode = "deviceNotFound"
+		return result
+	}
+	if command != googleSetCommand {
+		result.ErrorCode = "functionNotSupported"
+		return result
+	}
+	err := backend.SetSleepNumber(ctx, d, number, "google")
+	if errors.Is(err, ErrOutOfRange) {
+		result.ErrorCode = "valueOutOfRange"
+		return result
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":     "voice.GoogleHandler",
+			"device": d.ID,
+			"error":  err,
+		}).Warn("failed to set sleep number")
+		result.ErrorCode = "deviceOffline"
+		return result
+	}
+	d.SleepNumber = number
+	result.Status = "SUCCESS"
+	result.States = googleState(d)
+	return result
+}
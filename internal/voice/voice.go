@@ -0,0 +1,85 @@
+// Package voice fulfills the requests of Alexa and Google Home smart home
+// skills, presenting each side of a bed as a device whose occupancy can be
+// asked about and whose sleep number can be set.
+package voice
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Device is one side of a bed
+type Device struct {
+	// ID is stable across requests, and Name is what it is called by voice
+	ID   string
+	Name string
+	// Bed is the bed's name, and Side left or right
+	Bed  string
+	Side string
+	// Occupied and SleepNumber are as of Time, the latest poll of the bed
+	Occupied    bool
+	SleepNumber int
+	Time        time.Time
+}
+
+// Backend lists the devices and sets their sleep numbers
+type Backend interface {
+	Devices() []Device
+	// SetSleepNumber returns ErrOutOfRange when number isn't a valid sleep
+	// number
+	SetSleepNumber(ctx context.Context, d Device, number int, client string) error
+}
+
+// ErrOutOfRange is returned for sleep numbers that can't be set
+var ErrOutOfRange = errors.New("sleep number must be a multiple of 5 from 5 to 100")
+
+// Sleep number range, as advertised to assistants
+const (
+	MinSleepNumber  = 5
+	MaxSleepNumber  = 100
+	SleepNumberStep = 5
+)
+
+// DeviceID is the ID of side of the bed named bed of account, using only
+// characters both assistants accept in IDs
+func DeviceID(account, bed, side string) string {
+	id := bed + ":" + side
+	if account != "" {
+		id = account + ":" + id
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune(" _-=#;:?@&", r):
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+// find returns the device with id
+func find(devices []Device, id string) (Device, bool) {
+	for _, d := range devices {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// bearerToken returns the token of the Authorization header of r, if any
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// tokenMatches reports whether got is want, in constant time
+func tokenMatches(got, want string) bool {
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
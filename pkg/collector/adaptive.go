@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"time"
+)
+
+// adaptive reports whether the poll interval follows bed occupancy
+func (c *Collector) adaptive() bool {
+	return c.opts.AdaptiveMin > 0 && c.opts.AdaptiveMax >= c.opts.AdaptiveMin
+}
+
+// adapt returns the next poll interval: AdaptiveMin while anyone is in bed,
+// doubling towards AdaptiveMax for every cycle the beds stay empty
+func (c *Collector) adapt(current time.Duration) time.Duration {
+	if c.occupied || current <= 0 {
+		return c.opts.AdaptiveMin
+	}
+	next := current * 2
+	if next > c.opts.AdaptiveMax {
+		next = c.opts.AdaptiveMax
+	}
+	return next
+}
+
+// anyoneInBed reports whether either side of any of the given beds is
+// occupied
+func anyoneInBed(familyStatusBeds *sleepiq.FamilyStatusResponse, beds []sleepiq.Bed) bool {
+	selected := make(map[string]bool, len(beds))
+	for _, bed := range beds {
+		selected[bed.BedID] = true
+	}
+	for _, bed := range familyStatusBeds.Beds {
+		if !selected[bed.BedID] {
+			continue
+		}
+		if bed.LeftSide.IsInBed || bed.RightSide.IsInBed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Aggregation functions
+const (
+	AggregateMean = "mean"
+	AggregateMin  = "min"
+	AggregateMax  = "max"
+)
+
+// aggregateSink writes one point per window for each series of the given
+// measurements instead of every sample. Each numeric field is written as
+// its mean, minimum, and maximum over the window, as selected by functions,
+// under the field's name with a suffix such as _mean so the types of
+// existing fields never change; other fields keep their last value. A
+// window starts with its first sample and is written, timestamped with that
+// sample, once a sample arrives after it ends, or straight away when one of
+// the event fields changes so such changes show up without delay.
+type aggregateSink struct {
+	next         Sink
+	window       time.Duration
+	measurements map[string]bool
+	functions    []string
+	events       map[string]bool
+
+	mu      sync.Mutex
+	windows map[string]*aggregateWindow
+}
+
+// aggregateWindow accumulates the samples of one series
+type aggregateWindow struct {
+	measurement string
+	tags        map[string]string
+	start       time.Time
+	numeric     map[string]*aggregateField
+	last        map[string]interface{}
+}
+
+type aggregateField struct {
+	sum, min, max float64
+	count         int
+}
+
+func newAggregateSink(next Sink, window time.Duration, measurements, functions, events []string) *aggregateSink {
+	s := &aggregateSink{
+		next:         next,
+		window:       window,
+		measurements: make(map[string]bool, len(measurements)),
+		functions:    functions,
+		events:       make(map[string]bool, len(events)),
+		windows:      make(map[string]*aggregateWindow),
+	}
+	for _, m := range measurements {
+		s.measurements[m] = true
+	}
+	for _, f := range events {
+		s.events[f] = true
+	}
+	if len(s.functions) == 0 {
+		s.functions = []string{AggregateMean}
+	}
+	return s
+}
+
+func (s *aggregateSink) Write(ctx context.Context, p Point) {
+	if !s.measurements[p.Measurement] {
+		s.next.Write(ctx, p)
+		return
+	}
+
+	key := seriesKey(p)
+	s.mu.Lock()
+	w, ok := s.windows[key]
+	var done *aggregateWindow
+	if ok && (!p.Time.Before(w.start.Add(s.window)) || s.eventChanged(w, p)) {
+		done = w
+		ok = false
+	}
+	if !ok {
+		w = &aggregateWindow{
+			measurement: p.Measurement,
+			tags:        p.Tags,
+			start:       p.Time,
+			numeric:     make(map[string]*aggregateField),
+			last:        make(map[string]interface{}),
+		}
+		s.windows[key] = w
+	}
+	w.add(p.Fields, s.events)
+	s.mu.Unlock()
+
+	if done != nil {
+		s.next.Write(ctx, done.point(s.functions))
+	}
+}
+
+// flush writes every open window, such as when collection stops
+func (s *aggregateSink) flush(ctx context.Context) {
+	s.mu.Lock()
+	windows := s.windows
+	s.windows = make(map[string]*aggregateWindow)
+	s.mu.Unlock()
+
+	for _, w := range windows {
+		s.next.Write(ctx, w.point(s.functions))
+	}
+}
+
+// eventChanged reports whether p changes one of the event fields of w
+func (s *aggregateSink) eventChanged(w *aggregateWindow, p Point) bool {
+	for name := range s.events {
+		v, ok := p.Fields[name]
+		if !ok {
+			continue
+		}
+		if last, seen := w.last[name]; seen && !reflect.DeepEqual(last, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// add accumulates the fields of a sample; event fields and those that
+// aren't numbers keep their last value
+func (w *aggregateWindow) add(fields map[string]interface{}, events map[string]bool) {
+	for name, v := range fields {
+		f, ok := toFloat(v)
+		if !ok || events[name] {
+			w.last[name] = v
+			continue
+		}
+		agg, seen := w.numeric[name]
+		if !seen {
+			w.numeric[name] = &aggregateField{sum: f, min: f, max: f, count: 1}
+			continue
+		}
+		agg.sum += f
+		agg.min = min(agg.min, f)
+		agg.max = max(agg.max, f)
+		agg.count++
+	}
+}
+
+// point is the aggregate of the window
+func (w *aggregateWindow) point(functions []string) Point {
+	fields := make(map[string]interface{}, len(w.numeric)*len(functions)+len(w.last))
+	for name, v := range w.last {
+		fields[name] = v
+	}
+	for name, agg := range w.numeric {
+		for _, function := range functions {
+			switch function {
+			case AggregateMean:
+				fields[name+"_mean"] = agg.sum / float64(agg.count)
+			case AggregateMin:
+				fields[name+"_min"] = agg.min
+			case AggregateMax:
+				fields[name+"_max"] = agg.max
+			}
+		}
+	}
+	return Point{
+		Measurement: w.measurement,
+		Tags:        w.tags,
+		Fields:      fields,
+		Time:        w.start,
+	}
+}
+
+// toFloat converts numeric field values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
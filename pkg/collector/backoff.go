@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	log "github.com/sirupsen/logrus"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultLoginRetryMin = 5 * time.Second
+	defaultLoginRetryMax = 5 * time.Minute
+)
+
+// loginWithBackoff retries Login with exponential backoff and jitter until it
+// succeeds, ctx is cancelled, or the error is one retrying can't fix
+func (c *Collector) loginWithBackoff(ctx context.Context) error {
+	delay := c.opts.LoginRetryMin
+	if delay <= 0 {
+		delay = defaultLoginRetryMin
+	}
+	maxDelay := c.opts.LoginRetryMax
+	if maxDelay <= 0 {
+		maxDelay = defaultLoginRetryMax
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.login(ctx)
+		c.beat(time.Now())
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if sleepiq.Classify(err) == sleepiq.ClassFatal {
+			return err
+		}
+
+		// Wait somewhere between half and all of the current delay so
+		// restarted instances don't retry in lockstep
+		wait := delay/2 + rand.N(delay/2+1)
+		log.WithFields(log.Fields{
+			"op":       "collector.loginWithBackoff",
+			"attempt":  attempt,
+			"retry_in": wait.String(),
+			"class":    sleepiq.Classify(err).String(),
+			"error":    err,
+		}).Warn("failed to log into SleepIQ account, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
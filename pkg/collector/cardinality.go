@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+)
+
+// KeyTags tell apart the points of different beds, accounts, and sides of a
+// bed; everything reading points back keys them by these, so they are never
+// dropped or written as fields
+var KeyTags = []string{"name", "account", "side"}
+
+// cardinalitySink keeps series cardinality down by dropping some tags and
+// writing others as fields, such as a bed's model, which never tell its
+// series apart but each add to the series index
+type cardinalitySink struct {
+	next     Sink
+	drop     map[string]bool
+	toFields map[string]bool
+}
+
+func newCardinalitySink(next Sink, drop, toFields []string) *cardinalitySink {
+	s := &cardinalitySink{
+		next:     next,
+		drop:     make(map[string]bool, len(drop)),
+		toFields: make(map[string]bool, len(toFields)),
+	}
+	for _, tag := range drop {
+		s.drop[tag] = true
+	}
+	for _, tag := range toFields {
+		s.toFields[tag] = true
+	}
+	for _, tag := range KeyTags {
+		delete(s.drop, tag)
+		delete(s.toFields, tag)
+	}
+	return s
+}
+
+func (s *cardinalitySink) Write(ctx context.Context, p Point) {
+	affected := false
+	for k := range p.Tags {
+		if s.drop[k] || s.toFields[k] {
+			affected = true
+			break
+		}
+	}
+	if !affected {
+		s.next.Write(ctx, p)
+		return
+	}
+
+	tags := make(map[string]string, len(p.Tags))
+	fields := make(map[string]interface{}, len(p.Fields)+len(s.toFields))
+	for k, v := range p.Fields {
+		fields[k] = v
+	}
+	for k, v := range p.Tags {
+		switch {
+		case s.drop[k]:
+		case s.toFields[k]:
+			// A field of the same name wins
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		default:
+			tags[k] = v
+		}
+	}
+	p.Tags = tags
+	p.Fields = fields
+	s.next.Write(ctx, p)
+}
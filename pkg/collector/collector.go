@@ -0,0 +1,556 @@
+// Package collector polls the SleepIQ API for bed state and hands each sample
+// to a caller-supplied Sink.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"sync"
+	"time"
+)
+
+// Options configures a Collector
+type Options struct {
+	Username     string
+	Password     string
+	PollInterval time.Duration
+
+	// Account, when set, is added to every point as the "account" tag so
+	// several collectors can share sinks
+	Account string
+
+	// Tags are added to every point, such as location=master_bedroom to tell
+	// sites apart; tags set by the collector itself take precedence
+	Tags map[string]string
+
+	// RenameMeasurements renames measurements, such as bed_sleeper_state to
+	// occupancy
+	RenameMeasurements map[string]string
+
+	// RenameTags renames tag keys, including the account tag and those in
+	// Tags, such as name to bed_name to avoid clashing with other tags
+	RenameTags map[string]string
+
+	// RenameFields renames fields in every measurement, such as
+	// left_sleeper_is_in_bed to occupied_left to match other sensors
+	RenameFields map[string]string
+
+	// Intervals overrides PollInterval for individual endpoints
+	Intervals map[Endpoint]time.Duration
+
+	// Schedule, when set, decides when poll cycles start instead of
+	// PollInterval; endpoints with an entry in Intervals are still skipped
+	// until it has elapsed
+	Schedule Schedule
+
+	// AdaptiveMin and AdaptiveMax, when both set, replace PollInterval with
+	// an interval of AdaptiveMin while anyone is in bed that backs off
+	// towards AdaptiveMax while the beds are empty
+	AdaptiveMin time.Duration
+	AdaptiveMax time.Duration
+
+	// LoginRetryMin and LoginRetryMax bound the exponential backoff used
+	// when logging back in after a session expires; they default to 5s and
+	// 5m
+	LoginRetryMin time.Duration
+	LoginRetryMax time.Duration
+
+	// SessionLifetime is how long a SleepIQ session is trusted before the
+	// collector proactively logs in again; zero disables proactive refresh
+	SessionLifetime time.Duration
+
+	// DeltaMode writes a point only when one of its fields changed since the
+	// last write of the same series, or once DeltaHeartbeat has elapsed
+	DeltaMode      bool
+	DeltaHeartbeat time.Duration
+
+	// DedupMeasurements lists measurements whose consecutive identical
+	// points are dropped, whether or not DeltaMode is enabled
+	DedupMeasurements []string
+
+	// AggregateWindow, when set, writes one point per window for each series
+	// of AggregateMeasurements instead of every sample, with the
+	// AggregateFunctions, mean by default, of each numeric field;
+	// AggregateEvents lists fields whose changes end a window early
+	AggregateWindow       time.Duration
+	AggregateMeasurements []string
+	AggregateFunctions    []string
+	AggregateEvents       []string
+
+	// DropMeasurements lists measurements that are never written, and
+	// DropFields lists fields to leave out of each measurement; disabling a
+	// measurement's collector instead also saves its API calls
+	DropMeasurements []string
+	DropFields       map[string][]string
+
+	// DropTags lists tags left off every point, and TagsAsFields tags written
+	// as fields instead, to keep series cardinality down; they apply to those
+	// in Tags too, by their names before renaming, but never to KeyTags
+	DropTags     []string
+	TagsAsFields []string
+
+	// API configures the SleepIQ client, including its circuit breaker
+	API sleepiq.Options
+
+	// BedConcurrency bounds how many beds are polled in parallel; values
+	// below 1 poll serially
+	BedConcurrency int
+
+	// BedsRefresh is how long the list of beds, with their names, sizes,
+	// and models, is reused before querying it again; it is also queried
+	// again after a failed poll cycle. Zero queries it every cycle.
+	BedsRefresh time.Duration
+
+	// Collectors selects the measurements gathered for each bed; nil uses
+	// DefaultCollectors
+	Collectors []BedCollector
+
+	// Beds restricts collection to some of the account's beds, which also
+	// saves the API calls for the others
+	Beds BedFilter
+
+	// StateStore, when set, persists poll progress, firmware versions, and
+	// the last sleep sessions written so a restart picks up where the last
+	// run left off
+	StateStore StateStore
+
+	// PersistSession also keeps the SleepIQ session in StateStore so a
+	// restart resumes it instead of logging in again
+	PersistSession bool
+
+	// Observer, when set, is told about every poll cycle and login
+	Observer Observer
+
+	// RecordRequests writes a sleepiq_api_request point for every SleepIQ
+	// API request with its endpoint, duration, HTTP status, and outcome
+	RecordRequests bool
+}
+
+// Collector polls SleepIQ for bed state and writes it to a Sink
+type Collector struct {
+	opts       Options
+	siq        *sleepiq.Client
+	sink       Sink
+	collectors []BedCollector
+	nextPoll   [numEndpoints]time.Time
+	occupied   bool
+	state      *State
+	// sleepSessions records the sleep sessions written in state
+	sleepSessions *SleepSessionLog
+	health        health
+	requests      requestLog
+	aggregate     *aggregateSink
+
+	// beds is the last list of beds queried, at bedsQueried
+	beds        *sleepiq.BedsResponse
+	bedsQueried time.Time
+
+	// tags are added to every point, and bedTags holds each bed's tags
+	// along with them, by bed ID, until the beds are queried again
+	tags    map[string]string
+	bedTags map[string]map[string]string
+	// tagCache holds the tags collectors add to bedTags, reset with them
+	tagCache *tagCache
+
+	reloadMu sync.Mutex
+	pending  *Options
+	reloaded chan struct{}
+}
+
+func BoolToInt(val bool) int8 {
+	retVal := int8(0)
+	if val {
+		retVal = 1
+	}
+	return retVal
+}
+
+// New returns a Collector writing to the given Sink
+func New(opts Options, sink Sink) *Collector {
+	if len(opts.RenameMeasurements) > 0 || len(opts.RenameTags) > 0 || len(opts.RenameFields) > 0 {
+		sink = &renameSink{
+			next:         sink,
+			measurements: opts.RenameMeasurements,
+			tags:         opts.RenameTags,
+			fields:       opts.RenameFields,
+		}
+	}
+	if len(opts.DropTags) > 0 || len(opts.TagsAsFields) > 0 {
+		sink = newCardinalitySink(sink, opts.DropTags, opts.TagsAsFields)
+	}
+	tags := make(map[string]string, len(opts.Tags)+1)
+	for k, v := range opts.Tags {
+		tags[k] = v
+	}
+	if opts.Account != "" {
+		tags["account"] = opts.Account
+	}
+	if len(tags) > 0 {
+		sink = &tagSink{
+			next: sink,
+			tags: tags,
+		}
+	}
+	if len(opts.DedupMeasurements) > 0 {
+		sink = newDedupSink(sink, opts.DedupMeasurements)
+	}
+	if opts.DeltaMode {
+		sink = newDeltaSink(sink, opts.DeltaHeartbeat)
+	}
+	var aggregate *aggregateSink
+	if opts.AggregateWindow > 0 && len(opts.AggregateMeasurements) > 0 {
+		aggregate = newAggregateSink(sink, opts.AggregateWindow, opts.AggregateMeasurements, opts.AggregateFunctions, opts.AggregateEvents)
+		sink = aggregate
+	}
+	// Filter first so aggregation, delta, and dedup only see the fields kept
+	if len(opts.DropMeasurements) > 0 || len(opts.DropFields) > 0 {
+		sink = newFilterSink(sink, opts.DropMeasurements, opts.DropFields)
+	}
+	collectors := opts.Collectors
+	if collectors == nil {
+		collectors = DefaultCollectors()
+	}
+	c := &Collector{
+		opts:       opts,
+		sink:       sink,
+		collectors: collectors,
+		tags:       tags,
+		bedTags:    make(map[string]map[string]string),
+		tagCache:   newTagCache(),
+		aggregate:  aggregate,
+		reloaded:   make(chan struct{}, 1),
+	}
+	api := opts.API
+	api.Observe = func(endpoint string, elapsed time.Duration, err error) {
+		if opts.API.Observe != nil {
+			opts.API.Observe(endpoint, elapsed, err)
+		}
+		c.observeRequest(endpoint, elapsed, err)
+	}
+	c.siq = sleepiq.New(api)
+	c.requests.setEnabled(opts.RecordRequests)
+	c.loadState()
+	c.sleepSessions = &SleepSessionLog{state: c.state}
+	return c
+}
+
+// Client returns the SleepIQ client the collector polls through, logged into
+// its account once Login succeeds, for sharing its session rather than
+// logging in again; it is safe for concurrent use
+func (c *Collector) Client() *sleepiq.Client {
+	return c.siq
+}
+
+// Login resumes the persisted session if PersistSession is set and SleepIQ
+// still accepts it, and otherwise logs into the configured account
+func (c *Collector) Login(ctx context.Context) error {
+	if c.resumeSession(ctx) {
+		c.setLoggedIn(true)
+		return nil
+	}
+	return c.login(ctx)
+}
+
+// login starts a new session, persisting it if PersistSession is set
+func (c *Collector) login(ctx context.Context) error {
+	err := c.siq.Login(ctx, c.opts.Username, c.opts.Password)
+	c.setLoggedIn(err == nil)
+	c.setLastError(err)
+	c.observeLogin(err)
+	if err != nil {
+		return err
+	}
+	if c.opts.PersistSession {
+		c.state.Session = c.siq.Session()
+		c.persistState()
+	}
+	return nil
+}
+
+// Run polls each endpoint at its interval until ctx is cancelled, returning
+// nil, or until logging back in fails with an error retrying can't fix
+func (c *Collector) Run(ctx context.Context) error {
+	c.beat(time.Now())
+	defer c.beat(time.Time{})
+	defer c.flushAggregates(ctx)
+	tick := c.tick()
+	for {
+
+		pollStartTime := time.Now()
+
+		if c.sessionExpiring(tick) {
+			log.WithFields(log.Fields{
+				"op":          "collector.Run",
+				"session_age": c.siq.SessionAge().String(),
+			}).Info("refreshing login before session expiry")
+			err := c.loginWithBackoff(ctx)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		due := c.due(pollStartTime)
+		pollCtx, span := c.startPollSpan(ctx, due)
+		err := c.poll(pollCtx, due)
+		endSpan(span, err)
+		if ctx.Err() != nil {
+			return nil
+		}
+		c.observePoll(time.Since(pollStartTime), err)
+		c.setLastError(err)
+		log.WithFields(log.Fields{
+			"op":        "collector.Run",
+			"account":   c.opts.Account,
+			"endpoints": due.String(),
+			"elapsed":   time.Since(pollStartTime).String(),
+		}).Debug("finished poll cycle")
+		c.writeAPIState(ctx, pollStartTime)
+		c.writeRequests(ctx)
+		if err == nil {
+			c.setPolled(pollStartTime)
+			c.schedule(pollStartTime, due)
+			c.saveState(pollStartTime, due)
+		} else {
+			err = c.handlePollError(ctx, err)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.adaptive() {
+			tick = c.adapt(tick)
+		}
+		timeRemaining := tick - time.Since(pollStartTime)
+		if c.opts.Schedule != nil {
+			timeRemaining = time.Until(c.opts.Schedule.Next(time.Now()))
+		}
+		c.setInterval(time.Since(pollStartTime) + timeRemaining)
+		c.beat(time.Now())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.reloaded:
+			if c.applyReload() {
+				log.WithFields(log.Fields{
+					"op":      "collector.Run",
+					"account": c.opts.Account,
+				}).Info("logging in again with the changed password")
+				err := c.loginWithBackoff(ctx)
+				if ctx.Err() != nil {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+			tick = c.tick()
+		case <-time.After(timeRemaining):
+		}
+
+	}
+}
+
+// handlePollError logs a failed poll cycle and takes the recovery action for its
+// error class: auth errors log in again, while retryable and fatal errors
+// are left for the next cycle since a single bad response shouldn't stop
+// collection
+func (c *Collector) handlePollError(ctx context.Context, err error) error {
+	class := sleepiq.Classify(err)
+	entry := log.WithFields(log.Fields{
+		"op":    "collector.Run",
+		"class": class.String(),
+		"error": err,
+	})
+
+	switch class {
+	case sleepiq.ClassAuth:
+		c.setLoggedIn(false)
+		entry.Info("refreshing login due to invalid session")
+		return c.loginWithBackoff(ctx)
+	case sleepiq.ClassRetryable:
+		entry.Warn("failed to poll SleepIQ, retrying next cycle")
+	default:
+		entry.Error("failed to poll SleepIQ")
+	}
+	return nil
+}
+
+// sessionExpiring reports whether the session could expire before the next
+// poll cycle completes, allowing a minute of slack for the cycle itself
+func (c *Collector) sessionExpiring(tick time.Duration) bool {
+	if c.opts.SessionLifetime <= 0 {
+		return false
+	}
+	return c.siq.SessionAge()+tick+time.Minute >= c.opts.SessionLifetime
+}
+
+// Poll queries every endpoint of every bed once and writes the results,
+// saving the state if it succeeds so a run of one cycle at a time, such as
+// from cron, resumes where the last left off
+func (c *Collector) Poll(ctx context.Context) error {
+	start := time.Now()
+	pollCtx, span := c.startPollSpan(ctx, allEndpoints())
+	err := c.poll(pollCtx, allEndpoints())
+	endSpan(span, err)
+	if err == nil {
+		c.saveState(start, allEndpoints())
+	}
+	c.writeRequests(ctx)
+	c.flushAggregates(ctx)
+	return err
+}
+
+// flushAggregates writes the aggregation windows still open, even once ctx
+// is cancelled so stopping doesn't lose their samples
+func (c *Collector) flushAggregates(ctx context.Context) {
+	if c.aggregate != nil {
+		c.aggregate.flush(context.WithoutCancel(ctx))
+	}
+}
+
+func (c *Collector) poll(ctx context.Context, endpoints endpointSet) (err error) {
+	// Query the beds afresh after a failure, in case it was due to a change
+	defer func() {
+		if err != nil {
+			c.beds = nil
+		}
+	}()
+
+	// Query all beds, unless queried recently and their firmware versions
+	// aren't due to be checked
+	if endpoints[EndpointFirmware] {
+		c.beds = nil
+	}
+	beds, err := c.queryBeds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query beds, %w", err)
+	}
+	selected := c.opts.Beds.filterBeds(beds.Beds)
+	if endpoints[EndpointFirmware] {
+		c.trackFirmware(selected)
+	}
+
+	// Query all beds via family status
+	var familyStatusBeds *sleepiq.FamilyStatusResponse
+	var tsFamilyStatus time.Time
+	if endpoints[EndpointFamilyStatus] {
+		familyStatusBeds, err = c.siq.FamilyStatus(ctx)
+		tsFamilyStatus = time.Now()
+		if err != nil {
+			return fmt.Errorf("failed to query family status beds, %w", err)
+		}
+		c.occupied = anyoneInBed(familyStatusBeds, selected)
+	}
+
+	// Poll beds in parallel, bounded by BedConcurrency
+	concurrency := c.opts.BedConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// Every bed's error is kept rather than just the first so Classify sees
+	// them all
+	errs := make([]error, len(selected))
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for i, bed := range selected {
+		tags := c.tagsOf(bed)
+		g.Go(func() error {
+			errs[i] = c.pollBed(ctx, endpoints, bed, tags, familyStatusBeds, tsFamilyStatus)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return errors.Join(errs...)
+}
+
+// queryBeds returns the beds on the account, reusing the last list until
+// BedsRefresh has elapsed since it was queried
+func (c *Collector) queryBeds(ctx context.Context) (*sleepiq.BedsResponse, error) {
+	if c.beds != nil && time.Since(c.bedsQueried) < c.opts.BedsRefresh {
+		return c.beds, nil
+	}
+	beds, err := c.siq.Beds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.beds = beds
+	c.bedsQueried = time.Now()
+	clear(c.bedTags)
+	c.tagCache.reset()
+	return beds, nil
+}
+
+// tagsOf returns the tags of every point of bed, built once per bed and
+// shared by its points rather than built for each; points are never
+// modified once written, so sharing them is safe
+func (c *Collector) tagsOf(bed sleepiq.Bed) map[string]string {
+	if tags, ok := c.bedTags[bed.BedID]; ok {
+		return tags
+	}
+	bt := bedTags(bed)
+	tags := make(map[string]string, len(c.tags)+len(bt))
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+	for k, v := range bt {
+		tags[k] = v
+	}
+	c.bedTags[bed.BedID] = tags
+	return tags
+}
+
+// pollBed runs every enabled collector that is due against a single bed,
+// all at once so the cycle takes as long as the slowest endpoint and its
+// points are timestamped close together; a failing collector doesn't prevent
+// the others from writing
+func (c *Collector) pollBed(ctx context.Context, endpoints endpointSet, bed sleepiq.Bed, tags map[string]string, familyStatusBeds *sleepiq.FamilyStatusResponse, tsFamilyStatus time.Time) error {
+	req := Request{
+		Client:           c.siq,
+		Bed:              bed,
+		Tags:             tags,
+		FamilyStatus:     familyStatusBeds,
+		FamilyStatusTime: tsFamilyStatus,
+		SleepSessions:    c.sleepSessions,
+		tagCache:         c.tagCache,
+	}
+
+	errs := make([]error, len(c.collectors))
+	var g errgroup.Group
+	for i, bc := range c.collectors {
+		if !endpoints[bc.Endpoint()] {
+			continue
+		}
+		g.Go(func() error {
+			errs[i] = bc.Collect(ctx, req, c.sink)
+			return nil
+		})
+	}
+	g.Wait()
+	return errors.Join(errs...)
+}
+
+// writeAPIState records whether the SleepIQ circuit breaker is open so
+// outages show up as data rather than only as gaps
+func (c *Collector) writeAPIState(ctx context.Context, ts time.Time) {
+	degraded, failures := c.siq.Degraded()
+	c.sink.Write(ctx, Point{
+		Measurement: "sleepiq_api_state",
+		Tags:        map[string]string{},
+		Fields: map[string]interface{}{
+			"degraded":             BoolToInt(degraded),
+			"consecutive_failures": failures,
+		},
+		Time: ts,
+	})
+}
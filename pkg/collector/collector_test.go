@@ -0,0 +1,519 @@
+package collector_test
+
+import (
+	"context"
+	"errors"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/collector"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq/sleepiqtest"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testUsername = "sleeper@example.com"
+	testPassword = "secret"
+)
+
+// recorder is a collector.Sink keeping every point written to it
+type recorder struct {
+	mu     sync.Mutex
+	points []collector.Point
+}
+
+func (r *recorder) Write(ctx context.Context, p collector.Point) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points = append(r.points, p)
+}
+
+// byMeasurement returns the points written of measurement
+func (r *recorder) byMeasurement(measurement string) []collector.Point {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var points []collector.Point
+	for _, p := range r.points {
+		if p.Measurement == measurement {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// measurements returns the distinct measurements written, sorted
+func (r *recorder) measurements() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, p := range r.points {
+		if !seen[p.Measurement] {
+			seen[p.Measurement] = true
+			names = append(names, p.Measurement)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newCollector returns a Collector logged into a mock SleepIQ server with
+// opts, writing to a new recorder
+func newCollector(t *testing.T, server *sleepiqtest.Server, opts collector.Options) (*collector.Collector, *recorder) {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	opts.Username = testUsername
+	opts.Password = testPassword
+	opts.API = sleepiq.Options{BaseURL: httpServer.URL + sleepiqtest.BasePath, RateLimit: -1}
+	sink := &recorder{}
+	c := collector.New(opts, sink)
+	err := c.Login(context.Background())
+	if err != nil {
+		t.Fatalf("failed to log in, %s", err)
+	}
+	return c, sink
+}
+
+// testLocation is the time zone of the mock server's beds
+func testLocation() *time.Location {
+	loc, err := time.LoadLocation("US/Central")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// testSession returns a sleep session scored 75 that started at the start
+// hour of the day day days from today, in the beds' time zone, and ended at
+// the end hour of the next day
+func testSession(day, start, end int, finalized bool) sleepiq.SleepSession {
+	now := time.Now().In(testLocation())
+	date := time.Date(now.Year(), now.Month(), now.Day()+day, 0, 0, 0, 0, now.Location())
+	return sleepiq.SleepSession{
+		StartDate:     date.Add(time.Duration(start) * time.Hour).Format(sleepiq.SleepDateLayout),
+		EndDate:       date.AddDate(0, 0, 1).Add(time.Duration(end) * time.Hour).Format(sleepiq.SleepDateLayout),
+		IsFinalized:   finalized,
+		SleepQuotient: 75,
+	}
+}
+
+func TestPoll(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  collector.Options
+		inBed bool
+		// setup, if set, prepares the mock server before polling
+		setup func(t *testing.T, server *sleepiqtest.Server)
+		// polls is the number of poll cycles run; defaults to 1
+		polls int
+		check func(t *testing.T, sink *recorder)
+	}{
+		{
+			name: "default collectors",
+			check: func(t *testing.T, sink *recorder) {
+				want := []string{"bed_footwarmers_state", "bed_foundation_state", "bed_sleeper_state"}
+				got := sink.measurements()
+				if len(got) != len(want) {
+					t.Fatalf("got measurements %v, want %v", got, want)
+				}
+				for i := range want {
+					if got[i] != want[i] {
+						t.Fatalf("got measurements %v, want %v", got, want)
+					}
+				}
+			},
+		},
+		{
+			name:  "sleeper in bed",
+			inBed: true,
+			check: func(t *testing.T, sink *recorder) {
+				points := sink.byMeasurement("bed_sleeper_state")
+				if len(points) != 1 {
+					t.Fatalf("got %d bed_sleeper_state points, want 1", len(points))
+				}
+				p := points[0]
+				if p.Tags["name"] != "Bed" {
+					t.Errorf("got name tag %q, want Bed", p.Tags["name"])
+				}
+				if v := p.Fields["left_sleeper_is_in_bed"]; v != int8(1) {
+					t.Errorf("got left_sleeper_is_in_bed %v, want 1", v)
+				}
+				if v := p.Fields["right_sleeper_is_in_bed"]; v != int8(0) {
+					t.Errorf("got right_sleeper_is_in_bed %v, want 0", v)
+				}
+			},
+		},
+		{
+			name: "account and extra tags",
+			opts: collector.Options{
+				Account: "home",
+				Tags:    map[string]string{"location": "upstairs", "name": "ignored"},
+			},
+			check: func(t *testing.T, sink *recorder) {
+				points := sink.byMeasurement("bed_sleeper_state")
+				if len(points) == 0 {
+					t.Fatal("got no bed_sleeper_state points")
+				}
+				for _, p := range points {
+					if p.Tags["account"] != "home" {
+						t.Errorf("got account tag %q, want home", p.Tags["account"])
+					}
+					if p.Tags["location"] != "upstairs" {
+						t.Errorf("got location tag %q, want upstairs", p.Tags["location"])
+					}
+					if p.Tags["name"] != "Bed" {
+						t.Errorf("got name tag %q, want the collector's own Bed", p.Tags["name"])
+					}
+				}
+			},
+		},
+		{
+			name: "renames",
+			opts: collector.Options{
+				RenameMeasurements: map[string]string{"bed_sleeper_state": "occupancy"},
+				RenameTags:         map[string]string{"name": "bed"},
+				RenameFields:       map[string]string{"left_sleeper_is_in_bed": "occupied_left"},
+			},
+			check: func(t *testing.T, sink *recorder) {
+				if n := len(sink.byMeasurement("bed_sleeper_state")); n != 0 {
+					t.Errorf("got %d points under the old measurement name, want 0", n)
+				}
+				points := sink.byMeasurement("occupancy")
+				if len(points) != 1 {
+					t.Fatalf("got %d occupancy points, want 1", len(points))
+				}
+				p := points[0]
+				if p.Tags["bed"] != "Bed" {
+					t.Errorf("got bed tag %q, want Bed", p.Tags["bed"])
+				}
+				if _, ok := p.Fields["occupied_left"]; !ok {
+					t.Errorf("got fields %v, want occupied_left", p.Fields)
+				}
+			},
+		},
+		{
+			name: "dropped measurements and fields",
+			opts: collector.Options{
+				DropMeasurements: []string{"bed_footwarmers_state"},
+				DropFields:       map[string][]string{"bed_sleeper_state": {"left_sleep_number"}},
+			},
+			check: func(t *testing.T, sink *recorder) {
+				if n := len(sink.byMeasurement("bed_footwarmers_state")); n != 0 {
+					t.Errorf("got %d bed_footwarmers_state points, want 0", n)
+				}
+				points := sink.byMeasurement("bed_sleeper_state")
+				if len(points) == 0 {
+					t.Fatal("got no bed_sleeper_state points")
+				}
+				for _, p := range points {
+					if _, ok := p.Fields["left_sleep_number"]; ok {
+						t.Errorf("got left_sleep_number, want it dropped")
+					}
+					if _, ok := p.Fields["right_sleep_number"]; !ok {
+						t.Errorf("got fields %v, want right_sleep_number kept", p.Fields)
+					}
+				}
+			},
+		},
+		{
+			name: "light collector",
+			opts: collector.Options{Collectors: []collector.BedCollector{collector.LightCollector{}}},
+			check: func(t *testing.T, sink *recorder) {
+				if got := sink.measurements(); len(got) != 1 || got[0] != "bed_light_state" {
+					t.Fatalf("got measurements %v, want only bed_light_state", got)
+				}
+				p := sink.byMeasurement("bed_light_state")[0]
+				for _, field := range []string{"left_underbed_light", "right_underbed_light"} {
+					if v := p.Fields[field]; v != int8(0) {
+						t.Errorf("got %s %v, want 0", field, v)
+					}
+				}
+			},
+		},
+		{
+			name: "climate collector",
+			opts: collector.Options{Collectors: []collector.BedCollector{collector.ClimateCollector{}}},
+			setup: func(t *testing.T, server *sleepiqtest.Server) {
+				err := server.SetClimate("Bed", "left", sleepiq.ClimateHeatingMed, 120)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, sink *recorder) {
+				if got := sink.measurements(); len(got) != 1 || got[0] != "bed_climate_state" {
+					t.Fatalf("got measurements %v, want only bed_climate_state", got)
+				}
+				p := sink.byMeasurement("bed_climate_state")[0]
+				want := map[string]interface{}{
+					"left_climate_setting":  sleepiq.ClimateHeatingMed,
+					"right_climate_setting": sleepiq.ClimateOff,
+					"left_climate_timer":    120,
+					"right_climate_timer":   0,
+				}
+				if !reflect.DeepEqual(p.Fields, want) {
+					t.Errorf("got fields %v, want %v", p.Fields, want)
+				}
+			},
+		},
+		{
+			name: "sessions collector",
+			opts: collector.Options{Collectors: []collector.BedCollector{collector.SessionCollector{}}},
+			setup: func(t *testing.T, server *sleepiqtest.Server) {
+				for _, session := range []sleepiq.SleepSession{
+					testSession(-1, 22, 6, true),
+					// Still being scored
+					testSession(-2, 23, 2, false),
+				} {
+					err := server.AddSleepSession("Bed", "right", session)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			check: func(t *testing.T, sink *recorder) {
+				points := sink.byMeasurement("bed_sleep_session")
+				if len(points) != 1 {
+					t.Fatalf("got %d bed_sleep_session points, want the 1 finalized", len(points))
+				}
+				p := points[0]
+				if p.Tags["side"] != "right" || p.Tags["name"] != "Bed" {
+					t.Errorf("got tags %v, want side right of Bed", p.Tags)
+				}
+				start := testSession(-1, 22, 6, true).StartDate
+				if got := p.Time.In(testLocation()).Format(sleepiq.SleepDateLayout); got != start {
+					t.Errorf("got time %s, want the session start %s", got, start)
+				}
+				if v := p.Fields["sleep_quotient"]; v != 75 {
+					t.Errorf("got sleep_quotient %v, want 75", v)
+				}
+			},
+		},
+		{
+			name: "firmware collector",
+			opts: collector.Options{Collectors: []collector.BedCollector{collector.FirmwareCollector{}}},
+			check: func(t *testing.T, sink *recorder) {
+				points := sink.byMeasurement("bed_firmware_state")
+				if len(points) != 1 {
+					t.Fatalf("got %d bed_firmware_state points, want 1", len(points))
+				}
+				if v := points[0].Fields["version"]; v != "1.0.0" {
+					t.Errorf("got version %v, want 1.0.0", v)
+				}
+			},
+		},
+		{
+			name:  "delta mode skips unchanged points",
+			opts:  collector.Options{DeltaMode: true},
+			polls: 2,
+			check: func(t *testing.T, sink *recorder) {
+				if n := len(sink.byMeasurement("bed_sleeper_state")); n != 1 {
+					t.Errorf("got %d bed_sleeper_state points over two unchanged polls, want 1", n)
+				}
+			},
+		},
+		{
+			name:  "every poll written without delta mode",
+			polls: 2,
+			check: func(t *testing.T, sink *recorder) {
+				if n := len(sink.byMeasurement("bed_sleeper_state")); n != 2 {
+					t.Errorf("got %d bed_sleeper_state points over two polls, want 2", n)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := sleepiqtest.NewServer(testUsername, testPassword)
+			if test.inBed {
+				err := server.SetInBed("Bed", "left", true)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.setup != nil {
+				test.setup(t, server)
+			}
+			c, sink := newCollector(t, server, test.opts)
+			polls := test.polls
+			if polls == 0 {
+				polls = 1
+			}
+			for i := 0; i < polls; i++ {
+				err := c.Poll(context.Background())
+				if err != nil {
+					t.Fatalf("poll %d failed, %s", i+1, err)
+				}
+			}
+			test.check(t, sink)
+		})
+	}
+}
+
+func TestPollFailure(t *testing.T) {
+	server := sleepiqtest.NewServer(testUsername, testPassword)
+	c, sink := newCollector(t, server, collector.Options{})
+	server.Fail(http.StatusServiceUnavailable)
+	err := c.Poll(context.Background())
+	if err == nil {
+		t.Fatal("got no error polling a failing API")
+	}
+	if got := sink.byMeasurement("bed_sleeper_state"); len(got) != 0 {
+		t.Errorf("got %d bed_sleeper_state points from a failed poll, want 0", len(got))
+	}
+}
+
+func TestRunStopsOnWrongPassword(t *testing.T) {
+	server := sleepiqtest.NewServer(testUsername, testPassword)
+	c, _ := newCollector(t, server, collector.Options{
+		PollInterval:  10 * time.Millisecond,
+		LoginRetryMin: time.Hour,
+	})
+	// The password changed while the collector ran, and its session expired
+	server.SetPassword("changed")
+	server.ExpireSessions()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, sleepiq.ErrCredentialsRejected) {
+			t.Errorf("got %v, want the credentials rejected", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run kept retrying a rejected password")
+	}
+}
+
+// testRightSleeper is the sleeper ID of the right side of the mock server's
+// first bed
+const testRightSleeper = "-92233720368547758002"
+
+func TestSleepSessionBackfill(t *testing.T) {
+	tests := []struct {
+		name string
+		// persist keeps the state in a file across runs
+		persist bool
+		// last, if not 0, is the day, counting back from today, the last
+		// session written before the first run started on
+		last int
+		// sessions start on these days, counting back from today
+		sessions []int
+		// want is the number of sessions written by each run, each by a
+		// new collector as after a restart
+		want []int
+	}{
+		{
+			name:     "restart with state",
+			persist:  true,
+			sessions: []int{-1},
+			want:     []int{1, 0},
+		},
+		{
+			name:     "restart without state",
+			sessions: []int{-1},
+			want:     []int{1, 1},
+		},
+		{
+			name:     "resume after the last written",
+			persist:  true,
+			last:     -6,
+			sessions: []int{-6, -5, -3, -1},
+			want:     []int{3, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := sleepiqtest.NewServer(testUsername, testPassword)
+			for _, day := range test.sessions {
+				err := server.AddSleepSession("Bed", "right", testSession(day, 22, 6, true))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			var store collector.StateStore
+			if test.persist {
+				store = collector.NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+			}
+			if test.last != 0 {
+				err := store.Save("", &collector.State{
+					SleepSessions: map[string]string{testRightSleeper: testSession(test.last, 22, 6, true).ID()},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, want := range test.want {
+				c, sink := newCollector(t, server, collector.Options{
+					Collectors: []collector.BedCollector{collector.SessionCollector{}},
+					StateStore: store,
+				})
+				err := c.Poll(context.Background())
+				if err != nil {
+					t.Fatalf("run %d failed, %s", i+1, err)
+				}
+				if got := len(sink.byMeasurement("bed_sleep_session")); got != want {
+					t.Errorf("got %d sessions written by run %d, want %d", got, i+1, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunChecksFirmwareDaily(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals map[collector.Endpoint]time.Duration
+		// wantEvery is whether firmware is checked every poll cycle
+		wantEvery bool
+	}{
+		{
+			name: "default interval",
+		},
+		{
+			name:      "own interval",
+			intervals: map[collector.Endpoint]time.Duration{collector.EndpointFirmware: 10 * time.Millisecond},
+			wantEvery: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := sleepiqtest.NewServer(testUsername, testPassword)
+			c, sink := newCollector(t, server, collector.Options{
+				PollInterval: 10 * time.Millisecond,
+				Intervals:    test.intervals,
+				Collectors:   []collector.BedCollector{collector.SleeperCollector{}, collector.FirmwareCollector{}},
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := c.Run(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			polls := len(sink.byMeasurement("bed_sleeper_state"))
+			checks := len(sink.byMeasurement("bed_firmware_state"))
+			if polls < 3 {
+				t.Fatalf("got %d poll cycles, want several", polls)
+			}
+			if test.wantEvery && checks < polls-1 {
+				t.Errorf("got firmware checked %d times in %d poll cycles, want every cycle", checks, polls)
+			}
+			if !test.wantEvery && checks != 1 {
+				t.Errorf("got firmware checked %d times in %d poll cycles, want once", checks, polls)
+			}
+		})
+	}
+}
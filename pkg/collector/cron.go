@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+// Schedule decides when the next poll cycle starts
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// cronSchedules fires whenever any of its schedules fires
+type cronSchedules []cron.Schedule
+
+func (s cronSchedules) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, schedule := range s {
+		n := schedule.Next(t)
+		if next.IsZero() || n.Before(next) {
+			next = n
+		}
+	}
+	return next
+}
+
+// ParseCron returns a Schedule firing at the union of the given cron
+// expressions. Expressions take an optional leading seconds field, so
+// "*/30 * 20-23,0-9 * * *" polls every 30 seconds overnight, and descriptors
+// such as "@every 10m" are accepted.
+func ParseCron(specs ...string) (Schedule, error) {
+	schedules := make(cronSchedules, 0, len(specs))
+	for _, spec := range specs {
+		schedule, err := cronParser.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron schedule %q, %s", spec, err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deltaSink passes a point through only when one of its fields differs from
+// the last point written for the same series, or when the heartbeat interval
+// has elapsed since that write. With a zero heartbeat it drops every
+// consecutive duplicate. When measurements is non-nil only those
+// measurements are filtered.
+type deltaSink struct {
+	next         Sink
+	heartbeat    time.Duration
+	measurements map[string]bool
+
+	mu   sync.Mutex
+	last map[string]deltaEntry
+}
+
+type deltaEntry struct {
+	fields  map[string]interface{}
+	written time.Time
+}
+
+func newDeltaSink(next Sink, heartbeat time.Duration) *deltaSink {
+	return &deltaSink{
+		next:      next,
+		heartbeat: heartbeat,
+		last:      make(map[string]deltaEntry),
+	}
+}
+
+// newDedupSink drops consecutive identical points of the given measurements
+func newDedupSink(next Sink, measurements []string) *deltaSink {
+	s := newDeltaSink(next, 0)
+	s.measurements = make(map[string]bool, len(measurements))
+	for _, m := range measurements {
+		s.measurements[m] = true
+	}
+	return s
+}
+
+func (s *deltaSink) Write(ctx context.Context, p Point) {
+	if s.measurements != nil && !s.measurements[p.Measurement] {
+		s.next.Write(ctx, p)
+		return
+	}
+
+	key := seriesKey(p)
+
+	s.mu.Lock()
+	prev, ok := s.last[key]
+	changed := !ok || !equalFields(prev.fields, p.Fields)
+	stale := s.heartbeat > 0 && p.Time.Sub(prev.written) >= s.heartbeat
+	if changed || stale {
+		s.last[key] = deltaEntry{
+			fields:  p.Fields,
+			written: p.Time,
+		}
+	}
+	s.mu.Unlock()
+
+	if changed || stale {
+		s.next.Write(ctx, p)
+	}
+}
+
+// seriesKey identifies a series by measurement and tag set
+func seriesKey(p Point) string {
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(p.Measurement)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(p.Tags[k])
+	}
+	return b.String()
+}
+
+func equalFields(a, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || !reflect.DeepEqual(v, w) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+)
+
+// BedFilter selects the beds to collect from by name or ID. An empty Include
+// selects every bed; Exclude then removes beds, such as a guest bed, from the
+// selection.
+type BedFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Match reports whether the filter selects bed
+func (f BedFilter) Match(bed sleepiq.Bed) bool {
+	if len(f.Include) > 0 && !matchesBed(f.Include, bed) {
+		return false
+	}
+	return !matchesBed(f.Exclude, bed)
+}
+
+func matchesBed(names []string, bed sleepiq.Bed) bool {
+	for _, name := range names {
+		if name == bed.Name || name == bed.BedID {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBeds returns the beds the filter selects
+func (f BedFilter) filterBeds(beds []sleepiq.Bed) []sleepiq.Bed {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return beds
+	}
+	var selected []sleepiq.Bed
+	for _, bed := range beds {
+		if f.Match(bed) {
+			selected = append(selected, bed)
+		}
+	}
+	return selected
+}
+
+// filterSink drops whole measurements and individual fields before points
+// are written; a point left without fields is dropped too
+type filterSink struct {
+	next         Sink
+	measurements map[string]bool
+	fields       map[string]map[string]bool
+}
+
+func newFilterSink(next Sink, measurements []string, fields map[string][]string) *filterSink {
+	s := &filterSink{
+		next:         next,
+		measurements: make(map[string]bool, len(measurements)),
+		fields:       make(map[string]map[string]bool, len(fields)),
+	}
+	for _, m := range measurements {
+		s.measurements[m] = true
+	}
+	for m, names := range fields {
+		s.fields[m] = make(map[string]bool, len(names))
+		for _, name := range names {
+			s.fields[m][name] = true
+		}
+	}
+	return s
+}
+
+func (s *filterSink) Write(ctx context.Context, p Point) {
+	if s.measurements[p.Measurement] {
+		return
+	}
+	drop := s.fields[p.Measurement]
+	if len(drop) > 0 {
+		fields := make(map[string]interface{}, len(p.Fields))
+		for k, v := range p.Fields {
+			if !drop[k] {
+				fields[k] = v
+			}
+		}
+		if len(fields) == 0 {
+			return
+		}
+		p.Fields = fields
+	}
+	s.next.Write(ctx, p)
+}
@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Health is a snapshot of how a running Collector is doing
+type Health struct {
+	// LoggedIn reports whether the collector holds a SleepIQ session it
+	// hasn't seen rejected
+	LoggedIn bool
+	// LastPoll is when the last successful poll cycle started, or zero if
+	// none has succeeded yet
+	LastPoll time.Time
+	// Interval is the time between the last poll cycle and the next
+	Interval time.Duration
+	// Heartbeat is when the poll loop last made progress, by finishing a
+	// poll cycle or a login attempt, or zero if it isn't running
+	Heartbeat time.Time
+	// LastError is the error of the last poll cycle or login attempt, or nil
+	// if it succeeded
+	LastError error
+}
+
+// stallMin is the least time without progress for the poll loop to count as
+// stalled, long enough for slow requests and backing off between logins
+const stallMin = 10 * time.Minute
+
+// Stalled reports whether the poll loop seems hung, having made no progress
+// for twice the poll interval and at least stallMin
+func (h Health) Stalled(now time.Time) bool {
+	if h.Heartbeat.IsZero() {
+		return false
+	}
+	limit := 2 * h.Interval
+	if limit < stallMin {
+		limit = stallMin
+	}
+	return now.Sub(h.Heartbeat) > limit
+}
+
+// Ready reports why the collector isn't keeping up, or nil if it is logged in
+// and its last poll succeeded within two intervals
+func (h Health) Ready(now time.Time) error {
+	if !h.LoggedIn {
+		return errors.New("not logged into SleepIQ")
+	}
+	if h.LastPoll.IsZero() {
+		return errors.New("no successful poll yet")
+	}
+	if age := now.Sub(h.LastPoll); h.Interval > 0 && age > 2*h.Interval {
+		return fmt.Errorf("last successful poll was %s ago, more than twice the %s poll interval", age.Round(time.Second), h.Interval)
+	}
+	return nil
+}
+
+// health is updated by the poll loop and read by Health from any goroutine
+type health struct {
+	mu sync.Mutex
+	Health
+}
+
+// Health returns how the collector is doing, for health checks
+func (c *Collector) Health() Health {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	return c.health.Health
+}
+
+func (c *Collector) setLoggedIn(loggedIn bool) {
+	c.health.mu.Lock()
+	c.health.LoggedIn = loggedIn
+	c.health.mu.Unlock()
+}
+
+func (c *Collector) setLastError(err error) {
+	c.health.mu.Lock()
+	c.health.LastError = err
+	c.health.mu.Unlock()
+}
+
+func (c *Collector) setPolled(start time.Time) {
+	c.health.mu.Lock()
+	c.health.LastPoll = start
+	c.health.mu.Unlock()
+}
+
+func (c *Collector) setInterval(interval time.Duration) {
+	c.health.mu.Lock()
+	c.health.Interval = interval
+	c.health.mu.Unlock()
+}
+
+// beat records that the poll loop made progress, or with a zero time that
+// it stopped
+func (c *Collector) beat(now time.Time) {
+	c.health.mu.Lock()
+	c.health.Heartbeat = now
+	c.health.mu.Unlock()
+}
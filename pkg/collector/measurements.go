@@ -0,0 +1,470 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BedCollector gathers one class of bed data and writes it as points; each
+// built-in measurement is its own BedCollector so it can be enabled,
+// disabled, or exercised on its own
+type BedCollector interface {
+	// Name identifies the collector in configuration and logs
+	Name() string
+	// Endpoint is the interval class deciding when the collector runs
+	Endpoint() Endpoint
+	// Collect queries the data for req.Bed and writes it to sink; it runs
+	// alongside the other collectors of the bed and of other beds
+	Collect(ctx context.Context, req Request, sink Sink) error
+}
+
+// Request is the input of a single BedCollector run
+type Request struct {
+	Client *sleepiq.Client
+	Bed    sleepiq.Bed
+
+	// Tags are the tags of the bed, along with the collector's own, reused
+	// across poll cycles; collectors adding a tag use TagsWith, or copy them
+	// first
+	Tags map[string]string
+
+	// FamilyStatus is the account-wide status fetched this cycle, or nil
+	// when EndpointFamilyStatus was not due
+	FamilyStatus     *sleepiq.FamilyStatusResponse
+	FamilyStatusTime time.Time
+
+	// SleepSessions is the last sleep session written for each sleeper,
+	// for collectors backfilling history to resume from
+	SleepSessions *SleepSessionLog
+
+	// tagCache holds the tags of TagsWith, nil when the Request wasn't made
+	// by a Collector
+	tagCache *tagCache
+}
+
+// TagsWith returns Tags along with key set to value. Tags derived this way
+// are built once per bed, key, and value and reused across poll cycles until
+// the beds are queried again, so like Tags they must not be modified.
+func (r Request) TagsWith(key, value string) map[string]string {
+	return r.tagCache.with(r.Bed.BedID, r.Tags, key, value)
+}
+
+// tagCache holds tags derived from the tags of each bed by adding one tag
+type tagCache struct {
+	mu   sync.Mutex
+	tags map[tagCacheKey]map[string]string
+}
+
+type tagCacheKey struct {
+	bedID, key, value string
+}
+
+func newTagCache() *tagCache {
+	return &tagCache{tags: make(map[tagCacheKey]map[string]string)}
+}
+
+// with returns bedTags along with key set to value, building them only if
+// they aren't cached; a nil cache builds them every time
+func (c *tagCache) with(bedID string, bedTags map[string]string, key, value string) map[string]string {
+	ck := tagCacheKey{bedID: bedID, key: key, value: value}
+	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if tags, ok := c.tags[ck]; ok {
+			return tags
+		}
+	}
+	tags := make(map[string]string, len(bedTags)+1)
+	for k, v := range bedTags {
+		tags[k] = v
+	}
+	tags[key] = value
+	if c != nil {
+		c.tags[ck] = tags
+	}
+	return tags
+}
+
+// reset drops every cached tag, for when the beds are queried again
+func (c *tagCache) reset() {
+	c.mu.Lock()
+	clear(c.tags)
+	c.mu.Unlock()
+}
+
+// bedTags are the tags shared by every per-bed measurement
+func bedTags(bed sleepiq.Bed) map[string]string {
+	return map[string]string{
+		"size":       bed.Size,
+		"name":       bed.Name,
+		"generation": bed.Generation,
+		"model":      bed.Model,
+	}
+}
+
+// BuiltinCollectors returns every collector shipped with the package
+func BuiltinCollectors() []BedCollector {
+	return []BedCollector{
+		FoundationCollector{},
+		FootWarmerCollector{},
+		SleeperCollector{},
+		PumpCollector{},
+		LightCollector{},
+		ClimateCollector{},
+		SessionCollector{},
+		FirmwareCollector{},
+	}
+}
+
+// DefaultCollectors returns the collectors used when Options.Collectors is
+// nil
+func DefaultCollectors() []BedCollector {
+	return []BedCollector{
+		FoundationCollector{},
+		FootWarmerCollector{},
+		SleeperCollector{},
+	}
+}
+
+// FoundationCollector writes the adjustable base state as
+// bed_foundation_state
+type FoundationCollector struct{}
+
+func (FoundationCollector) Name() string {
+	return "foundation"
+}
+
+func (FoundationCollector) Endpoint() Endpoint {
+	return EndpointFoundation
+}
+
+func (FoundationCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	foundation, err := req.Client.FoundationStatus(ctx, req.Bed.BedID)
+	if err != nil {
+		return fmt.Errorf("failed to query bed %s foundation status, %w", req.Bed.Name, err)
+	}
+	sink.Write(ctx, foundationPoint(req, foundation, time.Now()))
+	return nil
+}
+
+// foundationFields is the number of fields of bed_foundation_state
+const foundationFields = 7
+
+// foundationPoint returns the bed_foundation_state point of foundation. Its
+// tags are shared with the points of earlier cycles, as nothing modifies a
+// point once written, but its fields are not: the bus may still be
+// delivering the last cycle's point to slower sinks while this one is built,
+// so reusing its field map would change a point in flight.
+func foundationPoint(req Request, foundation *sleepiq.FoundationStatus, t time.Time) Point {
+	fields := make(map[string]interface{}, foundationFields)
+	fields["is_moving"] = BoolToInt(foundation.IsMoving)
+	fields["current_position_preset_right"] = foundation.CurrentPositionPresetRight
+	fields["current_position_preset_left"] = foundation.CurrentPositionPresetLeft
+	fields["right_head_position"] = foundation.RightHeadPosition
+	fields["left_head_position"] = foundation.LeftHeadPosition
+	fields["right_foot_position"] = foundation.RightFootPosition
+	fields["left_foot_position"] = foundation.LeftFootPosition
+	return Point{
+		Measurement: "bed_foundation_state",
+		Tags:        req.TagsWith("type", foundation.Type),
+		Fields:      fields,
+		Time:        t,
+	}
+}
+
+// FootWarmerCollector writes the foot warmer state as bed_footwarmers_state
+type FootWarmerCollector struct{}
+
+func (FootWarmerCollector) Name() string {
+	return "footwarmers"
+}
+
+func (FootWarmerCollector) Endpoint() Endpoint {
+	return EndpointFootWarmer
+}
+
+func (FootWarmerCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	footwarmers, err := req.Client.FootWarmerStatus(ctx, req.Bed.BedID)
+	if err != nil {
+		return fmt.Errorf("failed to query bed %s footwarmer status, %w", req.Bed.Name, err)
+	}
+	sink.Write(ctx, Point{
+		Measurement: "bed_footwarmers_state",
+		Tags:        req.Tags,
+		Fields: map[string]interface{}{
+			"foot_warming_status_left":  footwarmers.FootWarmingStatusLeft,
+			"foot_warming_status_right": footwarmers.FootWarmingStatusRight,
+		},
+		Time: time.Now(),
+	})
+	return nil
+}
+
+// SleeperCollector writes occupancy, sleep number, and pressure from the
+// family status as bed_sleeper_state
+type SleeperCollector struct{}
+
+func (SleeperCollector) Name() string {
+	return "sleeper"
+}
+
+func (SleeperCollector) Endpoint() Endpoint {
+	return EndpointFamilyStatus
+}
+
+func (SleeperCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	if req.FamilyStatus == nil {
+		return nil
+	}
+	for _, familyStatusBed := range req.FamilyStatus.Beds {
+		if familyStatusBed.BedID == req.Bed.BedID {
+			sink.Write(ctx, Point{
+				Measurement: "bed_sleeper_state",
+				Tags:        req.Tags,
+				Fields: map[string]interface{}{
+					"left_sleeper_is_in_bed":  BoolToInt(familyStatusBed.LeftSide.IsInBed),
+					"right_sleeper_is_in_bed": BoolToInt(familyStatusBed.RightSide.IsInBed),
+					"left_sleep_number":       familyStatusBed.LeftSide.SleepNumber,
+					"right_sleep_number":      familyStatusBed.RightSide.SleepNumber,
+					"left_pressure":           familyStatusBed.LeftSide.Pressure,
+					"right_pressure":          familyStatusBed.RightSide.Pressure,
+				},
+				Time: req.FamilyStatusTime,
+			})
+		}
+	}
+	return nil
+}
+
+// PumpCollector writes the air pump state as bed_pump_state
+type PumpCollector struct{}
+
+func (PumpCollector) Name() string {
+	return "pump"
+}
+
+func (PumpCollector) Endpoint() Endpoint {
+	return EndpointPump
+}
+
+func (PumpCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	pump, err := req.Client.PumpStatus(ctx, req.Bed.BedID)
+	if err != nil {
+		return fmt.Errorf("failed to query bed %s pump status, %w", req.Bed.Name, err)
+	}
+	sink.Write(ctx, Point{
+		Measurement: "bed_pump_state",
+		Tags:        req.Tags,
+		Fields: map[string]interface{}{
+			"active_task":        pump.ActiveTask,
+			"chamber_type":       pump.ChamberType,
+			"left_sleep_number":  pump.LeftSideSleepNumber,
+			"right_sleep_number": pump.RightSideSleepNumber,
+		},
+		Time: time.Now(),
+	})
+	return nil
+}
+
+// LightCollector writes whether the underbed light of each side is on as
+// bed_light_state, polled along with the foundation
+type LightCollector struct{}
+
+func (LightCollector) Name() string {
+	return "light"
+}
+
+func (LightCollector) Endpoint() Endpoint {
+	return EndpointFoundation
+}
+
+func (LightCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	fields := make(map[string]interface{}, 2)
+	for side, outlet := range map[string]int{"left": sleepiq.OutletLeftLight, "right": sleepiq.OutletRightLight} {
+		status, err := req.Client.OutletStatus(ctx, req.Bed.BedID, outlet)
+		if err != nil {
+			return fmt.Errorf("failed to query bed %s %s light status, %w", req.Bed.Name, side, err)
+		}
+		fields[side+"_underbed_light"] = BoolToInt(status.Setting != 0)
+	}
+	sink.Write(ctx, Point{
+		Measurement: "bed_light_state",
+		Tags:        req.Tags,
+		Fields:      fields,
+		Time:        time.Now(),
+	})
+	return nil
+}
+
+// FirmwareCollector writes the firmware version of the bed as
+// bed_firmware_state, checked daily unless EndpointFirmware has an interval
+type FirmwareCollector struct{}
+
+func (FirmwareCollector) Name() string {
+	return "firmware"
+}
+
+func (FirmwareCollector) Endpoint() Endpoint {
+	return EndpointFirmware
+}
+
+func (FirmwareCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	sink.Write(ctx, Point{
+		Measurement: "bed_firmware_state",
+		Tags:        req.Tags,
+		Fields: map[string]interface{}{
+			"version": req.Bed.Version,
+		},
+		Time: time.Now(),
+	})
+	return nil
+}
+
+// ClimateCollector writes the heating and cooling of each side as
+// bed_climate_state
+type ClimateCollector struct{}
+
+func (ClimateCollector) Name() string {
+	return "climate"
+}
+
+func (ClimateCollector) Endpoint() Endpoint {
+	return EndpointClimate
+}
+
+func (ClimateCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	climate, err := req.Client.ClimateStatus(ctx, req.Bed.BedID)
+	if err != nil {
+		return fmt.Errorf("failed to query bed %s climate status, %w", req.Bed.Name, err)
+	}
+	sink.Write(ctx, Point{
+		Measurement: "bed_climate_state",
+		Tags:        req.Tags,
+		Fields: map[string]interface{}{
+			"left_climate_setting":  climate.ClimateSettingLeft,
+			"right_climate_setting": climate.ClimateSettingRight,
+			"left_climate_timer":    climate.ClimateTimerLeft,
+			"right_climate_timer":   climate.ClimateTimerRight,
+		},
+		Time: time.Now(),
+	})
+	return nil
+}
+
+// sessionDays is how many days of sleep sessions SessionCollector reads when
+// it has written none yet, so a session ending after midnight is still read
+// once it is finalized; maxSessionDays bounds how far back it backfills from
+// the last session written
+const (
+	sessionDays    = 2
+	maxSessionDays = 30
+)
+
+// SessionCollector writes the finalized sleep sessions SleepIQ scored for
+// the sleeper of each side as bed_sleep_session, at the time each started,
+// tagged with the side. It backfills from the last session written, as
+// recorded in Request.SleepSessions, writing each session once.
+type SessionCollector struct{}
+
+func (SessionCollector) Name() string {
+	return "sessions"
+}
+
+func (SessionCollector) Endpoint() Endpoint {
+	return EndpointSessions
+}
+
+func (SessionCollector) Collect(ctx context.Context, req Request, sink Sink) error {
+	loc, err := time.LoadLocation(req.Bed.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	for _, side := range []struct{ name, sleeper string }{
+		{"left", req.Bed.SleeperLeftID},
+		{"right", req.Bed.SleeperRightID},
+	} {
+		if side.sleeper == "" || side.sleeper == "0" {
+			continue
+		}
+		now := time.Now().In(loc)
+		last := req.SleepSessions.Last(side.sleeper)
+		data, err := req.Client.SleepData(ctx, side.sleeper, now, backfillDays(last, now))
+		if err != nil {
+			return fmt.Errorf("failed to query bed %s %s sleep data, %w", req.Bed.Name, side.name, err)
+		}
+
+		var sessions []sleepiq.SleepSession
+		for _, day := range data.Days {
+			for _, session := range day.Sessions {
+				if session.IsFinalized && session.ID() > last {
+					sessions = append(sessions, session)
+				}
+			}
+		}
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].ID() < sessions[j].ID()
+		})
+		for _, session := range sessions {
+			p, err := sessionPoint(req.Tags, side.name, session, loc)
+			if err != nil {
+				return fmt.Errorf("invalid bed %s %s sleep session, %w", req.Bed.Name, side.name, err)
+			}
+			sink.Write(ctx, p)
+			req.SleepSessions.Written(side.sleeper, session.ID())
+		}
+	}
+	return nil
+}
+
+// backfillDays returns how many days of sleep data, up to today, hold the
+// sessions after the one last written, which started on its day or the one
+// before it ended
+func backfillDays(last string, now time.Time) int {
+	start, err := time.ParseInLocation(sleepiq.SleepDateLayout, last, now.Location())
+	if err != nil {
+		return sessionDays
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	days := int(today.Sub(start).Hours()/24) + 2
+	return min(max(days, sessionDays), maxSessionDays)
+}
+
+// sessionPoint returns the bed_sleep_session point of session, on side of a
+// bed with bedTags, whose times are local to loc
+func sessionPoint(bedTags map[string]string, side string, session sleepiq.SleepSession, loc *time.Location) (Point, error) {
+	start, err := time.ParseInLocation(sleepiq.SleepDateLayout, session.StartDate, loc)
+	if err != nil {
+		return Point{}, err
+	}
+	end, err := time.ParseInLocation(sleepiq.SleepDateLayout, session.EndDate, loc)
+	if err != nil {
+		return Point{}, err
+	}
+	tags := make(map[string]string, len(bedTags)+1)
+	for k, v := range bedTags {
+		tags[k] = v
+	}
+	tags["side"] = side
+	return Point{
+		Measurement: "bed_sleep_session",
+		Tags:        tags,
+		Fields: map[string]interface{}{
+			"end_time":                 end.Unix(),
+			"longest":                  BoolToInt(session.Longest),
+			"sleep_number":             session.SleepNumber,
+			"sleep_quotient":           session.SleepQuotient,
+			"total_sleep_session_time": session.TotalSleepSessionTime,
+			"in_bed":                   session.InBed,
+			"out_of_bed":               session.OutOfBed,
+			"restful":                  session.Restful,
+			"restless":                 session.Restless,
+			"avg_heart_rate":           session.AvgHeartRate,
+			"avg_respiration_rate":     session.AvgRespirationRate,
+		},
+		Time: start,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"testing"
+	"time"
+)
+
+func TestTagsWith(t *testing.T) {
+	bed := sleepiq.Bed{BedID: "1", Name: "master", Size: "QUEEN"}
+	tests := []struct {
+		name  string
+		cache *tagCache
+		// wantShared is whether later calls return the first call's tags
+		wantShared bool
+	}{
+		{
+			name:       "cached",
+			cache:      newTagCache(),
+			wantShared: true,
+		},
+		{
+			name:       "no cache",
+			wantShared: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := Request{Bed: bed, Tags: bedTags(bed), tagCache: test.cache}
+			first := req.TagsWith("type", "split")
+			if got := first["type"]; got != "split" {
+				t.Errorf("got type %q, want %q", got, "split")
+			}
+			if got := first["name"]; got != "master" {
+				t.Errorf("got name %q, want %q", got, "master")
+			}
+			if _, ok := req.Tags["type"]; ok {
+				t.Errorf("got type added to the bed's tags, want them unchanged")
+			}
+			again := req.TagsWith("type", "split")
+			if got := sameMap(first, again); got != test.wantShared {
+				t.Errorf("got shared %t, want %t", got, test.wantShared)
+			}
+			if other := req.TagsWith("type", "single"); sameMap(first, other) {
+				t.Errorf("got the tags of type split for type single")
+			}
+			if test.cache != nil {
+				test.cache.reset()
+				if sameMap(first, req.TagsWith("type", "split")) {
+					t.Errorf("got tags cached before the reset, want them rebuilt")
+				}
+			}
+		})
+	}
+}
+
+// sameMap reports whether a and b are the same map rather than equal ones
+func sameMap(a, b map[string]string) bool {
+	a["sameMap"] = "a"
+	defer delete(a, "sameMap")
+	return b["sameMap"] == "a"
+}
+
+// BenchmarkFoundationPoint compares building the foundation point with the
+// tags cached across cycles against building them every cycle, as a Request
+// without a cache does
+func BenchmarkFoundationPoint(b *testing.B) {
+	bed := sleepiq.Bed{BedID: "1", Name: "master", Size: "QUEEN", Generation: "360", Model: "C2"}
+	foundation := &sleepiq.FoundationStatus{
+		Type:                       "split",
+		CurrentPositionPresetRight: "Flat",
+		CurrentPositionPresetLeft:  "Flat",
+		RightHeadPosition:          "0x00",
+		LeftHeadPosition:           "0x00",
+		RightFootPosition:          "0x00",
+		LeftFootPosition:           "0x00",
+	}
+	now := time.Now()
+	tests := []struct {
+		name  string
+		cache *tagCache
+	}{
+		{name: "cached tags", cache: newTagCache()},
+		{name: "tags per cycle"},
+	}
+
+	for _, test := range tests {
+		b.Run(test.name, func(b *testing.B) {
+			req := Request{Bed: bed, Tags: bedTags(bed), tagCache: test.cache}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				foundationPoint(req, foundation, now)
+			}
+		})
+	}
+}
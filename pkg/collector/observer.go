@@ -0,0 +1,28 @@
+package collector
+
+import (
+	"time"
+)
+
+// Observer is told about the work of a Collector, such as to export metrics
+// about it; several collectors may share one, so it must be safe for
+// concurrent use
+type Observer interface {
+	// PollCycle is called after every poll cycle with how long it took and
+	// its error
+	PollCycle(account string, elapsed time.Duration, err error)
+	// Login is called after every attempt to log into SleepIQ
+	Login(account string, err error)
+}
+
+func (c *Collector) observePoll(elapsed time.Duration, err error) {
+	if c.opts.Observer != nil {
+		c.opts.Observer.PollCycle(c.opts.Account, elapsed, err)
+	}
+}
+
+func (c *Collector) observeLogin(err error) {
+	if c.opts.Observer != nil {
+		c.opts.Observer.Login(c.opts.Account, err)
+	}
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Reload replaces the poll settings of a running collector: PollInterval,
+// Intervals, Schedule, AdaptiveMin, AdaptiveMax, BedConcurrency, BedsRefresh,
+// Collectors, Beds, and RecordRequests, as well as Password, logging in again
+// with a changed one. Run applies them by starting a fresh poll cycle;
+// changing any other option needs a new Collector.
+func (c *Collector) Reload(opts Options) {
+	c.reloadMu.Lock()
+	c.pending = &opts
+	c.reloadMu.Unlock()
+
+	select {
+	case c.reloaded <- struct{}{}:
+	default:
+	}
+}
+
+// applyReload switches to the settings passed to Reload and reports whether
+// the password changed; it runs on the poll loop between cycles so nothing
+// else reads the options concurrently
+func (c *Collector) applyReload() bool {
+	c.reloadMu.Lock()
+	opts := c.pending
+	c.pending = nil
+	c.reloadMu.Unlock()
+	if opts == nil {
+		return false
+	}
+
+	passwordChanged := c.opts.Password != opts.Password
+	c.opts.Password = opts.Password
+	c.opts.PollInterval = opts.PollInterval
+	c.opts.Intervals = opts.Intervals
+	c.opts.Schedule = opts.Schedule
+	c.opts.AdaptiveMin = opts.AdaptiveMin
+	c.opts.AdaptiveMax = opts.AdaptiveMax
+	c.opts.BedConcurrency = opts.BedConcurrency
+	c.opts.BedsRefresh = opts.BedsRefresh
+	c.opts.Beds = opts.Beds
+	c.opts.RecordRequests = opts.RecordRequests
+	c.requests.setEnabled(opts.RecordRequests)
+	c.collectors = opts.Collectors
+	if c.collectors == nil {
+		c.collectors = DefaultCollectors()
+	}
+
+	// Poll every endpoint, and query the beds, now and schedule from there
+	// with the new intervals
+	c.nextPoll = [numEndpoints]time.Time{}
+	c.beds = nil
+
+	log.WithFields(log.Fields{
+		"op":      "collector.Reload",
+		"account": c.opts.Account,
+	}).Info("applied reloaded poll settings")
+	return passwordChanged
+}
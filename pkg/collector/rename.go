@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"context"
+)
+
+// renameSink renames measurements and tag and field keys on the way out,
+// after every other tag has been added and every filter has seen the
+// original names
+type renameSink struct {
+	next         Sink
+	measurements map[string]string
+	tags         map[string]string
+	fields       map[string]string
+}
+
+func (s *renameSink) Write(ctx context.Context, p Point) {
+	if name, ok := s.measurements[p.Measurement]; ok {
+		p.Measurement = name
+	}
+	p.Tags = renameKeys(p.Tags, s.tags)
+	p.Fields = renameKeys(p.Fields, s.fields)
+	s.next.Write(ctx, p)
+}
+
+// renameKeys returns m with its keys renamed by names, leaving m untouched
+func renameKeys[V any](m map[string]V, names map[string]string) map[string]V {
+	if len(names) == 0 {
+		return m
+	}
+	renamed := make(map[string]V, len(m))
+	for k, v := range m {
+		if name, ok := names[k]; ok {
+			k = name
+		}
+		renamed[k] = v
+	}
+	return renamed
+}
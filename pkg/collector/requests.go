@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// apiRequest is a finished SleepIQ API request awaiting its point
+type apiRequest struct {
+	endpoint string
+	start    time.Time
+	elapsed  time.Duration
+	err      error
+}
+
+// requestLog holds the SleepIQ API requests made since the last points were
+// written, while RecordRequests is set
+type requestLog struct {
+	mu      sync.Mutex
+	enabled bool
+	pending []apiRequest
+}
+
+func (l *requestLog) setEnabled(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled = enabled
+	if !enabled {
+		l.pending = nil
+	}
+}
+
+// observeRequest is chained onto sleepiq.Options.Observe
+func (c *Collector) observeRequest(endpoint string, elapsed time.Duration, err error) {
+	c.requests.mu.Lock()
+	defer c.requests.mu.Unlock()
+	if !c.requests.enabled {
+		return
+	}
+	c.requests.pending = append(c.requests.pending, apiRequest{
+		endpoint: endpoint,
+		start:    time.Now().Add(-elapsed),
+		elapsed:  elapsed,
+		err:      err,
+	})
+}
+
+// writeRequests writes a sleepiq_api_request point for every API request made
+// since it was last called, so flaky responses from the cloud API can be
+// shown request by request
+func (c *Collector) writeRequests(ctx context.Context) {
+	c.requests.mu.Lock()
+	pending := c.requests.pending
+	c.requests.pending = nil
+	c.requests.mu.Unlock()
+
+	for _, req := range pending {
+		c.sink.Write(ctx, Point{
+			Measurement: "sleepiq_api_request",
+			Tags: map[string]string{
+				"endpoint": req.endpoint,
+				"class":    sleepiq.Classify(req.err).String(),
+			},
+			Fields: map[string]interface{}{
+				"duration_seconds": req.elapsed.Seconds(),
+				"status_code":      statusCode(req.err),
+				"success":          BoolToInt(req.err == nil),
+			},
+			Time: req.start,
+		})
+	}
+}
+
+// statusCode returns the HTTP status of a request from its error, or 0 if
+// it failed without a response
+func statusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var apiErr *sleepiq.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Endpoint identifies a class of SleepIQ data with its own poll interval
+type Endpoint int
+
+const (
+	EndpointFamilyStatus Endpoint = iota
+	EndpointFoundation
+	EndpointFootWarmer
+	EndpointPump
+	EndpointClimate
+	EndpointSessions
+	// EndpointFirmware checks the firmware version of each bed, which comes
+	// with the list of beds, so it queries them afresh
+	EndpointFirmware
+	numEndpoints
+)
+
+// defaultFirmwareInterval is how often firmware versions are checked unless
+// Options.Intervals says otherwise, since they rarely change
+const defaultFirmwareInterval = 24 * time.Hour
+
+func (e Endpoint) String() string {
+	switch e {
+	case EndpointFamilyStatus:
+		return "familyStatus"
+	case EndpointFoundation:
+		return "foundation"
+	case EndpointFootWarmer:
+		return "footWarmer"
+	case EndpointPump:
+		return "pump"
+	case EndpointClimate:
+		return "climate"
+	case EndpointSessions:
+		return "sessions"
+	case EndpointFirmware:
+		return "firmware"
+	}
+	return fmt.Sprintf("Endpoint(%d)", int(e))
+}
+
+// endpointSet records which endpoints a poll cycle should query
+type endpointSet [numEndpoints]bool
+
+// String lists the endpoints in the set, separated by commas
+func (s endpointSet) String() string {
+	var names []string
+	for e, ok := range s {
+		if ok {
+			names = append(names, Endpoint(e).String())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func allEndpoints() endpointSet {
+	var set endpointSet
+	for i := range set {
+		set[i] = true
+	}
+	return set
+}
+
+// interval returns the effective poll interval of an endpoint; with a
+// Schedule or an adaptive interval, endpoints without their own interval are
+// polled every cycle, apart from firmware, which is checked daily
+func (c *Collector) interval(e Endpoint) time.Duration {
+	if d := c.opts.Intervals[e]; d > 0 {
+		return d
+	}
+	if e == EndpointFirmware {
+		return defaultFirmwareInterval
+	}
+	if c.opts.Schedule != nil || c.adaptive() {
+		return 0
+	}
+	return c.opts.PollInterval
+}
+
+// tick returns the shortest effective interval, which drives the poll loop
+func (c *Collector) tick() time.Duration {
+	tick := c.interval(0)
+	for e := Endpoint(1); e < numEndpoints; e++ {
+		if d := c.interval(e); d < tick {
+			tick = d
+		}
+	}
+	return tick
+}
+
+// due returns the endpoints whose next poll time has been reached
+func (c *Collector) due(now time.Time) endpointSet {
+	var set endpointSet
+	for e := range set {
+		set[e] = !now.Before(c.nextPoll[e])
+	}
+	return set
+}
+
+// schedule advances the next poll time of every polled endpoint
+func (c *Collector) schedule(start time.Time, polled endpointSet) {
+	for e, ok := range polled {
+		if ok {
+			c.nextPoll[e] = start.Add(c.interval(Endpoint(e)))
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package collector
+
+import (
+	"context"
+	"time"
+)
+
+// Point is a single sample of bed state
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// Sink receives every Point produced by a Collector; ctx is cancelled when
+// the collector is shutting down. Write is called concurrently when beds are
+// polled in parallel.
+type Sink interface {
+	Write(ctx context.Context, p Point)
+}
+
+// SinkFunc adapts an ordinary function to the Sink interface
+type SinkFunc func(ctx context.Context, p Point)
+
+func (f SinkFunc) Write(ctx context.Context, p Point) {
+	f(ctx, p)
+}
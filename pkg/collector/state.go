@@ -0,0 +1,282 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is the collector progress kept across restarts
+type State struct {
+	// LastPoll is when each endpoint was last polled successfully, keyed by
+	// Endpoint.String
+	LastPoll map[string]time.Time `json:"lastPoll,omitempty"`
+	// Firmware is the last seen firmware version of each bed, keyed by bed ID
+	Firmware map[string]string `json:"firmware,omitempty"`
+	// SleepSessions is the ID of the last sleep session written for each
+	// sleeper, keyed by sleeper ID, after which backfilling resumes
+	SleepSessions map[string]string `json:"sleepSessions,omitempty"`
+	// Session is the last SleepIQ session, kept only with
+	// Options.PersistSession
+	Session *sleepiq.Session `json:"session,omitempty"`
+}
+
+// StateStore loads and saves the State of each account
+type StateStore interface {
+	Load(account string) (*State, error)
+	Save(account string, state *State) error
+}
+
+// FileStateStore keeps the State of every account in one JSON file, readable
+// only by its owner since it may hold session credentials
+type FileStateStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStateStore returns a StateStore backed by the file at path, which
+// is created on the first save
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+func (f *FileStateStore) Load(account string) (*State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	state, ok := states[account]
+	if !ok {
+		return &State{}, nil
+	}
+	return state, nil
+}
+
+func (f *FileStateStore) Save(account string, state *State) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return err
+	}
+	states[account] = state
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it over the old one so a crash
+	// mid-write can't leave a truncated state file behind
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to save state file %s, %s", f.path, err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save state file %s, %s", f.path, err)
+	}
+	return nil
+}
+
+func (f *FileStateStore) read() (map[string]*State, error) {
+	states := make(map[string]*State)
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s, %s", f.path, err)
+	}
+	err = json.Unmarshal(data, &states)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s, %s", f.path, err)
+	}
+	return states, nil
+}
+
+// loadState restores the persisted state, scheduling each endpoint from its
+// last successful poll so a restart doesn't repeat a poll that just happened
+func (c *Collector) loadState() {
+	c.state = &State{}
+	if c.opts.StateStore == nil {
+		return
+	}
+
+	state, err := c.opts.StateStore.Load(c.opts.Account)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":      "collector.loadState",
+			"account": c.opts.Account,
+			"error":   err,
+		}).Warn("failed to load collector state, starting fresh")
+		return
+	}
+	c.state = state
+	if !c.opts.PersistSession {
+		// Drop any session saved by an earlier run so it is not kept on disk
+		c.state.Session = nil
+	}
+
+	for e := Endpoint(0); e < numEndpoints; e++ {
+		if last, ok := state.LastPoll[e.String()]; ok {
+			c.nextPoll[e] = last.Add(c.interval(e))
+		}
+	}
+}
+
+// saveState records a successful poll of the given endpoints
+func (c *Collector) saveState(start time.Time, polled endpointSet) {
+	if c.opts.StateStore == nil {
+		return
+	}
+
+	if c.state.LastPoll == nil {
+		c.state.LastPoll = make(map[string]time.Time)
+	}
+	for e, ok := range polled {
+		if ok {
+			c.state.LastPoll[Endpoint(e).String()] = start
+		}
+	}
+	c.persistState()
+}
+
+func (c *Collector) persistState() {
+	if c.opts.StateStore == nil {
+		return
+	}
+	err := c.opts.StateStore.Save(c.opts.Account, c.state)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"op":      "collector.persistState",
+			"account": c.opts.Account,
+			"error":   err,
+		}).Warn("failed to save collector state")
+	}
+}
+
+// resumeSession restores the persisted session and checks SleepIQ still
+// accepts it, reporting whether a fresh login can be skipped
+func (c *Collector) resumeSession(ctx context.Context) bool {
+	session := c.state.Session
+	if !c.opts.PersistSession || session == nil {
+		return false
+	}
+	if c.opts.SessionLifetime > 0 && time.Since(session.LoginAt) >= c.opts.SessionLifetime {
+		return false
+	}
+
+	entry := log.WithFields(log.Fields{
+		"op":      "collector.resumeSession",
+		"account": c.opts.Account,
+	})
+	err := c.siq.Restore(session)
+	if err == nil {
+		_, err = c.siq.Beds(ctx)
+	}
+	if err != nil {
+		entry.WithField("error", err).Info("saved SleepIQ session was not accepted, logging in")
+		return false
+	}
+	entry.Info("resumed saved SleepIQ session")
+	return true
+}
+
+// Bootstrap logs in interactively, calling code for a two-factor code if the
+// account asks for one, and persists the session so later runs can refresh
+// it without a code; it requires StateStore and PersistSession
+func (c *Collector) Bootstrap(ctx context.Context, code func(challenge *sleepiq.MFAChallenge) (string, error)) error {
+	if c.opts.StateStore == nil || !c.opts.PersistSession {
+		return errors.New("storing a login requires a state store with session persistence enabled")
+	}
+
+	err := c.siq.Login(ctx, c.opts.Username, c.opts.Password)
+	var challenge *sleepiq.MFAChallenge
+	if errors.As(err, &challenge) {
+		var answer string
+		answer, err = code(challenge)
+		if err != nil {
+			return err
+		}
+		err = c.siq.RespondMFA(ctx, challenge, answer)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.state.Session = c.siq.Session()
+	return c.opts.StateStore.Save(c.opts.Account, c.state)
+}
+
+// SleepSessionLog records the last sleep session written for each sleeper,
+// kept in the collector's State so backfilling resumes after it, rather
+// than writing sessions again or skipping them, when the collector restarts.
+// A nil SleepSessionLog records nothing.
+type SleepSessionLog struct {
+	mu    sync.Mutex
+	state *State
+}
+
+// Last returns the ID of the last sleep session written for sleeperID, or
+// "" if there is none
+func (l *SleepSessionLog) Last(sleeperID string) string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state.SleepSessions[sleeperID]
+}
+
+// Written records id as the last sleep session written for sleeperID
+func (l *SleepSessionLog) Written(sleeperID, id string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state.SleepSessions == nil {
+		l.state.SleepSessions = make(map[string]string)
+	}
+	l.state.SleepSessions[sleeperID] = id
+}
+
+// trackFirmware logs beds whose firmware version changed since it was last
+// seen, including across restarts
+func (c *Collector) trackFirmware(beds []sleepiq.Bed) {
+	if c.state.Firmware == nil {
+		c.state.Firmware = make(map[string]string)
+	}
+	for _, bed := range beds {
+		previous, ok := c.state.Firmware[bed.BedID]
+		if ok && previous != bed.Version {
+			log.WithFields(log.Fields{
+				"op":       "collector.trackFirmware",
+				"account":  c.opts.Account,
+				"bed":      bed.Name,
+				"previous": previous,
+				"version":  bed.Version,
+			}).Info("bed firmware version changed")
+		}
+		c.state.Firmware[bed.BedID] = bed.Version
+	}
+}
@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"context"
+)
+
+// tagSink adds fixed tags to every point; tags already on a point win
+type tagSink struct {
+	next Sink
+	tags map[string]string
+}
+
+func (s *tagSink) Write(ctx context.Context, p Point) {
+	// Per-bed points come with the tags already, saving a copy per point
+	if hasKeys(p.Tags, s.tags) {
+		s.next.Write(ctx, p)
+		return
+	}
+	tags := make(map[string]string, len(p.Tags)+len(s.tags))
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+	for k, v := range p.Tags {
+		tags[k] = v
+	}
+	p.Tags = tags
+	s.next.Write(ctx, p)
+}
+
+// hasKeys reports whether m has every key of keys
+func hasKeys(m, keys map[string]string) bool {
+	for k := range keys {
+		if _, ok := m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
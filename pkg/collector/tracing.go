@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records a span for every poll cycle, parenting the spans of its
+// SleepIQ API requests, through the global OpenTelemetry tracer provider if
+// one is set
+var tracer = otel.Tracer("github.com/iwvelando/sleepnumber-stats-collector/pkg/collector")
+
+// startPollSpan starts the span of a poll cycle querying endpoints
+func (c *Collector) startPollSpan(ctx context.Context, endpoints endpointSet) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "collector.poll", trace.WithAttributes(
+		attribute.String("account", c.opts.Account),
+		attribute.String("endpoints", endpoints.String()),
+	))
+}
+
+// endSpan marks span as failed with err, if set, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
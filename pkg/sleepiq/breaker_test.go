@@ -0,0 +1,187 @@
+package sleepiq
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	serverError := &APIError{StatusCode: http.StatusInternalServerError}
+	badRequest := &APIError{StatusCode: http.StatusBadRequest}
+	expired := &APIError{StatusCode: http.StatusUnauthorized}
+
+	tests := []struct {
+		name   string
+		errors []error
+		// cooldown, when set, is waited out after the errors
+		cooldown  bool
+		wantOpen  bool
+		wantFails int
+		wantAllow []bool
+	}{
+		{
+			name:      "below threshold",
+			errors:    []error{serverError, serverError},
+			wantFails: 2,
+			wantAllow: []bool{true, true},
+		},
+		{
+			name:      "at threshold",
+			errors:    []error{serverError, serverError, serverError},
+			wantOpen:  true,
+			wantFails: 3,
+			wantAllow: []bool{false},
+		},
+		{
+			name:      "success resets the run",
+			errors:    []error{serverError, serverError, nil, serverError},
+			wantFails: 1,
+			wantAllow: []bool{true},
+		},
+		{
+			name:      "transport errors count",
+			errors:    []error{errors.New("connection refused"), errors.New("connection refused"), errors.New("connection refused")},
+			wantOpen:  true,
+			wantFails: 3,
+			wantAllow: []bool{false},
+		},
+		{
+			name:      "malformed requests and expired sessions don't count",
+			errors:    []error{serverError, serverError, badRequest, expired},
+			wantAllow: []bool{true},
+		},
+		{
+			name:      "cancelled requests don't count",
+			errors:    []error{serverError, serverError, context.Canceled},
+			wantAllow: []bool{true},
+		},
+		{
+			name:      "one probe after the cooldown",
+			errors:    []error{serverError, serverError, serverError},
+			cooldown:  true,
+			wantOpen:  true,
+			wantFails: 3,
+			wantAllow: []bool{true, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBreaker(3, 20*time.Millisecond)
+			for _, err := range test.errors {
+				b.record(err)
+			}
+			if test.cooldown {
+				time.Sleep(30 * time.Millisecond)
+			}
+			open, failures := b.state()
+			if open != test.wantOpen || failures != test.wantFails {
+				t.Errorf("got open %t with %d failures, want open %t with %d", open, failures, test.wantOpen, test.wantFails)
+			}
+			for i, want := range test.wantAllow {
+				if got := b.allow(); got != want {
+					t.Errorf("got allow %t for request %d, want %t", got, i, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     error
+		wantOpen  bool
+		wantAllow bool
+	}{
+		{
+			name:      "probe succeeds",
+			probe:     nil,
+			wantAllow: true,
+		},
+		{
+			name:     "probe fails",
+			probe:    &APIError{StatusCode: http.StatusServiceUnavailable},
+			wantOpen: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBreaker(1, 20*time.Millisecond)
+			b.record(&APIError{StatusCode: http.StatusServiceUnavailable})
+			time.Sleep(30 * time.Millisecond)
+			if !b.allow() {
+				t.Fatal("got no probe after the cooldown")
+			}
+			b.record(test.probe)
+			if open, _ := b.state(); open != test.wantOpen {
+				t.Errorf("got open %t after the probe, want %t", open, test.wantOpen)
+			}
+			// A failed probe starts another cooldown
+			if got := b.allow(); got != test.wantAllow {
+				t.Errorf("got allow %t after the probe, want %t", got, test.wantAllow)
+			}
+		})
+	}
+}
+
+func TestNewBreakerDefaults(t *testing.T) {
+	b := newBreaker(0, 0)
+	if b.threshold != defaultBreakerThreshold || b.cooldown != defaultBreakerCooldown {
+		t.Errorf("got threshold %d and cooldown %s, want %d and %s", b.threshold, b.cooldown, defaultBreakerThreshold, defaultBreakerCooldown)
+	}
+}
+
+func TestClientCircuitOpen(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	client := New(Options{BaseURL: server.URL, RateLimit: -1, BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	tests := []struct {
+		name         string
+		wantErr      error
+		wantRequests int32
+		wantDegraded bool
+	}{
+		{
+			name:         "first failure",
+			wantRequests: 1,
+		},
+		{
+			name:         "opening failure",
+			wantRequests: 2,
+			wantDegraded: true,
+		},
+		{
+			name:         "open",
+			wantErr:      ErrCircuitOpen,
+			wantRequests: 2,
+			wantDegraded: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := client.Beds(context.Background())
+			if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			if got := requests.Load(); got != test.wantRequests {
+				t.Errorf("got %d requests, want %d", got, test.wantRequests)
+			}
+			if degraded, _ := client.Degraded(); degraded != test.wantDegraded {
+				t.Errorf("got degraded %t, want %t", degraded, test.wantDegraded)
+			}
+		})
+	}
+}
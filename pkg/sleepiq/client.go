@@ -0,0 +1,503 @@
+// Package sleepiq is a minimal context-aware client for the SleepIQ REST API.
+package sleepiq
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the SleepIQ REST API used by the Sleep Number app
+const DefaultBaseURL = "https://prod-api.sleepiq.sleepnumber.com/rest"
+
+// Client is an authenticated SleepIQ API session; it is safe for concurrent
+// use once logged in
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	breaker    *breaker
+	limiter    *rate.Limiter
+	observe    func(endpoint string, elapsed time.Duration, err error)
+
+	tokenAuth bool
+	tokenURL  string
+	clientID  string
+
+	mu           sync.RWMutex
+	key          string
+	accessToken  string
+	refreshToken string
+	loginAt      time.Time
+}
+
+// Options configures a Client; the zero value uses the defaults
+type Options struct {
+	// BaseURL is the root of the REST API, such as a regional endpoint or a
+	// mock server; defaults to DefaultBaseURL
+	BaseURL string
+
+	// BreakerThreshold is the number of consecutive failed requests that
+	// opens the circuit breaker; defaults to 5
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before a probe
+	// request is allowed through; defaults to 1m
+	BreakerCooldown time.Duration
+
+	// RateLimit caps requests per second across all calls on the client;
+	// defaults to 2, and a negative value disables limiting
+	RateLimit float64
+	// RateBurst is the number of requests allowed back to back before
+	// RateLimit applies; defaults to 5
+	RateBurst int
+
+	// RequestTimeout bounds each API call from connecting to reading the
+	// whole response; defaults to 30s
+	RequestTimeout time.Duration
+	// ConnectTimeout bounds establishing the TCP connection and the TLS
+	// handshake; defaults to 10s
+	ConnectTimeout time.Duration
+	// MaxIdleConns is how many idle connections to the API are kept open
+	// for reuse; defaults to 2
+	MaxIdleConns int
+	// IdleConnTimeout is how long an idle connection is kept open; defaults
+	// to 90s, so set it above the poll interval to reuse connections across
+	// poll cycles
+	IdleConnTimeout time.Duration
+	// KeepAlive is the interval of TCP keep-alive probes, which stop NAT
+	// gateways from dropping idle connections; defaults to 30s
+	KeepAlive time.Duration
+	// TLSConfig overrides the TLS settings used for the API
+	TLSConfig *tls.Config
+	// Proxy selects the proxy for each request as http.Transport.Proxy
+	// does; defaults to http.ProxyFromEnvironment
+	Proxy func(*http.Request) (*url.URL, error)
+	// HTTPClient replaces the client built from the settings above
+	HTTPClient *http.Client
+	// Record saves every response of the API as a Recording in the
+	// directory it names, and Replay answers every request from the
+	// recordings in the directory it names instead of sending it, for
+	// reproducing what the API returned
+	Record string
+	Replay string
+
+	// TokenAuth logs in through the token service used by current versions
+	// of the Sleep Number app instead of the legacy /login endpoint; it is
+	// required for accounts with two-factor authentication
+	TokenAuth bool
+	// TokenURL and ClientID identify the token service; they default to
+	// DefaultTokenURL and DefaultClientID
+	TokenURL string
+	ClientID string
+
+	// Observe, when set, is called after every request sent to the API with
+	// the name of the endpoint, such as beds or pump_status, how long the
+	// request took, and its error; it must be safe for concurrent use
+	Observe func(endpoint string, elapsed time.Duration, err error)
+}
+
+const (
+	defaultRateLimit = 2
+	defaultRateBurst = 5
+)
+
+// New returns a Client for the SleepIQ API at opts.BaseURL
+func New(opts Options) *Client {
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	limit := rate.Limit(opts.RateLimit)
+	if opts.RateLimit == 0 {
+		limit = defaultRateLimit
+	} else if opts.RateLimit < 0 {
+		limit = rate.Inf
+	}
+	burst := opts.RateBurst
+	if burst <= 0 {
+		burst = defaultRateBurst
+	}
+
+	tokenURL := opts.TokenURL
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	clientID := opts.ClientID
+	if clientID == "" {
+		clientID = DefaultClientID
+	}
+
+	return &Client{
+		httpClient: withRecording(newHTTPClient(opts), opts.Record, opts.Replay),
+		baseURL:    baseURL,
+		tokenAuth:  opts.TokenAuth,
+		tokenURL:   tokenURL,
+		clientID:   clientID,
+		breaker:    newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+		limiter:    rate.NewLimiter(limit, burst),
+		observe:    opts.Observe,
+	}
+}
+
+// Degraded reports whether the circuit breaker is open, along with the
+// current run of consecutive failed requests
+func (c *Client) Degraded() (bool, int) {
+	return c.breaker.state()
+}
+
+// Login starts a new session, replacing any existing one. With TokenAuth a
+// held refresh token is tried before the password, and accounts with
+// two-factor authentication fail with an *MFAChallenge.
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	if c.tokenAuth {
+		return c.loginToken(ctx, username, password)
+	}
+
+	var login loginResponse
+	err := c.do(ctx, "login", http.MethodPut, "/login", nil, loginRequest{
+		Login:    username,
+		Password: password,
+	}, &login)
+	if err != nil {
+		return loginError(err)
+	}
+
+	c.mu.Lock()
+	c.key = login.Key
+	c.loginAt = time.Now()
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Session is a login that can be saved and restored into another Client
+type Session struct {
+	Key          string         `json:"key,omitempty"`
+	AccessToken  string         `json:"accessToken,omitempty"`
+	RefreshToken string         `json:"refreshToken,omitempty"`
+	Cookies      []*http.Cookie `json:"cookies"`
+	LoginAt      time.Time      `json:"loginAt"`
+}
+
+// Session returns the current session, or nil if the client has not logged
+// in
+func (c *Client) Session() *Session {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.key == "" && c.accessToken == "" {
+		return nil
+	}
+
+	session := &Session{
+		Key:          c.key,
+		AccessToken:  c.accessToken,
+		RefreshToken: c.refreshToken,
+		LoginAt:      c.loginAt,
+	}
+	if u, err := url.Parse(c.baseURL); err == nil && c.httpClient.Jar != nil {
+		session.Cookies = c.httpClient.Jar.Cookies(u)
+	}
+	return session
+}
+
+// Restore resumes a saved session without logging in; a stale session
+// surfaces as ErrSessionInvalid on the next request
+func (c *Client) Restore(session *Session) error {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return err
+	}
+	if c.httpClient.Jar != nil {
+		c.httpClient.Jar.SetCookies(u, session.Cookies)
+	}
+
+	c.mu.Lock()
+	c.key = session.Key
+	c.accessToken = session.AccessToken
+	c.refreshToken = session.RefreshToken
+	c.loginAt = session.LoginAt
+	c.mu.Unlock()
+
+	return nil
+}
+
+// SessionAge returns how long ago the current session was started, or zero
+// if the client has not logged in
+func (c *Client) SessionAge() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.loginAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.loginAt)
+}
+
+// Beds lists every bed on the account
+func (c *Client) Beds(ctx context.Context) (*BedsResponse, error) {
+	var beds BedsResponse
+	err := c.do(ctx, "beds", http.MethodGet, "/bed", nil, nil, &beds)
+	if err != nil {
+		return nil, err
+	}
+	return &beds, nil
+}
+
+// FamilyStatus returns occupancy and pressure for every bed on the account
+func (c *Client) FamilyStatus(ctx context.Context) (*FamilyStatusResponse, error) {
+	var status FamilyStatusResponse
+	err := c.do(ctx, "family_status", http.MethodGet, "/bed/familyStatus", nil, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// FoundationStatus returns the adjustable base state of a bed
+func (c *Client) FoundationStatus(ctx context.Context, bedID string) (*FoundationStatus, error) {
+	var status FoundationStatus
+	err := c.do(ctx, "foundation_status", http.MethodGet, fmt.Sprintf("/bed/%s/foundation/status", bedID), nil, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// FootWarmerStatus returns the foot warmer state of a bed
+func (c *Client) FootWarmerStatus(ctx context.Context, bedID string) (*FootWarmerStatus, error) {
+	var status FootWarmerStatus
+	err := c.do(ctx, "foot_warmer_status", http.MethodGet, fmt.Sprintf("/bed/%s/foundation/footwarming", bedID), nil, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// PumpStatus returns the air pump state of a bed
+func (c *Client) PumpStatus(ctx context.Context, bedID string) (*PumpStatus, error) {
+	var status PumpStatus
+	err := c.do(ctx, "pump_status", http.MethodGet, fmt.Sprintf("/bed/%s/pump/status", bedID), nil, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Climate settings of a side of a bed, as reported by ClimateStatus
+const (
+	ClimateOff         = "OFF"
+	ClimateHeatingLow  = "HEATING_PUSH_LOW"
+	ClimateHeatingMed  = "HEATING_PUSH_MED"
+	ClimateHeatingHigh = "HEATING_PUSH_HIGH"
+	ClimateCoolingLow  = "COOLING_PULL_LOW"
+	ClimateCoolingMed  = "COOLING_PULL_MED"
+	ClimateCoolingHigh = "COOLING_PULL_HIGH"
+)
+
+// ClimateStatus returns the heating and cooling state of a bed
+func (c *Client) ClimateStatus(ctx context.Context, bedID string) (*ClimateStatus, error) {
+	var status ClimateStatus
+	err := c.do(ctx, "climate_status", http.MethodGet, fmt.Sprintf("/bed/%s/foundation/climate", bedID), nil, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SleepDayLayout and SleepDateLayout lay out the days and local times of
+// sleep data
+const (
+	SleepDayLayout  = "2006-01-02"
+	SleepDateLayout = "2006-01-02T15:04:05"
+)
+
+// SleepData returns the sleep sessions of a sleeper, such as the
+// SleeperLeftID of a bed, that ended on each of the days days, counting
+// back from and including day, a date in the bed's time zone
+func (c *Client) SleepData(ctx context.Context, sleeperID string, day time.Time, days int) (*SleepDataResponse, error) {
+	var data SleepDataResponse
+	query := url.Values{
+		"sleeper":  {sleeperID},
+		"date":     {day.Format(SleepDayLayout)},
+		"interval": {fmt.Sprintf("D%d", days)},
+	}
+	err := c.do(ctx, "sleep_data", http.MethodGet, "/sleepData", query, nil, &data)
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// StopMotion halts head, foot, and massage motion on one side ("L" or "R")
+// of a bed
+func (c *Client) StopMotion(ctx context.Context, bedID, side string) error {
+	return c.do(ctx, "stop_motion", http.MethodPut, fmt.Sprintf("/bed/%s/foundation/motion", bedID), nil, motionRequest{
+		FootMotion:    1,
+		HeadMotion:    1,
+		MassageMotion: 1,
+		Side:          side,
+	}, nil)
+}
+
+// SetSleepNumber sets the firmness of one side ("L" or "R") of a bed, from 5
+// to 100 in steps of 5
+func (c *Client) SetSleepNumber(ctx context.Context, bedID, side string, number int) error {
+	return c.do(ctx, "set_sleep_number", http.MethodPut, fmt.Sprintf("/bed/%s/sleepNumber", bedID), nil, sleepNumberRequest{
+		Side:        side,
+		SleepNumber: number,
+	}, nil)
+}
+
+// Foundation presets, the positions of the adjustable base
+const (
+	PresetFavorite = 1
+	PresetRead     = 2
+	PresetWatchTV  = 3
+	PresetFlat     = 4
+	PresetZeroG    = 5
+	PresetSnore    = 6
+)
+
+// SetFoundationPreset moves one side ("L" or "R") of a bed's adjustable base
+// to a preset position at full speed
+func (c *Client) SetFoundationPreset(ctx context.Context, bedID, side string, preset int) error {
+	return c.do(ctx, "set_foundation_preset", http.MethodPut, fmt.Sprintf("/bed/%s/foundation/preset", bedID), nil, presetRequest{
+		Preset: preset,
+		Side:   side,
+	}, nil)
+}
+
+// Foundation outlets, the plugs on the sides of the base and the underbed
+// lights beneath each side
+const (
+	OutletRightPlug  = 1
+	OutletLeftPlug   = 2
+	OutletRightLight = 3
+	OutletLeftLight  = 4
+)
+
+// OutletStatus returns whether a foundation outlet of a bed, such as
+// OutletLeftLight, is on
+func (c *Client) OutletStatus(ctx context.Context, bedID string, outlet int) (*OutletStatus, error) {
+	var status OutletStatus
+	query := url.Values{"outletId": {strconv.Itoa(outlet)}}
+	err := c.do(ctx, "outlet_status", http.MethodGet, fmt.Sprintf("/bed/%s/foundation/outlet", bedID), query, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SetOutlet switches a foundation outlet of a bed, such as OutletLeftLight,
+// on or off
+func (c *Client) SetOutlet(ctx context.Context, bedID string, outlet int, on bool) error {
+	setting := 0
+	if on {
+		setting = 1
+	}
+	return c.do(ctx, "set_outlet", http.MethodPut, fmt.Sprintf("/bed/%s/foundation/outlet", bedID), nil, outletRequest{
+		OutletID: outlet,
+		Setting:  setting,
+	}, nil)
+}
+
+// do sends a request through the rate limiter and circuit breaker; endpoint
+// names the call for Options.Observe
+func (c *Client) do(ctx context.Context, endpoint, method, path string, query url.Values, body interface{}, result interface{}) (err error) {
+	ctx, span := tracer.Start(ctx, "sleepiq."+endpoint, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", method)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	err = c.limiter.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	if !c.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	start := time.Now()
+	err = c.send(ctx, method, path, query, body, result)
+	c.breaker.record(err)
+	if c.observe != nil {
+		c.observe(endpoint, time.Since(start), err)
+	}
+	return err
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+
+	if query == nil {
+		query = url.Values{}
+	}
+	c.mu.RLock()
+	if c.key != "" {
+		query.Set("_k", c.key)
+	}
+	accessToken := c.accessToken
+	c.mu.RUnlock()
+
+	// Paths are relative to the API root except for absolute URLs such as
+	// the token service
+	reqURL := path
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		reqURL = c.baseURL + path
+	}
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", accessToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var errResp apiErrorResponse
+		if json.Unmarshal(respBody, &errResp) == nil {
+			apiErr.Code = errResp.Error.Code
+			apiErr.Message = errResp.Error.Message
+		}
+		return apiErr
+	}
+
+	if result != nil {
+		return json.Unmarshal(respBody, result)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package sleepiq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrSessionInvalid matches any error caused by an expired or rejected
+// session key
+var ErrSessionInvalid = errors.New("SleepIQ session is invalid")
+
+// ErrCredentialsRejected matches any error caused by SleepIQ rejecting the
+// username and password, or a two-factor code, at login
+var ErrCredentialsRejected = errors.New("SleepIQ rejected the credentials")
+
+// APIError is returned when SleepIQ answers with a non-200 status
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	// Login is set for the answer to logging in with credentials, rather
+	// than to a call made with a session
+	Login bool
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("SleepIQ API returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("SleepIQ API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// Is makes errors.Is(err, ErrSessionInvalid) true for unauthorized and
+// forbidden responses to calls made with a session, and errors.Is(err,
+// ErrCredentialsRejected) true for those responses to a login
+func (e *APIError) Is(target error) bool {
+	rejected := e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	switch target {
+	case ErrSessionInvalid:
+		return rejected && !e.Login
+	case ErrCredentialsRejected:
+		return rejected && e.Login
+	}
+	return false
+}
+
+// loginError marks err, if SleepIQ answered a login with it, as the answer
+// to credentials rather than to a session
+func loginError(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		apiErr.Login = true
+	}
+	return err
+}
+
+type apiErrorResponse struct {
+	Error struct {
+		Code    int    `json:"Code"`
+		Message string `json:"Message"`
+	} `json:"Error"`
+}
+
+// ErrorClass groups errors by how a caller should recover from them
+type ErrorClass int
+
+const (
+	// ClassNone is the class of a nil error
+	ClassNone ErrorClass = iota
+	// ClassRetryable errors are transient; the same request may succeed later
+	ClassRetryable
+	// ClassFatal errors will not be fixed by retrying or logging in again,
+	// including credentials rejected at login
+	ClassFatal
+	// ClassAuth errors are sessions rejected by calls made with them, which
+	// need a fresh login before retrying
+	ClassAuth
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassNone:
+		return "none"
+	case ClassRetryable:
+		return "retryable"
+	case ClassAuth:
+		return "auth"
+	case ClassFatal:
+		return "fatal"
+	}
+	return fmt.Sprintf("ErrorClass(%d)", int(c))
+}
+
+// Classify returns the class of err. For joined errors, auth takes priority
+// over fatal, and fatal over retryable, so one expired session in a batch of
+// calls still triggers a login.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ClassNone
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		class := ClassNone
+		for _, e := range joined.Unwrap() {
+			if c := Classify(e); c > class {
+				class = c
+			}
+		}
+		return class
+	}
+	if errors.Is(err, ErrSessionInvalid) {
+		return ClassAuth
+	}
+	if isFatal(err) {
+		return ClassFatal
+	}
+	return ClassRetryable
+}
+
+func isFatal(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode != http.StatusTooManyRequests && apiErr.StatusCode < 500
+	}
+
+	// Two-factor codes need a person to enter them
+	var challenge *MFAChallenge
+	if errors.As(err, &challenge) {
+		return true
+	}
+
+	// A response that doesn't decode won't decode any better next time
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
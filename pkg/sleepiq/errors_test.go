@@ -0,0 +1,88 @@
+package sleepiq_test
+
+import (
+	"context"
+	"errors"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq/sleepiqtest"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testUsername = "sleeper@example.com"
+	testPassword = "secret"
+)
+
+// newClient returns a Client of a mock SleepIQ server, along with the server
+func newClient(t *testing.T) (*sleepiq.Client, *sleepiqtest.Server) {
+	t.Helper()
+	server := sleepiqtest.NewServer(testUsername, testPassword)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return sleepiq.New(sleepiq.Options{BaseURL: httpServer.URL + sleepiqtest.BasePath, RateLimit: -1}), server
+}
+
+func TestLoginErrorClass(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		// expire expires the session after logging in, before listing beds
+		expire            bool
+		wantClass         sleepiq.ErrorClass
+		wantRejected      bool
+		wantSessionFailed bool
+	}{
+		{
+			name:      "right password",
+			username:  testUsername,
+			password:  testPassword,
+			wantClass: sleepiq.ClassNone,
+		},
+		{
+			name:         "wrong password",
+			username:     testUsername,
+			password:     "wrong",
+			wantClass:    sleepiq.ClassFatal,
+			wantRejected: true,
+		},
+		{
+			name:         "unknown username",
+			username:     "nobody@example.com",
+			password:     testPassword,
+			wantClass:    sleepiq.ClassFatal,
+			wantRejected: true,
+		},
+		{
+			name:              "expired session",
+			username:          testUsername,
+			password:          testPassword,
+			expire:            true,
+			wantClass:         sleepiq.ClassAuth,
+			wantSessionFailed: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := newClient(t)
+			err := client.Login(context.Background(), test.username, test.password)
+			if err == nil {
+				if test.expire {
+					server.ExpireSessions()
+				}
+				_, err = client.Beds(context.Background())
+			}
+			if got := sleepiq.Classify(err); got != test.wantClass {
+				t.Errorf("got class %s for %v, want %s", got, err, test.wantClass)
+			}
+			if got := errors.Is(err, sleepiq.ErrCredentialsRejected); got != test.wantRejected {
+				t.Errorf("got credentials rejected %t for %v, want %t", got, err, test.wantRejected)
+			}
+			if got := errors.Is(err, sleepiq.ErrSessionInvalid); got != test.wantSessionFailed {
+				t.Errorf("got session invalid %t for %v, want %t", got, err, test.wantSessionFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package sleepiq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces secrets in recorded responses
+const redacted = "REDACTED"
+
+// secretKeys are the JSON keys of responses whose values are left out of
+// recordings, being session keys and tokens
+var secretKeys = map[string]bool{
+	"key":          true,
+	"accesstoken":  true,
+	"refreshtoken": true,
+	"idtoken":      true,
+}
+
+// Recording is a response of the SleepIQ API as saved by Options.Record
+type Recording struct {
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	Time   time.Time `json:"time"`
+	// Body is the response when it is JSON, with session keys and tokens
+	// redacted, and Text the response when it isn't
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+// recorder saves every response passing through it to dir, one file each,
+// numbered in the order they arrived, after any recordings already there
+type recorder struct {
+	next http.RoundTripper
+	dir  string
+
+	mu      sync.Mutex
+	scanned bool
+	seq     int
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := Recording{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Status: resp.StatusCode,
+		Time:   time.Now(),
+	}
+	// Responses without secrets are kept as they came, down to the order
+	// of keys and the digits of numbers
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	switch {
+	case decoder.Decode(&v) != nil || !json.Valid(body):
+		rec.Text = string(body)
+	case redact(v):
+		rec.Body, _ = json.Marshal(v)
+	default:
+		rec.Body = body
+	}
+	err = r.save(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record response, %s", err)
+	}
+	return resp, nil
+}
+
+func (r *recorder) save(rec Recording) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := os.MkdirAll(r.dir, 0o700)
+	if err != nil {
+		return err
+	}
+	if !r.scanned {
+		r.seq, err = lastRecording(r.dir)
+		if err != nil {
+			return err
+		}
+		r.scanned = true
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	r.seq++
+	name := fmt.Sprintf("%06d-%s%s.json", r.seq, rec.Method, strings.ReplaceAll(rec.Path, "/", "_"))
+	return os.WriteFile(filepath.Join(r.dir, name), data, 0o600)
+}
+
+// lastRecording returns the highest number of the recordings in dir, or 0
+// if there are none, so recordings of a later run are replayed after those
+// of earlier ones instead of overwriting them
+func lastRecording(dir string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	last := 0
+	for _, file := range files {
+		number, _, found := strings.Cut(filepath.Base(file), "-")
+		if !found {
+			continue
+		}
+		seq, err := strconv.Atoi(number)
+		if err == nil && seq > last {
+			last = seq
+		}
+	}
+	return last, nil
+}
+
+// redact replaces the values of secretKeys anywhere in v, reporting whether
+// there were any
+func redact(v interface{}) bool {
+	found := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if secretKeys[strings.ToLower(k)] {
+				v[k] = redacted
+				found = true
+				continue
+			}
+			found = redact(value) || found
+		}
+	case []interface{}:
+		for _, value := range v {
+			found = redact(value) || found
+		}
+	}
+	return found
+}
+
+// replayer answers requests from the recordings in dir instead of sending
+// them: each method and path gets its recorded responses in order, then
+// the last of them again
+type replayer struct {
+	dir string
+
+	once       sync.Once
+	err        error
+	mu         sync.Mutex
+	recordings map[string][]Recording
+}
+
+func (r *replayer) load() {
+	files, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		r.err = err
+		return
+	}
+	if len(files) == 0 {
+		r.err = fmt.Errorf("no recordings in %s", r.dir)
+		return
+	}
+	sort.Strings(files)
+	r.recordings = make(map[string][]Recording)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			r.err = err
+			return
+		}
+		var rec Recording
+		err = json.Unmarshal(data, &rec)
+		if err != nil {
+			r.err = fmt.Errorf("failed to parse recording %s, %s", file, err)
+			return
+		}
+		key := rec.Method + " " + rec.Path
+		r.recordings[key] = append(r.recordings[key], rec)
+	}
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	r.once.Do(r.load)
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to replay, %s", r.err)
+	}
+
+	key := req.Method + " " + req.URL.Path
+	r.mu.Lock()
+	queue := r.recordings[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("failed to replay, no recording of %s", key)
+	}
+	rec := queue[0]
+	if len(queue) > 1 {
+		r.recordings[key] = queue[1:]
+	}
+	r.mu.Unlock()
+
+	body := []byte(rec.Text)
+	if len(rec.Body) > 0 {
+		body = rec.Body
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// withRecording returns client with its transport wrapped to record
+// responses to record, or replaced to answer from the recordings in replay,
+// if either is set
+func withRecording(client *http.Client, record, replay string) *http.Client {
+	if record == "" && replay == "" {
+		return client
+	}
+	c := *client
+	switch {
+	case replay != "":
+		c.Transport = &replayer{dir: replay}
+	default:
+		next := c.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		c.Transport = &recorder{next: next, dir: record}
+	}
+	return &c
+}
@@ -0,0 +1,161 @@
+package sleepiq_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq/sleepiqtest"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// record logs in to a mock SleepIQ server with a client recording to dir,
+// and lists the beds
+func record(t *testing.T, dir string, bedNames ...string) {
+	t.Helper()
+	server := httptest.NewServer(sleepiqtest.NewServer(testUsername, testPassword, bedNames...))
+	defer server.Close()
+	client := sleepiq.New(sleepiq.Options{BaseURL: server.URL + sleepiqtest.BasePath, RateLimit: -1, Record: dir})
+	err := client.Login(context.Background(), testUsername, testPassword)
+	if err != nil {
+		t.Fatalf("failed to log in, %s", err)
+	}
+	listBeds(t, client)
+}
+
+func listBeds(t *testing.T, client *sleepiq.Client) []string {
+	t.Helper()
+	beds, err := client.Beds(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list beds, %s", err)
+	}
+	var names []string
+	for _, bed := range beds.Beds {
+		names = append(names, bed.Name)
+	}
+	return names
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		// runs are the beds of each recording run into the same directory
+		runs      [][]string
+		wantFiles []string
+	}{
+		{
+			name: "one run",
+			runs: [][]string{{"Master"}},
+			wantFiles: []string{
+				"000001-PUT_rest_login.json",
+				"000002-GET_rest_bed.json",
+			},
+		},
+		{
+			name: "later runs number after earlier ones",
+			runs: [][]string{{"Master"}, {"Guest"}},
+			wantFiles: []string{
+				"000001-PUT_rest_login.json",
+				"000002-GET_rest_bed.json",
+				"000003-PUT_rest_login.json",
+				"000004-GET_rest_bed.json",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, beds := range test.runs {
+				record(t, dir, beds...)
+			}
+
+			files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(test.wantFiles) {
+				t.Fatalf("got %d recordings, want %d", len(files), len(test.wantFiles))
+			}
+			for i, file := range files {
+				if got := filepath.Base(file); got != test.wantFiles[i] {
+					t.Errorf("got recording %s, want %s", got, test.wantFiles[i])
+				}
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var rec sleepiq.Recording
+				err = json.Unmarshal(data, &rec)
+				if err != nil {
+					t.Fatalf("failed to parse %s, %s", file, err)
+				}
+				if rec.Status != 200 || rec.Method == "" || rec.Path == "" {
+					t.Errorf("got %d for %s %s in %s, want 200 for a request", rec.Status, rec.Method, rec.Path, file)
+				}
+				if strings.HasSuffix(rec.Path, "/login") {
+					var login struct{ Key string }
+					json.Unmarshal(rec.Body, &login)
+					if login.Key != "REDACTED" {
+						t.Errorf("got session key %q in the login recording, want it redacted", login.Key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		// runs are the beds of each recording run, none meaning no
+		// recordings at all
+		runs [][]string
+		// wantBeds are the bed names of each listing replayed
+		wantBeds []string
+		wantErr  bool
+	}{
+		{
+			name:     "recorded response",
+			runs:     [][]string{{"Master"}},
+			wantBeds: []string{"Master", "Master"},
+		},
+		{
+			name:     "recorded responses in order, then the last again",
+			runs:     [][]string{{"Master"}, {"Guest"}},
+			wantBeds: []string{"Master", "Guest", "Guest"},
+		},
+		{
+			name:    "no recordings",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, beds := range test.runs {
+				record(t, dir, beds...)
+			}
+
+			// Nothing listens at the base URL, so every answer is replayed
+			client := sleepiq.New(sleepiq.Options{BaseURL: "http://127.0.0.1:1/rest", RateLimit: -1, Replay: dir})
+			err := client.Login(context.Background(), testUsername, testPassword)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v logging in, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for i, want := range test.wantBeds {
+				got := listBeds(t, client)
+				if len(got) != 1 || got[0] != want {
+					t.Errorf("got beds %v for listing %d, want %s", got, i, want)
+				}
+			}
+		})
+	}
+}
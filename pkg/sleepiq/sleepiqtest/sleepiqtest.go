@@ -0,0 +1,511 @@
+// Package sleepiqtest is a mock of the SleepIQ API, serving the endpoints
+// the collector uses from beds held in memory, so the collector can be
+// developed and its whole pipeline tested without a bed or an account.
+package sleepiqtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BasePath is the path the API is served under, to be appended to the
+// server's URL to make sleepiq.Options.BaseURL
+const BasePath = "/rest"
+
+// Settings a side starts with, and the pressure of a side with a sleeper in
+// it, which rises a little with the sleep number as a real bed's does
+const (
+	basePressure        = 1000
+	pressurePerNumber   = 5
+	defaultSleepNumber  = 50
+	defaultPositionCode = "0x00"
+)
+
+// presetPositions are the head and foot positions each preset moves a side
+// of a foundation to, as SleepIQ reports them
+var presetPositions = map[int][2]string{
+	sleepiq.PresetFavorite: {"0x14", "0x0a"},
+	sleepiq.PresetRead:     {"0x2d", "0x00"},
+	sleepiq.PresetWatchTV:  {"0x23", "0x0a"},
+	sleepiq.PresetFlat:     {"0x00", "0x00"},
+	sleepiq.PresetZeroG:    {"0x0f", "0x1e"},
+	sleepiq.PresetSnore:    {"0x0a", "0x00"},
+}
+
+var presetNames = map[int]string{
+	sleepiq.PresetFavorite: "Favorite",
+	sleepiq.PresetRead:     "Read",
+	sleepiq.PresetWatchTV:  "Watch TV",
+	sleepiq.PresetFlat:     "Flat",
+	sleepiq.PresetZeroG:    "Zero G",
+	sleepiq.PresetSnore:    "Snore",
+}
+
+// outlets are the foundation outlets of every mock bed
+var outlets = []int{sleepiq.OutletRightPlug, sleepiq.OutletLeftPlug, sleepiq.OutletRightLight, sleepiq.OutletLeftLight}
+
+// bed is a mock bed and the state of its sides, foundation, foot warmers,
+// climate, and outlets
+type bed struct {
+	info       sleepiq.Bed
+	left       sleepiq.SideStatus
+	right      sleepiq.SideStatus
+	foundation sleepiq.FoundationStatus
+	footWarmer sleepiq.FootWarmerStatus
+	climate    sleepiq.ClimateStatus
+	outlets    map[int]bool
+}
+
+// Server is an http.Handler serving the SleepIQ API under BasePath for one
+// account. Every side starts empty at sleep number 50 with its foundation
+// flat, its climate and outlets off, and no sleep sessions; sleep numbers,
+// presets, and outlets set through the API stick.
+type Server struct {
+	username string
+	password string
+
+	mu       sync.Mutex
+	keys     map[string]bool
+	beds     []*bed
+	failWith int
+	mux      *http.ServeMux
+	// sessions holds the sleep sessions of each sleeper ID
+	sessions map[string][]sleepiq.SleepSession
+}
+
+// NewServer returns a Server accepting username and password, with a queen
+// bed with a foundation for each of bedNames, or one named Bed if there are
+// none
+func NewServer(username, password string, bedNames ...string) *Server {
+	if len(bedNames) == 0 {
+		bedNames = []string{"Bed"}
+	}
+	s := &Server{
+		username: username,
+		password: password,
+		keys:     make(map[string]bool),
+		sessions: make(map[string][]sleepiq.SleepSession),
+	}
+	for i, name := range bedNames {
+		id := fmt.Sprintf("-92233720368547758%02d", i)
+		s.beds = append(s.beds, &bed{
+			info: sleepiq.Bed{
+				BedID:          id,
+				Name:           name,
+				Size:           "QUEEN",
+				Generation:     "360",
+				Model:          "C4",
+				Base:           "FlexFit",
+				SleeperLeftID:  id + "1",
+				SleeperRightID: id + "2",
+				Timezone:       "US/Central",
+				Version:        "1.0.0",
+				Status:         1,
+				DualSleep:      true,
+			},
+			left:  sleepiq.SideStatus{SleepNumber: defaultSleepNumber, LastLink: "00:00:00"},
+			right: sleepiq.SideStatus{SleepNumber: defaultSleepNumber, LastLink: "00:00:00"},
+			foundation: sleepiq.FoundationStatus{
+				Type:                       "fsType_FlexFit",
+				Configured:                 true,
+				CurrentPositionPresetLeft:  presetNames[sleepiq.PresetFlat],
+				CurrentPositionPresetRight: presetNames[sleepiq.PresetFlat],
+				LeftHeadPosition:           defaultPositionCode,
+				RightHeadPosition:          defaultPositionCode,
+				LeftFootPosition:           defaultPositionCode,
+				RightFootPosition:          defaultPositionCode,
+			},
+			climate: sleepiq.ClimateStatus{
+				ClimateSettingLeft:  sleepiq.ClimateOff,
+				ClimateSettingRight: sleepiq.ClimateOff,
+			},
+			outlets: make(map[int]bool),
+		})
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("PUT "+BasePath+"/login", s.login)
+	s.mux.HandleFunc("GET "+BasePath+"/bed", s.authorized(s.listBeds))
+	s.mux.HandleFunc("GET "+BasePath+"/bed/familyStatus", s.authorized(s.familyStatus))
+	s.mux.HandleFunc("GET "+BasePath+"/bed/{bedID}/foundation/status", s.authorized(s.withBed(func(w http.ResponseWriter, r *http.Request, b *bed) {
+		writeJSON(w, b.foundation)
+	})))
+	s.mux.HandleFunc("GET "+BasePath+"/bed/{bedID}/foundation/footwarming", s.authorized(s.withBed(func(w http.ResponseWriter, r *http.Request, b *bed) {
+		writeJSON(w, b.footWarmer)
+	})))
+	s.mux.HandleFunc("GET "+BasePath+"/bed/{bedID}/foundation/climate", s.authorized(s.withBed(func(w http.ResponseWriter, r *http.Request, b *bed) {
+		writeJSON(w, b.climate)
+	})))
+	s.mux.HandleFunc("GET "+BasePath+"/sleepData", s.authorized(s.sleepData))
+	s.mux.HandleFunc("GET "+BasePath+"/bed/{bedID}/pump/status", s.authorized(s.withBed(func(w http.ResponseWriter, r *http.Request, b *bed) {
+		writeJSON(w, sleepiq.PumpStatus{
+			ChamberType:          1,
+			LeftSideSleepNumber:  b.left.SleepNumber,
+			RightSideSleepNumber: b.right.SleepNumber,
+		})
+	})))
+	s.mux.HandleFunc("GET "+BasePath+"/bed/{bedID}/foundation/outlet", s.authorized(s.withBed(s.outletStatus)))
+	s.mux.HandleFunc("PUT "+BasePath+"/bed/{bedID}/foundation/outlet", s.authorized(s.withBed(s.setOutlet)))
+	s.mux.HandleFunc("PUT "+BasePath+"/bed/{bedID}/sleepNumber", s.authorized(s.withBed(s.setSleepNumber)))
+	s.mux.HandleFunc("PUT "+BasePath+"/bed/{bedID}/foundation/preset", s.authorized(s.withBed(s.setPreset)))
+	s.mux.HandleFunc("PUT "+BasePath+"/bed/{bedID}/foundation/motion", s.authorized(s.withBed(func(w http.ResponseWriter, r *http.Request, b *bed) {
+		b.foundation.IsMoving = false
+		writeJSON(w, struct{}{})
+	})))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	failWith := s.failWith
+	s.mu.Unlock()
+	if failWith != 0 {
+		writeError(w, failWith, "mock failure")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetInBed puts a sleeper in side, left or right, of the bed named bedName,
+// or takes them out
+func (s *Server) SetInBed(bedName, side string, inBed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.beds {
+		if b.info.Name != bedName {
+			continue
+		}
+		status, err := b.side(side)
+		if err != nil {
+			return err
+		}
+		status.IsInBed = inBed
+		return nil
+	}
+	return fmt.Errorf("no bed named %s", bedName)
+}
+
+// SetClimate sets the climate of side, left or right, of the bed named
+// bedName to setting, one of the sleepiq Climate constants, with timer
+// minutes left
+func (s *Server) SetClimate(bedName, side, setting string, timer int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bed(bedName)
+	if err != nil {
+		return err
+	}
+	switch side {
+	case "left":
+		b.climate.ClimateSettingLeft, b.climate.ClimateTimerLeft = setting, timer
+	case "right":
+		b.climate.ClimateSettingRight, b.climate.ClimateTimerRight = setting, timer
+	default:
+		return fmt.Errorf("unknown side %q", side)
+	}
+	return nil
+}
+
+// AddSleepSession records a sleep session of the sleeper of side, left or
+// right, of the bed named bedName, served on the day its EndDate falls on
+func (s *Server) AddSleepSession(bedName, side string, session sleepiq.SleepSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bed(bedName)
+	if err != nil {
+		return err
+	}
+	var sleeper string
+	switch side {
+	case "left":
+		sleeper = b.info.SleeperLeftID
+	case "right":
+		sleeper = b.info.SleeperRightID
+	default:
+		return fmt.Errorf("unknown side %q", side)
+	}
+	if _, err := time.Parse(sleepiq.SleepDateLayout, session.EndDate); err != nil {
+		return fmt.Errorf("invalid session end %q, %s", session.EndDate, err)
+	}
+	s.sessions[sleeper] = append(s.sessions[sleeper], session)
+	return nil
+}
+
+// bed returns the bed named name; s.mu must be held
+func (s *Server) bed(name string) (*bed, error) {
+	for _, b := range s.beds {
+		if b.info.Name == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("no bed named %s", name)
+}
+
+// Beds returns the names of the beds
+func (s *Server) Beds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, len(s.beds))
+	for i, b := range s.beds {
+		names[i] = b.info.Name
+	}
+	return names
+}
+
+// Fail makes every request fail with status, such as 503, until called
+// again with 0
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failWith = status
+}
+
+// ExpireSessions rejects every session key handed out so far, as SleepIQ
+// does once a session times out
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = make(map[string]bool)
+}
+
+// SetPassword changes the password the account accepts, as when its owner
+// changes it
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+func (b *bed) side(side string) (*sleepiq.SideStatus, error) {
+	switch side {
+	case "left", "L":
+		return &b.left, nil
+	case "right", "R":
+		return &b.right, nil
+	}
+	return nil, fmt.Errorf("unknown side %q", side)
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed login request")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Login != s.username || req.Password != s.password {
+		writeError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	key := hex.EncodeToString(raw)
+	s.keys[key] = true
+	writeJSON(w, map[string]string{"userId": "mock-user", "key": key})
+}
+
+// authorized answers requests without a current session key with 401, as
+// SleepIQ does, and serves the others with next holding s.mu
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.keys[r.URL.Query().Get("_k")] {
+			writeError(w, http.StatusUnauthorized, "Session is invalid")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// withBed serves requests about the bed with the bedID of the path, and
+// answers those about others with 404
+func (s *Server) withBed(next func(http.ResponseWriter, *http.Request, *bed)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("bedID")
+		for _, b := range s.beds {
+			if b.info.BedID == id {
+				next(w, r, b)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "Bed not found")
+	}
+}
+
+func (s *Server) listBeds(w http.ResponseWriter, r *http.Request) {
+	resp := sleepiq.BedsResponse{Beds: []sleepiq.Bed{}}
+	for _, b := range s.beds {
+		resp.Beds = append(resp.Beds, b.info)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) familyStatus(w http.ResponseWriter, r *http.Request) {
+	resp := sleepiq.FamilyStatusResponse{Beds: []sleepiq.FamilyStatusBed{}}
+	for _, b := range s.beds {
+		resp.Beds = append(resp.Beds, sleepiq.FamilyStatusBed{
+			BedID:     b.info.BedID,
+			Status:    1,
+			LeftSide:  withPressure(b.left),
+			RightSide: withPressure(b.right),
+		})
+	}
+	writeJSON(w, resp)
+}
+
+// sleepData answers with the sessions of the sleeper that ended on each day
+// of the interval, such as D7 for a week, counting back from date
+func (s *Server) sleepData(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	date, err := time.Parse(sleepiq.SleepDayLayout, query.Get("date"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid date")
+		return
+	}
+	days, err := strconv.Atoi(strings.TrimPrefix(query.Get("interval"), "D"))
+	if err != nil || days < 1 {
+		writeError(w, http.StatusBadRequest, "Invalid interval")
+		return
+	}
+	sleeper := query.Get("sleeper")
+	resp := sleepiq.SleepDataResponse{SleeperID: sleeper, Days: []sleepiq.SleepDataDay{}}
+	for i := days - 1; i >= 0; i-- {
+		day := sleepiq.SleepDataDay{
+			Date:     date.AddDate(0, 0, -i).Format(sleepiq.SleepDayLayout),
+			Sessions: []sleepiq.SleepSession{},
+		}
+		for _, session := range s.sessions[sleeper] {
+			if strings.HasPrefix(session.EndDate, day.Date) {
+				day.Sessions = append(day.Sessions, session)
+			}
+		}
+		resp.Days = append(resp.Days, day)
+	}
+	writeJSON(w, resp)
+}
+
+// withPressure returns side with the pressure it would read
+func withPressure(side sleepiq.SideStatus) sleepiq.SideStatus {
+	side.Pressure = 0
+	if side.IsInBed {
+		side.Pressure = basePressure + pressurePerNumber*side.SleepNumber
+	}
+	return side
+}
+
+func (s *Server) setSleepNumber(w http.ResponseWriter, r *http.Request, b *bed) {
+	var req struct {
+		Side        string `json:"side"`
+		SleepNumber int    `json:"sleepNumber"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed sleep number request")
+		return
+	}
+	side, err := b.side(req.Side)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.SleepNumber < 5 || req.SleepNumber > 100 || req.SleepNumber%5 != 0 {
+		writeError(w, http.StatusBadRequest, "Invalid sleep number")
+		return
+	}
+	side.SleepNumber = req.SleepNumber
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) setPreset(w http.ResponseWriter, r *http.Request, b *bed) {
+	var req struct {
+		Preset int    `json:"preset"`
+		Side   string `json:"side"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed preset request")
+		return
+	}
+	positions, ok := presetPositions[req.Preset]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid preset")
+		return
+	}
+	switch strings.ToUpper(req.Side) {
+	case "L":
+		b.foundation.CurrentPositionPresetLeft = presetNames[req.Preset]
+		b.foundation.LeftHeadPosition, b.foundation.LeftFootPosition = positions[0], positions[1]
+	case "R":
+		b.foundation.CurrentPositionPresetRight = presetNames[req.Preset]
+		b.foundation.RightHeadPosition, b.foundation.RightFootPosition = positions[0], positions[1]
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid side")
+		return
+	}
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) outletStatus(w http.ResponseWriter, r *http.Request, b *bed) {
+	outlet, err := strconv.Atoi(r.URL.Query().Get("outletId"))
+	if err != nil || !slices.Contains(outlets, outlet) {
+		writeError(w, http.StatusBadRequest, "Invalid outlet")
+		return
+	}
+	writeJSON(w, b.outletStatus(outlet))
+}
+
+func (s *Server) setOutlet(w http.ResponseWriter, r *http.Request, b *bed) {
+	var req struct {
+		OutletID int `json:"outletId"`
+		Setting  int `json:"setting"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "malformed outlet request")
+		return
+	}
+	if !slices.Contains(outlets, req.OutletID) || req.Setting < 0 || req.Setting > 1 {
+		writeError(w, http.StatusBadRequest, "Invalid outlet")
+		return
+	}
+	b.outlets[req.OutletID] = req.Setting == 1
+	writeJSON(w, b.outletStatus(req.OutletID))
+}
+
+func (b *bed) outletStatus(outlet int) sleepiq.OutletStatus {
+	status := sleepiq.OutletStatus{BedID: b.info.BedID, Outlet: outlet}
+	if b.outlets[outlet] {
+		status.Setting = 1
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with status and an error body shaped as SleepIQ's,
+// whose codes, such as 40100, extend the status
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Error": map[string]interface{}{"Code": status * 100, "Message": msg},
+	})
+}
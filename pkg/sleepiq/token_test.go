@@ -0,0 +1,213 @@
+package sleepiq_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const (
+	testCode    = "123456"
+	testSession = "mfa-session"
+)
+
+// tokenService is a fake of the token service, which asks for a two-factor
+// code when mfa is set and counts the logins of each kind
+type tokenService struct {
+	mfa bool
+
+	mu             sync.Mutex
+	refreshToken   string
+	passwordLogins int
+	refreshLogins  int
+}
+
+func (s *tokenService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email         string
+		Password      string
+		RefreshToken  string
+		Session       string
+		ChallengeName string
+		Code          string
+		ClientID      string
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.ClientID != sleepiq.DefaultClientID {
+		http.Error(w, `{"Error":{"Message":"bad request"}}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut:
+		if req.RefreshToken != s.refreshToken {
+			http.Error(w, `{"Error":{"Message":"refresh token expired"}}`, http.StatusUnauthorized)
+			return
+		}
+		s.refreshLogins++
+	case req.ChallengeName != "":
+		if req.Session != testSession || req.Code != testCode {
+			http.Error(w, `{"Error":{"Message":"wrong code"}}`, http.StatusUnauthorized)
+			return
+		}
+		s.passwordLogins++
+	case req.Email != testUsername || req.Password != testPassword:
+		http.Error(w, `{"Error":{"Message":"wrong password"}}`, http.StatusUnauthorized)
+		return
+	case s.mfa:
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+			"ChallengeName": "SMS_MFA",
+			"Session":       testSession,
+		}})
+		return
+	default:
+		s.passwordLogins++
+	}
+	s.refreshToken = "refresh-" + req.Email
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+		"AccessToken":  "access",
+		"RefreshToken": s.refreshToken,
+		"ExpiresIn":    3600,
+	}})
+}
+
+func newTokenClient(t *testing.T, service *tokenService) *sleepiq.Client {
+	t.Helper()
+	server := httptest.NewServer(service)
+	t.Cleanup(server.Close)
+	return sleepiq.New(sleepiq.Options{TokenAuth: true, TokenURL: server.URL, RateLimit: -1})
+}
+
+func TestTokenLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		mfa      bool
+		// code, when set, answers the two-factor challenge
+		code         string
+		wantMFA      bool
+		wantRejected bool
+		wantSession  bool
+	}{
+		{
+			name:        "password",
+			password:    testPassword,
+			wantSession: true,
+		},
+		{
+			name:         "wrong password",
+			password:     "wrong",
+			wantRejected: true,
+		},
+		{
+			name:     "two-factor challenge",
+			password: testPassword,
+			mfa:      true,
+			wantMFA:  true,
+		},
+		{
+			name:        "two-factor code",
+			password:    testPassword,
+			mfa:         true,
+			code:        testCode,
+			wantSession: true,
+		},
+		{
+			name:         "wrong two-factor code",
+			password:     testPassword,
+			mfa:          true,
+			code:         "000000",
+			wantRejected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTokenClient(t, &tokenService{mfa: test.mfa})
+			err := client.Login(context.Background(), testUsername, test.password)
+
+			var challenge *sleepiq.MFAChallenge
+			if errors.As(err, &challenge) && test.code != "" {
+				if challenge.Email != testUsername || challenge.Session != testSession {
+					t.Errorf("got challenge for %s in session %s, want %s in %s", challenge.Email, challenge.Session, testUsername, testSession)
+				}
+				err = client.RespondMFA(context.Background(), challenge, test.code)
+				challenge = nil
+				errors.As(err, &challenge)
+			}
+
+			if got := challenge != nil; got != test.wantMFA {
+				t.Errorf("got two-factor challenge %t from %v, want %t", got, err, test.wantMFA)
+			}
+			if test.wantMFA && sleepiq.Classify(err) != sleepiq.ClassFatal {
+				t.Errorf("got class %s for a two-factor challenge, want %s", sleepiq.Classify(err), sleepiq.ClassFatal)
+			}
+			if got := errors.Is(err, sleepiq.ErrCredentialsRejected); got != test.wantRejected {
+				t.Errorf("got rejected %t from %v, want %t", got, err, test.wantRejected)
+			}
+			session := client.Session()
+			if got := session != nil; got != test.wantSession {
+				t.Fatalf("got session %t, want %t", got, test.wantSession)
+			}
+			if session != nil && (session.AccessToken != "access" || session.RefreshToken == "") {
+				t.Errorf("got access token %q and refresh token %q, want both", session.AccessToken, session.RefreshToken)
+			}
+		})
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// revoke changes the refresh token the service accepts before
+		// logging in again
+		revoke             bool
+		wantRefreshLogins  int
+		wantPasswordLogins int
+	}{
+		{
+			name:               "refresh token accepted",
+			wantRefreshLogins:  1,
+			wantPasswordLogins: 1,
+		},
+		{
+			name:               "refresh token rejected falls back to the password",
+			revoke:             true,
+			wantPasswordLogins: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &tokenService{}
+			client := newTokenClient(t, service)
+			err := client.Login(context.Background(), testUsername, testPassword)
+			if err != nil {
+				t.Fatalf("failed to log in, %s", err)
+			}
+			if test.revoke {
+				service.mu.Lock()
+				service.refreshToken = "revoked"
+				service.mu.Unlock()
+			}
+
+			err = client.Login(context.Background(), testUsername, testPassword)
+			if err != nil {
+				t.Fatalf("failed to log in again, %s", err)
+			}
+			service.mu.Lock()
+			defer service.mu.Unlock()
+			if service.refreshLogins != test.wantRefreshLogins || service.passwordLogins != test.wantPasswordLogins {
+				t.Errorf("got %d refresh and %d password logins, want %d and %d",
+					service.refreshLogins, service.passwordLogins, test.wantRefreshLogins, test.wantPasswordLogins)
+			}
+		})
+	}
+}
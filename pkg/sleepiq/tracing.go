@@ -0,0 +1,20 @@
+package sleepiq
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records a span for every API request, exported through the global
+// OpenTelemetry tracer provider if one is set
+var tracer = otel.Tracer("github.com/iwvelando/sleepnumber-stats-collector/pkg/sleepiq")
+
+// endSpan marks span as failed with err, if set, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,70 @@
+package sleepiq
+
+import (
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+)
+
+const (
+	defaultRequestTimeout = 30 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+	defaultKeepAlive      = 30 * time.Second
+)
+
+// newHTTPClient builds the HTTP client used for API calls; a caller-supplied
+// client is used as-is apart from getting a cookie jar if it has none, since
+// SleepIQ sessions depend on cookies
+func newHTTPClient(opts Options) *http.Client {
+	if opts.HTTPClient != nil {
+		if opts.HTTPClient.Jar == nil {
+			client := *opts.HTTPClient
+			client.Jar, _ = cookiejar.New(nil)
+			return &client
+		}
+		return opts.HTTPClient
+	}
+
+	requestTimeout := opts.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	connectTimeout := opts.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = defaultKeepAlive
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: keepAlive,
+	}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	// Every request goes to the one API host
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opts.MaxIdleConns
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.Proxy != nil {
+		transport.Proxy = opts.Proxy
+	}
+	if opts.TLSConfig != nil {
+		transport.TLSClientConfig = opts.TLSConfig
+	}
+
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar:       jar,
+		Transport: transport,
+		Timeout:   requestTimeout,
+	}
+}
@@ -0,0 +1,165 @@
+package sleepiq
+
+type loginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type loginResponse struct {
+	UserID string `json:"userId"`
+	Key    string `json:"key"`
+}
+
+type motionRequest struct {
+	FootMotion    int    `json:"footMotion"`
+	HeadMotion    int    `json:"headMotion"`
+	MassageMotion int    `json:"massageMotion"`
+	Side          string `json:"side"`
+}
+
+type sleepNumberRequest struct {
+	Side        string `json:"side"`
+	SleepNumber int    `json:"sleepNumber"`
+}
+
+type presetRequest struct {
+	Preset int    `json:"preset"`
+	Side   string `json:"side"`
+	Speed  int    `json:"speed"`
+}
+
+type outletRequest struct {
+	OutletID int `json:"outletId"`
+	Setting  int `json:"setting"`
+}
+
+// BedsResponse is the response of the bed listing endpoint
+type BedsResponse struct {
+	Beds []Bed `json:"beds"`
+}
+
+// Bed describes a bed registered to the account
+type Bed struct {
+	BedID          string `json:"bedId"`
+	Name           string `json:"name"`
+	Size           string `json:"size"`
+	Generation     string `json:"generation"`
+	Model          string `json:"model"`
+	Base           string `json:"base"`
+	SleeperLeftID  string `json:"sleeperLeftId"`
+	SleeperRightID string `json:"sleeperRightId"`
+	Timezone       string `json:"timezone"`
+	Version        string `json:"version"`
+	Status         int    `json:"status"`
+	DualSleep      bool   `json:"dualSleep"`
+}
+
+// FamilyStatusResponse is the response of the family status endpoint
+type FamilyStatusResponse struct {
+	Beds []FamilyStatusBed `json:"beds"`
+}
+
+// FamilyStatusBed is the live status of both sides of a bed
+type FamilyStatusBed struct {
+	BedID     string     `json:"bedId"`
+	Status    int        `json:"status"`
+	LeftSide  SideStatus `json:"leftSide"`
+	RightSide SideStatus `json:"rightSide"`
+}
+
+// SideStatus is the live status of one side of a bed
+type SideStatus struct {
+	IsInBed              bool   `json:"isInBed"`
+	SleepNumber          int    `json:"sleepNumber"`
+	Pressure             int    `json:"pressure"`
+	AlertID              int    `json:"alertId"`
+	AlertDetailedMessage string `json:"alertDetailedMessage"`
+	LastLink             string `json:"lastLink"`
+}
+
+// FoundationStatus is the state of an adjustable base
+type FoundationStatus struct {
+	Type                       string `json:"fsType"`
+	IsMoving                   bool   `json:"fsIsMoving"`
+	NeedsHoming                bool   `json:"fsNeedsHoming"`
+	Configured                 bool   `json:"fsConfigured"`
+	CurrentPositionPresetRight string `json:"fsCurrentPositionPresetRight"`
+	CurrentPositionPresetLeft  string `json:"fsCurrentPositionPresetLeft"`
+	RightHeadPosition          string `json:"fsRightHeadPosition"`
+	LeftHeadPosition           string `json:"fsLeftHeadPosition"`
+	RightFootPosition          string `json:"fsRightFootPosition"`
+	LeftFootPosition           string `json:"fsLeftFootPosition"`
+}
+
+// FootWarmerStatus is the state of both foot warmers of a bed
+type FootWarmerStatus struct {
+	FootWarmingStatusLeft  int `json:"footWarmingStatusLeft"`
+	FootWarmingStatusRight int `json:"footWarmingStatusRight"`
+	FootWarmingTimerLeft   int `json:"footWarmingTimerLeft"`
+	FootWarmingTimerRight  int `json:"footWarmingTimerRight"`
+}
+
+// ClimateStatus is the heating and cooling of both sides of a bed with a
+// climate foundation; settings are one of the Climate constants and timers
+// are the minutes left, 0 when running without a timer
+type ClimateStatus struct {
+	ClimateSettingLeft  string `json:"climateSettingLeft"`
+	ClimateSettingRight string `json:"climateSettingRight"`
+	ClimateTimerLeft    int    `json:"climateTimerLeft"`
+	ClimateTimerRight   int    `json:"climateTimerRight"`
+}
+
+// SleepDataResponse is the sleep history of one sleeper, a day at a time
+type SleepDataResponse struct {
+	SleeperID string         `json:"sleeperId"`
+	Days      []SleepDataDay `json:"sleepDataDays"`
+}
+
+// SleepDataDay is the sleep sessions of one sleeper that ended on Date, a
+// day in the bed's time zone formatted as SleepDayLayout
+type SleepDataDay struct {
+	Date     string         `json:"date"`
+	Sessions []SleepSession `json:"sessions"`
+}
+
+// SleepSession is one stretch of time a sleeper spent in bed, as scored by
+// SleepIQ. StartDate and EndDate are local times in the bed's time zone,
+// formatted as SleepDateLayout, and the durations are in seconds. Its scores
+// may still change until IsFinalized is set.
+type SleepSession struct {
+	StartDate             string `json:"startDate"`
+	EndDate               string `json:"endDate"`
+	Longest               bool   `json:"longest"`
+	IsFinalized           bool   `json:"isFinalized"`
+	SleepNumber           int    `json:"sleepNumber"`
+	SleepQuotient         int    `json:"sleepQuotient"`
+	TotalSleepSessionTime int    `json:"totalSleepSessionTime"`
+	InBed                 int    `json:"inBed"`
+	OutOfBed              int    `json:"outOfBed"`
+	Restful               int    `json:"restful"`
+	Restless              int    `json:"restless"`
+	AvgHeartRate          int    `json:"avgHeartRate"`
+	AvgRespirationRate    int    `json:"avgRespirationRate"`
+}
+
+// ID tells the sessions of a sleeper apart by when they started; IDs sort in
+// the order the sessions started
+func (s SleepSession) ID() string {
+	return s.StartDate
+}
+
+// PumpStatus is the state of the air pump of a bed
+type PumpStatus struct {
+	ActiveTask           int `json:"activeTask"`
+	ChamberType          int `json:"chamberType"`
+	LeftSideSleepNumber  int `json:"leftSideSleepNumber"`
+	RightSideSleepNumber int `json:"rightSideSleepNumber"`
+}
+
+// OutletStatus is the state of a foundation outlet; Setting is 1 when it is
+// on and 0 when it is off
+type OutletStatus struct {
+	BedID   string `json:"bedId"`
+	Outlet  int    `json:"outlet"`
+	Setting int    `json:"setting"`
+}
@@ -0,0 +1,6 @@
+// Package sleepnumberpb is the gRPC API of the collector, generated from
+// sleepnumber.proto, through which other services can read the state of the
+// beds and control them with typed messages rather than querying a sink.
+package sleepnumberpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative sleepnumber.proto
@@ -0,0 +1,1062 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        v5.27.1
+// source: sleepnumber.proto
+
+package sleepnumberpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Side is a side of a bed, as seen lying in it.
+type Side int32
+
+const (
+	Side_SIDE_UNSPECIFIED Side = 0
+	Side_SIDE_LEFT        Side = 1
+	Side_SIDE_RIGHT       Side = 2
+)
+
+// Enum value maps for Side.
+var (
+	Side_name = map[int32]string{
+		0: "SIDE_UNSPECIFIED",
+		1: "SIDE_LEFT",
+		2: "SIDE_RIGHT",
+	}
+	Side_value = map[string]int32{
+		"SIDE_UNSPECIFIED": 0,
+		"SIDE_LEFT":        1,
+		"SIDE_RIGHT":       2,
+	}
+)
+
+func (x Side) Enum() *Side {
+	p := new(Side)
+	*p = x
+	return p
+}
+
+func (x Side) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Side) Descriptor() protoreflect.EnumDescriptor {
+	return file_sleepnumber_proto_enumTypes[0].Descriptor()
+}
+
+func (Side) Type() protoreflect.EnumType {
+	return &file_sleepnumber_proto_enumTypes[0]
+}
+
+func (x Side) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Side.Descriptor instead.
+func (Side) EnumDescriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{0}
+}
+
+// Preset is a foundation position preset.
+type Preset int32
+
+const (
+	Preset_PRESET_UNSPECIFIED Preset = 0
+	Preset_PRESET_FAVORITE    Preset = 1
+	Preset_PRESET_READ        Preset = 2
+	Preset_PRESET_WATCH_TV    Preset = 3
+	Preset_PRESET_FLAT        Preset = 4
+	Preset_PRESET_ZERO_G      Preset = 5
+	Preset_PRESET_SNORE       Preset = 6
+)
+
+// Enum value maps for Preset.
+var (
+	Preset_name = map[int32]string{
+		0: "PRESET_UNSPECIFIED",
+		1: "PRESET_FAVORITE",
+		2: "PRESET_READ",
+		3: "PRESET_WATCH_TV",
+		4: "PRESET_FLAT",
+		5: "PRESET_ZERO_G",
+		6: "PRESET_SNORE",
+	}
+	Preset_value = map[string]int32{
+		"PRESET_UNSPECIFIED": 0,
+		"PRESET_FAVORITE":    1,
+		"PRESET_READ":        2,
+		"PRESET_WATCH_TV":    3,
+		"PRESET_FLAT":        4,
+		"PRESET_ZERO_G":      5,
+		"PRESET_SNORE":       6,
+	}
+)
+
+func (x Preset) Enum() *Preset {
+	p := new(Preset)
+	*p = x
+	return p
+}
+
+func (x Preset) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Preset) Descriptor() protoreflect.EnumDescriptor {
+	return file_sleepnumber_proto_enumTypes[1].Descriptor()
+}
+
+func (Preset) Type() protoreflect.EnumType {
+	return &file_sleepnumber_proto_enumTypes[1]
+}
+
+func (x Preset) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Preset.Descriptor instead.
+func (Preset) EnumDescriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{1}
+}
+
+type GetStateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *GetStateRequest) Reset() {
+	*x = GetStateRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetStateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStateRequest) ProtoMessage() {}
+
+func (x *GetStateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStateRequest.ProtoReflect.Descriptor instead.
+func (*GetStateRequest) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{0}
+}
+
+type WatchStateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *WatchStateRequest) Reset() {
+	*x = WatchStateRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WatchStateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchStateRequest) ProtoMessage() {}
+
+func (x *WatchStateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchStateRequest.ProtoReflect.Descriptor instead.
+func (*WatchStateRequest) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{1}
+}
+
+// State is the latest state of every bed polled so far.
+type State struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Time of the latest report of any bed.
+	Time *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// Beds in account and then name order.
+	Beds []*Bed `protobuf:"bytes,2,rep,name=beds,proto3" json:"beds,omitempty"`
+}
+
+func (x *State) Reset() {
+	*x = State{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *State) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*State) ProtoMessage() {}
+
+func (x *State) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use State.ProtoReflect.Descriptor instead.
+func (*State) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *State) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *State) GetBeds() []*Bed {
+	if x != nil {
+		return x.Beds
+	}
+	return nil
+}
+
+// Bed is the latest state of a bed.
+type Bed struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Account the bed belongs to, set when several accounts are polled.
+	Account string `protobuf:"bytes,2,opt,name=account,proto3" json:"account,omitempty"`
+	// Time the bed last reported.
+	Time  *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	Left  *BedSide               `protobuf:"bytes,4,opt,name=left,proto3" json:"left,omitempty"`
+	Right *BedSide               `protobuf:"bytes,5,opt,name=right,proto3" json:"right,omitempty"`
+	// Whether the foundation is moving, if the bed has one.
+	FoundationMoving bool `protobuf:"varint,6,opt,name=foundation_moving,json=foundationMoving,proto3" json:"foundation_moving,omitempty"`
+}
+
+func (x *Bed) Reset() {
+	*x = Bed{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Bed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Bed) ProtoMessage() {}
+
+func (x *Bed) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Bed.ProtoReflect.Descriptor instead.
+func (*Bed) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Bed) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Bed) GetAccount() string {
+	if x != nil {
+		return x.Account
+	}
+	return ""
+}
+
+func (x *Bed) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Bed) GetLeft() *BedSide {
+	if x != nil {
+		return x.Left
+	}
+	return nil
+}
+
+func (x *Bed) GetRight() *BedSide {
+	if x != nil {
+		return x.Right
+	}
+	return nil
+}
+
+func (x *Bed) GetFoundationMoving() bool {
+	if x != nil {
+		return x.FoundationMoving
+	}
+	return false
+}
+
+// BedSide is the latest state of a side of a bed.
+type BedSide struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	InBed       bool  `protobuf:"varint,1,opt,name=in_bed,json=inBed,proto3" json:"in_bed,omitempty"`
+	SleepNumber int32 `protobuf:"varint,2,opt,name=sleep_number,json=sleepNumber,proto3" json:"sleep_number,omitempty"`
+	Pressure    int32 `protobuf:"varint,3,opt,name=pressure,proto3" json:"pressure,omitempty"`
+	// Foundation positions, if the bed has a foundation, from 0 for flat to
+	// 100.
+	HeadPosition int32 `protobuf:"varint,4,opt,name=head_position,json=headPosition,proto3" json:"head_position,omitempty"`
+	FootPosition int32 `protobuf:"varint,5,opt,name=foot_position,json=footPosition,proto3" json:"foot_position,omitempty"`
+}
+
+func (x *BedSide) Reset() {
+	*x = BedSide{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BedSide) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BedSide) ProtoMessage() {}
+
+func (x *BedSide) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BedSide.ProtoReflect.Descriptor instead.
+func (*BedSide) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BedSide) GetInBed() bool {
+	if x != nil {
+		return x.InBed
+	}
+	return false
+}
+
+func (x *BedSide) GetSleepNumber() int32 {
+	if x != nil {
+		return x.SleepNumber
+	}
+	return 0
+}
+
+func (x *BedSide) GetPressure() int32 {
+	if x != nil {
+		return x.Pressure
+	}
+	return 0
+}
+
+func (x *BedSide) GetHeadPosition() int32 {
+	if x != nil {
+		return x.HeadPosition
+	}
+	return 0
+}
+
+func (x *BedSide) GetFootPosition() int32 {
+	if x != nil {
+		return x.FootPosition
+	}
+	return 0
+}
+
+type SetSleepNumberRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name of the bed, ignoring case; it may be left out when there is only
+	// one.
+	Bed  string `protobuf:"bytes,1,opt,name=bed,proto3" json:"bed,omitempty"`
+	Side Side   `protobuf:"varint,2,opt,name=side,proto3,enum=sleepnumber.v1.Side" json:"side,omitempty"`
+	// Multiple of 5 from 5 to 100.
+	SleepNumber int32 `protobuf:"varint,3,opt,name=sleep_number,json=sleepNumber,proto3" json:"sleep_number,omitempty"`
+}
+
+func (x *SetSleepNumberRequest) Reset() {
+	*x = SetSleepNumberRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetSleepNumberRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetSleepNumberRequest) ProtoMessage() {}
+
+func (x *SetSleepNumberRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetSleepNumberRequest.ProtoReflect.Descriptor instead.
+func (*SetSleepNumberRequest) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SetSleepNumberRequest) GetBed() string {
+	if x != nil {
+		return x.Bed
+	}
+	return ""
+}
+
+func (x *SetSleepNumberRequest) GetSide() Side {
+	if x != nil {
+		return x.Side
+	}
+	return Side_SIDE_UNSPECIFIED
+}
+
+func (x *SetSleepNumberRequest) GetSleepNumber() int32 {
+	if x != nil {
+		return x.SleepNumber
+	}
+	return 0
+}
+
+type SetSleepNumberResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *SetSleepNumberResponse) Reset() {
+	*x = SetSleepNumberResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetSleepNumberResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetSleepNumberResponse) ProtoMessage() {}
+
+func (x *SetSleepNumberResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetSleepNumberResponse.ProtoReflect.Descriptor instead.
+func (*SetSleepNumberResponse) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{6}
+}
+
+type RecallPresetRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name of the bed, ignoring case; it may be left out when there is only
+	// one.
+	Bed    string `protobuf:"bytes,1,opt,name=bed,proto3" json:"bed,omitempty"`
+	Side   Side   `protobuf:"varint,2,opt,name=side,proto3,enum=sleepnumber.v1.Side" json:"side,omitempty"`
+	Preset Preset `protobuf:"varint,3,opt,name=preset,proto3,enum=sleepnumber.v1.Preset" json:"preset,omitempty"`
+}
+
+func (x *RecallPresetRequest) Reset() {
+	*x = RecallPresetRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RecallPresetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecallPresetRequest) ProtoMessage() {}
+
+func (x *RecallPresetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecallPresetRequest.ProtoReflect.Descriptor instead.
+func (*RecallPresetRequest) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *RecallPresetRequest) GetBed() string {
+	if x != nil {
+		return x.Bed
+	}
+	return ""
+}
+
+func (x *RecallPresetRequest) GetSide() Side {
+	if x != nil {
+		return x.Side
+	}
+	return Side_SIDE_UNSPECIFIED
+}
+
+func (x *RecallPresetRequest) GetPreset() Preset {
+	if x != nil {
+		return x.Preset
+	}
+	return Preset_PRESET_UNSPECIFIED
+}
+
+type RecallPresetResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *RecallPresetResponse) Reset() {
+	*x = RecallPresetResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RecallPresetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecallPresetResponse) ProtoMessage() {}
+
+func (x *RecallPresetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecallPresetResponse.ProtoReflect.Descriptor instead.
+func (*RecallPresetResponse) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{8}
+}
+
+type StopMotionRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name of the bed, ignoring case; every bed is stopped if it is left out.
+	Bed string `protobuf:"bytes,1,opt,name=bed,proto3" json:"bed,omitempty"`
+}
+
+func (x *StopMotionRequest) Reset() {
+	*x = StopMotionRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StopMotionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopMotionRequest) ProtoMessage() {}
+
+func (x *StopMotionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopMotionRequest.ProtoReflect.Descriptor instead.
+func (*StopMotionRequest) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StopMotionRequest) GetBed() string {
+	if x != nil {
+		return x.Bed
+	}
+	return ""
+}
+
+type StopMotionResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *StopMotionResponse) Reset() {
+	*x = StopMotionResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sleepnumber_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StopMotionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopMotionResponse) ProtoMessage() {}
+
+func (x *StopMotionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sleepnumber_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopMotionResponse.ProtoReflect.Descriptor instead.
+func (*StopMotionResponse) Descriptor() ([]byte, []int) {
+	return file_sleepnumber_proto_rawDescGZIP(), []int{10}
+}
+
+var File_sleepnumber_proto protoreflect.FileDescriptor
+
+var file_sleepnumber_proto_rawDesc = []byte{
+	0x0a, 0x11, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x12, 0x0e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x22, 0x11, 0x0a, 0x0f, 0x47, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x13, 0x0a, 0x11, 0x57, 0x61, 0x74, 0x63, 0x68,
+	0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x60, 0x0a, 0x05,
+	0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52,
+	0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x27, 0x0a, 0x04, 0x62, 0x65, 0x64, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65,
+	0x72, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x65, 0x64, 0x52, 0x04, 0x62, 0x65, 0x64, 0x73, 0x22, 0xec,
+	0x01, 0x0a, 0x03, 0x42, 0x65, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x63,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x63, 0x63,
+	0x6f, 0x75, 0x6e, 0x74, 0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04,
+	0x74, 0x69, 0x6d, 0x65, 0x12, 0x2b, 0x0a, 0x04, 0x6c, 0x65, 0x66, 0x74, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x17, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x2e, 0x42, 0x65, 0x64, 0x53, 0x69, 0x64, 0x65, 0x52, 0x04, 0x6c, 0x65, 0x66,
+	0x74, 0x12, 0x2d, 0x0a, 0x05, 0x72, 0x69, 0x67, 0x68, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x17, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76,
+	0x31, 0x2e, 0x42, 0x65, 0x64, 0x53, 0x69, 0x64, 0x65, 0x52, 0x05, 0x72, 0x69, 0x67, 0x68, 0x74,
+	0x12, 0x2b, 0x0a, 0x11, 0x66, 0x6f, 0x75, 0x6e, 0x64, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6d,
+	0x6f, 0x76, 0x69, 0x6e, 0x67, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x10, 0x66, 0x6f, 0x75,
+	0x6e, 0x64, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x6f, 0x76, 0x69, 0x6e, 0x67, 0x22, 0xa9, 0x01,
+	0x0a, 0x07, 0x42, 0x65, 0x64, 0x53, 0x69, 0x64, 0x65, 0x12, 0x15, 0x0a, 0x06, 0x69, 0x6e, 0x5f,
+	0x62, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x69, 0x6e, 0x42, 0x65, 0x64,
+	0x12, 0x21, 0x0a, 0x0c, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x4e, 0x75, 0x6d,
+	0x62, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x65, 0x73, 0x73, 0x75, 0x72, 0x65, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x70, 0x72, 0x65, 0x73, 0x73, 0x75, 0x72, 0x65, 0x12,
+	0x23, 0x0a, 0x0d, 0x68, 0x65, 0x61, 0x64, 0x5f, 0x70, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x68, 0x65, 0x61, 0x64, 0x50, 0x6f, 0x73, 0x69,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x23, 0x0a, 0x0d, 0x66, 0x6f, 0x6f, 0x74, 0x5f, 0x70, 0x6f, 0x73,
+	0x69, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x66, 0x6f, 0x6f,
+	0x74, 0x50, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x76, 0x0a, 0x15, 0x53, 0x65, 0x74,
+	0x53, 0x6c, 0x65, 0x65, 0x70, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x62, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x62, 0x65, 0x64, 0x12, 0x28, 0x0a, 0x04, 0x73, 0x69, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x14, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x2e, 0x53, 0x69, 0x64, 0x65, 0x52, 0x04, 0x73, 0x69, 0x64, 0x65, 0x12, 0x21,
+	0x0a, 0x0c, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x0b, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x4e, 0x75, 0x6d, 0x62, 0x65,
+	0x72, 0x22, 0x18, 0x0a, 0x16, 0x53, 0x65, 0x74, 0x53, 0x6c, 0x65, 0x65, 0x70, 0x4e, 0x75, 0x6d,
+	0x62, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x81, 0x01, 0x0a, 0x13,
+	0x52, 0x65, 0x63, 0x61, 0x6c, 0x6c, 0x50, 0x72, 0x65, 0x73, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x62, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x62, 0x65, 0x64, 0x12, 0x28, 0x0a, 0x04, 0x73, 0x69, 0x64, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x14, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65,
+	0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x69, 0x64, 0x65, 0x52, 0x04, 0x73, 0x69, 0x64, 0x65, 0x12,
+	0x2e, 0x0a, 0x06, 0x70, 0x72, 0x65, 0x73, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x16, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76, 0x31,
+	0x2e, 0x50, 0x72, 0x65, 0x73, 0x65, 0x74, 0x52, 0x06, 0x70, 0x72, 0x65, 0x73, 0x65, 0x74, 0x22,
+	0x16, 0x0a, 0x14, 0x52, 0x65, 0x63, 0x61, 0x6c, 0x6c, 0x50, 0x72, 0x65, 0x73, 0x65, 0x74, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x25, 0x0a, 0x11, 0x53, 0x74, 0x6f, 0x70, 0x4d,
+	0x6f, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x10, 0x0a, 0x03,
+	0x62, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x62, 0x65, 0x64, 0x22, 0x14,
+	0x0a, 0x12, 0x53, 0x74, 0x6f, 0x70, 0x4d, 0x6f, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x2a, 0x3b, 0x0a, 0x04, 0x53, 0x69, 0x64, 0x65, 0x12, 0x14, 0x0a, 0x10,
+	0x53, 0x49, 0x44, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44,
+	0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x53, 0x49, 0x44, 0x45, 0x5f, 0x4c, 0x45, 0x46, 0x54, 0x10,
+	0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x53, 0x49, 0x44, 0x45, 0x5f, 0x52, 0x49, 0x47, 0x48, 0x54, 0x10,
+	0x02, 0x2a, 0x91, 0x01, 0x0a, 0x06, 0x50, 0x72, 0x65, 0x73, 0x65, 0x74, 0x12, 0x16, 0x0a, 0x12,
+	0x50, 0x52, 0x45, 0x53, 0x45, 0x54, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49,
+	0x45, 0x44, 0x10, 0x00, 0x12, 0x13, 0x0a, 0x0f, 0x50, 0x52, 0x45, 0x53, 0x45, 0x54, 0x5f, 0x46,
+	0x41, 0x56, 0x4f, 0x52, 0x49, 0x54, 0x45, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b, 0x50, 0x52, 0x45,
+	0x53, 0x45, 0x54, 0x5f, 0x52, 0x45, 0x41, 0x44, 0x10, 0x02, 0x12, 0x13, 0x0a, 0x0f, 0x50, 0x52,
+	0x45, 0x53, 0x45, 0x54, 0x5f, 0x57, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x54, 0x56, 0x10, 0x03, 0x12,
+	0x0f, 0x0a, 0x0b, 0x50, 0x52, 0x45, 0x53, 0x45, 0x54, 0x5f, 0x46, 0x4c, 0x41, 0x54, 0x10, 0x04,
+	0x12, 0x11, 0x0a, 0x0d, 0x50, 0x52, 0x45, 0x53, 0x45, 0x54, 0x5f, 0x5a, 0x45, 0x52, 0x4f, 0x5f,
+	0x47, 0x10, 0x05, 0x12, 0x10, 0x0a, 0x0c, 0x50, 0x52, 0x45, 0x53, 0x45, 0x54, 0x5f, 0x53, 0x4e,
+	0x4f, 0x52, 0x45, 0x10, 0x06, 0x32, 0xac, 0x03, 0x0a, 0x0b, 0x53, 0x6c, 0x65, 0x65, 0x70, 0x4e,
+	0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x42, 0x0a, 0x08, 0x47, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x12, 0x1f, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e,
+	0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x15, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x48, 0x0a, 0x0a, 0x57, 0x61, 0x74,
+	0x63, 0x68, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x21, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e,
+	0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x73, 0x6c, 0x65,
+	0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x30, 0x01, 0x12, 0x5f, 0x0a, 0x0e, 0x53, 0x65, 0x74, 0x53, 0x6c, 0x65, 0x65, 0x70, 0x4e,
+	0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x25, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d,
+	0x62, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x74, 0x53, 0x6c, 0x65, 0x65, 0x70, 0x4e,
+	0x75, 0x6d, 0x62, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x73,
+	0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65,
+	0x74, 0x53, 0x6c, 0x65, 0x65, 0x70, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x59, 0x0a, 0x0c, 0x52, 0x65, 0x63, 0x61, 0x6c, 0x6c, 0x50, 0x72,
+	0x65, 0x73, 0x65, 0x74, 0x12, 0x23, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62,
+	0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x61, 0x6c, 0x6c, 0x50, 0x72, 0x65, 0x73,
+	0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x73, 0x6c, 0x65, 0x65,
+	0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x61, 0x6c,
+	0x6c, 0x50, 0x72, 0x65, 0x73, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x53, 0x0a, 0x0a, 0x53, 0x74, 0x6f, 0x70, 0x4d, 0x6f, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x2e,
+	0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53,
+	0x74, 0x6f, 0x70, 0x4d, 0x6f, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x22, 0x2e, 0x73, 0x6c, 0x65, 0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2e, 0x76,
+	0x31, 0x2e, 0x53, 0x74, 0x6f, 0x70, 0x4d, 0x6f, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x42, 0x44, 0x5a, 0x42, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2f, 0x69, 0x77, 0x76, 0x65, 0x6c, 0x61, 0x6e, 0x64, 0x6f, 0x2f, 0x73, 0x6c, 0x65,
+	0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x2d, 0x73, 0x74, 0x61, 0x74, 0x73, 0x2d, 0x63,
+	0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x73, 0x6c, 0x65,
+	0x65, 0x70, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_sleepnumber_proto_rawDescOnce sync.Once
+	file_sleepnumber_proto_rawDescData = file_sleepnumber_proto_rawDesc
+)
+
+func file_sleepnumber_proto_rawDescGZIP() []byte {
+	file_sleepnumber_proto_rawDescOnce.Do(func() {
+		file_sleepnumber_proto_rawDescData = protoimpl.X.CompressGZIP(file_sleepnumber_proto_rawDescData)
+	})
+	return file_sleepnumber_proto_rawDescData
+}
+
+var file_sleepnumber_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_sleepnumber_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_sleepnumber_proto_goTypes = []any{
+	(Side)(0),                      // 0: sleepnumber.v1.Side
+	(Preset)(0),                    // 1: sleepnumber.v1.Preset
+	(*GetStateRequest)(nil),        // 2: sleepnumber.v1.GetStateRequest
+	(*WatchStateRequest)(nil),      // 3: sleepnumber.v1.WatchStateRequest
+	(*State)(nil),                  // 4: sleepnumber.v1.State
+	(*Bed)(nil),                    // 5: sleepnumber.v1.Bed
+	(*BedSide)(nil),                // 6: sleepnumber.v1.BedSide
+	(*SetSleepNumberRequest)(nil),  // 7: sleepnumber.v1.SetSleepNumberRequest
+	(*SetSleepNumberResponse)(nil), // 8: sleepnumber.v1.SetSleepNumberResponse
+	(*RecallPresetRequest)(nil),    // 9: sleepnumber.v1.RecallPresetRequest
+	(*RecallPresetResponse)(nil),   // 10: sleepnumber.v1.RecallPresetResponse
+	(*StopMotionRequest)(nil),      // 11: sleepnumber.v1.StopMotionRequest
+	(*StopMotionResponse)(nil),     // 12: sleepnumber.v1.StopMotionResponse
+	(*timestamppb.Timestamp)(nil),  // 13: google.protobuf.Timestamp
+}
+var file_sleepnumber_proto_depIdxs = []int32{
+	13, // 0: sleepnumber.v1.State.time:type_name -> google.protobuf.Timestamp
+	5,  // 1: sleepnumber.v1.State.beds:type_name -> sleepnumber.v1.Bed
+	13, // 2: sleepnumber.v1.Bed.time:type_name -> google.protobuf.Timestamp
+	6,  // 3: sleepnumber.v1.Bed.left:type_name -> sleepnumber.v1.BedSide
+	6,  // 4: sleepnumber.v1.Bed.right:type_name -> sleepnumber.v1.BedSide
+	0,  // 5: sleepnumber.v1.SetSleepNumberRequest.side:type_name -> sleepnumber.v1.Side
+	0,  // 6: sleepnumber.v1.RecallPresetRequest.side:type_name -> sleepnumber.v1.Side
+	1,  // 7: sleepnumber.v1.RecallPresetRequest.preset:type_name -> sleepnumber.v1.Preset
+	2,  // 8: sleepnumber.v1.SleepNumber.GetState:input_type -> sleepnumber.v1.GetStateRequest
+	3,  // 9: sleepnumber.v1.SleepNumber.WatchState:input_type -> sleepnumber.v1.WatchStateRequest
+	7,  // 10: sleepnumber.v1.SleepNumber.SetSleepNumber:input_type -> sleepnumber.v1.SetSleepNumberRequest
+	9,  // 11: sleepnumber.v1.SleepNumber.RecallPreset:input_type -> sleepnumber.v1.RecallPresetRequest
+	11, // 12: sleepnumber.v1.SleepNumber.StopMotion:input_type -> sleepnumber.v1.StopMotionRequest
+	4,  // 13: sleepnumber.v1.SleepNumber.GetState:output_type -> sleepnumber.v1.State
+	4,  // 14: sleepnumber.v1.SleepNumber.WatchState:output_type -> sleepnumber.v1.State
+	8,  // 15: sleepnumber.v1.SleepNumber.SetSleepNumber:output_type -> sleepnumber.v1.SetSleepNumberResponse
+	10, // 16: sleepnumber.v1.SleepNumber.RecallPreset:output_type -> sleepnumber.v1.RecallPresetResponse
+	12, // 17: sleepnumber.v1.SleepNumber.StopMotion:output_type -> sleepnumber.v1.StopMotionResponse
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_sleepnumber_proto_init() }
+func file_sleepnumber_proto_init() {
+	if File_sleepnumber_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_sleepnumber_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*GetStateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[1].Exporter = func(v any, i int) any {
+			switch v := v.(*WatchStateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*State); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[3].Exporter = func(v any, i int) any {
+			switch v := v.(*Bed); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[4].Exporter = func(v any, i int) any {
+			switch v := v.(*BedSide); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[5].Exporter = func(v any, i int) any {
+			switch v := v.(*SetSleepNumberRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[6].Exporter = func(v any, i int) any {
+			switch v := v.(*SetSleepNumberResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[7].Exporter = func(v any, i int) any {
+			switch v := v.(*RecallPresetRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[8].Exporter = func(v any, i int) any {
+			switch v := v.(*RecallPresetResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[9].Exporter = func(v any, i int) any {
+			switch v := v.(*StopMotionRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sleepnumber_proto_msgTypes[10].Exporter = func(v any, i int) any {
+			switch v := v.(*StopMotionResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_sleepnumber_proto_rawDesc,
+			NumEnums:      2,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sleepnumber_proto_goTypes,
+		DependencyIndexes: file_sleepnumber_proto_depIdxs,
+		EnumInfos:         file_sleepnumber_proto_enumTypes,
+		MessageInfos:      file_sleepnumber_proto_msgTypes,
+	}.Build()
+	File_sleepnumber_proto = out.File
+	file_sleepnumber_proto_rawDesc = nil
+	file_sleepnumber_proto_goTypes = nil
+	file_sleepnumber_proto_depIdxs = nil
+}
@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.1
+// source: sleepnumber.proto
+
+package sleepnumberpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SleepNumber_GetState_FullMethodName       = "/sleepnumber.v1.SleepNumber/GetState"
+	SleepNumber_WatchState_FullMethodName     = "/sleepnumber.v1.SleepNumber/WatchState"
+	SleepNumber_SetSleepNumber_FullMethodName = "/sleepnumber.v1.SleepNumber/SetSleepNumber"
+	SleepNumber_RecallPreset_FullMethodName   = "/sleepnumber.v1.SleepNumber/RecallPreset"
+	SleepNumber_StopMotion_FullMethodName     = "/sleepnumber.v1.SleepNumber/StopMotion"
+)
+
+// SleepNumberClient is the client API for SleepNumber service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SleepNumber serves the current state of the beds as the collector last
+// polled them, and controls them through SleepIQ.
+type SleepNumberClient interface {
+	// GetState returns the current state of every bed polled so far.
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error)
+	// WatchState sends the current state, then the state again every time a
+	// bed reports, until the call is cancelled or the collector stops.
+	WatchState(ctx context.Context, in *WatchStateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[State], error)
+	// SetSleepNumber sets the sleep number of one side of a bed.
+	SetSleepNumber(ctx context.Context, in *SetSleepNumberRequest, opts ...grpc.CallOption) (*SetSleepNumberResponse, error)
+	// RecallPreset moves one side of a bed's foundation to a preset.
+	RecallPreset(ctx context.Context, in *RecallPresetRequest, opts ...grpc.CallOption) (*RecallPresetResponse, error)
+	// StopMotion halts foundation motion on both sides of a bed, or of every
+	// bed.
+	StopMotion(ctx context.Context, in *StopMotionRequest, opts ...grpc.CallOption) (*StopMotionResponse, error)
+}
+
+type sleepNumberClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSleepNumberClient(cc grpc.ClientConnInterface) SleepNumberClient {
+	return &sleepNumberClient{cc}
+}
+
+func (c *sleepNumberClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(State)
+	err := c.cc.Invoke(ctx, SleepNumber_GetState_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sleepNumberClient) WatchState(ctx context.Context, in *WatchStateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[State], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SleepNumber_ServiceDesc.Streams[0], SleepNumber_WatchState_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchStateRequest, State]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SleepNumber_WatchStateClient = grpc.ServerStreamingClient[State]
+
+func (c *sleepNumberClient) SetSleepNumber(ctx context.Context, in *SetSleepNumberRequest, opts ...grpc.CallOption) (*SetSleepNumberResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetSleepNumberResponse)
+	err := c.cc.Invoke(ctx, SleepNumber_SetSleepNumber_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sleepNumberClient) RecallPreset(ctx context.Context, in *RecallPresetRequest, opts ...grpc.CallOption) (*RecallPresetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RecallPresetResponse)
+	err := c.cc.Invoke(ctx, SleepNumber_RecallPreset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sleepNumberClient) StopMotion(ctx context.Context, in *StopMotionRequest, opts ...grpc.CallOption) (*StopMotionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StopMotionResponse)
+	err := c.cc.Invoke(ctx, SleepNumber_StopMotion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SleepNumberServer is the server API for SleepNumber service.
+// All implementations must embed UnimplementedSleepNumberServer
+// for forward compatibility.
+//
+// SleepNumber serves the current state of the beds as the collector last
+// polled them, and controls them through SleepIQ.
+type SleepNumberServer interface {
+	// GetState returns the current state of every bed polled so far.
+	GetState(context.Context, *GetStateRequest) (*State, error)
+	// WatchState sends the current state, then the state again every time a
+	// bed reports, until the call is cancelled or the collector stops.
+	WatchState(*WatchStateRequest, grpc.ServerStreamingServer[State]) error
+	// SetSleepNumber sets the sleep number of one side of a bed.
+	SetSleepNumber(context.Context, *SetSleepNumberRequest) (*SetSleepNumberResponse, error)
+	// RecallPreset moves one side of a bed's foundation to a preset.
+	RecallPreset(context.Context, *RecallPresetRequest) (*RecallPresetResponse, error)
+	// StopMotion halts foundation motion on both sides of a bed, or of every
+	// bed.
+	StopMotion(context.Context, *StopMotionRequest) (*StopMotionResponse, error)
+	mustEmbedUnimplementedSleepNumberServer()
+}
+
+// UnimplementedSleepNumberServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSleepNumberServer struct{}
+
+func (UnimplementedSleepNumberServer) GetState(context.Context, *GetStateRequest) (*State, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedSleepNumberServer) WatchState(*WatchStateRequest, grpc.ServerStreamingServer[State]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchState not implemented")
+}
+func (UnimplementedSleepNumberServer) SetSleepNumber(context.Context, *SetSleepNumberRequest) (*SetSleepNumberResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetSleepNumber not implemented")
+}
+func (UnimplementedSleepNumberServer) RecallPreset(context.Context, *RecallPresetRequest) (*RecallPresetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecallPreset not implemented")
+}
+func (UnimplementedSleepNumberServer) StopMotion(context.Context, *StopMotionRequest) (*StopMotionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopMotion not implemented")
+}
+func (UnimplementedSleepNumberServer) mustEmbedUnimplementedSleepNumberServer() {}
+func (UnimplementedSleepNumberServer) testEmbeddedByValue()                     {}
+
+// UnsafeSleepNumberServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SleepNumberServer will
+// result in compilation errors.
+type UnsafeSleepNumberServer interface {
+	mustEmbedUnimplementedSleepNumberServer()
+}
+
+func RegisterSleepNumberServer(s grpc.ServiceRegistrar, srv SleepNumberServer) {
+	// If the following call pancis, it indicates UnimplementedSleepNumberServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SleepNumber_ServiceDesc, srv)
+}
+
+func _SleepNumber_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SleepNumberServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SleepNumber_GetState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SleepNumberServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SleepNumber_WatchState_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SleepNumberServer).WatchState(m, &grpc.GenericServerStream[WatchStateRequest, State]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SleepNumber_WatchStateServer = grpc.ServerStreamingServer[State]
+
+func _SleepNumber_SetSleepNumber_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetSleepNumberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SleepNumberServer).SetSleepNumber(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SleepNumber_SetSleepNumber_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SleepNumberServer).SetSleepNumber(ctx, req.(*SetSleepNumberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SleepNumber_RecallPreset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecallPresetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SleepNumberServer).RecallPreset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SleepNumber_RecallPreset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SleepNumberServer).RecallPreset(ctx, req.(*RecallPresetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SleepNumber_StopMotion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopMotionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SleepNumberServer).StopMotion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SleepNumber_StopMotion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SleepNumberServer).StopMotion(ctx, req.(*StopMotionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SleepNumber_ServiceDesc is the grpc.ServiceDesc for SleepNumber service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SleepNumber_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sleepnumber.v1.SleepNumber",
+	HandlerType: (*SleepNumberServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetState",
+			Handler:    _SleepNumber_GetState_Handler,
+		},
+		{
+			MethodName: "SetSleepNumber",
+			Handler:    _SleepNumber_SetSleepNumber_Handler,
+		},
+		{
+			MethodName: "RecallPreset",
+			Handler:    _SleepNumber_RecallPreset_Handler,
+		},
+		{
+			MethodName: "StopMotion",
+			Handler:    _SleepNumber_StopMotion_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchState",
+			Handler:       _SleepNumber_WatchState_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sleepnumber.proto",
+}